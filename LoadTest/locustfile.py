@@ -1,17 +1,39 @@
-from locust import HttpUser, task, between
+from locust import HttpUser, task, between, events
+import json
+import os
 import random
 
+# IDs of existing products, from the manifest written by
+# `marketctl seed` (see `make seed`).
+MANIFEST = os.environ.get("SEED_MANIFEST", os.path.join(os.path.dirname(__file__), "seed-manifest.json"))
+product_ids = []
+
+@events.init.add_listener
+def load_manifest(environment, **kwargs):
+    try:
+        with open(MANIFEST) as f:
+            product_ids.extend(p["id"] for p in json.load(f)["products"])
+    except FileNotFoundError:
+        print(f"{MANIFEST} not found; run make seed to load test existing products")
+
 class APIUser(HttpUser):
     wait_time = between(1, 3)
 
+    def on_start(self):
+        # Without a manifest, fall back to the products the server has.
+        if not product_ids:
+            product_ids.extend(p["id"] for p in self.client.get("/products").json())
+
     @task(3)
     def get_products(self):
         self.client.get("/products")
 
     @task(2)
     def get_product(self):
-        id = random.randint(1, 100)
-        self.client.get(f"/products/{id}")
+        if not product_ids:
+            return
+        id = random.choice(product_ids)
+        self.client.get(f"/products/{id}", name="/products/{id}")
 
     @task(1)
     def create_product(self):
@@ -25,4 +47,3 @@ class APIUser(HttpUser):
     @task(1)
     def health_check(self):
         self.client.get("/health")
-
@@ -0,0 +1,204 @@
+// Command loadgen load tests the product API. It replays a weighted mix of
+// list, get, create, patch and delete requests at a fixed rate against a
+// running server, or against the API in the same process on a temporary
+// database, and reports latency percentiles, throughput and errors.
+//
+//	loadgen -target http://localhost:8080 -manifest LoadTest/seed-manifest.json -rate 200 -duration 1m
+//	loadgen -in-process -rate 500 -duration 10s -max-p99 50ms -max-error-rate 0.01
+//
+// The exit status is 1 if a -max threshold is exceeded, so that the second
+// form can guard against performance regressions in CI.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/http/api"
+	"github.com/v-kuu/mini-marketplace/internal/loadgen"
+	"github.com/v-kuu/mini-marketplace/internal/repository/sqlite"
+	"github.com/v-kuu/mini-marketplace/internal/seed"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command line args and returns the exit status: 0 on
+// success, 1 if the test failed or missed a threshold and 2 for usage
+// errors.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	opts := loadgen.Options{Mix: loadgen.DefaultMix()}
+	target := fs.String("target", "", "Base URL of the API to test, such as http://localhost:8080")
+	inProcess := fs.Bool("in-process", false, "Test the API in this process on a temporary database instead of -target")
+	manifest := fs.String("manifest", "", "Seed manifest with the IDs of the products to request (default the products the target lists)")
+	seedCount := fs.Int("seed-count", 1000, "Products seeded into the temporary database with -in-process")
+	fs.Float64Var(&opts.Rate, "rate", 100, "Requests started per second")
+	fs.DurationVar(&opts.Duration, "duration", 30 * time.Second, "How long to send requests")
+	fs.StringVar(&opts.Arrival, "arrival", loadgen.ArrivalConstant, "Arrival process: constant or poisson")
+	fs.Func("mix", "Scenario weights (default "+opts.Mix.String()+")", func(s string) error {
+		m, err := loadgen.ParseMix(s)
+		opts.Mix = m
+		return err
+	})
+	fs.IntVar(&opts.MaxInFlight, "max-in-flight", 1000, "Most requests waiting for a response; requests due beyond it are dropped")
+	fs.DurationVar(&opts.Timeout, "timeout", 10 * time.Second, "Timeout of a single request")
+	fs.Uint64Var(&opts.Seed, "seed", 1, "Random seed of the scenario sequence")
+	output := fs.String("o", "text", "Output format: text or json")
+	maxP99 := fs.Duration("max-p99", 0, "Fail if the overall p99 latency is above this (0 disables)")
+	maxErrorRate := fs.Float64("max-error-rate", 1, "Fail if a larger share of requests fails or is dropped")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 || (*target == "") == !*inProcess || (*output != "text" && *output != "json") {
+		fmt.Fprintln(stderr, "loadgen: set either -target or -in-process, and -o text or json")
+		fs.Usage()
+		return 2
+	}
+
+	report, err := loadTest(ctx, opts, *target, *inProcess, *manifest, *seedCount, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "loadgen: %v\n", err)
+		return 1
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = report.Print(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "loadgen: %v\n", err)
+		return 1
+	}
+
+	code := 0
+	if *maxP99 > 0 && report.Latency.P99 > *maxP99 {
+		fmt.Fprintf(stderr, "loadgen: p99 latency %s is above %s\n", report.Latency.P99, *maxP99)
+		code = 1
+	}
+	if rate := report.ErrorRate(); rate > *maxErrorRate {
+		fmt.Fprintf(stderr, "loadgen: error rate %.2f%% is above %.2f%%\n", 100 * rate, 100 * *maxErrorRate)
+		code = 1
+	}
+	return code
+}
+
+// loadTest prepares the target and runs the test.
+func loadTest(ctx context.Context, opts loadgen.Options, target string, inProcess bool, manifest string, seedCount int, log io.Writer) (*loadgen.Report, error) {
+	if inProcess {
+		h, ids, cleanup, err := inProcessAPI(ctx, seedCount)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		opts.BaseURL, opts.Client, opts.IDs = "http://in-process", loadgen.HandlerClient(h), ids
+	} else {
+		opts.BaseURL = target
+		opts.Client = &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: opts.MaxInFlight}}
+		var err error
+		if manifest != "" {
+			opts.IDs, err = readManifest(manifest)
+		} else {
+			opts.IDs, err = listIDs(ctx, opts.Client, target)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.IDs) == 0 {
+		fmt.Fprintln(log, "loadgen: no products to request; get and patch requests are skipped until some are created")
+	}
+	return loadgen.Run(ctx, opts)
+}
+
+// inProcessAPI serves the product API on a temporary, seeded database.
+func inProcessAPI(ctx context.Context, seedCount int) (http.Handler, []string, func(), error) {
+	dir, err := os.MkdirTemp("", "loadgen")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cfg := config.Default()
+	cfg.DB_DSN = "file:" + filepath.Join(dir, "products.db")
+	db, err := sqlite.OpenDB(cfg.DB_DSN, cfg)
+	if err != nil {
+		return nil, nil, nil, errors.Join(err, os.RemoveAll(dir))
+	}
+	cleanup := func() {
+		db.Close() //nolint:all
+		os.RemoveAll(dir) //nolint:all
+	}
+	if err := sqlite.Migrate(ctx, db); err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+
+	repo := sqlite.NewProductRepository(db, cfg)
+	m, err := seed.Run(ctx, repo, seed.DefaultSpec(), seed.Options{Seed: 1, Count: seedCount, BatchSize: int(cfg.IMPORT_CHUNK_SIZE)})
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+	return api.AddRoutes(cfg, api.Dependencies{Products: service.NewProductService(repo)}), m.IDs(), cleanup, nil
+}
+
+func readManifest(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m seed.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m.IDs(), nil
+}
+
+// listIDs returns the IDs of the products the target has.
+func listIDs(ctx context.Context, c *http.Client, target string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target + "/products", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:all
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing products: %s", resp.Status)
+	}
+	var products []struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&products); err != nil {
+		return nil, fmt.Errorf("listing products: %w", err)
+	}
+	ids := make([]string, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	return ids, nil
+}
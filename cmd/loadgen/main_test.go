@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/api"
+	"github.com/v-kuu/mini-marketplace/internal/loadgen"
+	"github.com/v-kuu/mini-marketplace/internal/seed"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/internal/testdb"
+)
+
+func loadgenRun(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestLoadgen_InProcess(t *testing.T) {
+	code, stdout, stderr := loadgenRun("-in-process", "-seed-count", "20", "-rate", "200", "-duration", "200ms", "-o", "json", "-max-error-rate", "0")
+	if code != 0 {
+		t.Fatalf("Expected success, got %d: %s", code, stderr)
+	}
+	var report loadgen.Report
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Sent == 0 || report.Errors != 0 {
+		t.Fatalf("Expected successful requests, got %+v", report)
+	}
+
+	code, _, stderr = loadgenRun("-in-process", "-seed-count", "20", "-rate", "200", "-duration", "100ms", "-max-p99", "1ns")
+	if code != 1 || !strings.Contains(stderr, "p99 latency") {
+		t.Fatalf("Expected the p99 threshold to fail the run, got %d: %s", code, stderr)
+	}
+}
+
+func TestLoadgen_Target(t *testing.T) {
+	db := testdb.Open(t)
+	m, err := seed.Run(context.Background(), db.Products, seed.DefaultSpec(), seed.Options{Seed: 1, Count: 10, BatchSize: 10})
+	if err != nil {
+		t.Fatalf("Failed to seed db: %v", err)
+	}
+	manifest := filepath.Join(t.TempDir(), "manifest.json")
+	data, _ := json.Marshal(m)
+	if err := os.WriteFile(manifest, data, 0o600); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+	server := httptest.NewServer(api.AddRoutes(db.Config, api.Dependencies{Products: service.NewProductService(db.Products)}))
+	t.Cleanup(server.Close)
+
+	for _, source := range [][]string{{"-manifest", manifest}, nil} {
+		args := append([]string{"-target", server.URL, "-rate", "100", "-duration", "100ms", "-mix", "get=1", "-max-error-rate", "0"}, source...)
+		if code, stdout, stderr := loadgenRun(args...); code != 0 || !strings.Contains(stdout, "get") {
+			t.Fatalf("Expected gets of existing products with %v, got %d: %s%s", source, code, stdout, stderr)
+		}
+	}
+}
+
+func TestLoadgen_Usage(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"-target", "http://localhost", "-in-process"},
+		{"-in-process", "-o", "yaml"},
+		{"-in-process", "-mix", "buy=1"},
+	} {
+		if code, _, _ := loadgenRun(args...); code != 2 {
+			t.Errorf("Expected a usage error for %v, got %d", args, code)
+		}
+	}
+}
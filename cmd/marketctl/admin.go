@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/v-kuu/mini-marketplace/internal/backup"
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/repository/sqlite"
+	"github.com/v-kuu/mini-marketplace/internal/seed"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/pkg/client"
+)
+
+// fileFormat registers the -format flag of imports and exports.
+func fileFormat(fs *flag.FlagSet) *string {
+	return fs.String("format", "", "File format, ndjson or csv (default from the file extension, else ndjson)")
+}
+
+// formatOf returns the format given with -format or implied by the file
+// name.
+func formatOf(flagValue, file string) client.FileFormat {
+	if flagValue != "" {
+		return client.FileFormat(flagValue)
+	}
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		return client.FormatCSV
+	}
+	return client.FormatNDJSON
+}
+
+func runImport(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, true)
+	format := fileFormat(fs)
+	upsert := fs.Bool("upsert", false, "Update products that already exist instead of failing their rows")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	file := fs.Arg(0)
+	in := e.stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close() //nolint:all
+		in = f
+	}
+
+	return s.with(ctx, func(ctx context.Context, b backend) error {
+		report, err := b.Import(ctx, in, formatOf(*format, file), service.ImportOptions{DryRun: s.dryRun, Upsert: *upsert})
+		if err != nil {
+			return err
+		}
+		if err := s.out.report(e.stdout, report); err != nil {
+			return err
+		}
+		if report.Failed > 0 {
+			return fmt.Errorf("%d of %d rows failed", report.Failed, report.Rows)
+		}
+		return nil
+	})
+}
+
+func runExport(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var t target
+	t.register(fs)
+	format := fileFormat(fs)
+	out := fs.String("out", "-", "File to write, - for standard output")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	w := e.stdout
+	var f *os.File
+	if *out != "-" {
+		var err error
+		if f, err = os.Create(*out); err != nil {
+			return err
+		}
+		w = f
+	}
+
+	s := session{target: t}
+	err := s.with(ctx, func(ctx context.Context, b backend) error {
+		return b.Export(ctx, w, formatOf(*format, *out))
+	})
+	if f != nil {
+		err = errors.Join(err, f.Close())
+	}
+	return err
+}
+
+func runMigrate(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, false)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.target.timeout)
+	defer cancel()
+	db, err := s.target.openDB(ctx, false)
+	if err != nil {
+		return err
+	}
+	if err := sqlite.Migrate(ctx, db); err != nil {
+		return errors.Join(err, db.Close())
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+	return s.out.message(e.stdout, "Migrated "+s.target.db, map[string]any{"migrated": s.target.db})
+}
+
+func runSeed(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, true)
+	opts := seed.Options{BatchSize: int(config.Default().IMPORT_CHUNK_SIZE)}
+	fs.IntVar(&opts.Count, "n", 100, "Number of products to generate")
+	fs.Uint64Var(&opts.Seed, "seed", 1, "Random seed; the same seed and spec always give the same products")
+	fs.IntVar(&opts.BatchSize, "batch", opts.BatchSize, "Products written per transaction")
+	specFile := fs.String("spec", "", "YAML or JSON file with the categories, names and prices to draw from (default a general store)")
+	manifest := fs.String("manifest", "seed-manifest.json", "File to write the IDs and products to, - for standard output")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	opts.DryRun = s.dryRun
+
+	spec := seed.DefaultSpec()
+	if *specFile != "" {
+		data, err := os.ReadFile(*specFile)
+		if err != nil {
+			return err
+		}
+		if spec, err = seed.ParseSpec(data); err != nil {
+			return fmt.Errorf("%s: %w", *specFile, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.target.timeout)
+	defer cancel()
+	db, err := s.target.openDB(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint:all
+
+	m, err := seed.Run(ctx, sqlite.NewProductRepository(db, config.Default()), spec, opts)
+	if err != nil {
+		return err
+	}
+
+	// The summary makes way for the manifest on standard output.
+	summary := e.stdout
+	if *manifest == "-" {
+		summary = e.stderr
+		if err := writeJSON(e.stdout, m); err != nil {
+			return err
+		}
+	} else if err := writeManifest(*manifest, m); err != nil {
+		return err
+	}
+
+	verb := "Seeded"
+	if s.dryRun {
+		dryRunNote(e, "nothing was changed")
+		verb = "Would seed"
+	}
+	err = s.out.message(summary,
+		fmt.Sprintf("%s %d products with seed %d: %d created, %d updated, %d skipped", verb, len(m.Products) + len(m.Skipped), m.Seed, m.Created, m.Updated, len(m.Skipped)),
+		map[string]any{"seed": m.Seed, "created": m.Created, "updated": m.Updated, "skipped": len(m.Skipped), "manifest": *manifest},
+	)
+	if err == nil && len(m.Skipped) > 0 {
+		err = fmt.Errorf("%d products were skipped, see %s", len(m.Skipped), *manifest)
+	}
+	return err
+}
+
+func writeManifest(path string, m *seed.Manifest) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	return errors.Join(writeJSON(f, m), f.Close())
+}
+
+func runVacuum(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, true)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.target.timeout)
+	defer cancel()
+	db, err := s.target.openDB(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint:all
+
+	size := func() (total, free int64, err error) {
+		var pages, freePages, pageSize int64
+		for pragma, dest := range map[string]*int64{"page_count": &pages, "freelist_count": &freePages, "page_size": &pageSize} {
+			if err := db.Writer.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(dest); err != nil {
+				return 0, 0, err
+			}
+		}
+		return pages * pageSize, freePages * pageSize, nil
+	}
+
+	before, free, err := size()
+	if err != nil {
+		return err
+	}
+	if s.dryRun {
+		dryRunNote(e, "nothing was changed")
+		return s.out.message(e.stdout,
+			fmt.Sprintf("%s is %s; vacuuming would reclaim at least %s", s.target.db, bytesString(before), bytesString(free)),
+			map[string]any{"bytes": before, "reclaimable_bytes": free},
+		)
+	}
+
+	// VACUUM rewrites the whole file and holds the write lock meanwhile, so
+	// it goes through the writer connection like every other write.
+	if _, err := db.Writer.ExecContext(ctx, "VACUUM"); err != nil {
+		return err
+	}
+	after, _, err := size()
+	if err != nil {
+		return err
+	}
+	return s.out.message(e.stdout,
+		fmt.Sprintf("Vacuumed %s from %s to %s", s.target.db, bytesString(before), bytesString(after)),
+		map[string]any{"bytes_before": before, "bytes_after": after},
+	)
+}
+
+func runBackup(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, false)
+	cfg := config.Default()
+	keep := int(cfg.BACKUP_RETENTION)
+	if v, err := strconv.Atoi(os.Getenv("BACKUP_RETENTION")); err == nil {
+		keep = v
+	}
+	dir := fs.String("dir", envOr("BACKUP_DIR", cfg.BACKUP_DIR), "Directory to write the backup to (env BACKUP_DIR)")
+	retention := fs.Int("retention", keep, "Newest backups to keep in -dir, 0 keeps all of them (env BACKUP_RETENTION)")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.target.timeout)
+	defer cancel()
+	db, err := s.target.openDB(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint:all
+
+	info, err := backup.NewManager(db, *dir, *retention).Create(ctx)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(*dir, info.Name)
+	return s.out.message(e.stdout,
+		fmt.Sprintf("Backed up %s to %s (%s)", s.target.db, path, bytesString(info.Size)),
+		map[string]any{"path": path, "bytes": info.Size, "created_at": info.CreatedAt},
+	)
+}
+
+func runRestore(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, true)
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if s.target.server != "" {
+		return errLocalOnly
+	}
+	path, err := sqlite.FilePath(s.target.db)
+	if err != nil {
+		return err
+	}
+	file := fs.Arg(0)
+
+	ctx, cancel := context.WithTimeout(ctx, s.target.timeout)
+	defer cancel()
+	if s.dryRun {
+		if err := sqlite.VerifyFile(ctx, file); err != nil {
+			return err
+		}
+		dryRunNote(e, "nothing was changed")
+		return s.out.message(e.stdout,
+			fmt.Sprintf("%s passed the integrity check and would replace %s", file, path),
+			map[string]any{"backup": file, "database": path},
+		)
+	}
+
+	previous, err := sqlite.Restore(ctx, file, path)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Restored %s from %s", path, file)
+	if previous != "" {
+		text += "; the replaced database was kept as " + previous
+	}
+	return s.out.message(e.stdout, text, map[string]any{"backup": file, "database": path, "previous": previous})
+}
+
+// envOr returns the environment variable key, or def if it is unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func bytesString(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n) / float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/repository/sqlite"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/pkg/client"
+)
+
+// backend is where a command reads and writes products: the database file
+// or the HTTP API of a running server. Both apply the same validation.
+type backend interface {
+	List(ctx context.Context) ([]model.Product, error)
+	Get(ctx context.Context, id string) (*model.Product, error)
+	Create(ctx context.Context, name string, price int64) (*model.Product, error)
+	// Update changes the fields that are not nil.
+	Update(ctx context.Context, id string, name *string, price *int64) (*model.Product, error)
+	Delete(ctx context.Context, id string) error
+	Import(ctx context.Context, r io.Reader, format client.FileFormat, opts service.ImportOptions) (*client.ImportReport, error)
+	Export(ctx context.Context, w io.Writer, format client.FileFormat) error
+	Close() error
+}
+
+// errLocalOnly is returned by the commands that only work locally when
+// -server is given.
+var errLocalOnly = errors.New("this command only works on the database, not through -server")
+
+// target holds the flags that select the backend.
+type target struct {
+	server string
+	db string
+	dbSet bool
+	timeout time.Duration
+}
+
+func (t *target) register(fs *flag.FlagSet) {
+	t.db = config.Default().DB_DSN
+	if dsn := os.Getenv("DB_DSN"); dsn != "" {
+		t.db = dsn
+	}
+	fs.StringVar(&t.server, "server", os.Getenv("MARKETCTL_SERVER"), "Base URL of the HTTP API to work through instead of the database, such as http://localhost:8080 (env MARKETCTL_SERVER)")
+	fs.Func("db", "SQLite data source name to work on directly (env DB_DSN, default "+t.db+")", func(s string) error {
+		t.db, t.dbSet = s, true
+		return nil
+	})
+	fs.DurationVar(&t.timeout, "timeout", time.Minute, "Give up after this long")
+}
+
+// open returns the selected backend.
+func (t *target) open(ctx context.Context) (backend, error) {
+	if t.server == "" {
+		db, err := t.openDB(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		return newLocalBackend(db), nil
+	}
+	if t.dbSet {
+		return nil, errors.New("-db and -server cannot be used together")
+	}
+	c, err := client.New(t.server, client.Options{UserAgent: "marketctl"})
+	if err != nil {
+		return nil, err
+	}
+	return remoteBackend{c}, nil
+}
+
+// openDB opens the database for the commands that only work locally. Unless
+// migrating, the schema has to exist already, so that a mistyped path does
+// not quietly create an empty database.
+func (t *target) openDB(ctx context.Context, requireSchema bool) (*sqlite.DB, error) {
+	if t.server != "" {
+		return nil, errLocalOnly
+	}
+
+	cfg := config.Default()
+	cfg.DB_DSN = t.db
+	db, err := sqlite.OpenDB(cfg.DB_DSN, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !requireSchema {
+		return db, nil
+	}
+
+	var n int
+	err = db.Reader.QueryRowContext(ctx, `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'products'`).Scan(&n)
+	if err == nil && n == 0 {
+		err = fmt.Errorf("%s has no products table; run marketctl migrate first", t.db)
+	}
+	if err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+	return db, nil
+}
+
+// localBackend works on the database through the product service, the way
+// the server does.
+type localBackend struct {
+	db *sqlite.DB
+	svc *service.ProductService
+	chunkSize int
+}
+
+func newLocalBackend(db *sqlite.DB) *localBackend {
+	cfg := config.Default()
+	return &localBackend{
+		db: db,
+		svc: service.NewProductService(sqlite.NewProductRepository(db, cfg)),
+		chunkSize: int(cfg.IMPORT_CHUNK_SIZE),
+	}
+}
+
+func (b *localBackend) List(ctx context.Context) ([]model.Product, error) {
+	return b.svc.ListProducts(ctx)
+}
+
+// checkProduct applies the rules the API enforces on product fields, so
+// that products written locally can be written back through the API.
+func checkProduct(name string, price int64) error {
+	violations := model.ValidateProduct(name, price)
+	if len(violations) == 0 {
+		return nil
+	}
+	problems := make([]string, len(violations))
+	for i, v := range violations {
+		problems[i] = v.Field + " " + v.Message
+	}
+	return fmt.Errorf("%w: %s", service.ErrInvalidProduct, strings.Join(problems, "; "))
+}
+
+func (b *localBackend) Get(ctx context.Context, id string) (*model.Product, error) {
+	p, err := b.svc.GetProduct(ctx, id)
+	if err == nil && p == nil {
+		return nil, service.ErrProductNotFound
+	}
+	return p, err
+}
+
+func (b *localBackend) Create(ctx context.Context, name string, price int64) (*model.Product, error) {
+	if err := checkProduct(name, price); err != nil {
+		return nil, err
+	}
+	id, err := b.svc.CreateProduct(ctx, name, price)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Product{ID: id, Name: name, Price: price}, nil
+}
+
+func (b *localBackend) Update(ctx context.Context, id string, name *string, price *int64) (*model.Product, error) {
+	return b.svc.ModifyProduct(ctx, id, func(p model.Product) (model.Product, error) {
+		if name != nil {
+			p.Name = *name
+		}
+		if price != nil {
+			p.Price = *price
+		}
+		return p, checkProduct(p.Name, p.Price)
+	})
+}
+
+func (b *localBackend) Delete(ctx context.Context, id string) error {
+	return b.svc.DeleteProduct(ctx, id)
+}
+
+func (b *localBackend) Close() error {
+	return b.db.Close()
+}
+
+// remoteBackend works through the HTTP API.
+type remoteBackend struct {
+	c *client.Client
+}
+
+func fromClient(p *client.Product) *model.Product {
+	return &model.Product{ID: p.ID, Name: p.Name, Price: p.Price}
+}
+
+func (b remoteBackend) List(ctx context.Context) ([]model.Product, error) {
+	products, err := b.c.ListProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]model.Product, len(products))
+	for i := range products {
+		out[i] = *fromClient(&products[i])
+	}
+	return out, nil
+}
+
+func (b remoteBackend) Get(ctx context.Context, id string) (*model.Product, error) {
+	p, err := b.c.GetProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return fromClient(p), nil
+}
+
+func (b remoteBackend) Create(ctx context.Context, name string, price int64) (*model.Product, error) {
+	p, err := b.c.CreateProduct(ctx, name, price)
+	if err != nil {
+		return nil, err
+	}
+	return fromClient(p), nil
+}
+
+func (b remoteBackend) Update(ctx context.Context, id string, name *string, price *int64) (*model.Product, error) {
+	p, err := b.c.PatchProduct(ctx, id, client.ProductPatch{Name: name, Price: price})
+	if err != nil {
+		return nil, err
+	}
+	return fromClient(p), nil
+}
+
+func (b remoteBackend) Delete(ctx context.Context, id string) error {
+	return b.c.DeleteProduct(ctx, id)
+}
+
+func (b remoteBackend) Import(ctx context.Context, r io.Reader, format client.FileFormat, opts service.ImportOptions) (*client.ImportReport, error) {
+	return b.c.ImportProducts(ctx, r, client.ImportOptions{Format: format, DryRun: opts.DryRun, Upsert: opts.Upsert})
+}
+
+func (b remoteBackend) Export(ctx context.Context, w io.Writer, format client.FileFormat) error {
+	r, err := b.c.ExportProducts(ctx, format)
+	if err != nil {
+		return err
+	}
+	defer r.Close() //nolint:all
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (b remoteBackend) Close() error {
+	return nil
+}
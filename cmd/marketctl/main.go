@@ -0,0 +1,145 @@
+// Command marketctl administers the product catalog. It works directly on
+// the database file through the repository layer, or remotely through the
+// HTTP API of a running server when -server is given.
+//
+//	marketctl products list -o json
+//	marketctl products create -name Coffee -price 499 -dry-run
+//	marketctl -h
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// errUsage is returned for invalid command lines; its message has already
+// been printed.
+var errUsage = errors.New("usage error")
+
+// env is what a command runs with.
+type env struct {
+	stdin io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	name string
+	args string
+	summary string
+	// run parses args with fs, which already prints the usage of the
+	// command, and runs it.
+	run func(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"products list", "", "List every product", runList},
+	{"products get", "<id>", "Show one product", runGet},
+	{"products create", "-name <name> -price <cents>", "Create a product", runCreate},
+	{"products update", "[-name <name>] [-price <cents>] <id>", "Change the name or price of a product", runUpdate},
+	{"products delete", "<id>", "Delete a product", runDelete},
+	{"import", "[-format ndjson|csv] [-upsert] <file|->", "Import products from CSV or NDJSON", runImport},
+	{"export", "[-format ndjson|csv] [-out <file>]", "Export every product as CSV or NDJSON", runExport},
+	{"migrate", "", "Create missing tables and indexes (local only)", runMigrate},
+	{"seed", "[-n <count>] [-seed <seed>] [-spec <file>] [-manifest <file>]", "Generate sample products and write an ID manifest (local only)", runSeed},
+	{"vacuum", "", "Rebuild the database file to reclaim space (local only)", runVacuum},
+	{"backup", "[-dir <dir>] [-retention <n>]", "Write a consistent snapshot of the database while it is in use (local only)", runBackup},
+	{"restore", "<backup>", "Replace the stopped database with a verified backup (local only)", runRestore},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr})
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command line args and returns the exit status: 0 on
+// success, 1 if the command failed and 2 for usage errors.
+func run(ctx context.Context, args []string, e *env) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		usage(e.stderr)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	name, rest := args[0], args[1:]
+	if name == "products" {
+		if len(rest) == 0 {
+			fmt.Fprintln(e.stderr, "marketctl products: missing subcommand")
+			usage(e.stderr)
+			return 2
+		}
+		name, rest = name+" "+rest[0], rest[1:]
+	}
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if i < 0 {
+		fmt.Fprintf(e.stderr, "marketctl: unknown command %q\n", name)
+		usage(e.stderr)
+		return 2
+	}
+
+	err := commands[i].run(ctx, e, newFlagSet(e, commands[i]), rest)
+	switch {
+		case err == nil, errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		default:
+			fmt.Fprintf(e.stderr, "marketctl %s: %v\n", name, err)
+			return 1
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: marketctl <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-17s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Every command accepts -db <dsn> to work on a database file, the default,")
+	fmt.Fprintln(w, "or -server <url> to go through the HTTP API, and -o table|json|csv.")
+	fmt.Fprintln(w, "Commands that change data accept -dry-run. Flags come before arguments.")
+	fmt.Fprintln(w, "Run marketctl <command> -h for the flags of a command.")
+}
+
+// newFlagSet returns the flag set of command c. Errors and help are printed
+// to e.stderr.
+func newFlagSet(e *env, c command) *flag.FlagSet {
+	fs := flag.NewFlagSet("marketctl "+c.name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: marketctl %s [flags] %s\n\n%s.\n\nFlags:\n", c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of a command and checks that it got want
+// positional arguments.
+func parse(fs *flag.FlagSet, args []string, want int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() != want {
+		fmt.Fprintf(fs.Output(), "%s: expected %d argument(s), got %d: %s\n", fs.Name(), want, fs.NArg(), strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/api"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/seed"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/internal/testdb"
+)
+
+// marketctl runs a command line and returns its exit status and output.
+func marketctl(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &env{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr})
+	return code, stdout.String(), stderr.String()
+}
+
+func mustRun(t *testing.T, stdin string, args ...string) string {
+	t.Helper()
+
+	code, stdout, stderr := marketctl(t, stdin, args...)
+	if code != 0 {
+		t.Fatalf("marketctl %s: exit status %d: %s", strings.Join(args, " "), code, stderr)
+	}
+	return stdout
+}
+
+func decode[T any](t *testing.T, s string) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("Failed to decode %q: %v", s, err)
+	}
+	return v
+}
+
+func TestMarketctl_Local(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "products.db")
+	db := []string{"-db", dsn}
+	cmd := func(args ...string) []string {
+		// Flags come after the command name and before the arguments.
+		i := 1
+		if args[0] == "products" {
+			i = 2
+		}
+		return append(append(append([]string{}, args[:i]...), db...), args[i:]...)
+	}
+
+	if code, _, stderr := marketctl(t, "", cmd("products", "list")...); code != 1 || !strings.Contains(stderr, "run marketctl migrate first") {
+		t.Fatalf("Expected a hint to migrate, got %d: %s", code, stderr)
+	}
+	mustRun(t, "", cmd("migrate")...)
+
+	created := decode[model.Product](t, mustRun(t, "", cmd("products", "create", "-o", "json", "-name", "Coffee", "-price", "499")...))
+	if created.ID == "" || created.Name != "Coffee" {
+		t.Fatalf("Unexpected product %+v", created)
+	}
+	if code, _, stderr := marketctl(t, "", cmd("products", "create", "-name", "Coffee?", "-price", "0")...); code != 1 || !strings.Contains(stderr, "invalid product") {
+		t.Fatalf("Expected the invalid product to be rejected, got %d: %s", code, stderr)
+	}
+
+	code, stdout, stderr := marketctl(t, "", cmd("products", "update", "-dry-run", "-o", "json", "-price", "549", created.ID)...)
+	if code != 0 || decode[model.Product](t, stdout).Price != 549 || !strings.Contains(stderr, "dry run") {
+		t.Fatalf("Expected a dry-run update, got %d: %s %s", code, stdout, stderr)
+	}
+	if got := decode[model.Product](t, mustRun(t, "", cmd("products", "get", "-o", "json", created.ID)...)); got != created {
+		t.Fatalf("Expected the dry run to change nothing, got %+v", got)
+	}
+	mustRun(t, "", cmd("products", "update", "-price", "549", created.ID)...)
+
+	code, stdout, _ = marketctl(t, "name,price\nTea,299\nCoffee,1\n", cmd("import", "-format", "csv", "-")...)
+	if code != 1 || !strings.Contains(stdout, "1 created, 0 updated, 1 failed") || !strings.Contains(stdout, "product_already_exists") {
+		t.Fatalf("Expected one row imported and one conflict, got %d: %s", code, stdout)
+	}
+
+	out := filepath.Join(t.TempDir(), "products.csv")
+	mustRun(t, "", cmd("export", "-out", out)...)
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if want := created.ID + ",Coffee,549\n"; !strings.HasPrefix(string(data), "id,name,price\n") || !strings.Contains(string(data), want) {
+		t.Fatalf("Expected a CSV export containing %q, got %q", want, data)
+	}
+
+	mustRun(t, "", cmd("products", "delete", "-dry-run", created.ID)...)
+	mustRun(t, "", cmd("products", "delete", created.ID)...)
+	if code, _, stderr := marketctl(t, "", cmd("products", "get", created.ID)...); code != 1 || !strings.Contains(stderr, "product not found") {
+		t.Fatalf("Expected the product to be gone, got %d: %s", code, stderr)
+	}
+
+	listed := mustRun(t, "", cmd("products", "list", "-o", "csv")...)
+	if lines := strings.Split(strings.TrimSpace(listed), "\n"); len(lines) != 2 || !strings.HasSuffix(lines[1], ",Tea,299") {
+		t.Fatalf("Expected only Tea, got %q", listed)
+	}
+
+	manifest := filepath.Join(t.TempDir(), "manifest.json")
+	mustRun(t, "", cmd("seed", "-n", "20", "-seed", "7", "-batch", "8", "-manifest", manifest)...)
+	data, err = os.ReadFile(manifest)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	m := decode[seed.Manifest](t, string(data))
+	if m.Seed != 7 || m.Created != 20 || len(m.Products) != 20 {
+		t.Fatalf("Expected 20 seeded products, got %+v", m)
+	}
+	if got := decode[model.Product](t, mustRun(t, "", cmd("products", "get", "-o", "json", m.Products[19].ID)...)); got.Name != m.Products[19].Name {
+		t.Fatalf("Expected manifest product %+v to be stored, got %+v", m.Products[19], got)
+	}
+	again := decode[map[string]any](t, mustRun(t, "", cmd("seed", "-n", "20", "-seed", "7", "-manifest", manifest, "-o", "json")...))
+	if again["created"] != 0.0 || again["updated"] != 20.0 {
+		t.Fatalf("Expected seeding again to update the same products, got %v", again)
+	}
+
+	mustRun(t, "", cmd("vacuum")...)
+
+	backups := filepath.Join(t.TempDir(), "backups")
+	taken := decode[map[string]any](t, mustRun(t, "", cmd("backup", "-dir", backups, "-retention", "1", "-o", "json")...))
+	backup, _ := taken["path"].(string)
+	if filepath.Dir(backup) != backups {
+		t.Fatalf("Expected a backup in %s, got %v", backups, taken)
+	}
+	tea := decode[[]model.Product](t, mustRun(t, "", cmd("products", "list", "-o", "json")...))[0]
+	mustRun(t, "", cmd("products", "delete", tea.ID)...)
+	if code, stdout, stderr := marketctl(t, "", cmd("restore", "-dry-run", backup)...); code != 0 || !strings.Contains(stdout, "passed the integrity check") || !strings.Contains(stderr, "dry run") {
+		t.Fatalf("Expected the dry run to verify the backup, got %d: %s %s", code, stdout, stderr)
+	}
+	if code, _, stderr := marketctl(t, "", cmd("restore", filepath.Join(backups, "missing.db"))...); code != 1 || !strings.Contains(stderr, "no such file") {
+		t.Fatalf("Expected a missing backup to fail, got %d: %s", code, stderr)
+	}
+	if stdout := mustRun(t, "", cmd("restore", backup)...); !strings.Contains(stdout, "the replaced database was kept") {
+		t.Fatalf("Expected the replaced database to be kept, got %s", stdout)
+	}
+	if got := decode[model.Product](t, mustRun(t, "", cmd("products", "get", "-o", "json", tea.ID)...)); got != tea {
+		t.Fatalf("Expected the restore to bring back the deleted product, got %+v", got)
+	}
+}
+
+func TestMarketctl_Remote(t *testing.T) {
+	db := testdb.Open(t)
+	svc := service.NewProductService(db.Products)
+	server := httptest.NewServer(api.AddRoutes(db.Config, api.Dependencies{Products: svc}))
+	t.Cleanup(server.Close)
+
+	mustRun(t, "name,price\nCoffee,499\nTea,299\nCocoa,399\n", "import", "-server", server.URL, "-format", "csv", "-")
+	products := decode[[]model.Product](t, mustRun(t, "", "products", "list", "-server", server.URL, "-o", "json"))
+	if len(products) != 3 {
+		t.Fatalf("Expected 3 imported products, got %+v", products)
+	}
+
+	code, _, stderr := marketctl(t, "", "products", "create", "-server", server.URL, "-dry-run", "-name", products[0].Name, "-price", "1")
+	if code != 1 || !strings.Contains(stderr, "product_already_exists") {
+		t.Fatalf("Expected the dry run to report the conflict, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := marketctl(t, "", "vacuum", "-server", server.URL); code != 1 || !strings.Contains(stderr, "only works on the database") {
+		t.Fatalf("Expected vacuum to refuse -server, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := marketctl(t, "", "restore", "-server", server.URL, "backup.db"); code != 1 || !strings.Contains(stderr, "only works on the database") {
+		t.Fatalf("Expected restore to refuse -server, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := marketctl(t, "", "restore", "-db", db.Config.DB_DSN, db.Config.DB_DSN[len("file:"):]); code != 1 || !strings.Contains(stderr, "database is in use") {
+		t.Fatalf("Expected restore to refuse the database the server has open, got %d: %s", code, stderr)
+	}
+	if code, _, _ := marketctl(t, "", "products", "get", "-server", server.URL); code != 2 {
+		t.Fatalf("Expected a usage error without an ID, got %d", code)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/v-kuu/mini-marketplace/internal/importer"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/pkg/client"
+)
+
+const (
+	formatTable = "table"
+	formatJSON = "json"
+	formatCSV = "csv"
+)
+
+// output is the format results are printed in.
+type output string
+
+func (o *output) register(fs *flag.FlagSet) {
+	*o = formatTable
+	fs.Func("o", "Output format: table, json or csv (default table)", func(s string) error {
+		switch s {
+			case formatTable, formatJSON, formatCSV:
+				*o = output(s)
+				return nil
+			default:
+				return fmt.Errorf("must be table, json or csv")
+		}
+	})
+}
+
+// products prints a list of products. JSON output is an array.
+func (o output) products(w io.Writer, products []model.Product) error {
+	switch o {
+		case formatJSON:
+			if products == nil {
+				products = []model.Product{}
+			}
+			return writeJSON(w, products)
+		case formatCSV:
+			cw := csv.NewWriter(w)
+			if err := cw.Write(importer.Columns); err != nil {
+				return err
+			}
+			for _, p := range products {
+				if err := cw.Write([]string{p.ID, p.Name, strconv.FormatInt(p.Price, 10)}); err != nil {
+					return err
+				}
+			}
+			cw.Flush()
+			return cw.Error()
+		default:
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tNAME\tPRICE")
+			for _, p := range products {
+				fmt.Fprintf(tw, "%s\t%s\t%d\n", p.ID, p.Name, p.Price)
+			}
+			return tw.Flush()
+	}
+}
+
+// product prints one product. JSON output is an object.
+func (o output) product(w io.Writer, p model.Product) error {
+	if o == formatJSON {
+		return writeJSON(w, p)
+	}
+	return o.products(w, []model.Product{p})
+}
+
+// report prints the outcome of an import. CSV output lists the failed
+// rows only.
+func (o output) report(w io.Writer, r *client.ImportReport) error {
+	switch o {
+		case formatJSON:
+			return writeJSON(w, r)
+		case formatCSV:
+			cw := csv.NewWriter(w)
+			if err := cw.Write([]string{"line", "code", "detail"}); err != nil {
+				return err
+			}
+			for _, e := range r.Errors {
+				if err := cw.Write([]string{strconv.Itoa(e.Line), e.Code, importDetail(e)}); err != nil {
+					return err
+				}
+			}
+			cw.Flush()
+			return cw.Error()
+		default:
+			verb := "Imported"
+			if r.DryRun {
+				verb = "Dry run, would import"
+			}
+			fmt.Fprintf(w, "%s %d rows: %d created, %d updated, %d failed\n", verb, r.Rows, r.Created, r.Updated, r.Failed)
+			if len(r.Errors) == 0 {
+				return nil
+			}
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "LINE\tCODE\tDETAIL")
+			for _, e := range r.Errors {
+				fmt.Fprintf(tw, "%d\t%s\t%s\n", e.Line, e.Code, importDetail(e))
+			}
+			if r.ErrorsTruncated {
+				fmt.Fprintln(tw, "...\t\tmore rows failed")
+			}
+			return tw.Flush()
+	}
+}
+
+// importDetail explains a failed import row, with its invalid fields.
+func importDetail(e client.ImportError) string {
+	detail := e.Detail
+	for _, v := range e.Violations {
+		detail += "; " + v.Pointer + " " + v.Message
+	}
+	return strings.TrimPrefix(detail, "; ")
+}
+
+// message prints a status line. JSON output wraps it in an object with the
+// given fields.
+func (o output) message(w io.Writer, text string, fields map[string]any) error {
+	if o == formatJSON {
+		return writeJSON(w, fields)
+	}
+	_, err := fmt.Fprintln(w, text)
+	return err
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/pkg/client"
+)
+
+// session is the state shared by the product commands: the backend, the
+// output format and whether changes are only tried.
+type session struct {
+	target target
+	out output
+	dryRun bool
+}
+
+func (s *session) register(fs *flag.FlagSet, mutation bool) {
+	s.target.register(fs)
+	s.out.register(fs)
+	if mutation {
+		fs.BoolVar(&s.dryRun, "dry-run", false, "Check the change against the current data without making it")
+	}
+}
+
+// with opens the backend for the duration of fn.
+func (s *session) with(ctx context.Context, fn func(ctx context.Context, b backend) error) error {
+	ctx, cancel := context.WithTimeout(ctx, s.target.timeout)
+	defer cancel()
+
+	b, err := s.target.open(ctx)
+	if err != nil {
+		return err
+	}
+	return errors.Join(fn(ctx, b), b.Close())
+}
+
+// tryImport runs one product through a dry-run import, which applies every
+// check a real write would, including conflicts with stored products.
+func tryImport(ctx context.Context, b backend, p model.Product, upsert bool) error {
+	row, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	report, err := b.Import(ctx, bytes.NewReader(row), client.FormatNDJSON, service.ImportOptions{DryRun: true, Upsert: upsert})
+	if err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%s: %s", report.Errors[0].Code, importDetail(report.Errors[0]))
+	}
+	return nil
+}
+
+func dryRunNote(e *env, format string, args ...any) {
+	fmt.Fprintf(e.stderr, "dry run: "+format+"\n", args...)
+}
+
+func runList(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, false)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	return s.with(ctx, func(ctx context.Context, b backend) error {
+		products, err := b.List(ctx)
+		if err != nil {
+			return err
+		}
+		return s.out.products(e.stdout, products)
+	})
+}
+
+func runGet(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, false)
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	return s.with(ctx, func(ctx context.Context, b backend) error {
+		p, err := b.Get(ctx, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		return s.out.product(e.stdout, *p)
+	})
+}
+
+func runCreate(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, true)
+	name := fs.String("name", "", "Product name")
+	price := fs.Int64("price", 0, "Price in cents")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	return s.with(ctx, func(ctx context.Context, b backend) error {
+		if s.dryRun {
+			p := model.Product{Name: *name, Price: *price}
+			if err := tryImport(ctx, b, p, false); err != nil {
+				return err
+			}
+			dryRunNote(e, "the product can be created; nothing was changed")
+			return s.out.product(e.stdout, p)
+		}
+
+		p, err := b.Create(ctx, *name, *price)
+		if err != nil {
+			return err
+		}
+		return s.out.product(e.stdout, *p)
+	})
+}
+
+func runUpdate(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, true)
+	var name *string
+	var price *int64
+	fs.Func("name", "New product name", func(v string) error {
+		name = &v
+		return nil
+	})
+	fs.Func("price", "New price in cents", func(v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		price = &n
+		return nil
+	})
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if name == nil && price == nil {
+		fmt.Fprintln(e.stderr, "marketctl products update: set -name, -price or both")
+		return errUsage
+	}
+	id := fs.Arg(0)
+
+	return s.with(ctx, func(ctx context.Context, b backend) error {
+		if s.dryRun {
+			p, err := b.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			if name != nil {
+				p.Name = *name
+			}
+			if price != nil {
+				p.Price = *price
+			}
+			if err := tryImport(ctx, b, *p, true); err != nil {
+				return err
+			}
+			dryRunNote(e, "the product can be updated; nothing was changed")
+			return s.out.product(e.stdout, *p)
+		}
+
+		p, err := b.Update(ctx, id, name, price)
+		if err != nil {
+			return err
+		}
+		return s.out.product(e.stdout, *p)
+	})
+}
+
+func runDelete(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	var s session
+	s.register(fs, true)
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	id := fs.Arg(0)
+
+	return s.with(ctx, func(ctx context.Context, b backend) error {
+		if s.dryRun {
+			p, err := b.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			dryRunNote(e, "the product can be deleted; nothing was changed")
+			return s.out.product(e.stdout, *p)
+		}
+
+		if err := b.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.out.message(e.stdout, "Deleted "+id, map[string]any{"deleted": id})
+	})
+}
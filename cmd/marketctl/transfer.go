@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/v-kuu/mini-marketplace/internal/importer"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/pkg/client"
+)
+
+// Import writes the valid rows in chunks of one transaction each, with the
+// same reader and report as the server's import endpoint.
+func (b *localBackend) Import(ctx context.Context, r io.Reader, format client.FileFormat, opts service.ImportOptions) (*client.ImportReport, error) {
+	var rows importer.Reader
+	switch format {
+		case "", client.FormatNDJSON:
+			rows = importer.NewNDJSONReader(r)
+		case client.FormatCSV:
+			var err error
+			if rows, err = importer.NewCSVReader(r); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown format %q, expected ndjson or csv", format)
+	}
+
+	report, err := importer.Import(ctx, rows, b.svc.ImportProducts, importer.Options{ImportOptions: opts, ChunkSize: b.chunkSize})
+	if err != nil {
+		return nil, err
+	}
+	return clientReport(report), nil
+}
+
+// clientReport converts a local import report to the one the server sends.
+func clientReport(r *importer.Report) *client.ImportReport {
+	report := &client.ImportReport{
+		DryRun: r.DryRun,
+		Rows: r.Rows,
+		Created: r.Created,
+		Updated: r.Updated,
+		Failed: r.Failed,
+		Errors: make([]client.ImportError, len(r.Errors)),
+		ErrorsTruncated: r.ErrorsTruncated,
+	}
+	for i, e := range r.Errors {
+		report.Errors[i] = client.ImportError{Line: e.Line, Code: e.Code, Detail: e.Detail}
+		for _, v := range e.Violations {
+			report.Errors[i].Violations = append(report.Errors[i].Violations, client.Violation{Pointer: v.Pointer, Rule: v.Rule, Message: v.Message})
+		}
+	}
+	return report
+}
+
+// Export writes every product in ID order in the format of the server's
+// export endpoint.
+func (b *localBackend) Export(ctx context.Context, w io.Writer, format client.FileFormat) error {
+	var write func(p model.Product) error
+	var flush func() error
+	switch format {
+		case "", client.FormatNDJSON:
+			buf := bufio.NewWriter(w)
+			enc := json.NewEncoder(buf)
+			write, flush = func(p model.Product) error { return enc.Encode(p) }, buf.Flush
+		case client.FormatCSV:
+			cw := csv.NewWriter(w)
+			if err := cw.Write(importer.Columns); err != nil {
+				return err
+			}
+			write = func(p model.Product) error {
+				return cw.Write([]string{p.ID, p.Name, strconv.FormatInt(p.Price, 10)})
+			}
+			flush = func() error {
+				cw.Flush()
+				return cw.Error()
+			}
+		default:
+			return fmt.Errorf("unknown format %q, expected ndjson or csv", format)
+	}
+
+	for p, err := range b.svc.AllProducts(ctx) {
+		if err == nil {
+			err = write(p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return flush()
+}
@@ -2,51 +2,215 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/v-kuu/mini-marketplace/internal/backup"
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/grpcapi"
 	"github.com/v-kuu/mini-marketplace/internal/http/api"
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+	"github.com/v-kuu/mini-marketplace/internal/outbox"
+	"github.com/v-kuu/mini-marketplace/internal/repository/sqlite"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/internal/webhook"
 	_ "github.com/v-kuu/mini-marketplace/docs"
 )
 
+const (
+	configPollInterval = 5 * time.Second
+	eventPruneInterval = time.Minute
+	webhookPollInterval = time.Second
+	outboxPollInterval = time.Second
+	outboxPublishTimeout = 10 * time.Second
+)
+
 // @title           mini-marketplace
 // @version         1.0
 // @description     A small CRUD api serving a simple Product model
 // @host            localhost:8080
 // @BasePath        /
+//
+// @securityDefinitions.apikey  AdminToken
+// @in                          header
+// @name                        Authorization
+// @description                 ADMIN_TOKEN as "Bearer <token>"
 func main() {
-	mux, err := api.AddRoutes()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	logLevel := new(slog.LevelVar)
+	setLogLevel(logLevel, cfg)
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+
+	metrics.Register()
+
+	db, err := sqlite.OpenDB(cfg.DB_DSN, cfg)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Failed to open the database", err)
+	}
+	defer func () {
+		if err := db.Close(); err != nil {
+			slog.Error("Failed to close db", "err", err)
+		}
+	}()
+	if err := sqlite.Migrate(context.Background(), db); err != nil {
+		fatal("Failed to migrate the database", err)
 	}
+	metrics.RegisterDB("reader", db.Reader)
+	metrics.RegisterDB("writer", db.Writer)
+
+	watcher := config.NewWatcher(cfg, os.Args[1:])
+
+	repo := sqlite.NewProductRepository(db, cfg)
+	svc := service.NewProductService(repo)
+	webhooks := service.NewWebhookService(sqlite.NewWebhookRepository(repo))
+	backups := backup.NewManager(db, cfg.BACKUP_DIR, int(cfg.BACKUP_RETENTION))
+	done := make(chan struct{})
+	mux := api.AddRoutes(cfg, api.Dependencies{Products: svc, Webhooks: webhooks, GraphQL: svc, Backups: backups, Watcher: watcher, Done: done})
+
+	watcher.Subscribe(func(cfg *config.Config) {
+		repo.Reconfigure(cfg)
+		setLogLevel(logLevel, cfg)
+	})
+
 	server := &http.Server{
-		Addr: ":8080",
+		Addr: cfg.ADDR,
 		Handler: mux,
+		ReadTimeout: time.Duration(cfg.READ_TIMEOUT) * time.Second,
+		WriteTimeout: time.Duration(cfg.WRITE_TIMEOUT) * time.Second,
+		IdleTimeout: time.Duration(cfg.IDLE_TIMEOUT) * time.Second,
+	}
+	// Event streams never finish on their own, so Shutdown would wait for
+	// them until the grace period ends.
+	server.RegisterOnShutdown(func() { close(done) })
+
+	grpcServer := grpcapi.NewServer(cfg, grpcapi.Dependencies{Products: svc, Watcher: watcher})
+	grpcListener, err := net.Listen("tcp", cfg.GRPC_ADDR)
+	if err != nil {
+		fatal("Failed to listen for gRPC", err)
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	go watcher.Run(ctx, configPollInterval)
+	go svc.RunEventPruning(ctx, cfg.EVENTS_RETENTION, eventPruneInterval)
+	if cfg.BACKUP_INTERVAL > 0 {
+		go backups.Run(ctx, time.Duration(cfg.BACKUP_INTERVAL) * time.Second)
+	}
+
+	allowed, err := webhook.ParseNetworks(cfg.WEBHOOK_ALLOWED_NETWORKS)
+	if err != nil {
+		fatal("Invalid WEBHOOK_ALLOWED_NETWORKS", err)
+	}
+	worker := webhook.NewWorker(webhooks, webhook.Options{
+		MaxAttempts: int(cfg.WEBHOOK_MAX_ATTEMPTS),
+		BackoffBase: time.Duration(cfg.WEBHOOK_BACKOFF_BASE) * time.Second,
+		BackoffMax: time.Duration(cfg.WEBHOOK_BACKOFF_MAX) * time.Second,
+		Timeout: time.Duration(cfg.WEBHOOK_TIMEOUT) * time.Second,
+		Concurrency: int(cfg.WEBHOOK_CONCURRENCY),
+		PollInterval: webhookPollInterval,
+		AllowedNetworks: allowed,
+	})
+	changes, unsubscribe := svc.SubscribeChanges()
+	defer unsubscribe()
+	go worker.Run(ctx, changes)
+
+	publisher, err := newEventPublisher(cfg)
+	if err != nil {
+		fatal("Failed to create the event publisher", err)
+	}
+	relay := outbox.NewRelay(repo, publisher, int(cfg.OUTBOX_BATCH_SIZE), outboxPollInterval)
+	outboxChanges, unsubscribeOutbox := svc.SubscribeChanges()
+	defer unsubscribeOutbox()
+	relayDone := make(chan struct{})
 	go func() {
-		log.Println("Server starting on :8080")
+		relay.Run(ctx, outboxChanges)
+		close(relayDone)
+	}()
+
+	go func() {
+		slog.Info("Server starting", "addr", cfg.ADDR)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %v", err)
+			fatal("Failed to listen", err)
+		}
+	}()
+	go func() {
+		slog.Info("gRPC server starting", "addr", cfg.GRPC_ADDR)
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			fatal("Failed to serve gRPC", err)
 		}
 	}()
 
 	<-ctx.Done()
-	log.Println("Shutdown signal received")
+	slog.Info("Shutdown signal received")
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.SHUTDOWN_GRACE) * time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("shutdown error: %v", err)
+	// Both servers drain at once, so each gets the whole grace period
+	// rather than what the other left of it.
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to shut down the server", "err", err)
+		}
+	})
+	wg.Go(func() {
+		grpcServer.Shutdown(shutdownCtx)
+	})
+	wg.Wait()
+	<-relayDone
+	if err := publisher.Close(); err != nil {
+		slog.Error("Failed to close event publisher", "err", err)
+	}
+
+	slog.Info("Server stopped")
+}
+
+// newEventPublisher creates the outbox publisher selected by
+// OUTBOX_PUBLISHER.
+func newEventPublisher(cfg *config.Config) (outbox.EventPublisher, error) {
+	switch cfg.OUTBOX_PUBLISHER {
+		case "file":
+			return outbox.NewFilePublisher(cfg.OUTBOX_FILE)
+		case "nats":
+			return outbox.NewNATSPublisher(cfg.OUTBOX_NATS_URL, cfg.OUTBOX_SUBJECT, outboxPublishTimeout)
+		default:
+			return outbox.NewLogPublisher(slog.Default()), nil
 	}
+}
+
+func setLogLevel(level *slog.LevelVar, cfg *config.Config) {
+	// The value has already been validated by config.Load.
+	if err := level.UnmarshalText([]byte(cfg.LOG_LEVEL)); err != nil {
+		slog.Error("Invalid log level", "level", cfg.LOG_LEVEL, "err", err)
+	}
+}
 
-	log.Println("Server stopped")
+// fatal logs err and exits. The log package would log through the default
+// slog handler at INFO, where LOG_LEVEL could drop it.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
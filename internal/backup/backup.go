@@ -0,0 +1,183 @@
+// Package backup keeps a rotating set of database snapshots in a directory,
+// taken on demand or on a schedule.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+)
+
+// Backup files are named after the time they were taken, in UTC, so that
+// they sort by age.
+const (
+	namePrefix = "products-"
+	nameSuffix = ".db"
+	nameLayout = "20060102T150405.000Z"
+)
+
+// Snapshotter writes a consistent copy of the database to a file while it
+// keeps serving traffic, such as sqlite.DB.
+type Snapshotter interface {
+	Snapshot(ctx context.Context, path string) error
+}
+
+// Info describes one backup.
+type Info struct {
+	Name string `json:"name"`
+	Size int64 `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Manager takes backups into a directory and keeps the newest of them.
+// Files in the directory that are not named like backups are left alone.
+type Manager struct {
+	db Snapshotter
+	dir string
+	retention int
+	now func() time.Time
+
+	// mu serializes backups, so that a manual one cannot race the
+	// scheduled one over the same name or the pruning.
+	mu sync.Mutex
+}
+
+// NewManager creates a manager that keeps the newest retention backups of
+// db in dir, or all of them if retention is 0.
+func NewManager(db Snapshotter, dir string, retention int) *Manager {
+	return &Manager{db: db, dir: dir, retention: retention, now: time.Now}
+}
+
+// Dir returns the directory the backups are kept in.
+func (m *Manager) Dir() string {
+	return m.dir
+}
+
+// Create takes a backup and then removes the ones beyond the retention.
+func (m *Manager) Create(ctx context.Context) (Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, err := m.create(ctx)
+	if err != nil {
+		metrics.BackupsTotal.WithLabelValues("failure").Inc()
+		return Info{}, err
+	}
+	metrics.BackupsTotal.WithLabelValues("success").Inc()
+	metrics.BackupLastSuccess.Set(float64(info.CreatedAt.Unix()))
+	metrics.BackupSize.Set(float64(info.Size))
+
+	if err := m.prune(); err != nil {
+		return info, fmt.Errorf("backup %s was taken, but pruning old backups failed: %w", info.Name, err)
+	}
+	return info, nil
+}
+
+func (m *Manager) create(ctx context.Context) (Info, error) {
+	if err := os.MkdirAll(m.dir, 0o750); err != nil {
+		return Info{}, err
+	}
+	created := m.now().UTC().Truncate(time.Millisecond)
+	name := namePrefix + created.Format(nameLayout) + nameSuffix
+	path := filepath.Join(m.dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return Info{}, fmt.Errorf("backup %s already exists", name)
+	}
+	if err := m.db.Snapshot(ctx, path); err != nil {
+		return Info{}, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Name: name, Size: fi.Size(), CreatedAt: created}, nil
+}
+
+// List returns the backups in the directory, newest first.
+func (m *Manager) List() ([]Info, error) {
+	entries, err := os.ReadDir(m.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Info{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []Info{}
+	for _, e := range entries {
+		created, ok := parseName(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		fi, err := e.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, Info{Name: e.Name(), Size: fi.Size(), CreatedAt: created})
+	}
+	slices.SortFunc(backups, func(a, b Info) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return backups, nil
+}
+
+// prune removes the oldest backups beyond the retention.
+func (m *Manager) prune() error {
+	if m.retention <= 0 {
+		return nil
+	}
+	backups, err := m.List()
+	if err != nil || len(backups) <= m.retention {
+		return err
+	}
+	var errs []error
+	for _, b := range backups[m.retention:] {
+		if err := os.Remove(filepath.Join(m.dir, b.Name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseName returns the time a backup file was taken, and false if name is
+// not a backup file.
+func parseName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, namePrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, nameSuffix)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(nameLayout, stamp)
+	return t, err == nil
+}
+
+// Run takes a backup every interval until ctx is done. Failures are logged
+// and counted; the next backup is tried at the next interval.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := m.Create(ctx); err != nil && ctx.Err() == nil {
+					slog.Error("Failed to back up database", "err", err)
+				}
+		}
+	}
+}
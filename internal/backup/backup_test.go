@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+)
+
+// fakeDB writes a fixed body as the snapshot, or fails with err.
+type fakeDB struct {
+	err error
+}
+
+func (f *fakeDB) Snapshot(ctx context.Context, path string) error {
+	if f.err != nil {
+		return f.err
+	}
+	return os.WriteFile(path, []byte("snapshot"), 0o600)
+}
+
+func TestManager(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	db := &fakeDB{}
+	m := NewManager(db, dir, 2)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	successes := testutil.ToFloat64(metrics.BackupsTotal.WithLabelValues("success"))
+	var names []string
+	for range 3 {
+		info, err := m.Create(context.Background())
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if info.Size != int64(len("snapshot")) || !info.CreatedAt.Equal(now) {
+			t.Fatalf("Unexpected backup %+v", info)
+		}
+		names = append(names, info.Name)
+		now = now.Add(time.Hour)
+	}
+	if names[0] != "products-20261018T120000.000Z.db" {
+		t.Fatalf("Unexpected backup name %s", names[0])
+	}
+	if got := testutil.ToFloat64(metrics.BackupsTotal.WithLabelValues("success")) - successes; got != 3 {
+		t.Fatalf("Expected 3 successful backups counted, got %v", got)
+	}
+
+	// Files not named like backups survive the pruning.
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := m.Create(context.Background()); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	backups, err := m.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(backups) != 2 || backups[0].CreatedAt.Before(backups[1].CreatedAt) || backups[1].Name != names[2] {
+		t.Fatalf("Expected the 2 newest backups, newest first, got %+v", backups)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Fatalf("Expected other files to be kept, got %v", err)
+	}
+
+	failures := testutil.ToFloat64(metrics.BackupsTotal.WithLabelValues("failure"))
+	db.err = errors.New("disk full")
+	if _, err := m.Create(context.Background()); err == nil {
+		t.Fatalf("Expected the snapshot failure to be returned")
+	}
+	if got := testutil.ToFloat64(metrics.BackupsTotal.WithLabelValues("failure")) - failures; got != 1 {
+		t.Fatalf("Expected the failure to be counted, got %v", got)
+	}
+}
+
+func TestManager_ListMissingDir(t *testing.T) {
+	m := NewManager(&fakeDB{}, filepath.Join(t.TempDir(), "missing"), 0)
+	backups, err := m.List()
+	if err != nil || len(backups) != 0 {
+		t.Fatalf("Expected no backups, got %v, %v", backups, err)
+	}
+}
@@ -1,40 +1,230 @@
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"reflect"
 	"strconv"
+	"strings"
 )
 
+// Config holds every setting of the server. Each field can be set from the
+// config file entry named by its key tag, the environment variable with the
+// same name as the field, and the flag named by the key with dashes instead
+// of underscores, in increasing order of precedence. Fields tagged with
+// reload can be changed on a running server, see Watcher.
 type Config struct {
-	SEM_MAX int64
-	TIMEOUT int64
+	SEM_MAX int64 `key:"sem_max" reload:"true" usage:"Upper bound of the adaptive database concurrency limit"`
+	SEM_MIN int64 `key:"sem_min" reload:"true" usage:"Lower bound of the adaptive database concurrency limit"`
+	SEM_TARGET_WAIT_MS int64 `key:"sem_target_wait_ms" reload:"true" usage:"Queueing delay in milliseconds above which low-priority requests are shed"`
+	TIMEOUT int64 `key:"timeout" reload:"true" usage:"Per-request handler timeout in seconds"`
+	RATE_LIMIT int64 `key:"rate_limit" reload:"true" usage:"Product API requests per second, 0 disables rate limiting"`
+	RATE_BURST int64 `key:"rate_burst" reload:"true" usage:"Product API requests allowed in a burst above the rate"`
+	LOG_LEVEL string `key:"log_level" reload:"true" usage:"Log level (debug, info, warn or error)"`
+	DB_DSN string `key:"db_dsn" flag:"db" usage:"SQLite data source name" secret:"dsn"`
+	DB_MAX_OPEN_CONNS int64 `key:"db_max_open_conns" usage:"Maximum open reader connections"`
+	DB_MAX_IDLE_CONNS int64 `key:"db_max_idle_conns" usage:"Maximum idle reader connections"`
+	DB_CONN_MAX_LIFETIME int64 `key:"db_conn_max_lifetime" usage:"Reader connection lifetime in seconds, 0 keeps them forever"`
+	DB_BUSY_TIMEOUT_MS int64 `key:"db_busy_timeout_ms" usage:"How long SQLite waits on a locked database in milliseconds"`
+	DB_SYNCHRONOUS string `key:"db_synchronous" usage:"SQLite synchronous pragma (OFF, NORMAL, FULL or EXTRA)"`
+	ADDR string `key:"addr" usage:"HTTP listen address"`
+	GRPC_ADDR string `key:"grpc_addr" usage:"gRPC listen address"`
+	READ_TIMEOUT int64 `key:"read_timeout" usage:"HTTP read timeout in seconds"`
+	WRITE_TIMEOUT int64 `key:"write_timeout" usage:"HTTP write timeout in seconds"`
+	IDLE_TIMEOUT int64 `key:"idle_timeout" usage:"HTTP keep-alive idle timeout in seconds"`
+	SHUTDOWN_GRACE int64 `key:"shutdown_grace" usage:"Seconds to wait for in-flight requests on shutdown"`
+	IMPORT_MAX_BYTES int64 `key:"import_max_bytes" usage:"Largest accepted product import body in bytes"`
+	IMPORT_CHUNK_SIZE int64 `key:"import_chunk_size" usage:"Product import rows written per transaction"`
+	BATCH_MAX_SIZE int64 `key:"batch_max_size" usage:"Most operations accepted in one product batch"`
+	EVENTS_HEARTBEAT int64 `key:"events_heartbeat" usage:"Seconds between heartbeats on product event streams"`
+	EVENTS_RETENTION int64 `key:"events_retention" usage:"Product change events kept for resuming event streams"`
+	WS_MAX_CONNECTIONS int64 `key:"ws_max_connections" usage:"Most concurrent WebSocket connections"`
+	WS_MAX_SUBSCRIPTIONS int64 `key:"ws_max_subscriptions" usage:"Most subscriptions per WebSocket connection"`
+	GRAPHQL_MAX_DEPTH int64 `key:"graphql_max_depth" usage:"Deepest field nesting accepted in a GraphQL query"`
+	GRAPHQL_MAX_COMPLEXITY int64 `key:"graphql_max_complexity" usage:"Highest estimated cost accepted for a GraphQL query"`
+	WEBHOOK_MAX_ATTEMPTS int64 `key:"webhook_max_attempts" usage:"Attempts of a webhook delivery before it is dead-lettered"`
+	WEBHOOK_BACKOFF_BASE int64 `key:"webhook_backoff_base" usage:"Seconds before the first webhook retry; doubles with every retry"`
+	WEBHOOK_BACKOFF_MAX int64 `key:"webhook_backoff_max" usage:"Longest delay between webhook retries in seconds"`
+	WEBHOOK_TIMEOUT int64 `key:"webhook_timeout" usage:"Timeout of a single webhook delivery attempt in seconds"`
+	WEBHOOK_CONCURRENCY int64 `key:"webhook_concurrency" usage:"Webhook deliveries sent at once"`
+	WEBHOOK_ALLOWED_NETWORKS string `key:"webhook_allowed_networks" usage:"Comma-separated CIDR ranges of internal networks webhooks may be sent to; loopback, private and link-local addresses are refused otherwise"`
+	OUTBOX_PUBLISHER string `key:"outbox_publisher" usage:"Where outbox events are published (log, file or nats)"`
+	OUTBOX_FILE string `key:"outbox_file" usage:"File the file publisher appends outbox events to"`
+	OUTBOX_NATS_URL string `key:"outbox_nats_url" usage:"NATS server the nats publisher publishes to" secret:"url"`
+	OUTBOX_SUBJECT string `key:"outbox_subject" usage:"Subject prefix of outbox events published to NATS"`
+	OUTBOX_BATCH_SIZE int64 `key:"outbox_batch_size" usage:"Outbox events read per relay round"`
+	ADMIN_TOKEN string `key:"admin_token" usage:"Bearer token of the /admin and /webhooks routes, which are disabled while it is empty" secret:"token"`
+	BACKUP_DIR string `key:"backup_dir" usage:"Directory database backups are written to"`
+	BACKUP_INTERVAL int64 `key:"backup_interval" usage:"Seconds between scheduled database backups, 0 disables them"`
+	BACKUP_RETENTION int64 `key:"backup_retention" usage:"Newest database backups kept, 0 keeps all of them"`
+
+	// File is the config file the settings were read from, if any.
+	File string `key:"-"`
+	// PrintConfig asks the caller to print the effective config and exit.
+	PrintConfig bool `key:"-"`
 }
 
-func Load() *Config {
-	cfg := &Config{
-		SEM_MAX: getEnvInt("SEM_MAX", 100),
-		TIMEOUT: getEnvInt("TIMEOUT", 30),
+// Default returns the built-in configuration without consulting the
+// environment, a config file or flags.
+func Default() *Config {
+	return &Config{
+		SEM_MAX: 100,
+		SEM_MIN: 1,
+		SEM_TARGET_WAIT_MS: 100,
+		TIMEOUT: 30,
+		RATE_LIMIT: 0,
+		RATE_BURST: 100,
+		LOG_LEVEL: "info",
+		DB_DSN: "file:products.db",
+		DB_MAX_OPEN_CONNS: 10,
+		DB_MAX_IDLE_CONNS: 10,
+		DB_CONN_MAX_LIFETIME: 0,
+		DB_BUSY_TIMEOUT_MS: 5000,
+		DB_SYNCHRONOUS: "NORMAL",
+		ADDR: ":8080",
+		GRPC_ADDR: ":9090",
+		READ_TIMEOUT: 10,
+		WRITE_TIMEOUT: 60,
+		IDLE_TIMEOUT: 120,
+		SHUTDOWN_GRACE: 5,
+		IMPORT_MAX_BYTES: 64 << 20,
+		IMPORT_CHUNK_SIZE: 500,
+		BATCH_MAX_SIZE: 100,
+		EVENTS_HEARTBEAT: 15,
+		EVENTS_RETENTION: 10000,
+		WS_MAX_CONNECTIONS: 1000,
+		WS_MAX_SUBSCRIPTIONS: 50,
+		GRAPHQL_MAX_DEPTH: 10,
+		GRAPHQL_MAX_COMPLEXITY: 1000,
+		WEBHOOK_MAX_ATTEMPTS: 8,
+		WEBHOOK_BACKOFF_BASE: 10,
+		WEBHOOK_BACKOFF_MAX: 3600,
+		WEBHOOK_TIMEOUT: 10,
+		WEBHOOK_CONCURRENCY: 4,
+		WEBHOOK_ALLOWED_NETWORKS: "",
+		OUTBOX_PUBLISHER: "log",
+		OUTBOX_FILE: "outbox.ndjson",
+		OUTBOX_NATS_URL: "nats://127.0.0.1:4222",
+		OUTBOX_SUBJECT: "marketplace",
+		OUTBOX_BATCH_SIZE: 100,
+		ADMIN_TOKEN: "",
+		BACKUP_DIR: "backups",
+		BACKUP_INTERVAL: 0,
+		BACKUP_RETENTION: 24,
 	}
-	return cfg
 }
 
-//nolint:all
-func getEnvStr(key, fallback string) string {
-	v, ok := os.LookupEnv(key)
-	if ok {
-		return v
+// Load builds the configuration from defaults, an optional config file,
+// the environment and the command-line flags in args, with later sources
+// taking precedence. All problems found along the way, including invalid
+// values, are returned together.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	fields := cfg.fields()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(&cfg.File, "config", os.Getenv("CONFIG_FILE"), "Path to a YAML or TOML config file")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "Print the effective configuration and exit")
+	flags := make(map[string]*string)
+	for _, f := range fields {
+		flags[f.key] = fs.String(f.flag, fmt.Sprint(f.value.Interface()), f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	if cfg.File != "" {
+		if err := cfg.loadFile(cfg.File); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return fallback
+
+	for _, f := range fields {
+		v, ok := os.LookupEnv(f.env)
+		if !ok {
+			continue
+		}
+		if err := f.set(v); err != nil {
+			errs = append(errs, fmt.Errorf("env %s: %w", f.env, err))
+		}
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.flag == fl.Name {
+				if err := f.set(*flags[f.key]); err != nil {
+					errs = append(errs, fmt.Errorf("flag -%s: %w", f.flag, err))
+				}
+			}
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// field is a settable view of one Config field.
+type field struct {
+	env string
+	key string
+	flag string
+	usage string
+	secret string
+	reload bool
+	value reflect.Value
 }
 
-func getEnvInt(key string, fallback int64) int64 {
-	v, ok := os.LookupEnv(key)
-	if !ok {
-		return fallback
+func (c *Config) fields() []field {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	var fields []field
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		key := sf.Tag.Get("key")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := sf.Tag.Get("flag")
+		if name == "" {
+			name = strings.ReplaceAll(key, "_", "-")
+		}
+		fields = append(fields, field{
+			env: sf.Name,
+			key: key,
+			flag: name,
+			usage: sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret"),
+			reload: sf.Tag.Get("reload") == "true",
+			value: v.Field(i),
+		})
 	}
-	i, err := strconv.ParseInt(v, 10, 64)
-	if err != nil {
-		return fallback
+	return fields
+}
+
+// set parses s into the field. Parse failures are reported instead of
+// silently keeping the previous value.
+func (f field) set(s string) error {
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(s)
+	case reflect.Int64:
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		f.value.SetInt(i)
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Kind())
 	}
-	return i
+	return nil
 }
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// loadFile applies the settings in a YAML or TOML file, chosen by
+// extension. Unknown keys and values of the wrong type are errors.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	values := make(map[string]any)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	fields := make(map[string]field)
+	for _, f := range c.fields() {
+		fields[f.key] = f
+	}
+
+	var errs []string
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		f, ok := fields[k]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown key %q", k))
+			continue
+		}
+		if err := f.setValue(values[k]); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", k, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config file %s: %s", path, strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// setValue assigns a decoded YAML or TOML value to the field.
+func (f field) setValue(v any) error {
+	switch f.value.Kind() {
+	case reflect.String:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %T", v)
+		}
+		f.value.SetString(s)
+	case reflect.Int64:
+		switch n := v.(type) {
+		case int:
+			f.value.SetInt(int64(n))
+		case int64:
+			f.value.SetInt(n)
+		case uint64:
+			if n > 1<<63-1 {
+				return fmt.Errorf("integer %d out of range", n)
+			}
+			f.value.SetInt(int64(n))
+		default:
+			return fmt.Errorf("expected an integer, got %T", v)
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Kind())
+	}
+	return nil
+}
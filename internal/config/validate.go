@@ -0,0 +1,90 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// Validate checks the configuration for values the server cannot run with
+// and reports all of them at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.SEM_MAX >= 1, "SEM_MAX must be at least 1, got %d", c.SEM_MAX)
+	check(c.SEM_MIN >= 1, "SEM_MIN must be at least 1, got %d", c.SEM_MIN)
+	check(c.SEM_MIN <= c.SEM_MAX, "SEM_MIN (%d) must not exceed SEM_MAX (%d)", c.SEM_MIN, c.SEM_MAX)
+	check(c.SEM_TARGET_WAIT_MS >= 0, "SEM_TARGET_WAIT_MS must not be negative, got %d", c.SEM_TARGET_WAIT_MS)
+	check(c.TIMEOUT >= 1, "TIMEOUT must be at least 1 second, got %d", c.TIMEOUT)
+	check(c.RATE_LIMIT >= 0, "RATE_LIMIT must not be negative, got %d", c.RATE_LIMIT)
+	check(c.RATE_BURST >= 1, "RATE_BURST must be at least 1, got %d", c.RATE_BURST)
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LOG_LEVEL)) == nil, "LOG_LEVEL must be one of debug, info, warn or error, got %q", c.LOG_LEVEL)
+
+	check(c.DB_DSN != "", "DB_DSN must not be empty")
+	check(c.DB_MAX_OPEN_CONNS >= 1, "DB_MAX_OPEN_CONNS must be at least 1, got %d", c.DB_MAX_OPEN_CONNS)
+	check(c.DB_MAX_IDLE_CONNS >= 0, "DB_MAX_IDLE_CONNS must not be negative, got %d", c.DB_MAX_IDLE_CONNS)
+	check(c.DB_CONN_MAX_LIFETIME >= 0, "DB_CONN_MAX_LIFETIME must not be negative, got %d", c.DB_CONN_MAX_LIFETIME)
+	check(c.DB_BUSY_TIMEOUT_MS >= 0, "DB_BUSY_TIMEOUT_MS must not be negative, got %d", c.DB_BUSY_TIMEOUT_MS)
+	switch strings.ToUpper(c.DB_SYNCHRONOUS) {
+	case "OFF", "NORMAL", "FULL", "EXTRA", "0", "1", "2", "3":
+	default:
+		check(false, "DB_SYNCHRONOUS must be one of OFF, NORMAL, FULL or EXTRA, got %q", c.DB_SYNCHRONOUS)
+	}
+
+	_, _, err := net.SplitHostPort(c.ADDR)
+	check(err == nil, "ADDR %q is not a valid listen address", c.ADDR)
+	_, _, err = net.SplitHostPort(c.GRPC_ADDR)
+	check(err == nil, "GRPC_ADDR %q is not a valid listen address", c.GRPC_ADDR)
+	check(c.READ_TIMEOUT >= 0, "READ_TIMEOUT must not be negative, got %d", c.READ_TIMEOUT)
+	check(c.WRITE_TIMEOUT >= 0, "WRITE_TIMEOUT must not be negative, got %d", c.WRITE_TIMEOUT)
+	check(c.IDLE_TIMEOUT >= 0, "IDLE_TIMEOUT must not be negative, got %d", c.IDLE_TIMEOUT)
+	check(c.SHUTDOWN_GRACE >= 0, "SHUTDOWN_GRACE must not be negative, got %d", c.SHUTDOWN_GRACE)
+	check(c.IMPORT_MAX_BYTES >= 1, "IMPORT_MAX_BYTES must be at least 1, got %d", c.IMPORT_MAX_BYTES)
+	check(c.IMPORT_CHUNK_SIZE >= 1, "IMPORT_CHUNK_SIZE must be at least 1, got %d", c.IMPORT_CHUNK_SIZE)
+	check(c.BATCH_MAX_SIZE >= 1, "BATCH_MAX_SIZE must be at least 1, got %d", c.BATCH_MAX_SIZE)
+	check(c.EVENTS_HEARTBEAT >= 1, "EVENTS_HEARTBEAT must be at least 1, got %d", c.EVENTS_HEARTBEAT)
+	check(c.EVENTS_RETENTION >= 1, "EVENTS_RETENTION must be at least 1, got %d", c.EVENTS_RETENTION)
+	check(c.WS_MAX_CONNECTIONS >= 1, "WS_MAX_CONNECTIONS must be at least 1, got %d", c.WS_MAX_CONNECTIONS)
+	check(c.WS_MAX_SUBSCRIPTIONS >= 1, "WS_MAX_SUBSCRIPTIONS must be at least 1, got %d", c.WS_MAX_SUBSCRIPTIONS)
+	check(c.GRAPHQL_MAX_DEPTH >= 1, "GRAPHQL_MAX_DEPTH must be at least 1, got %d", c.GRAPHQL_MAX_DEPTH)
+	check(c.GRAPHQL_MAX_COMPLEXITY >= 1, "GRAPHQL_MAX_COMPLEXITY must be at least 1, got %d", c.GRAPHQL_MAX_COMPLEXITY)
+	check(c.WEBHOOK_MAX_ATTEMPTS >= 1, "WEBHOOK_MAX_ATTEMPTS must be at least 1, got %d", c.WEBHOOK_MAX_ATTEMPTS)
+	check(c.WEBHOOK_BACKOFF_BASE >= 1, "WEBHOOK_BACKOFF_BASE must be at least 1, got %d", c.WEBHOOK_BACKOFF_BASE)
+	check(c.WEBHOOK_BACKOFF_BASE <= c.WEBHOOK_BACKOFF_MAX, "WEBHOOK_BACKOFF_BASE (%d) must not exceed WEBHOOK_BACKOFF_MAX (%d)", c.WEBHOOK_BACKOFF_BASE, c.WEBHOOK_BACKOFF_MAX)
+	check(c.WEBHOOK_TIMEOUT >= 1, "WEBHOOK_TIMEOUT must be at least 1, got %d", c.WEBHOOK_TIMEOUT)
+	check(c.WEBHOOK_CONCURRENCY >= 1, "WEBHOOK_CONCURRENCY must be at least 1, got %d", c.WEBHOOK_CONCURRENCY)
+	for _, part := range strings.Split(c.WEBHOOK_ALLOWED_NETWORKS, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			_, err := netip.ParsePrefix(part)
+			check(err == nil, "WEBHOOK_ALLOWED_NETWORKS must be a comma-separated list of CIDR ranges, got %q", part)
+		}
+	}
+	switch c.OUTBOX_PUBLISHER {
+	case "log":
+	case "file":
+		check(c.OUTBOX_FILE != "", "OUTBOX_FILE must not be empty with the file publisher")
+	case "nats":
+		u, err := url.Parse(c.OUTBOX_NATS_URL)
+		check(err == nil && u.Scheme == "nats" && u.Host != "", "OUTBOX_NATS_URL must look like nats://host:port, got %q", redactURL(c.OUTBOX_NATS_URL))
+		check(c.OUTBOX_SUBJECT != "" && !strings.ContainsAny(c.OUTBOX_SUBJECT, " \t\r\n*>"), "OUTBOX_SUBJECT must be a NATS subject without wildcards, got %q", c.OUTBOX_SUBJECT)
+	default:
+		check(false, "OUTBOX_PUBLISHER must be one of log, file or nats, got %q", c.OUTBOX_PUBLISHER)
+	}
+	check(c.OUTBOX_BATCH_SIZE >= 1, "OUTBOX_BATCH_SIZE must be at least 1, got %d", c.OUTBOX_BATCH_SIZE)
+	check(c.ADMIN_TOKEN == "" || len(c.ADMIN_TOKEN) >= 16, "ADMIN_TOKEN must be at least 16 characters long")
+	check(c.BACKUP_DIR != "", "BACKUP_DIR must not be empty")
+	check(c.BACKUP_INTERVAL >= 0, "BACKUP_INTERVAL must not be negative, got %d", c.BACKUP_INTERVAL)
+	check(c.BACKUP_RETENTION >= 0, "BACKUP_RETENTION must not be negative, got %d", c.BACKUP_RETENTION)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+)
+
+// ErrRestartRequired is returned by Reload when the new configuration
+// changes settings that are only read at startup.
+var ErrRestartRequired = errors.New("settings require a restart")
+
+// Watcher reloads the configuration on SIGHUP or when the config file
+// changes and hands the result to subscribers. Only fields tagged with
+// reload may differ from the running configuration; any other change
+// rejects the whole reload.
+type Watcher struct {
+	args []string
+	current atomic.Pointer[Config]
+
+	mu sync.Mutex
+	subscribers []func(*Config)
+}
+
+// NewWatcher starts from cfg, which must have been loaded from args.
+func NewWatcher(cfg *Config, args []string) *Watcher {
+	w := &Watcher{args: args}
+	w.current.Store(cfg)
+	return w
+}
+
+func (w *Watcher) Current() *Config {
+	return w.current.Load()
+}
+
+// Subscribe registers fn to be called with every successfully reloaded
+// configuration.
+func (w *Watcher) Subscribe(fn func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Reload loads the configuration again from the same sources and applies it
+// if only reloadable settings changed.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	next, err := Load(w.args)
+	if err != nil {
+		metrics.ConfigReloadsTotal.WithLabelValues("error").Inc()
+		return err
+	}
+
+	prev := w.current.Load()
+	changed, static := prev.diff(next)
+	if len(static) > 0 {
+		metrics.ConfigReloadsTotal.WithLabelValues("rejected").Inc()
+		return fmt.Errorf("%w: %s", ErrRestartRequired, strings.Join(static, ", "))
+	}
+
+	w.current.Store(next)
+	for _, fn := range w.subscribers {
+		fn(next)
+	}
+
+	metrics.ConfigReloadsTotal.WithLabelValues("success").Inc()
+	metrics.ConfigLastReloadSuccess.SetToCurrentTime()
+	if len(changed) > 0 {
+		slog.Info("Config reloaded", "changed", strings.Join(changed, ", "))
+	} else {
+		slog.Info("Config reloaded, no changes")
+	}
+	return nil
+}
+
+// Run reloads on SIGHUP and whenever the config file's size or modification
+// time changes, checked every interval, until ctx is done.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	file := w.Current().File
+	last := fileVersion(file)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("SIGHUP received, reloading config")
+		case <-ticker.C:
+			if file == "" {
+				continue
+			}
+			version := fileVersion(file)
+			if version == last {
+				continue
+			}
+			last = version
+			slog.Info("Config file changed, reloading config", "file", file)
+		}
+
+		if err := w.Reload(); err != nil {
+			slog.Error("Config reload rejected", "err", err)
+		}
+	}
+}
+
+func fileVersion(path string) string {
+	if path == "" {
+		return ""
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// diff returns the keys that differ between c and next, split into
+// reloadable and static ones.
+func (c *Config) diff(next *Config) (changed, static []string) {
+	nextFields := next.fields()
+	for i, f := range c.fields() {
+		if reflect.DeepEqual(f.value.Interface(), nextFields[i].value.Interface()) {
+			continue
+		}
+		if f.reload {
+			changed = append(changed, f.key)
+		} else {
+			static = append(static, f.key)
+		}
+	}
+	return changed, static
+}
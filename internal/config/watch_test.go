@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestWatcher_Reload(t *testing.T) {
+	path := writeFile(t, "config.yaml", "sem_max: 20\ntimeout: 5\n")
+	args := []string{"-config", path}
+
+	cfg, err := Load(args)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	w := NewWatcher(cfg, args)
+
+	var got *Config
+	w.Subscribe(func(cfg *Config) {
+		got = cfg
+	})
+
+	if err := os.WriteFile(path, []byte("sem_max: 40\ntimeout: 9\nlog_level: debug\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got == nil || got.SEM_MAX != 40 || got.TIMEOUT != 9 || got.LOG_LEVEL != "debug" {
+		t.Fatalf("Subscriber did not receive the new config: %+v", got)
+	}
+	if w.Current() != got {
+		t.Fatalf("Current config was not swapped")
+	}
+}
+
+func TestWatcher_ReloadRejected(t *testing.T) {
+	path := writeFile(t, "config.yaml", "sem_max: 20\n")
+	args := []string{"-config", path}
+
+	cfg, err := Load(args)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	w := NewWatcher(cfg, args)
+
+	called := false
+	w.Subscribe(func(*Config) {
+		called = true
+	})
+
+	tests := []struct {
+		name string
+		content string
+		restart bool
+	}{
+		{name: "Static setting", content: "sem_max: 30\naddr: \":9999\"\n", restart: true},
+		{name: "Invalid value", content: "sem_max: 0\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+
+			err := w.Reload()
+			if err == nil {
+				t.Fatalf("Expected reload to be rejected")
+			}
+			if errors.Is(err, ErrRestartRequired) != tt.restart {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if called {
+				t.Fatalf("Subscriber must not be called for a rejected reload")
+			}
+			if w.Current().SEM_MAX != 20 {
+				t.Fatalf("Rejected reload changed the running config")
+			}
+		})
+	}
+}
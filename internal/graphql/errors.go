@@ -0,0 +1,174 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// Codes of errors in extensions.code. Field errors use the codes of the
+// matching problem types of the HTTP API.
+const (
+	codeSyntaxError = "syntax_error"
+	codeValidationFailed = "validation_failed"
+	codeQueryTooDeep = "query_too_deep"
+	codeQueryTooComplex = "query_too_complex"
+	codeQueryTooLarge = "query_too_large"
+	codeInternalError = "internal_error"
+)
+
+var errorCodes = []struct {
+	err error
+	code string
+}{
+	{service.ErrInvalidProduct, "invalid_product"},
+	{service.ErrProductNotFound, "product_not_found"},
+	{service.ErrProductAlreadyExists, "product_already_exists"},
+	{service.ErrOverloaded, "overloaded"},
+	{context.DeadlineExceeded, "timeout"},
+	{context.Canceled, "canceled"},
+}
+
+// inputError reports every invalid field of a mutation's input, in the
+// same form as the violations of the HTTP API.
+type inputError struct {
+	violations []problem.Violation
+}
+
+func (e *inputError) Error() string {
+	msgs := make([]string, len(e.violations))
+	for i, v := range e.violations {
+		msgs[i] = v.Pointer + ": " + v.Message
+	}
+	return "invalid input: " + strings.Join(msgs, "; ")
+}
+
+// errorFor returns the code, message and extra extensions a field error is
+// reported with. Unknown errors are reported as internal errors without
+// leaking the cause, and ok is false.
+func errorFor(err error) (code, message string, extensions map[string]any, ok bool) {
+	var ierr *inputError
+	if errors.As(err, &ierr) {
+		return codeValidationFailed, "the input has invalid fields", map[string]any{"violations": ierr.violations}, true
+	}
+	for _, ec := range errorCodes {
+		if errors.Is(err, ec.err) {
+			if ec.err == context.DeadlineExceeded {
+				return ec.code, "the request did not complete in time", nil, true
+			}
+			return ec.code, err.Error(), nil, true
+		}
+	}
+	return codeInternalError, "internal error", nil, false
+}
+
+// lines are the offsets at which the lines of a query start. Queries are
+// parsed without their source, since the executor locates an error by
+// scanning the whole source for line breaks, which makes documents with
+// many errors slow to validate. Without the source it reports the offset
+// of a node as the column of line 1, and lines turns that into the line
+// and column. Syntax errors are located by the parser and have nil lines.
+type lines []int
+
+func newLines(query string) lines {
+	l := lines{0}
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+			case '\r':
+				if i+1 < len(query) && query[i+1] == '\n' {
+					i++
+				}
+				l = append(l, i+1)
+			case '\n':
+				l = append(l, i+1)
+		}
+	}
+	return l
+}
+
+func (l lines) locate(offset int) Location {
+	line, _ := slices.BinarySearch(l, offset+1)
+	return Location{Line: line, Column: offset - l[line-1] + 1}
+}
+
+// convert converts an error of the executor, keeping only the first line
+// of its message; syntax errors continue with an excerpt of the query.
+func (l lines) convert(e gqlerrors.FormattedError) *Error {
+	message, _, _ := strings.Cut(e.Message, "\n")
+	gerr := &Error{Message: message, Path: e.Path}
+	for _, loc := range e.Locations {
+		if l != nil {
+			gerr.Locations = append(gerr.Locations, l.locate(loc.Column-1))
+		} else {
+			gerr.Locations = append(gerr.Locations, Location{Line: loc.Line, Column: loc.Column})
+		}
+	}
+	return gerr
+}
+
+// cause returns the error a resolver failed with, or err itself if it did
+// not come from a resolver.
+func cause(err error) error {
+	var located *gqlerrors.Error
+	if errors.As(err, &located) && located.OriginalError != nil {
+		return located.OriginalError
+	}
+	var formatted gqlerrors.FormattedError
+	if errors.As(err, &formatted) && formatted.OriginalError() != nil && formatted.OriginalError() != err {
+		return cause(formatted.OriginalError())
+	}
+	return err
+}
+
+// requestError reports an error that stopped the whole request before any
+// field was resolved. Errors without a code of their own are taken to be
+// the request's fault.
+func (l lines) requestError(err error) *Error {
+	gerr := &Error{Message: err.Error()}
+	if formatted, ok := err.(gqlerrors.FormattedError); ok {
+		gerr = l.convert(formatted)
+	}
+	code, message, extensions, ok := errorFor(cause(err))
+	if !ok {
+		code, message = codeValidationFailed, gerr.Message
+	}
+	gerr.Message = message
+	gerr.Extensions = map[string]any{"code": code}
+	for k, v := range extensions {
+		gerr.Extensions[k] = v
+	}
+	return gerr
+}
+
+// fieldError reports the error of a field, which is null in the data.
+func (l lines) fieldError(e gqlerrors.FormattedError) *Error {
+	gerr := l.convert(e)
+	code, message, extensions, ok := errorFor(cause(e))
+	if !ok {
+		slog.Error("GraphQL field failed", "path", e.Path, "err", e.Message)
+	}
+	gerr.Message = message
+	gerr.Extensions = map[string]any{"code": code}
+	for k, v := range extensions {
+		gerr.Extensions[k] = v
+	}
+	return gerr
+}
+
+// errorAt returns an error located at node.
+func (l lines) errorAt(node ast.Node, format string, args ...any) *Error {
+	gerr := &Error{Message: fmt.Sprintf(format, args...)}
+	if loc := node.GetLoc(); loc != nil {
+		gerr.Locations = []Location{l.locate(loc.Start)}
+	}
+	return gerr
+}
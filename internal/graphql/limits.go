@@ -0,0 +1,225 @@
+package graphql
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// cost is what a selection set costs to run: how deep its fields nest and
+// how many fields may be resolved.
+type cost struct {
+	depth int
+	complexity int
+}
+
+// coster works out the cost of an operation from its document, before
+// anything is run. Each fragment is costed once and spread at most once
+// per selection set, as the executor collects fields, so fragments that
+// spread each other repeatedly cost as much as they are written, not as
+// much as they expand to.
+type coster struct {
+	ctx context.Context
+	lines lines
+	schema *Schema
+	fragments map[string]*ast.FragmentDefinition
+	// vars are the variable values of the request and defaults the
+	// defaults the operation declares.
+	vars map[string]any
+	defaults map[string]ast.Value
+	// costs are the costs of the fragments seen so far. A fragment being
+	// costed is present with a nil cost, so a cycle cannot recurse.
+	costs map[string]*cost
+}
+
+func checkLimits(ctx context.Context, s *Schema, l lines, fragments map[string]*ast.FragmentDefinition, op *ast.OperationDefinition, vars map[string]any, limits Limits) *Error {
+	c := &coster{
+		ctx: ctx,
+		lines: l,
+		schema: s,
+		fragments: fragments,
+		vars: vars,
+		defaults: make(map[string]ast.Value),
+		costs: make(map[string]*cost),
+	}
+	for _, v := range op.VariableDefinitions {
+		if v.DefaultValue != nil {
+			c.defaults[v.Variable.Name.Value] = v.DefaultValue
+		}
+	}
+
+	root := s.query
+	if op.Operation == ast.OperationTypeMutation {
+		root = s.mutation
+	}
+	total, err := c.selectionSet(root, op.SelectionSet, make(map[string]bool))
+	if err != nil {
+		return l.requestError(err)
+	}
+
+	if limits.MaxDepth > 0 && total.depth > limits.MaxDepth {
+		err := l.errorAt(op, "The query has a depth of %d, more than the %d allowed.", total.depth, limits.MaxDepth)
+		err.Extensions = map[string]any{"code": codeQueryTooDeep, "depth": total.depth, "maxDepth": limits.MaxDepth}
+		return err
+	}
+	if limits.MaxComplexity > 0 && total.complexity > limits.MaxComplexity {
+		err := l.errorAt(op, "The query has a complexity of %d, more than the %d allowed.", total.complexity, limits.MaxComplexity)
+		err.Extensions = map[string]any{"code": codeQueryTooComplex, "complexity": total.complexity, "maxComplexity": limits.MaxComplexity}
+		return err
+	}
+	return nil
+}
+
+// selectionSet returns the cost of set, selected on t. t is nil for types
+// that are not described, such as those of introspection; their fields
+// count as single items. visited are the fragments already spread in the
+// set.
+func (c *coster) selectionSet(t *typeDef, set *ast.SelectionSet, visited map[string]bool) (cost, error) {
+	if err := c.ctx.Err(); err != nil {
+		return cost{}, err
+	}
+	var total cost
+	if set == nil {
+		return total, nil
+	}
+	for _, sel := range set.Selections {
+		var sub cost
+		var err error
+		switch sel := sel.(type) {
+			case *ast.Field:
+				var def *fieldDef
+				if t != nil {
+					def = t.field(sel.Name.Value)
+				}
+				sub, err = c.selectionSet(c.typeOf(def), sel.SelectionSet, make(map[string]bool))
+				if err != nil {
+					return cost{}, err
+				}
+				sub = cost{depth: 1 + sub.depth, complexity: saturate(1 + int64(c.items(sel, def)) * int64(sub.complexity))}
+			case *ast.InlineFragment:
+				on := t
+				if sel.TypeCondition != nil {
+					on = c.schema.typeNamed(sel.TypeCondition.Name.Value)
+				}
+				if sub, err = c.selectionSet(on, sel.SelectionSet, visited); err != nil {
+					return cost{}, err
+				}
+			case *ast.FragmentSpread:
+				name := sel.Name.Value
+				if visited[name] {
+					continue
+				}
+				visited[name] = true
+				if sub, err = c.fragment(name); err != nil {
+					return cost{}, err
+				}
+		}
+		total.depth = max(total.depth, sub.depth)
+		total.complexity = saturate(int64(total.complexity) + int64(sub.complexity))
+	}
+	return total, nil
+}
+
+func (c *coster) fragment(name string) (cost, error) {
+	if known, ok := c.costs[name]; ok {
+		if known == nil {
+			return cost{}, nil
+		}
+		return *known, nil
+	}
+	f, ok := c.fragments[name]
+	if !ok {
+		return cost{}, nil
+	}
+	c.costs[name] = nil
+	fc, err := c.selectionSet(c.schema.typeNamed(f.TypeCondition.Name.Value), f.SelectionSet, make(map[string]bool))
+	if err != nil {
+		return cost{}, err
+	}
+	c.costs[name] = &fc
+	return fc, nil
+}
+
+func (c *coster) typeOf(def *fieldDef) *typeDef {
+	if def == nil {
+		return nil
+	}
+	return c.schema.typeNamed(graphql.GetNamed(def.typ).String())
+}
+
+// items returns how many items field returns at most, from the argument
+// that bounds it, its default or the default of the variable given for it.
+func (c *coster) items(field *ast.Field, def *fieldDef) int {
+	if def == nil || def.itemsArg == "" {
+		return 1
+	}
+	n, _ := def.arg(def.itemsArg).def.(int)
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != def.itemsArg {
+			continue
+		}
+		value := arg.Value
+		if v, ok := value.(*ast.Variable); ok {
+			if given, ok := c.vars[v.Name.Value]; ok {
+				if given != nil {
+					n = intValue(given)
+				}
+				break
+			}
+			value = c.defaults[v.Name.Value]
+		}
+		if v, ok := value.(*ast.IntValue); ok {
+			n = intValue(v.Value)
+		}
+	}
+	return max(n, 0)
+}
+
+// intValue converts an Int variable or literal. Values that are no Int
+// are rejected when the query runs, so they count as no items.
+func intValue(v any) int {
+	switch v := v.(type) {
+		case int64:
+			if v >= math.MinInt32 && v <= math.MaxInt32 {
+				return int(v)
+			}
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 32); err == nil {
+				return int(n)
+			}
+	}
+	return 0
+}
+
+// selections counts the fields and fragments selected in doc as written,
+// without expanding fragments. It stops counting past limit.
+func selections(doc *ast.Document, limit int) int {
+	n := 0
+	var count func(set *ast.SelectionSet)
+	count = func(set *ast.SelectionSet) {
+		if set == nil {
+			return
+		}
+		for _, sel := range set.Selections {
+			if n++; n > limit {
+				return
+			}
+			count(sel.GetSelectionSet())
+		}
+	}
+	for _, def := range doc.Definitions {
+		if def, ok := def.(ast.Definition); ok {
+			count(def.GetSelectionSet())
+		}
+	}
+	return n
+}
+
+// saturate caps a cost at the largest Int, so a query cannot wrap around
+// the limits.
+func saturate(n int64) int {
+	return int(min(n, math.MaxInt32))
+}
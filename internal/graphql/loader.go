@@ -0,0 +1,58 @@
+package graphql
+
+import "context"
+
+// loader batches lookups by key within one request. load queues a key and
+// returns a thunk; the first thunk called fetches every queued key in a
+// single call, and later loads of a fetched key are served from the cache.
+// The executor resolves every field of a level before it calls the
+// level's thunks, so all keys of a level are loaded in one batch. It runs
+// a request on a single goroutine, so a loader needs no locking.
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+	queued []K
+	pending map[K]bool
+	results map[K]V
+	errs map[K]error
+}
+
+func newLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, pending: make(map[K]bool), results: make(map[K]V), errs: make(map[K]error)}
+}
+
+// load returns a thunk for the value of key. Keys without a value give the
+// zero value of V. The executor only treats a value as a thunk if it has
+// exactly the type func() (any, error), so the type is not named.
+func (l *loader[K, V]) load(ctx context.Context, key K) func() (any, error) {
+	_, done := l.results[key]
+	_, failed := l.errs[key]
+	if !done && !failed && !l.pending[key] {
+		l.queued = append(l.queued, key)
+		l.pending[key] = true
+	}
+
+	return func() (any, error) {
+		if len(l.queued) > 0 {
+			l.dispatch(ctx)
+		}
+		if err, ok := l.errs[key]; ok {
+			return nil, err
+		}
+		return l.results[key], nil
+	}
+}
+
+func (l *loader[K, V]) dispatch(ctx context.Context) {
+	keys := l.queued
+	l.queued = nil
+	clear(l.pending)
+
+	values, err := l.fetch(ctx, keys)
+	for _, k := range keys {
+		if err != nil {
+			l.errs[k] = err
+		} else {
+			l.results[k] = values[k]
+		}
+	}
+}
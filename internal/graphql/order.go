@@ -0,0 +1,95 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// object is a result object. It keeps its fields in the order they were
+// selected, as the specification requires; the executor returns maps.
+type object struct {
+	keys []string
+	values map[string]any
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// ordered returns v with the fields of its objects in the order sets
+// select them. Fields left out by @skip or @include are not in v and are
+// passed over.
+func ordered(v any, sets []*ast.SelectionSet, fragments map[string]*ast.FragmentDefinition) any {
+	switch v := v.(type) {
+		case map[string]any:
+			var keys []string
+			fields := make(map[string][]*ast.SelectionSet)
+			visited := make(map[string]bool)
+			var collect func(set *ast.SelectionSet)
+			collect = func(set *ast.SelectionSet) {
+				if set == nil {
+					return
+				}
+				for _, sel := range set.Selections {
+					switch sel := sel.(type) {
+						case *ast.Field:
+							key := sel.Name.Value
+							if sel.Alias != nil {
+								key = sel.Alias.Value
+							}
+							if _, ok := v[key]; !ok {
+								continue
+							}
+							if _, ok := fields[key]; !ok {
+								keys = append(keys, key)
+							}
+							fields[key] = append(fields[key], sel.SelectionSet)
+						case *ast.InlineFragment:
+							collect(sel.SelectionSet)
+						case *ast.FragmentSpread:
+							if f, ok := fragments[sel.Name.Value]; ok && !visited[sel.Name.Value] {
+								visited[sel.Name.Value] = true
+								collect(f.SelectionSet)
+							}
+					}
+				}
+			}
+			for _, set := range sets {
+				collect(set)
+			}
+
+			o := &object{keys: keys, values: make(map[string]any, len(keys))}
+			for _, key := range keys {
+				o.values[key] = ordered(v[key], fields[key], fragments)
+			}
+			return o
+		case []any:
+			items := make([]any, len(v))
+			for i, item := range v {
+				items[i] = ordered(item, sets, fragments)
+			}
+			return items
+	}
+	return v
+}
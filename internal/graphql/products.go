@@ -0,0 +1,372 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize = 100
+	defaultHistory = 10
+	maxHistory = 100
+)
+
+type ProductService interface {
+	FindProducts(ctx context.Context, filter service.ProductFilter, after string, limit int) ([]model.Product, error)
+	ProductsByIDs(ctx context.Context, ids []string) ([]model.Product, error)
+	ProductHistory(ctx context.Context, ids []string, limit int) (map[string][]service.ProductEvent, error)
+	CreateProduct(ctx context.Context, name string, price int64) (string, error)
+	PatchProduct(ctx context.Context, id string, name *string, price *int64) (*model.Product, error)
+	DeleteProduct(ctx context.Context, id string) error
+}
+
+// productConnection is a page of products.
+type productConnection struct {
+	nodes []model.Product
+	endCursor string
+	hasNextPage bool
+}
+
+// loaders are the dataloaders of one request. Products are looked up by
+// ID and histories by product, one loader per history length.
+type loaders struct {
+	svc ProductService
+	products *loader[string, *model.Product]
+	history map[int]*loader[string, []service.ProductEvent]
+}
+
+type loadersKey struct{}
+
+func newLoaders(svc ProductService) *loaders {
+	return &loaders{
+		svc: svc,
+		products: newLoader(func(ctx context.Context, ids []string) (map[string]*model.Product, error) {
+			products, err := svc.ProductsByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[string]*model.Product, len(products))
+			for i := range products {
+				byID[products[i].ID] = &products[i]
+			}
+			return byID, nil
+		}),
+		history: make(map[int]*loader[string, []service.ProductEvent]),
+	}
+}
+
+func (l *loaders) historyOf(last int) *loader[string, []service.ProductEvent] {
+	h, ok := l.history[last]
+	if !ok {
+		h = newLoader(func(ctx context.Context, ids []string) (map[string][]service.ProductEvent, error) {
+			return l.svc.ProductHistory(ctx, ids, last)
+		})
+		l.history[last] = h
+	}
+	return h
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// NewSchema returns the product schema, resolved against svc.
+func NewSchema(svc ProductService) *Schema {
+	changeType := newEnum("ChangeType", "The kind of a product change.",
+		enumValue{"CREATED", service.EventCreated},
+		enumValue{"UPDATED", service.EventUpdated},
+		enumValue{"DELETED", service.EventDeleted},
+	)
+
+	product := newObject("Product", "A product of the marketplace. Prices are in cents.")
+	change := newObject("ProductChange", "A change of a product, with the product as it was after the change. Deletions carry the product as it was last stored.")
+	product.fields = []*fieldDef{
+		{name: "id", typ: graphql.NewNonNull(graphql.ID), resolve: productField(func(p model.Product) any { return p.ID })},
+		{name: "name", typ: graphql.NewNonNull(graphql.String), resolve: productField(func(p model.Product) any { return p.Name })},
+		{name: "price", typ: graphql.NewNonNull(graphql.Int), resolve: productField(func(p model.Product) any { return p.Price })},
+		{
+			name: "history",
+			description: "The latest retained changes of the product, newest first.",
+			typ: graphql.NewList(graphql.NewNonNull(change.object())),
+			args: []*argDef{{name: "last", typ: graphql.Int, def: defaultHistory}},
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				last, err := count(args, "last", maxHistory)
+				if err != nil {
+					return nil, err
+				}
+				return loadersFrom(ctx).historyOf(last).load(ctx, asProduct(source).ID), nil
+			},
+			itemsArg: "last",
+		},
+	}
+	change.fields = []*fieldDef{
+		{name: "id", typ: graphql.NewNonNull(graphql.ID), resolve: changeField(func(e service.ProductEvent) any { return strconv.FormatInt(e.ID, 10) })},
+		{name: "type", typ: graphql.NewNonNull(changeType.typ), resolve: changeField(func(e service.ProductEvent) any { return e.Type })},
+		{name: "name", typ: graphql.NewNonNull(graphql.String), resolve: changeField(func(e service.ProductEvent) any { return e.Product.Name })},
+		{name: "price", typ: graphql.NewNonNull(graphql.Int), resolve: changeField(func(e service.ProductEvent) any { return e.Product.Price })},
+		{
+			name: "product",
+			description: "The product as it is now, or null if it has been deleted.",
+			typ: product.object(),
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				return loadersFrom(ctx).products.load(ctx, source.(service.ProductEvent).Product.ID), nil
+			},
+		},
+	}
+
+	pageInfo := newObject("PageInfo", "")
+	pageInfo.fields = []*fieldDef{
+		{
+			name: "endCursor",
+			description: "Pass as after to get the next page. Null on an empty page.",
+			typ: graphql.String,
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				if c := source.(*productConnection).endCursor; c != "" {
+					return c, nil
+				}
+				return nil, nil
+			},
+		},
+		{
+			name: "hasNextPage",
+			typ: graphql.NewNonNull(graphql.Boolean),
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				return source.(*productConnection).hasNextPage, nil
+			},
+		},
+	}
+	connection := newObject("ProductConnection", "A page of products in ID order.")
+	connection.fields = []*fieldDef{
+		{
+			name: "nodes",
+			typ: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(product.object()))),
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				return source.(*productConnection).nodes, nil
+			},
+		},
+		{
+			name: "pageInfo",
+			typ: graphql.NewNonNull(pageInfo.object()),
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				return source, nil
+			},
+		},
+	}
+
+	filter := newInput("ProductFilter", "Selects products. Fields that are not set do not filter.",
+		&argDef{name: "nameContains", description: "Matches names containing it, ignoring case.", typ: graphql.String},
+		&argDef{name: "minPrice", typ: graphql.Int},
+		&argDef{name: "maxPrice", typ: graphql.Int},
+	)
+	createInput := newInput("CreateProductInput", "",
+		&argDef{name: "name", typ: graphql.NewNonNull(graphql.String)},
+		&argDef{name: "price", typ: graphql.NewNonNull(graphql.Int)},
+	)
+	updateInput := newInput("UpdateProductInput", "The fields to change. At least one must be set.",
+		&argDef{name: "name", typ: graphql.String},
+		&argDef{name: "price", typ: graphql.Int},
+	)
+
+	query := newObject("Query", "")
+	query.fields = []*fieldDef{
+		{
+			name: "product",
+			description: "The product with the ID, or null if there is none.",
+			typ: product.object(),
+			args: []*argDef{{name: "id", typ: graphql.NewNonNull(graphql.ID)}},
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				return loadersFrom(ctx).products.load(ctx, args["id"].(string)), nil
+			},
+		},
+		{
+			name: "products",
+			description: "Products in ID order, a page at a time.",
+			typ: connection.object(),
+			args: []*argDef{
+				{name: "filter", typ: filter.input()},
+				{name: "first", typ: graphql.Int, def: defaultPageSize},
+				{name: "after", description: "The endCursor of the previous page.", typ: graphql.String},
+			},
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				return findProducts(ctx, svc, args)
+			},
+			itemsArg: "first",
+		},
+	}
+
+	mutation := newObject("Mutation", "")
+	mutation.fields = []*fieldDef{
+		{
+			name: "createProduct",
+			typ: product.object(),
+			args: []*argDef{{name: "input", typ: graphql.NewNonNull(createInput.input())}},
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				input := args["input"].(map[string]any)
+				name, _ := input["name"].(string)
+				price := int64(intArg(input, "price"))
+				var v violations
+				v.product("/input", model.ValidateProduct(name, price))
+				if err := v.err(); err != nil {
+					return nil, err
+				}
+				id, err := svc.CreateProduct(ctx, name, price)
+				if err != nil {
+					return nil, err
+				}
+				return model.Product{ID: id, Name: name, Price: price}, nil
+			},
+		},
+		{
+			name: "updateProduct",
+			description: "Changes the fields set in input and returns the product with all of its fields.",
+			typ: product.object(),
+			args: []*argDef{
+				{name: "id", typ: graphql.NewNonNull(graphql.ID)},
+				{name: "input", typ: graphql.NewNonNull(updateInput.input())},
+			},
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				input := args["input"].(map[string]any)
+				var v violations
+				var name *string
+				var price *int64
+				if n, ok := input["name"].(string); ok {
+					v.product("/input", model.ValidateName(n))
+					name = &n
+				}
+				if _, ok := input["price"]; ok {
+					p := int64(intArg(input, "price"))
+					v.product("/input", model.ValidatePrice(p))
+					price = &p
+				}
+				if name == nil && price == nil {
+					v.add("/input", "min_properties", "must set name or price")
+				}
+				if err := v.err(); err != nil {
+					return nil, err
+				}
+				p, err := svc.PatchProduct(ctx, args["id"].(string), name, price)
+				if err != nil {
+					return nil, err
+				}
+				return *p, nil
+			},
+		},
+		{
+			name: "deleteProduct",
+			description: "Deletes the product and returns its ID.",
+			typ: graphql.ID,
+			args: []*argDef{{name: "id", typ: graphql.NewNonNull(graphql.ID)}},
+			resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				id := args["id"].(string)
+				if err := svc.DeleteProduct(ctx, id); err != nil {
+					return nil, err
+				}
+				return id, nil
+			},
+		},
+	}
+
+	return newSchema(query, mutation, []*typeDef{query, mutation, product, change, changeType, connection, pageInfo, filter, createInput, updateInput},
+		func(ctx context.Context) context.Context {
+			return context.WithValue(ctx, loadersKey{}, newLoaders(svc))
+		})
+}
+
+func productField(get func(model.Product) any) resolveFunc {
+	return func(ctx context.Context, source any, args map[string]any) (any, error) {
+		return get(asProduct(source)), nil
+	}
+}
+
+// asProduct returns the product a Product is resolved from. Dataloaders
+// give pointers, the other resolvers values.
+func asProduct(source any) model.Product {
+	if p, ok := source.(*model.Product); ok {
+		return *p
+	}
+	return source.(model.Product)
+}
+
+func changeField(get func(service.ProductEvent) any) resolveFunc {
+	return func(ctx context.Context, source any, args map[string]any) (any, error) {
+		return get(source.(service.ProductEvent)), nil
+	}
+}
+
+// findProducts reads one more product than asked for, to know whether
+// there is a next page.
+func findProducts(ctx context.Context, svc ProductService, args map[string]any) (*productConnection, error) {
+	first, err := count(args, "first", maxPageSize)
+	if err != nil {
+		return nil, err
+	}
+	var filter service.ProductFilter
+	if f, ok := args["filter"].(map[string]any); ok {
+		filter.NameContains, _ = f["nameContains"].(string)
+		filter.MinPrice = int64(intArg(f, "minPrice"))
+		filter.MaxPrice = int64(intArg(f, "maxPrice"))
+	}
+	after, _ := args["after"].(string)
+
+	products, err := svc.FindProducts(ctx, filter, after, first+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &productConnection{nodes: products}
+	if len(products) > first {
+		page.nodes, page.hasNextPage = products[:first], true
+	}
+	if len(page.nodes) > 0 {
+		page.endCursor = page.nodes[len(page.nodes)-1].ID
+	}
+	return page, nil
+}
+
+// intArg returns an Int argument, or 0 if it is null.
+func intArg(args map[string]any, name string) int {
+	n, _ := args[name].(int)
+	return n
+}
+
+// count returns an Int argument that counts items, between 1 and limit.
+func count(args map[string]any, name string, limit int) (int, error) {
+	n := intArg(args, name)
+	var v violations
+	if n < 1 {
+		v.add("/"+name, "minimum", "must be at least 1")
+	} else if n > limit {
+		v.add("/"+name, "maximum", fmt.Sprintf("must be at most %d", limit))
+	}
+	return n, v.err()
+}
+
+// violations collects invalid input fields, so a mutation is rejected with
+// all of its problems at once. The rules are those of the HTTP API.
+type violations []problem.Violation
+
+func (v *violations) add(pointer, rule, message string) {
+	*v = append(*v, problem.Violation{Pointer: pointer, Rule: rule, Message: message})
+}
+
+// product adds the violations of product fields below the input object at
+// pointer.
+func (v *violations) product(pointer string, violations []model.Violation) {
+	for _, violation := range violations {
+		v.add(pointer+"/"+violation.Field, violation.Rule, violation.Message)
+	}
+}
+
+func (v violations) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return &inputError{violations: v}
+}
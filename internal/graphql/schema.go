@@ -0,0 +1,311 @@
+// Package graphql serves products over GraphQL. Documents are parsed,
+// validated and run by github.com/graphql-go/graphql; this package holds
+// the schema with its resolvers and dataloaders, and checks what a query
+// costs before it is run. The schema is also published as SDL.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// maxQueryLength is the longest query document accepted and
+// maxSelections the most fields and fragments it may select, as written.
+// Validation takes time with the square of the fields selected together,
+// so documents are bounded before it starts.
+const (
+	maxQueryLength = 16 << 10
+	maxSelections = 250
+	// maxErrors is the most validation errors reported, as in graphql-js.
+	maxErrors = 100
+)
+
+// Location is a position in the query document, counted from 1.
+type Location struct {
+	Line int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is a GraphQL error as sent in the errors of a response.
+type Error struct {
+	Message string `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	// Path is the response path of the field that failed, made of field
+	// names and list indexes.
+	Path []any `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Request is a GraphQL request. Numbers in Variables are best decoded with
+// json.Decoder.UseNumber, so large integers are not rounded.
+type Request struct {
+	Query string `json:"query"`
+	OperationName string `json:"operationName"`
+	Variables map[string]any `json:"variables"`
+}
+
+// Response is the result of a request. Data is left out if the request
+// failed before execution started.
+type Response struct {
+	Data any `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// Limits bound the cost of a query before it is run. Depth counts nested
+// fields; complexity counts every field that may be resolved, with the
+// fields below a list multiplied by the most items the list returns.
+type Limits struct {
+	MaxDepth int
+	MaxComplexity int
+	// QueryOnly rejects mutations, for requests that must be safe.
+	QueryOnly bool
+}
+
+// Schema is an executable GraphQL schema.
+type Schema struct {
+	schema graphql.Schema
+	query *typeDef
+	mutation *typeDef
+	// types are the named types other than the built-in scalars, in the
+	// order they are printed.
+	types []*typeDef
+	// prepare returns the context a request is run with, such as one
+	// carrying the request's dataloaders.
+	prepare func(ctx context.Context) context.Context
+}
+
+// newSchema builds the executable schema of the types. The schema is
+// fixed at compile time, so an invalid one is a programming error.
+func newSchema(query, mutation *typeDef, types []*typeDef, prepare func(ctx context.Context) context.Context) *Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query.object(), Mutation: mutation.object()})
+	if err != nil {
+		panic(fmt.Sprintf("graphql: invalid schema: %v", err))
+	}
+	return &Schema{schema: schema, query: query, mutation: mutation, types: types, prepare: prepare}
+}
+
+// typeNamed returns the described type called name, or nil.
+func (s *Schema) typeNamed(name string) *typeDef {
+	for _, t := range s.types {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Execute runs req against the schema. Errors are reported in the
+// response; a request is only refused without data if it is invalid or
+// exceeds limits.
+func (s *Schema) Execute(ctx context.Context, req Request, limits Limits) *Response {
+	if len(req.Query) > maxQueryLength {
+		return failed(codeQueryTooLarge, &Error{Message: fmt.Sprintf("The query is %d bytes long, more than the %d allowed.", len(req.Query), maxQueryLength)})
+	}
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+		Options: parser.ParseOptions{NoSource: true},
+	})
+	if err != nil {
+		return failed(codeSyntaxError, lines(nil).convert(gqlerrors.FormatError(err)))
+	}
+	l := newLines(req.Query)
+	if selections(doc, maxSelections) > maxSelections {
+		return failed(codeQueryTooLarge, &Error{Message: fmt.Sprintf("The query has more than the %d selections allowed.", maxSelections)})
+	}
+	if err := ctx.Err(); err != nil {
+		return &Response{Errors: []*Error{l.requestError(err)}}
+	}
+	if errs := validate(&s.schema, l, req.Query, doc); len(errs) > 0 {
+		return failed(codeValidationFailed, errs...)
+	}
+
+	op, gerr := selectOperation(doc, req.OperationName)
+	if gerr != nil {
+		return failed(codeValidationFailed, gerr)
+	}
+	switch op.Operation {
+		case ast.OperationTypeMutation:
+			if limits.QueryOnly {
+				return failed(codeValidationFailed, l.errorAt(op, "Mutations cannot be run with this request; use POST."))
+			}
+		case ast.OperationTypeSubscription:
+			return failed(codeValidationFailed, l.errorAt(op, "Subscriptions are not supported."))
+	}
+
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[f.Name.Value] = f
+		}
+	}
+	vars, _ := variableValues(req.Variables).(map[string]any)
+	if err := checkLimits(ctx, s, l, fragments, op, vars, limits); err != nil {
+		return &Response{Errors: []*Error{err}}
+	}
+
+	res := graphql.Execute(graphql.ExecuteParams{
+		Schema: s.schema,
+		AST: doc,
+		OperationName: req.OperationName,
+		Args: vars,
+		Context: s.prepare(ctx),
+	})
+	out := &Response{}
+	if res.Data != nil {
+		out.Data = ordered(res.Data, []*ast.SelectionSet{op.SelectionSet}, fragments)
+	}
+	for _, e := range res.Errors {
+		if res.Data == nil {
+			// The request failed before any field was resolved, such as
+			// with variables of the wrong type.
+			out.Errors = append(out.Errors, l.requestError(e))
+		} else {
+			out.Errors = append(out.Errors, l.fieldError(e))
+		}
+	}
+	return out
+}
+
+// validate checks doc against the schema and returns at most maxErrors of
+// its errors. The rule that fields of the same name must merge compares
+// them in pairs, and a document that breaks it breaks it for every pair,
+// so it runs last, on a copy of doc without locations, and its errors are
+// reported without them.
+func validate(schema *graphql.Schema, l lines, query string, doc *ast.Document) []*Error {
+	bare, err := parser.Parse(parser.ParseParams{Source: query, Options: parser.ParseOptions{NoLocation: true}})
+	if err != nil {
+		return []*Error{lines(nil).convert(gqlerrors.FormatError(err))}
+	}
+	passes := []struct {
+		doc *ast.Document
+		rules []graphql.ValidationRuleFn
+	}{
+		// Merging fields also recurses without end on fragment cycles, so
+		// those are ruled out first.
+		{doc, []graphql.ValidationRuleFn{graphql.NoFragmentCyclesRule}},
+		{doc, locatedRules},
+		{bare, []graphql.ValidationRuleFn{graphql.OverlappingFieldsCanBeMergedRule}},
+	}
+	for _, pass := range passes {
+		res := graphql.ValidateDocument(schema, pass.doc, pass.rules)
+		if res.IsValid {
+			continue
+		}
+		errs := make([]*Error, min(len(res.Errors), maxErrors))
+		for i := range errs {
+			errs[i] = l.convert(res.Errors[i])
+		}
+		return errs
+	}
+	return nil
+}
+
+// locatedRules are the validation rules other than the one that fields
+// must merge.
+var locatedRules = slices.DeleteFunc(slices.Clone(graphql.SpecifiedRules), func(rule graphql.ValidationRuleFn) bool {
+	return reflect.ValueOf(rule).Pointer() == reflect.ValueOf(graphql.OverlappingFieldsCanBeMergedRule).Pointer()
+})
+
+func selectOperation(doc *ast.Document, name string) (*ast.OperationDefinition, *Error) {
+	var ops []*ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			ops = append(ops, op)
+		}
+	}
+	if name == "" {
+		if len(ops) != 1 {
+			return nil, &Error{Message: "Must provide operation name if query contains multiple operations."}
+		}
+		return ops[0], nil
+	}
+	for _, op := range ops {
+		if op.Name != nil && op.Name.Value == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("Unknown operation named %q.", name)}
+}
+
+// failed is the response to a request that cannot be run.
+func failed(code string, errs ...*Error) *Response {
+	for _, err := range errs {
+		err.Extensions = map[string]any{"code": code}
+	}
+	return &Response{Errors: errs}
+}
+
+// SDL returns the schema in the GraphQL schema definition language, for
+// clients that generate code or validate queries against it.
+func (s *Schema) SDL() string {
+	var b strings.Builder
+	for i, t := range s.types {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		writeDescription(&b, "", t.description)
+		switch t.kind {
+			case objectKind:
+				fmt.Fprintf(&b, "type %s {\n", t.name)
+				for _, f := range t.fields {
+					writeDescription(&b, "  ", f.description)
+					fmt.Fprintf(&b, "  %s%s: %s\n", f.name, sdlArgs(f.args), f.typ)
+				}
+				b.WriteString("}\n")
+			case inputKind:
+				fmt.Fprintf(&b, "input %s {\n", t.name)
+				for _, f := range t.inputFields {
+					writeDescription(&b, "  ", f.description)
+					fmt.Fprintf(&b, "  %s\n", sdlArg(f))
+				}
+				b.WriteString("}\n")
+			case enumKind:
+				fmt.Fprintf(&b, "enum %s {\n", t.name)
+				for _, v := range t.values {
+					fmt.Fprintf(&b, "  %s\n", v.name)
+				}
+				b.WriteString("}\n")
+		}
+	}
+	return b.String()
+}
+
+func writeDescription(b *strings.Builder, indent, description string) {
+	if description != "" {
+		fmt.Fprintf(b, "%s%q\n", indent, description)
+	}
+}
+
+func sdlArgs(args []*argDef) string {
+	if len(args) == 0 {
+		return ""
+	}
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = sdlArg(a)
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func sdlArg(a *argDef) string {
+	s := a.name + ": " + a.typ.String()
+	if a.def != nil {
+		def, _ := json.Marshal(a.def)
+		s += " = " + string(def)
+	}
+	return s
+}
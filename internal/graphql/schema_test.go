@@ -0,0 +1,422 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// fakeService serves products from memory and counts the calls made to
+// it, to check that nested lookups are batched.
+type fakeService struct {
+	products []model.Product
+	history map[string][]service.ProductEvent
+	err error
+	calls map[string]int
+}
+
+func newFakeService() *fakeService {
+	return &fakeService{
+		products: []model.Product{
+			{ID: "1", Name: "Coffee", Price: 499},
+			{ID: "2", Name: "Tea", Price: 299},
+			{ID: "3", Name: "Iced coffee", Price: 599},
+		},
+		history: map[string][]service.ProductEvent{
+			"1": {
+				{ID: 4, Type: service.EventUpdated, Product: model.Product{ID: "1", Name: "Coffee", Price: 499}},
+				{ID: 1, Type: service.EventCreated, Product: model.Product{ID: "1", Name: "Coffee", Price: 450}},
+			},
+			"2": {{ID: 2, Type: service.EventCreated, Product: model.Product{ID: "2", Name: "Tea", Price: 299}}},
+			"9": {
+				{ID: 6, Type: service.EventDeleted, Product: model.Product{ID: "9", Name: "Cocoa", Price: 350}},
+			},
+		},
+		calls: make(map[string]int),
+	}
+}
+
+func (f *fakeService) FindProducts(ctx context.Context, filter service.ProductFilter, after string, limit int) ([]model.Product, error) {
+	f.calls["FindProducts"]++
+	if f.err != nil {
+		return nil, f.err
+	}
+	var found []model.Product
+	for _, p := range f.products {
+		if p.ID > after && strings.Contains(strings.ToLower(p.Name), strings.ToLower(filter.NameContains)) &&
+			(filter.MinPrice == 0 || p.Price >= filter.MinPrice) && len(found) < limit {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeService) ProductsByIDs(ctx context.Context, ids []string) ([]model.Product, error) {
+	f.calls["ProductsByIDs"]++
+	var found []model.Product
+	for _, p := range f.products {
+		if slices.Contains(ids, p.ID) {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeService) ProductHistory(ctx context.Context, ids []string, limit int) (map[string][]service.ProductEvent, error) {
+	f.calls["ProductHistory"]++
+	history := make(map[string][]service.ProductEvent)
+	for _, id := range ids {
+		events := f.history[id]
+		history[id] = events[:min(limit, len(events))]
+	}
+	return history, nil
+}
+
+func (f *fakeService) CreateProduct(ctx context.Context, name string, price int64) (string, error) {
+	f.calls["CreateProduct"]++
+	for _, p := range f.products {
+		if p.Name == name {
+			return "", service.ErrProductAlreadyExists
+		}
+	}
+	f.products = append(f.products, model.Product{ID: "4", Name: name, Price: price})
+	return "4", nil
+}
+
+func (f *fakeService) PatchProduct(ctx context.Context, id string, name *string, price *int64) (*model.Product, error) {
+	f.calls["PatchProduct"]++
+	for i, p := range f.products {
+		if p.ID != id {
+			continue
+		}
+		if name != nil {
+			f.products[i].Name = *name
+		}
+		if price != nil {
+			f.products[i].Price = *price
+		}
+		return &f.products[i], nil
+	}
+	return nil, service.ErrProductNotFound
+}
+
+func (f *fakeService) DeleteProduct(ctx context.Context, id string) error {
+	f.calls["DeleteProduct"]++
+	for i, p := range f.products {
+		if p.ID == id {
+			f.products = slices.Delete(f.products, i, i+1)
+			return nil
+		}
+	}
+	return service.ErrProductNotFound
+}
+
+var testLimits = Limits{MaxDepth: 6, MaxComplexity: 500}
+
+// execute runs req and returns the response as JSON.
+func execute(t *testing.T, s *Schema, req Request, limits Limits) string {
+	t.Helper()
+	data, err := json.Marshal(s.Execute(context.Background(), req, limits))
+	if err != nil {
+		t.Fatalf("Failed to encode response: %v", err)
+	}
+	return string(data)
+}
+
+func TestSchema_Queries(t *testing.T) {
+	tests := []struct {
+		name string
+		req Request
+		want string
+	}{
+		{
+			name: "product by id",
+			req: Request{Query: `{ product(id: "2") { id name price } }`},
+			want: `{"data":{"product":{"id":"2","name":"Tea","price":299}}}`,
+		},
+		{
+			name: "missing product",
+			req: Request{Query: `{ product(id: "42") { id } }`},
+			want: `{"data":{"product":null}}`,
+		},
+		{
+			name: "aliases, typename and variables",
+			req: Request{
+				Query: `query Two($a: ID!, $b: ID = "3") { a: product(id: $a) { __typename name } b: product(id: $b) { name } }`,
+				Variables: map[string]any{"a": "1"},
+			},
+			want: `{"data":{"a":{"__typename":"Product","name":"Coffee"},"b":{"name":"Iced coffee"}}}`,
+		},
+		{
+			name: "filter and pagination",
+			req: Request{Query: `{ products(first: 1, filter: {nameContains: "coffee"}) { nodes { id } pageInfo { endCursor hasNextPage } } }`},
+			want: `{"data":{"products":{"nodes":[{"id":"1"}],"pageInfo":{"endCursor":"1","hasNextPage":true}}}}`,
+		},
+		{
+			name: "last page",
+			req: Request{Query: `{ products(after: "1", filter: {nameContains: "coffee"}) { nodes { id } pageInfo { hasNextPage } } }`},
+			want: `{"data":{"products":{"nodes":[{"id":"3"}],"pageInfo":{"hasNextPage":false}}}}`,
+		},
+		{
+			name: "fragments and directives",
+			req: Request{
+				Query: `query ($full: Boolean!) { product(id: "1") { ...Basic ... @include(if: $full) { price } name @skip(if: true) } }
+					fragment Basic on Product { id }`,
+				Variables: map[string]any{"full": true},
+			},
+			want: `{"data":{"product":{"id":"1","price":499}}}`,
+		},
+		{
+			name: "history with current product",
+			req: Request{Query: `{ product(id: "1") { history(last: 1) { id type price product { price } } } }`},
+			want: `{"data":{"product":{"history":[{"id":"4","type":"UPDATED","price":499,"product":{"price":499}}]}}}`,
+		},
+		{
+			name: "selected operation",
+			req: Request{Query: `query A { product(id: "1") { id } } query B { product(id: "2") { id } }`, OperationName: "B"},
+			want: `{"data":{"product":{"id":"2"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execute(t, NewSchema(newFakeService()), tt.req, testLimits); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSchema_BatchesNestedLookups(t *testing.T) {
+	svc := newFakeService()
+	s := NewSchema(svc)
+
+	got := execute(t, s, Request{Query: `{
+		products { nodes { id history { type product { name history(last: 1) { id } } } } }
+		deleted: product(id: "9") { id }
+	}`}, Limits{})
+	if strings.Contains(got, `"errors"`) {
+		t.Fatalf("Unexpected errors: %s", got)
+	}
+
+	// One history lookup per history length, and one product lookup per
+	// level, however many products there are.
+	want := map[string]int{"FindProducts": 1, "ProductHistory": 2, "ProductsByIDs": 2}
+	for name, n := range want {
+		if svc.calls[name] != n {
+			t.Errorf("Expected %d %s calls, got %d", n, name, svc.calls[name])
+		}
+	}
+}
+
+func TestSchema_Mutations(t *testing.T) {
+	svc := newFakeService()
+	s := NewSchema(svc)
+
+	got := execute(t, s, Request{
+		Query: `mutation ($input: CreateProductInput!) {
+			created: createProduct(input: $input) { id name price }
+			updated: updateProduct(id: "4", input: {price: 250}) { id name price }
+			deleted: deleteProduct(id: "4")
+		}`,
+		Variables: map[string]any{"input": map[string]any{"name": "Cocoa", "price": json.Number("199")}},
+	}, testLimits)
+	want := `{"data":{"created":{"id":"4","name":"Cocoa","price":199},"updated":{"id":"4","name":"Cocoa","price":250},"deleted":"4"}}`
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	got = execute(t, s, Request{Query: `{ product(id: "4") { id } }`}, Limits{QueryOnly: true})
+	if want := `{"data":{"product":null}}`; got != want {
+		t.Errorf("Expected the product deleted, got %s", got)
+	}
+}
+
+func TestSchema_FieldErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		query string
+		want string
+	}{
+		{
+			name: "invalid input",
+			query: `mutation { createProduct(input: {name: "<b>", price: 0}) { id } }`,
+			want: `{"data":{"createProduct":null},"errors":[{"message":"the input has invalid fields","locations":[{"line":1,"column":12}],"path":["createProduct"],"extensions":{"code":"validation_failed","violations":[{"pointer":"/input/name","rule":"pattern","message":"may only contain letters, digits, spaces and -_.,\u0026'()/+#%!:"},{"pointer":"/input/price","rule":"minimum","message":"must be greater than 0"}]}}]}`,
+		},
+		{
+			name: "empty update",
+			query: `mutation { updateProduct(id: "1", input: {}) { id } }`,
+			want: `{"data":{"updateProduct":null},"errors":[{"message":"the input has invalid fields","locations":[{"line":1,"column":12}],"path":["updateProduct"],"extensions":{"code":"validation_failed","violations":[{"pointer":"/input","rule":"min_properties","message":"must set name or price"}]}}]}`,
+		},
+		{
+			name: "duplicate",
+			query: `mutation { createProduct(input: {name: "Tea", price: 5}) { id } }`,
+			want: `{"data":{"createProduct":null},"errors":[{"message":"product already exists","locations":[{"line":1,"column":12}],"path":["createProduct"],"extensions":{"code":"product_already_exists"}}]}`,
+		},
+		{
+			name: "missing product",
+			query: `mutation { deleteProduct(id: "42") }`,
+			want: `{"data":{"deleteProduct":null},"errors":[{"message":"product not found","locations":[{"line":1,"column":12}],"path":["deleteProduct"],"extensions":{"code":"product_not_found"}}]}`,
+		},
+		{
+			name: "page too large",
+			query: `{ products(first: 101) { nodes { id } } }`,
+			want: `{"data":{"products":null},"errors":[{"message":"the input has invalid fields","locations":[{"line":1,"column":3}],"path":["products"],"extensions":{"code":"validation_failed","violations":[{"pointer":"/first","rule":"maximum","message":"must be at most 100"}]}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execute(t, NewSchema(newFakeService()), Request{Query: tt.query}, testLimits); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	svc := newFakeService()
+	svc.err = service.ErrOverloaded
+	got := execute(t, NewSchema(svc), Request{Query: `{ a: products { nodes { id } } b: product(id: "1") { id } }`}, testLimits)
+	want := `{"data":{"a":null,"b":{"id":"1"}},"errors":[{"message":"service overloaded","locations":[{"line":1,"column":3}],"path":["a"],"extensions":{"code":"overloaded"}}]}`
+	if got != want {
+		t.Errorf("Expected the failed field null and the others resolved, got %s", got)
+	}
+}
+
+func TestSchema_RequestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		req Request
+		limits Limits
+		code string
+		message string
+	}{
+		{"syntax", Request{Query: `{ product(id: "1") { id }`}, testLimits, "syntax_error", "Syntax Error GraphQL request (1:26) Expected Name, found EOF"},
+		{"unknown field", Request{Query: `{ product(id: "1") { sku } }`}, testLimits, "validation_failed", `Cannot query field "sku" on type "Product".`},
+		{"missing argument", Request{Query: `{ product { id } }`}, testLimits, "validation_failed", `argument "id" of type "ID!" is required but not provided`},
+		{"wrong argument type", Request{Query: `{ products(first: "ten") { nodes { id } } }`}, testLimits, "validation_failed", `Argument "first" has invalid value "ten".`},
+		{"missing selection", Request{Query: `{ product(id: "1") }`}, testLimits, "validation_failed", "must have a sub selection"},
+		{"selection on scalar", Request{Query: `{ product(id: "1") { id { x } } }`}, testLimits, "validation_failed", "must not have a sub selection"},
+		{"missing variable", Request{Query: `query ($id: ID!) { product(id: $id) { id } }`}, testLimits, "validation_failed", `Variable "$id" of required type "ID!" was not provided.`},
+		{"invalid variable", Request{Query: `query ($n: Int) { products(first: $n) { nodes { id } } }`, Variables: map[string]any{"n": "x"}}, testLimits, "validation_failed", `Variable "$n" got invalid value "x".`},
+		{"undefined variable", Request{Query: `{ product(id: $id) { id } }`}, testLimits, "validation_failed", `Variable "$id" is not defined.`},
+		{"fragment cycle", Request{Query: `{ product(id: "1") { ...A } } fragment A on Product { ...A }`}, testLimits, "validation_failed", `Cannot spread fragment "A" within itself.`},
+		{"several operations", Request{Query: `query A { product(id: "1") { id } } query B { product(id: "2") { id } }`}, testLimits, "validation_failed", "Must provide operation name"},
+		{"subscription", Request{Query: `subscription { product(id: "1") { id } }`}, testLimits, "validation_failed", "Subscriptions are not supported."},
+		{"mutation over get", Request{Query: `mutation { deleteProduct(id: "1") }`}, Limits{QueryOnly: true}, "validation_failed", "Mutations cannot be run"},
+		{"too long", Request{Query: `{ product(id: "1") { id } }` + strings.Repeat(" ", maxQueryLength)}, testLimits, "query_too_large", "more than the 16384 allowed"},
+		{
+			"too many selections",
+			Request{Query: `{ product(id: "1") { ` + strings.Repeat("id ", maxSelections) + `} }`},
+			testLimits, "query_too_large", "more than the 250 selections allowed",
+		},
+		{
+			"too deep",
+			Request{Query: `{ product(id: "1") { history { product { history { product { history { id } } } } } } }`},
+			testLimits, "query_too_deep", "The query has a depth of 7, more than the 6 allowed.",
+		},
+		{
+			"too complex",
+			Request{Query: `{ products(first: 100) { nodes { history(last: 100) { id } } } }`},
+			testLimits, "query_too_complex", "The query has a complexity of 10201, more than the 500 allowed.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newFakeService()
+			res := NewSchema(svc).Execute(context.Background(), tt.req, tt.limits)
+			if res.Data != nil {
+				t.Errorf("Expected no data, got %v", res.Data)
+			}
+			if len(res.Errors) != 1 {
+				t.Fatalf("Expected one error, got %v", res.Errors)
+			}
+			if code := res.Errors[0].Extensions["code"]; code != tt.code {
+				t.Errorf("Expected code %s, got %v", tt.code, code)
+			}
+			if !strings.Contains(res.Errors[0].Message, tt.message) {
+				t.Errorf("Expected message containing %q, got %q", tt.message, res.Errors[0].Message)
+			}
+			if len(svc.calls) != 0 {
+				t.Errorf("Expected nothing resolved, got calls %v", svc.calls)
+			}
+		})
+	}
+}
+
+func TestSchema_NullPropagation(t *testing.T) {
+	svc := newFakeService()
+	// A price outside the 32 bits of Int cannot be serialized, so the
+	// non-null price is null and so is the closest nullable field.
+	svc.products[1].Price = 1 << 40
+
+	got := execute(t, NewSchema(svc), Request{Query: `{ products { nodes { id price } } product(id: "1") { price } }`}, testLimits)
+	want := `{"data":{"products":null,"product":{"price":499}},"errors":[{"message":"internal error","locations":[{"line":1,"column":25}],"path":["products","nodes",1,"price"],"extensions":{"code":"internal_error"}}]}`
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+// TestSchema_FragmentSpreads checks that fragments spreading each other
+// twice at every level are costed and run as written, not expanded into
+// the 2^n spreads they stand for.
+func TestSchema_FragmentSpreads(t *testing.T) {
+	const n = 40
+	var b strings.Builder
+	fmt.Fprintf(&b, `{ product(id: "1") { ...F%d } products(first: 100) { nodes { ...F%d } } }`, n, n)
+	b.WriteString("\nfragment F0 on Product { name id }\n")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "fragment F%d on Product { ...F%d ...F%d }\n", i, i-1, i-1)
+	}
+
+	svc := newFakeService()
+	res := NewSchema(svc).Execute(context.Background(), Request{Query: b.String()}, Limits{MaxDepth: 6, MaxComplexity: 100})
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "query_too_complex" {
+		t.Fatalf("Expected the query to be too complex, got %+v", res.Errors)
+	}
+	// The product costs 1 and its fields 2; the page costs 1, its nodes 1
+	// and every one of its 100 products the same 2.
+	if c := res.Errors[0].Extensions["complexity"]; c != 3 + 1 + 100 * (1 + 2) {
+		t.Errorf("Expected a complexity of 305, got %v", c)
+	}
+
+	got := execute(t, NewSchema(svc), Request{Query: b.String()}, Limits{MaxDepth: 6, MaxComplexity: 1000})
+	want := `{"data":{"product":{"name":"Coffee","id":"1"},"products":{"nodes":[{"name":"Coffee","id":"1"},{"name":"Tea","id":"2"},{"name":"Iced coffee","id":"3"}]}}}`
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestSchema_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	svc := newFakeService()
+	res := NewSchema(svc).Execute(ctx, Request{Query: `{ product(id: "1") { id } }`}, testLimits)
+	if res.Data != nil || len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "canceled" {
+		t.Errorf("Expected the request to be canceled, got %+v", res)
+	}
+	if len(svc.calls) != 0 {
+		t.Errorf("Expected nothing resolved, got calls %v", svc.calls)
+	}
+}
+
+func TestSchema_SDL(t *testing.T) {
+	sdl := NewSchema(newFakeService()).SDL()
+	for _, want := range []string{
+		"type Query {\n",
+		"  product(id: ID!): Product\n",
+		"  products(filter: ProductFilter, first: Int = 20, after: String): ProductConnection\n",
+		"  history(last: Int = 10): [ProductChange!]\n",
+		"  createProduct(input: CreateProductInput!): Product\n",
+		"enum ChangeType {\n  CREATED\n  UPDATED\n  DELETED\n}\n",
+		"input UpdateProductInput {\n  name: String\n  price: Int\n}\n",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("Expected the SDL to contain %q, got:\n%s", want, sdl)
+		}
+	}
+}
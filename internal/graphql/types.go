@@ -0,0 +1,176 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+)
+
+type typeKind int
+
+const (
+	enumKind typeKind = iota
+	objectKind
+	inputKind
+)
+
+// typeDef describes a named type of the schema. The executable type is
+// built from it; the description also keeps the fields in schema order,
+// for the SDL, and the arguments that bound list sizes, for the
+// complexity of queries.
+type typeDef struct {
+	kind typeKind
+	name string
+	description string
+	// fields are the fields of an object type, in schema order. They may
+	// be set after the type is created, so types can refer to each other.
+	fields []*fieldDef
+	// inputFields are the fields of an input object type.
+	inputFields []*argDef
+	// values are the values of an enum type.
+	values []enumValue
+	typ graphql.Type
+}
+
+type enumValue struct {
+	name string
+	// value is the Go value the enum value stands for.
+	value any
+}
+
+type resolveFunc func(ctx context.Context, source any, args map[string]any) (any, error)
+
+type fieldDef struct {
+	name string
+	description string
+	typ graphql.Output
+	args []*argDef
+	resolve resolveFunc
+	// itemsArg names the Int argument that bounds how many items a list
+	// field returns. It multiplies the complexity of the field's
+	// selections; without one the field counts as a single item.
+	itemsArg string
+}
+
+type argDef struct {
+	name string
+	description string
+	typ graphql.Input
+	// def is the default value, if any.
+	def any
+}
+
+func newObject(name, description string) *typeDef {
+	t := &typeDef{kind: objectKind, name: name, description: description}
+	t.typ = graphql.NewObject(graphql.ObjectConfig{
+		Name: name,
+		Description: description,
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			fields := make(graphql.Fields, len(t.fields))
+			for _, f := range t.fields {
+				fields[f.name] = &graphql.Field{
+					Type: f.typ,
+					Description: f.description,
+					Args: arguments(f.args),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return f.resolve(p.Context, p.Source, p.Args)
+					},
+				}
+			}
+			return fields
+		}),
+	})
+	return t
+}
+
+func newInput(name, description string, fields ...*argDef) *typeDef {
+	config := make(graphql.InputObjectConfigFieldMap, len(fields))
+	for _, f := range fields {
+		config[f.name] = &graphql.InputObjectFieldConfig{Type: f.typ, DefaultValue: f.def, Description: f.description}
+	}
+	return &typeDef{
+		kind: inputKind,
+		name: name,
+		description: description,
+		inputFields: fields,
+		typ: graphql.NewInputObject(graphql.InputObjectConfig{Name: name, Description: description, Fields: config}),
+	}
+}
+
+func newEnum(name, description string, values ...enumValue) *typeDef {
+	config := make(graphql.EnumValueConfigMap, len(values))
+	for _, v := range values {
+		config[v.name] = &graphql.EnumValueConfig{Value: v.value}
+	}
+	return &typeDef{
+		kind: enumKind,
+		name: name,
+		description: description,
+		values: values,
+		typ: graphql.NewEnum(graphql.EnumConfig{Name: name, Description: description, Values: config}),
+	}
+}
+
+func (t *typeDef) object() *graphql.Object {
+	return t.typ.(*graphql.Object)
+}
+
+func (t *typeDef) input() *graphql.InputObject {
+	return t.typ.(*graphql.InputObject)
+}
+
+func (t *typeDef) field(name string) *fieldDef {
+	for _, f := range t.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (f *fieldDef) arg(name string) *argDef {
+	for _, a := range f.args {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+func arguments(args []*argDef) graphql.FieldConfigArgument {
+	config := make(graphql.FieldConfigArgument, len(args))
+	for _, a := range args {
+		config[a.name] = &graphql.ArgumentConfig{Type: a.typ, DefaultValue: a.def, Description: a.description}
+	}
+	return config
+}
+
+// variableValues converts the numbers of variables decoded with
+// json.Decoder.UseNumber to the integers and floats the scalars coerce.
+// Other values are kept as they are.
+func variableValues(v any) any {
+	switch v := v.(type) {
+		case json.Number:
+			if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+				return n
+			}
+			if f, err := v.Float64(); err == nil {
+				return f
+			}
+		case map[string]any:
+			values := make(map[string]any, len(v))
+			for k, item := range v {
+				values[k] = variableValues(item)
+			}
+			return values
+		case []any:
+			values := make([]any, len(v))
+			for i, item := range v {
+				values[i] = variableValues(item)
+			}
+			return values
+	}
+	return v
+}
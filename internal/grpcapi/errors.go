@@ -0,0 +1,45 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// statusCodes maps service errors to the status codes clients receive,
+// like the problem types of the HTTP API.
+var statusCodes = []struct {
+	err error
+	code codes.Code
+}{
+	{service.ErrInvalidProduct, codes.InvalidArgument},
+	{service.ErrProductNotFound, codes.NotFound},
+	{service.ErrProductAlreadyExists, codes.AlreadyExists},
+	{service.ErrOverloaded, codes.Unavailable},
+	{context.DeadlineExceeded, codes.DeadlineExceeded},
+	{context.Canceled, codes.Canceled},
+}
+
+// statusError converts err to a status error. Errors that already carry a
+// status pass through; unknown errors are logged and reported as Internal
+// without leaking the cause.
+func statusError(method string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	for _, sc := range statusCodes {
+		if errors.Is(err, sc.err) {
+			if sc.err == context.DeadlineExceeded {
+				return status.Error(sc.code, "the request did not complete in time")
+			}
+			return status.Error(sc.code, err.Error())
+		}
+	}
+	slog.Error("gRPC request failed", "method", method, "err", err)
+	return status.Error(codes.Internal, "internal error")
+}
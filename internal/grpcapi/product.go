@@ -0,0 +1,129 @@
+package grpcapi
+
+import (
+	"context"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	productv1 "github.com/v-kuu/mini-marketplace/proto/product/v1"
+)
+
+type ProductService interface {
+	ListProducts(ctx context.Context) ([]model.Product, error)
+	GetProduct(ctx context.Context, id string) (*model.Product, error)
+	CreateProduct(ctx context.Context, name string, price int64) (string, error)
+	PatchProduct(ctx context.Context, id string, name *string, price *int64) (*model.Product, error)
+	DeleteProduct(ctx context.Context, id string) error
+}
+
+// productServer implements productv1.ProductServiceServer on top of the
+// product service. Errors are converted to statuses by the interceptor.
+type productServer struct {
+	productv1.UnimplementedProductServiceServer
+	service ProductService
+}
+
+func toProto(p model.Product) *productv1.Product {
+	return &productv1.Product{Id: p.ID, Name: p.Name, Price: p.Price}
+}
+
+// violations collects invalid fields, so a request is rejected with all of
+// its problems at once, as the HTTP API does.
+type violations []*errdetails.BadRequest_FieldViolation
+
+func (v *violations) add(field, description string) {
+	*v = append(*v, &errdetails.BadRequest_FieldViolation{Field: field, Description: description})
+}
+
+// product adds the violations of product fields, named as in the proto
+// messages.
+func (v *violations) product(violations []model.Violation) {
+	for _, violation := range violations {
+		v.add(violation.Field, violation.Message)
+	}
+}
+
+// err returns an InvalidArgument status with the violations as BadRequest
+// details, or nil if there are none.
+func (v violations) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	st, err := status.New(codes.InvalidArgument, "the request has invalid fields").
+		WithDetails(&errdetails.BadRequest{FieldViolations: v})
+	if err != nil {
+		return err
+	}
+	return st.Err()
+}
+
+func (s *productServer) ListProducts(ctx context.Context, req *productv1.ListProductsRequest) (*productv1.ListProductsResponse, error) {
+	products, err := s.service.ListProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &productv1.ListProductsResponse{Products: make([]*productv1.Product, len(products))}
+	for i, p := range products {
+		res.Products[i] = toProto(p)
+	}
+	return res, nil
+}
+
+func (s *productServer) GetProduct(ctx context.Context, req *productv1.GetProductRequest) (*productv1.Product, error) {
+	p, err := s.service.GetProduct(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, service.ErrProductNotFound
+	}
+	return toProto(*p), nil
+}
+
+func (s *productServer) CreateProduct(ctx context.Context, req *productv1.CreateProductRequest) (*productv1.Product, error) {
+	var v violations
+	v.product(model.ValidateProduct(req.GetName(), req.GetPrice()))
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	id, err := s.service.CreateProduct(ctx, req.GetName(), req.GetPrice())
+	if err != nil {
+		return nil, err
+	}
+	return &productv1.Product{Id: id, Name: req.GetName(), Price: req.GetPrice()}, nil
+}
+
+func (s *productServer) UpdateProduct(ctx context.Context, req *productv1.UpdateProductRequest) (*productv1.Product, error) {
+	var v violations
+	if req.Name == nil && req.Price == nil {
+		v.add("", "at least one of name or price must be set")
+	}
+	if req.Name != nil {
+		v.product(model.ValidateName(req.GetName()))
+	}
+	if req.Price != nil {
+		v.product(model.ValidatePrice(req.GetPrice()))
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	p, err := s.service.PatchProduct(ctx, req.GetId(), req.Name, req.Price)
+	if err != nil {
+		return nil, err
+	}
+	return toProto(*p), nil
+}
+
+func (s *productServer) DeleteProduct(ctx context.Context, req *productv1.DeleteProductRequest) (*productv1.DeleteProductResponse, error) {
+	if err := s.service.DeleteProduct(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	return &productv1.DeleteProductResponse{}, nil
+}
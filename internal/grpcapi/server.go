@@ -0,0 +1,98 @@
+package grpcapi
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+	productv1 "github.com/v-kuu/mini-marketplace/proto/product/v1"
+)
+
+// Dependencies are the services the gRPC API is built on.
+type Dependencies struct {
+	Products ProductService
+	// Watcher, if set, delivers reloaded configuration to the server.
+	Watcher *config.Watcher
+}
+
+// Server serves the gRPC API with the standard health service and server
+// reflection, so tools such as grpcurl work without the proto files.
+type Server struct {
+	*grpc.Server
+	health *health.Server
+}
+
+func NewServer(cfg *config.Config, deps Dependencies) *Server {
+	var timeout atomic.Int64
+	timeout.Store(int64(time.Duration(cfg.TIMEOUT) * time.Second))
+	if deps.Watcher != nil {
+		deps.Watcher.Subscribe(func(cfg *config.Config) {
+			timeout.Store(int64(time.Duration(cfg.TIMEOUT) * time.Second))
+		})
+	}
+
+	s := &Server{
+		Server: grpc.NewServer(grpc.ChainUnaryInterceptor(metricsInterceptor, timeoutInterceptor(&timeout))),
+		health: health.NewServer(),
+	}
+	productv1.RegisterProductServiceServer(s.Server, &productServer{service: deps.Products})
+	healthpb.RegisterHealthServer(s.Server, s.health)
+	reflection.Register(s.Server)
+	s.health.SetServingStatus(productv1.ProductService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	return s
+}
+
+// Shutdown reports NOT_SERVING to health checks, so clients move to other
+// instances, and stops the server once the running calls have finished.
+// Calls still running when ctx is done are cancelled.
+func (s *Server) Shutdown(ctx context.Context) {
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.Stop()
+			<-stopped
+	}
+}
+
+// metricsInterceptor records the request metrics of every call and
+// converts the errors of the handlers to statuses, so the recorded code is
+// the one the client receives.
+func metricsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	metrics.GrpcInFlight.Inc()
+	defer metrics.GrpcInFlight.Dec()
+
+	res, err := handler(ctx, req)
+	if err != nil {
+		err = statusError(info.FullMethod, err)
+	}
+
+	metrics.GrpcRequestsTotal.WithLabelValues("POST", info.FullMethod, status.Code(err).String()).Inc()
+	metrics.GrpcRequestDuration.WithLabelValues("POST", info.FullMethod).Observe(time.Since(start).Seconds())
+	return res, err
+}
+
+// timeoutInterceptor bounds every call by TIMEOUT, like the HTTP handlers.
+// A shorter client deadline still applies.
+func timeoutInterceptor(timeout *atomic.Int64) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, cancel := context.WithTimeoutCause(ctx, time.Duration(timeout.Load()), context.DeadlineExceeded)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
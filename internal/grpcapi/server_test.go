@@ -0,0 +1,201 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/internal/testdb"
+	productv1 "github.com/v-kuu/mini-marketplace/proto/product/v1"
+)
+
+// newTestConn serves the gRPC API over an in-memory listener, backed by a
+// fresh SQLite database, and returns a client connection to it.
+func newTestConn(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+
+	db := testdb.Open(t)
+	server := NewServer(db.Config, Dependencies{Products: service.NewProductService(db.Products)})
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis) //nolint:all
+	t.Cleanup(func () { server.Shutdown(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func () { conn.Close() }) //nolint:all
+	return conn
+}
+
+func TestServer_Products(t *testing.T) {
+	client := productv1.NewProductServiceClient(newTestConn(t))
+	ctx := context.Background()
+
+	created, err := client.CreateProduct(ctx, &productv1.CreateProductRequest{Name: "Lamp", Price: 1200})
+	if err != nil {
+		t.Fatalf("CreateProduct failed: %v", err)
+	}
+	if created.GetId() == "" || created.GetName() != "Lamp" || created.GetPrice() != 1200 {
+		t.Fatalf("Unexpected created product %v", created)
+	}
+
+	got, err := client.GetProduct(ctx, &productv1.GetProductRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatalf("GetProduct failed: %v", err)
+	}
+	if !proto.Equal(got, created) {
+		t.Errorf("Expected %v, got %v", created, got)
+	}
+
+	price := int64(900)
+	updated, err := client.UpdateProduct(ctx, &productv1.UpdateProductRequest{Id: created.GetId(), Price: &price})
+	if err != nil {
+		t.Fatalf("UpdateProduct failed: %v", err)
+	}
+	if updated.GetName() != "Lamp" || updated.GetPrice() != 900 {
+		t.Errorf("Expected only the price updated, got %v", updated)
+	}
+
+	list, err := client.ListProducts(ctx, &productv1.ListProductsRequest{})
+	if err != nil {
+		t.Fatalf("ListProducts failed: %v", err)
+	}
+	if len(list.GetProducts()) != 1 || !proto.Equal(list.GetProducts()[0], updated) {
+		t.Errorf("Expected [%v], got %v", updated, list.GetProducts())
+	}
+
+	if _, err := client.DeleteProduct(ctx, &productv1.DeleteProductRequest{Id: created.GetId()}); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+	if _, err := client.GetProduct(ctx, &productv1.GetProductRequest{Id: created.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound after delete, got %v", err)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	client := productv1.NewProductServiceClient(newTestConn(t))
+	ctx := context.Background()
+
+	if _, err := client.CreateProduct(ctx, &productv1.CreateProductRequest{Name: "Lamp", Price: 1200}); err != nil {
+		t.Fatalf("CreateProduct failed: %v", err)
+	}
+	name := "Chair"
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"duplicate", func() error {
+			_, err := client.CreateProduct(ctx, &productv1.CreateProductRequest{Name: "Lamp", Price: 5})
+			return err
+		}, codes.AlreadyExists},
+		{"missing", func() error {
+			_, err := client.UpdateProduct(ctx, &productv1.UpdateProductRequest{Id: "999", Name: &name})
+			return err
+		}, codes.NotFound},
+		{"delete missing", func() error {
+			_, err := client.DeleteProduct(ctx, &productv1.DeleteProductRequest{Id: "999"})
+			return err
+		}, codes.NotFound},
+		{"empty update", func() error {
+			_, err := client.UpdateProduct(ctx, &productv1.UpdateProductRequest{Id: "1"})
+			return err
+		}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); status.Code(err) != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestServer_ValidationDetails(t *testing.T) {
+	client := productv1.NewProductServiceClient(newTestConn(t))
+
+	_, err := client.CreateProduct(context.Background(), &productv1.CreateProductRequest{Name: "<b>", Price: -1})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+
+	fields := map[string]bool{}
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				fields[v.GetField()] = true
+			}
+		}
+	}
+	if !fields["name"] || !fields["price"] {
+		t.Errorf("Expected violations for name and price, got %v", st.Details())
+	}
+}
+
+func TestServer_HealthAndReflection(t *testing.T) {
+	conn := newTestConn(t)
+	ctx := context.Background()
+
+	for _, svc := range []string{"", productv1.ProductService_ServiceDesc.ServiceName} {
+		res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: svc})
+		if err != nil {
+			t.Fatalf("Health check of %q failed: %v", svc, err)
+		}
+		if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Expected %q SERVING, got %v", svc, res.GetStatus())
+		}
+	}
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatalf("Reflection failed: %v", err)
+	}
+	if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}); err != nil {
+		t.Fatalf("Reflection request failed: %v", err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Reflection response failed: %v", err)
+	}
+	found := false
+	for _, s := range res.GetListServicesResponse().GetService() {
+		found = found || s.GetName() == productv1.ProductService_ServiceDesc.ServiceName
+	}
+	if !found {
+		t.Errorf("Expected the product service listed, got %v", res.GetListServicesResponse().GetService())
+	}
+}
+
+func TestServer_Metrics(t *testing.T) {
+	client := productv1.NewProductServiceClient(newTestConn(t))
+	method := productv1.ProductService_GetProduct_FullMethodName
+	counter := metrics.GrpcRequestsTotal.WithLabelValues("POST", method, codes.NotFound.String())
+	before := testutil.ToFloat64(counter)
+
+	if _, err := client.GetProduct(context.Background(), &productv1.GetProductRequest{Id: "999"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound, got %v", err)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("Expected the NotFound call counted once, got %v", got)
+	}
+}
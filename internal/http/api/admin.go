@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/v-kuu/mini-marketplace/internal/backup"
+)
+
+// BackupService takes and lists database backups, such as backup.Manager.
+type BackupService interface {
+	Create(ctx context.Context) (backup.Info, error)
+	List() ([]backup.Info, error)
+}
+
+// AdminHandler serves the operator routes below /admin. They are only
+// registered when an admin token is configured and require it on every
+// request.
+type AdminHandler struct {
+	backups BackupService
+}
+
+func NewAdminHandler(b BackupService) *AdminHandler {
+	return &AdminHandler{backups: b}
+}
+
+// CreateBackup godoc
+// @Summary      Back up the database
+// @Description  Writes a consistent snapshot of the database to the backup directory while requests keep being served, then removes the oldest backups beyond BACKUP_RETENTION. The snapshot is not bound by the request timeout, since copying a large database can take longer; it stops if the client goes away.
+// @Tags         admin
+// @Produce      json
+// @Security     AdminToken
+// @Success      201  {object}  backup.Info
+// @Failure      401  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Router       /admin/backups [post]
+func (h *AdminHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	info, err := h.backups.Create(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
+
+// ListBackups godoc
+// @Summary      List database backups
+// @Description  Lists the backups in the backup directory, newest first.
+// @Tags         admin
+// @Produce      json
+// @Security     AdminToken
+// @Success      200  {array}   backup.Info
+// @Failure      401  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Router       /admin/backups [get]
+func (h *AdminHandler) ListBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := h.backups.List()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(backups); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
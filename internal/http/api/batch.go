@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+const (
+	batchAtomic = "atomic"
+	batchBestEffort = "best_effort"
+
+	// maxBatchOperationBody bounds the size of one batch operation, so the
+	// body limit of a batch grows with BATCH_MAX_SIZE.
+	maxBatchOperationBody = 1 << 10
+)
+
+// batchEnvelope is a batch request whose operations are decoded one at a
+// time, so that in best-effort mode a bad operation only fails itself.
+type batchEnvelope struct {
+	Mode string `json:"mode"`
+	Operations []json.RawMessage `json:"operations"`
+
+	maxSize int
+}
+
+func (b *batchEnvelope) validate(v *validator) {
+	if !v.failed("/mode") {
+		switch b.Mode {
+			case "", batchAtomic, batchBestEffort:
+			default:
+				v.add("/mode", ruleEnum, "must be atomic or best_effort")
+		}
+	}
+	if v.failed("/operations") {
+		return
+	}
+	if len(b.Operations) == 0 {
+		v.add("/operations", ruleMinItems, "must contain at least one operation")
+	} else if len(b.Operations) > b.maxSize {
+		v.add("/operations", ruleMaxItems, fmt.Sprintf("must contain at most %d operations", b.maxSize))
+	}
+}
+
+// batchOperation is one decoded operation of a batch.
+type batchOperation struct {
+	Op string `json:"op"`
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Price int64 `json:"price"`
+}
+
+func (op *batchOperation) validate(v *validator) {
+	if v.failed("/op") {
+		return
+	}
+	switch op.Op {
+		case string(service.BatchCreate):
+			if op.ID != "" {
+				v.add("/id", ruleReadOnly, "is assigned by the server")
+			}
+			v.name("/name", op.Name)
+			v.price("/price", op.Price)
+		case string(service.BatchUpdate):
+			if op.ID == "" && !v.failed("/id") {
+				v.add("/id", ruleRequired, "must not be empty")
+			}
+			v.name("/name", op.Name)
+			v.price("/price", op.Price)
+		case string(service.BatchDelete):
+			if op.ID == "" && !v.failed("/id") {
+				v.add("/id", ruleRequired, "must not be empty")
+			}
+		case "":
+			v.add("/op", ruleRequired, "must be create, update or delete")
+		default:
+			v.add("/op", ruleEnum, "must be create, update or delete")
+	}
+}
+
+// decodeBatchOperation decodes the operation at index i. Its violations
+// point into the whole batch request.
+func decodeBatchOperation(i int, raw json.RawMessage) (batchOperation, []problem.Violation) {
+	var op batchOperation
+	prefix := "/operations/" + strconv.Itoa(i)
+
+	err := decodeRequest(raw, &op)
+	var verr *ValidationError
+	if err == nil {
+		return op, nil
+	} else if errors.As(err, &verr) {
+		violations := make([]problem.Violation, len(verr.Violations))
+		for j, violation := range verr.Violations {
+			violation.Pointer = prefix + violation.Pointer
+			violations[j] = violation
+		}
+		return op, violations
+	}
+	return op, []problem.Violation{{Pointer: prefix, Rule: ruleType, Message: "must be an object"}}
+}
+
+// batchResult renders the outcome of one operation.
+func batchResult(action service.BatchAction, res service.BatchResult) BatchOperationResult {
+	if res.Err != nil {
+		return batchFailure(res.Err)
+	}
+	switch action {
+		case service.BatchCreate:
+			return BatchOperationResult{Status: http.StatusCreated, Product: res.Product}
+		case service.BatchDelete:
+			return BatchOperationResult{Status: http.StatusNoContent}
+		default:
+			return BatchOperationResult{Status: http.StatusOK, Product: res.Product}
+	}
+}
+
+func batchFailure(err error) BatchOperationResult {
+	p, ok := problemFor(err)
+	if !ok {
+		slog.Error("Batch operation failed", "err", err)
+		p = problem.New(http.StatusInternalServerError, "internal_error", "Internal error", "")
+	}
+	return BatchOperationResult{Status: p.Status, Error: &p}
+}
+
+// BatchProducts godoc
+// @Summary      Run product operations in one transaction
+// @Description  Runs up to BATCH_MAX_SIZE create, update and delete operations in order in a single transaction and returns one result per operation, with the status the operation would have had as a single request. In atomic mode, the default, an invalid operation fails the request with a validation_failed problem and nothing runs; an operation that fails while running rolls the whole batch back, it reports its own problem and every other operation reports batch_aborted. In best_effort mode failed operations are undone on their own and the others are committed. committed tells whether any changes were kept.
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      BatchRequest  true  "Operations to run"
+// @Success      200      {object}  BatchResponse
+// @Failure      400      {object}  ProblemDetails
+// @Failure      408      {object}  ProblemDetails
+// @Failure      413      {object}  ProblemDetails
+// @Failure      415      {object}  ProblemDetails
+// @Failure      500      {object}  ProblemDetails
+// @Failure      503      {object}  ProblemDetails
+// @Router       /products/batch [post]
+func (h *ProductHandler) BatchProducts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+
+	req := batchEnvelope{maxSize: h.batchMaxSize}
+	if err := readRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	mode := batchAtomic
+	if req.Mode == batchBestEffort {
+		mode = batchBestEffort
+	}
+
+	results := make([]BatchOperationResult, len(req.Operations))
+	var ops []service.BatchOp
+	var indexes []int
+	var violations []problem.Violation
+	for i, raw := range req.Operations {
+		op, vs := decodeBatchOperation(i, raw)
+		if len(vs) > 0 {
+			violations = append(violations, vs...)
+			results[i] = batchFailure(&ValidationError{Violations: vs})
+			continue
+		}
+		ops = append(ops, service.BatchOp{
+			Action: service.BatchAction(op.Op),
+			Product: model.Product{ID: op.ID, Name: op.Name, Price: op.Price},
+		})
+		indexes = append(indexes, i)
+	}
+	if mode == batchAtomic && len(violations) > 0 {
+		writeError(w, r, &ValidationError{Violations: violations})
+		return
+	}
+
+	committed := false
+	if len(ops) > 0 {
+		stored, err := h.service.BatchProducts(ctx, ops, mode == batchAtomic)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		for j, res := range stored {
+			results[indexes[j]] = batchResult(ops[j].Action, res)
+			if res.Err == nil {
+				committed = true
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := BatchResponse{Mode: mode, Committed: committed, Results: results}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
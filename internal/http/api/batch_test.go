@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+func TestProductHandler_Batch(t *testing.T) {
+	stored := []model.Product{
+		{ID: "1", Name: "Coffee", Price: 499},
+		{ID: "2", Name: "Tea", Price: 299},
+	}
+
+	tests := []struct {
+		name string
+		body string
+		wantStatus int
+		wantCode string
+		wantPointers []string
+		wantCommitted bool
+		wantResults []int
+		wantProducts []model.Product
+	}{
+		{
+			name: "Atomic",
+			body: `{"operations":[
+				{"op":"create","name":"Cake","price":399},
+				{"op":"update","id":"1","name":"Espresso","price":299},
+				{"op":"delete","id":"2"}
+			]}`,
+			wantStatus: http.StatusOK,
+			wantCommitted: true,
+			wantResults: []int{http.StatusCreated, http.StatusOK, http.StatusNoContent},
+			wantProducts: []model.Product{{ID: "1", Name: "Espresso", Price: 299}, {ID: "new-2", Name: "Cake", Price: 399}},
+		},
+		{
+			name: "Atomic rolls back",
+			body: `{"mode":"atomic","operations":[
+				{"op":"delete","id":"1"},
+				{"op":"delete","id":"3"},
+				{"op":"delete","id":"2"}
+			]}`,
+			wantStatus: http.StatusOK,
+			wantResults: []int{http.StatusFailedDependency, http.StatusNotFound, http.StatusFailedDependency},
+			wantProducts: stored,
+		},
+		{
+			name: "Atomic rejects invalid operations",
+			body: `{"operations":[
+				{"op":"create","name":"","price":399},
+				{"op":"delete","id":"1"},
+				{"op":"rename","id":"2"},
+				7
+			]}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode: "validation_failed",
+			wantPointers: []string{"/operations/0/name", "/operations/2/op", "/operations/3"},
+			wantProducts: stored,
+		},
+		{
+			name: "Best effort",
+			body: `{"mode":"best_effort","operations":[
+				{"op":"delete","id":"1"},
+				{"op":"update","id":"3","name":"Cake","price":399},
+				{"op":"create","id":"4","name":"Cake","price":399}
+			]}`,
+			wantStatus: http.StatusOK,
+			wantCommitted: true,
+			wantResults: []int{http.StatusNoContent, http.StatusNotFound, http.StatusBadRequest},
+			wantProducts: []model.Product{{ID: "2", Name: "Tea", Price: 299}},
+		},
+		{
+			name: "Too many operations",
+			body: `{"operations":[` + strings.TrimSuffix(strings.Repeat(`{"op":"delete","id":"1"},`, 101), ",") + `]}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode: "validation_failed",
+			wantPointers: []string{"/operations"},
+			wantProducts: stored,
+		},
+		{
+			name: "Invalid envelope",
+			body: `{"mode":"eventually","operations":{}}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode: "validation_failed",
+			wantPointers: []string{"/operations", "/mode"},
+			wantProducts: stored,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := &fakeProductService{products: append([]model.Product(nil), stored...)}
+			handler := NewProductHandler(svc, config.Default())
+
+			req := httptest.NewRequest(http.MethodPost, "/products/batch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.BatchProducts(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantCode != "" {
+				var p problem.Details
+				if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+					t.Fatalf("Failed to decode problem: %v", err)
+				}
+				if p.Code != tt.wantCode {
+					t.Fatalf("Expected code %q, got %q", tt.wantCode, p.Code)
+				}
+				var pointers []string
+				for _, v := range p.Violations {
+					pointers = append(pointers, v.Pointer)
+				}
+				if strings.Join(pointers, " ") != strings.Join(tt.wantPointers, " ") {
+					t.Fatalf("Expected violations at %v, got %+v", tt.wantPointers, p.Violations)
+				}
+			} else {
+				var resp BatchResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if resp.Committed != tt.wantCommitted {
+					t.Fatalf("Expected committed %v, got %v", tt.wantCommitted, resp.Committed)
+				}
+				if len(resp.Results) != len(tt.wantResults) {
+					t.Fatalf("Expected %d results, got %+v", len(tt.wantResults), resp.Results)
+				}
+				for i, want := range tt.wantResults {
+					if got := resp.Results[i]; got.Status != want || (got.Error == nil) != (want < 300) {
+						t.Fatalf("Expected result %d to have status %d, got %+v", i, want, got)
+					}
+				}
+			}
+
+			if len(svc.products) != len(tt.wantProducts) {
+				t.Fatalf("Expected products %+v, got %+v", tt.wantProducts, svc.products)
+			}
+			for i := range tt.wantProducts {
+				if svc.products[i] != tt.wantProducts[i] {
+					t.Fatalf("Expected products %+v, got %+v", tt.wantProducts, svc.products)
+				}
+			}
+		})
+	}
+}
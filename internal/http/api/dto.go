@@ -1,16 +1,107 @@
 package api
 
+import (
+	"github.com/v-kuu/mini-marketplace/internal/importer"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+// Product names must be non-blank, at most 100 characters long and consist
+// of letters, digits, spaces and the symbols -_.,&'()/+#%!: only. Prices are
+// in cents and must be between 1 and 100000000. Unknown fields are rejected.
+
 type CreateProductRequest struct {
-	Name string `json:"name"`
-	Price int64 `json:"price"`
+	Name string `json:"name" validate:"required" minLength:"1" maxLength:"100" example:"Coffee"`
+	Price int64 `json:"price" validate:"required" minimum:"1" maximum:"100000000" example:"499"`
 }
 
 type UpdateProductRequest struct {
+	Name string `json:"name" validate:"required" minLength:"1" maxLength:"100" example:"Coffee"`
+	Price int64 `json:"price" validate:"required" minimum:"1" maximum:"100000000" example:"499"`
+}
+
+type PatchProductRequest struct {
+	Name *string `json:"name,omitempty" minLength:"1" maxLength:"100" example:"Coffee"`
+	Price *int64 `json:"price,omitempty" minimum:"1" maximum:"100000000" example:"499"`
+}
+
+// productDocument is a product as seen by merge and JSON patches, which
+// operate on its full JSON representation.
+type productDocument struct {
+	ID string `json:"id"`
 	Name string `json:"name"`
 	Price int64 `json:"price"`
+
+	storedID string
 }
 
-type PatchProductRequest struct {
-	Name *string `json:"name,omitempty"`
-	Price *int64 `json:"price,omitempty"`
+// ImportReport is the outcome of a product import.
+type ImportReport = importer.Report
+
+// ImportError explains why one row of an import failed.
+type ImportError = importer.Error
+
+// BatchRequest is a list of product operations run in one transaction.
+// Mode is atomic unless set to best_effort.
+type BatchRequest struct {
+	Mode string `json:"mode,omitempty" enums:"atomic,best_effort" example:"atomic"`
+	Operations []BatchOperation `json:"operations" validate:"required" minItems:"1"`
+}
+
+// BatchOperation creates, updates or deletes one product. Creates take a
+// name and price, updates an id, name and price, and deletes an id.
+type BatchOperation struct {
+	Op string `json:"op" validate:"required" enums:"create,update,delete" example:"create"`
+	ID string `json:"id,omitempty" example:""`
+	Name string `json:"name,omitempty" maxLength:"100" example:"Coffee"`
+	Price int64 `json:"price,omitempty" minimum:"1" maximum:"100000000" example:"499"`
+}
+
+// BatchResponse has one result per operation, in request order.
+type BatchResponse struct {
+	Mode string `json:"mode" example:"atomic"`
+	// Committed is set if at least one operation was kept.
+	Committed bool `json:"committed" example:"true"`
+	Results []BatchOperationResult `json:"results"`
+}
+
+// BatchOperationResult carries the status an operation would have had as a
+// single request, with the stored product or the problem.
+type BatchOperationResult struct {
+	Status int `json:"status" example:"201"`
+	Product *model.Product `json:"product,omitempty"`
+	Error *ProblemDetails `json:"error,omitempty"`
+}
+
+// WebSocketRequest is a message a client sends on /products/ws. subscribe
+// adds or replaces the subscription with the given id; unsubscribe removes
+// it. A subscription matches products with one of product_ids, if given,
+// and a price within min_price and max_price, if given.
+type WebSocketRequest struct {
+	Type string `json:"type" validate:"required" enums:"subscribe,unsubscribe" example:"subscribe"`
+	ID string `json:"id" validate:"required" maxLength:"64" example:"cheap-drinks"`
+	ProductIDs []string `json:"product_ids,omitempty" maxItems:"100"`
+	MinPrice *int64 `json:"min_price,omitempty" minimum:"0" example:"0"`
+	MaxPrice *int64 `json:"max_price,omitempty" minimum:"0" example:"500"`
+}
+
+// WebSocketMessage is a message the server sends on /products/ws:
+// subscribed and unsubscribed confirm a request, event carries a change
+// with the ids of every matching subscription, reset tells the client that
+// it missed changes, and error answers a request that failed.
+type WebSocketMessage struct {
+	Type string `json:"type" enums:"subscribed,unsubscribed,event,reset,error" example:"event"`
+	// ID is the subscription a confirmation or error refers to.
+	ID string `json:"id,omitempty" example:""`
+	Subscriptions []string `json:"subscriptions,omitempty"`
+	EventID int64 `json:"event_id,omitempty" example:"42"`
+	Event string `json:"event,omitempty" enums:"created,updated,deleted" example:"updated"`
+	Product *model.Product `json:"product,omitempty"`
+	Error *ProblemDetails `json:"error,omitempty"`
+}
+
+// WebhookRequest registers or changes a webhook. Events defaults to every
+// event type.
+type WebhookRequest struct {
+	URL string `json:"url" validate:"required" maxLength:"2048" example:"https://partner.example.com/hooks/products"`
+	Events []string `json:"events,omitempty" enums:"created,updated,deleted"`
 }
@@ -1,13 +1,120 @@
 package api
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/importer"
+	"github.com/v-kuu/mini-marketplace/internal/patch"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
 
 var (
-	ErrInvalidName = errors.New("invalid name")
-	ErrInvalidPrice = errors.New("invalid price")
-	ErrEmptyPatch = errors.New("empty patch")
+	ErrValidation = errors.New("validation failed")
+	// ErrInvalidName, ErrInvalidPrice and ErrEmptyPatch are validation
+	// failures that had codes of their own before violations were listed.
+	// They keep them, so that clients matching on those codes still work.
+	ErrInvalidName = fmt.Errorf("%w: invalid name", ErrValidation)
+	ErrInvalidPrice = fmt.Errorf("%w: invalid price", ErrValidation)
+	ErrEmptyPatch = fmt.Errorf("%w: empty patch", ErrValidation)
+	// ErrInvalidJSON and ErrInvalidCSV are those of the importer, so that
+	// unreadable import files fail like any other malformed body.
+	ErrInvalidJSON = importer.ErrInvalidJSON
+	ErrBodyTooLarge = errors.New("request body too large")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrInvalidCSV = importer.ErrInvalidCSV
+	ErrInvalidParameter = errors.New("invalid parameter")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrNotFound = errors.New("not found")
+	ErrTooManyConnections = errors.New("too many connections")
+	ErrTooManySubscriptions = errors.New("too many subscriptions")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
 )
+
+const retryAfterSeconds = "1"
+
+// ProblemDetails is the body of every error response.
+type ProblemDetails = problem.Details
+
+// problemType maps an error to the problem details clients receive. Codes
+// are part of the API contract and must not change once published.
+type problemType struct {
+	err error
+	status int
+	code string
+	title string
+}
+
+var problemTypes = []problemType{
+	{ErrInvalidJSON, http.StatusBadRequest, "invalid_json", "Invalid JSON"},
+	{ErrInvalidName, http.StatusBadRequest, "invalid_name", "Invalid name"},
+	{ErrInvalidPrice, http.StatusBadRequest, "invalid_price", "Invalid price"},
+	{ErrEmptyPatch, http.StatusBadRequest, "empty_patch", "Empty patch"},
+	{ErrValidation, http.StatusBadRequest, "validation_failed", "Validation failed"},
+	{ErrInvalidCSV, http.StatusBadRequest, "invalid_csv", "Invalid CSV"},
+	{ErrInvalidParameter, http.StatusBadRequest, "invalid_parameter", "Invalid parameter"},
+	{ErrBodyTooLarge, http.StatusRequestEntityTooLarge, "body_too_large", "Request body too large"},
+	{ErrUnsupportedMediaType, http.StatusUnsupportedMediaType, "unsupported_media_type", "Unsupported media type"},
+	{patch.ErrInvalidPatch, http.StatusUnprocessableEntity, "invalid_patch", "Invalid patch"},
+	{patch.ErrTestFailed, http.StatusConflict, "patch_test_failed", "Patch test failed"},
+	{ErrMethodNotAllowed, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed"},
+	{ErrNotFound, http.StatusNotFound, "not_found", "Not found"},
+	{ErrSubscriptionNotFound, http.StatusNotFound, "subscription_not_found", "Subscription not found"},
+	{ErrTooManySubscriptions, http.StatusTooManyRequests, "too_many_subscriptions", "Too many subscriptions"},
+	{ErrTooManyConnections, http.StatusServiceUnavailable, "too_many_connections", "Too many connections"},
+	{service.ErrInvalidProduct, http.StatusBadRequest, "invalid_product", "Invalid product"},
+	{service.ErrProductNotFound, http.StatusNotFound, "product_not_found", "Product not found"},
+	{service.ErrInvalidWebhook, http.StatusBadRequest, "invalid_webhook", "Invalid webhook"},
+	{service.ErrWebhookNotFound, http.StatusNotFound, "webhook_not_found", "Webhook not found"},
+	{service.ErrDeliveryNotFound, http.StatusNotFound, "delivery_not_found", "Webhook delivery not found"},
+	{service.ErrDeliveryPending, http.StatusConflict, "delivery_pending", "Webhook delivery pending"},
+	{service.ErrBatchAborted, http.StatusFailedDependency, "batch_aborted", "Batch aborted"},
+	{service.ErrProductAlreadyExists, http.StatusConflict, "product_already_exists", "Product already exists"},
+	{service.ErrOverloaded, http.StatusServiceUnavailable, "overloaded", "Service overloaded"},
+	{context.DeadlineExceeded, http.StatusRequestTimeout, "timeout", "Request timeout"},
+}
+
+// writeError is the single error-rendering path of the API. Known errors
+// become problem details with their stable code; anything else is logged
+// and reported as an internal error without leaking the cause. Errors from
+// requests the client abandoned are not answered at all.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	p, ok := problemFor(err)
+	if !ok {
+		slog.Error("Request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+		p = problem.New(http.StatusInternalServerError, "internal_error", "Internal error", "")
+	}
+	if errors.Is(err, service.ErrOverloaded) || errors.Is(err, ErrTooManyConnections) {
+		w.Header().Set("Retry-After", retryAfterSeconds)
+	}
+	problem.Write(w, r, p)
+}
+
+// problemFor returns the problem details of a known error.
+func problemFor(err error) (problem.Details, bool) {
+	for _, pt := range problemTypes {
+		if !errors.Is(err, pt.err) {
+			continue
+		}
+		detail := err.Error()
+		if pt.err == context.DeadlineExceeded {
+			detail = "the request did not complete in time"
+		}
+		p := problem.New(pt.status, pt.code, pt.title, detail)
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			p.Detail = "the request body has invalid fields"
+			p.Violations = verr.Violations
+		}
+		return p, true
+	}
+	return problem.Details{}, false
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name string
+		err error
+		wantStatus int
+		wantCode string
+	}{
+		{name: "Not found", err: service.ErrProductNotFound, wantStatus: http.StatusNotFound, wantCode: "product_not_found"},
+		{name: "Conflict", err: service.ErrProductAlreadyExists, wantStatus: http.StatusConflict, wantCode: "product_already_exists"},
+		{name: "Invalid product", err: service.ErrInvalidProduct, wantStatus: http.StatusBadRequest, wantCode: "invalid_product"},
+		{name: "Overloaded", err: service.ErrOverloaded, wantStatus: http.StatusServiceUnavailable, wantCode: "overloaded"},
+		{name: "Invalid JSON", err: fmt.Errorf("%w: unexpected EOF", ErrInvalidJSON), wantStatus: http.StatusBadRequest, wantCode: "invalid_json"},
+		{name: "Validation", err: &ValidationError{Violations: []problem.Violation{{Pointer: "/name", Rule: "required", Message: "must not be empty"}, {Pointer: "/price", Rule: "minimum", Message: "must be greater than 0"}}}, wantStatus: http.StatusBadRequest, wantCode: "validation_failed"},
+		{name: "Invalid name", err: &ValidationError{Violations: []problem.Violation{{Pointer: "/name", Rule: "max_length", Message: "must be at most 100 characters"}, {Pointer: "/name", Rule: "pattern", Message: "may only contain letters"}}}, wantStatus: http.StatusBadRequest, wantCode: "invalid_name"},
+		{name: "Invalid price", err: &ValidationError{Violations: []problem.Violation{{Pointer: "/price", Rule: "maximum", Message: "must be at most 100000000"}}}, wantStatus: http.StatusBadRequest, wantCode: "invalid_price"},
+		{name: "Empty patch", err: &ValidationError{Violations: []problem.Violation{{Pointer: "", Rule: "min_properties", Message: "at least one of name or price must be set"}}}, wantStatus: http.StatusBadRequest, wantCode: "empty_patch"},
+		{name: "Timeout", err: fmt.Errorf("query: %w", context.DeadlineExceeded), wantStatus: http.StatusRequestTimeout, wantCode: "timeout"},
+		{name: "Unknown", err: errors.New("disk on fire"), wantStatus: http.StatusInternalServerError, wantCode: "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/products/42", nil)
+			rec := httptest.NewRecorder()
+
+			writeError(rec, req, tt.err)
+
+			res := rec.Result()
+			defer func () {
+				if err := res.Body.Close(); err != nil {
+					t.Fatalf("Failed to close response body: %v", err)
+				}
+			}()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, res.StatusCode)
+			}
+			if ct := res.Header.Get("Content-Type"); ct != problem.ContentType {
+				t.Fatalf("Expected content type %s, got %s", problem.ContentType, ct)
+			}
+
+			var p problem.Details
+			if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if p.Code != tt.wantCode || p.Status != tt.wantStatus {
+				t.Fatalf("Unexpected problem: %+v", p)
+			}
+			if p.Type != "/problems/"+tt.wantCode || p.Title == "" || p.Instance != "/products/42" {
+				t.Fatalf("Incomplete problem: %+v", p)
+			}
+			if tt.wantStatus == http.StatusInternalServerError && p.Detail != "" {
+				t.Fatalf("Internal error detail must not be exposed: %q", p.Detail)
+			}
+		})
+	}
+}
+
+func TestWriteError_Canceled(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	rec := httptest.NewRecorder()
+
+	writeError(rec, req, context.Canceled)
+
+	if rec.Body.Len() != 0 {
+		t.Fatalf("Expected no response for a cancelled request, got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+const (
+	// eventPageSize is how many events are read and sent at a time.
+	eventPageSize = 100
+	// eventWriteTimeout is how long a client gets to accept one write.
+	eventWriteTimeout = 10 * time.Second
+	// eventRetryMillis is the reconnection delay suggested to clients.
+	eventRetryMillis = 3000
+)
+
+// eventStream writes server-sent events. Every write has its own deadline:
+// a client that does not accept it in time is too slow and is disconnected,
+// so events never queue up in server memory. The client resumes from its
+// last event with Last-Event-ID.
+type eventStream struct {
+	w http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *eventStream) send(write func(w io.Writer) error) error {
+	// Not every ResponseWriter supports deadlines; the server timeouts then
+	// apply as usual.
+	_ = s.rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+	if err := write(s.w); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func writeEvent(w io.Writer, e service.ProductEvent) error {
+	data, err := json.Marshal(e.Product)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+// lastEventID returns the event a client resumes after. EventSource sends
+// the Last-Event-ID header when it reconnects; the query parameter serves
+// clients that cannot set headers on the first request.
+func lastEventID(r *http.Request) (int64, bool, error) {
+	s := r.Header.Get("Last-Event-ID")
+	if s == "" {
+		s = r.URL.Query().Get("last_event_id")
+	}
+	if s == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, fmt.Errorf("%w: Last-Event-ID must be a non-negative integer", ErrInvalidParameter)
+	}
+	return id, true, nil
+}
+
+// ProductEvents godoc
+// @Summary      Stream product changes
+// @Description  Streams created, updated and deleted events as server-sent events. Each event has the product as its JSON data and an increasing ID. A client that sends Last-Event-ID receives every event after it from the change log first; without it the stream starts with the next change. If the requested events have already been pruned, a reset event tells the client to reload all products. Heartbeat comments keep idle connections open. Clients that do not keep up are disconnected and can resume with Last-Event-ID.
+// @Tags         products
+// @Produce      text/event-stream
+// @Param        Last-Event-ID  header  int  false  "Resume after this event"
+// @Param        last_event_id  query   int  false  "Resume after this event, for clients that cannot set headers"
+// @Success      200  {string}  string  "Event stream"
+// @Failure      400  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Failure      503  {object}  ProblemDetails
+// @Router       /products/events [get]
+func (h *ProductHandler) ProductEvents(w http.ResponseWriter, r *http.Request) {
+	after, resume, err := lastEventID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// Subscribe before reading the latest position, so a change in between
+	// is not missed.
+	changes, unsubscribe := h.service.SubscribeChanges()
+	defer unsubscribe()
+
+	if !resume {
+		ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+		after, err = h.service.LatestEventID(ctx)
+		cancel()
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep reverse proxies such as nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	metrics.EventStreamsActive.Inc()
+	defer metrics.EventStreamsActive.Dec()
+
+	s := &eventStream{w: w, rc: http.NewResponseController(w)}
+	err = s.send(func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "retry: %d\n\n", eventRetryMillis)
+		return err
+	})
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for err == nil {
+		if after, err = h.sendEvents(r.Context(), s, after); err != nil {
+			break
+		}
+
+		select {
+			case <-r.Context().Done():
+				return
+			case <-h.done:
+				return
+			case <-changes:
+			case <-heartbeat.C:
+				// Also catches changes made by other server instances.
+				err = s.send(func(w io.Writer) error {
+					_, err := io.WriteString(w, ": heartbeat\n\n")
+					return err
+				})
+		}
+	}
+
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		metrics.EventStreamsDropped.Inc()
+	} else if !errors.Is(err, context.Canceled) {
+		slog.Warn("Event stream ended", "method", r.Method, "path", r.URL.Path, "err", err)
+	}
+}
+
+// sendEvents sends every event after the given one and returns the ID of
+// the last event sent.
+func (h *ProductHandler) sendEvents(ctx context.Context, s *eventStream, after int64) (int64, error) {
+	return h.pageEvents(
+		ctx, after,
+		func(latest int64) error {
+			return s.send(func(w io.Writer) error {
+				_, err := fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", latest)
+				return err
+			})
+		},
+		func(events []service.ProductEvent) error {
+			return s.send(func(w io.Writer) error {
+				for _, e := range events {
+					if err := writeEvent(w, e); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+	)
+}
+
+// pageEvents reads every event after the given one a page at a time, passes
+// each page to write and returns the ID of the last event read. If the
+// events after it have been pruned, reset is called with the latest event
+// ID instead: the client has to reload everything and can follow the
+// events from there on.
+func (h *ProductHandler) pageEvents(ctx context.Context, after int64, reset func(latest int64) error, write func([]service.ProductEvent) error) (int64, error) {
+	for {
+		queryCtx, cancel := context.WithTimeoutCause(ctx, h.requestTimeout(), context.DeadlineExceeded)
+		events, err := h.service.ProductEvents(queryCtx, after, eventPageSize)
+		if errors.Is(err, service.ErrEventsExpired) {
+			var latest int64
+			if latest, err = h.service.LatestEventID(queryCtx); err == nil {
+				err = reset(latest)
+				after = latest
+			}
+		}
+		cancel()
+		if err != nil || len(events) == 0 {
+			return after, err
+		}
+
+		if err := write(events); err != nil {
+			return after, err
+		}
+		after = events[len(events)-1].ID
+		if len(events) < eventPageSize {
+			return after, nil
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// readEventBlock reads the next blank-line terminated block of an event
+// stream.
+func readEventBlock(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	var block []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return strings.Join(block, "\n")
+		}
+		block = append(block, line)
+	}
+}
+
+func TestProductHandler_Events(t *testing.T) {
+	events := []service.ProductEvent{
+		{ID: 5, Type: service.EventCreated, Product: model.Product{ID: "1", Name: "Coffee", Price: 499}},
+		{ID: 6, Type: service.EventUpdated, Product: model.Product{ID: "1", Name: "Coffee", Price: 399}},
+		{ID: 7, Type: service.EventDeleted, Product: model.Product{ID: "1", Name: "Coffee", Price: 399}},
+	}
+
+	tests := []struct {
+		name string
+		lastEventID string
+		wantBlocks []string
+	}{
+		{
+			name: "Resume",
+			lastEventID: "5",
+			wantBlocks: []string{
+				"retry: 3000",
+				"id: 6\nevent: updated\ndata: {\"id\":\"1\",\"name\":\"Coffee\",\"price\":399}",
+				"id: 7\nevent: deleted\ndata: {\"id\":\"1\",\"name\":\"Coffee\",\"price\":399}",
+				": heartbeat",
+			},
+		},
+		{
+			name: "Live only",
+			wantBlocks: []string{"retry: 3000", ": heartbeat"},
+		},
+		{
+			name: "Expired",
+			lastEventID: "2",
+			wantBlocks: []string{"retry: 3000", "id: 7\nevent: reset\ndata: {}", ": heartbeat"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			handler := NewProductHandler(&fakeProductService{events: events, latest: 7}, config.Default())
+			handler.heartbeat = 10 * time.Millisecond
+			srv := httptest.NewServer(http.HandlerFunc(handler.ProductEvents))
+			defer srv.Close()
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+				t.Fatalf("Expected an event stream, got %q", ct)
+			}
+			r := bufio.NewReader(resp.Body)
+			for _, want := range tt.wantBlocks {
+				if got := readEventBlock(t, r); got != want {
+					t.Fatalf("Expected block %q, got %q", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestProductHandler_Events_InvalidLastEventID(t *testing.T) {
+	handler := NewProductHandler(&fakeProductService{}, config.Default())
+
+	for _, id := range []string{"abc", "-1"} {
+		req := httptest.NewRequest(http.MethodGet, "/products/events?last_event_id="+id, nil)
+		rec := httptest.NewRecorder()
+
+		handler.ProductEvents(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400 for %q, got %d", id, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/graphql"
+)
+
+// maxGraphQLBody is the largest GraphQL request accepted. Queries are
+// bounded by depth and complexity long before they get this large.
+const maxGraphQLBody = 64 << 10
+
+type GraphQLHandler struct {
+	schema *graphql.Schema
+	timeout atomic.Int64
+	maxDepth int
+	maxComplexity int
+}
+
+func NewGraphQLHandler(s graphql.ProductService, cfg *config.Config) *GraphQLHandler {
+	h := &GraphQLHandler{
+		schema: graphql.NewSchema(s),
+		maxDepth: int(cfg.GRAPHQL_MAX_DEPTH),
+		maxComplexity: int(cfg.GRAPHQL_MAX_COMPLEXITY),
+	}
+	h.Reconfigure(cfg)
+	return h
+}
+
+// Reconfigure applies the reloadable settings in cfg.
+func (h *GraphQLHandler) Reconfigure(cfg *config.Config) {
+	h.timeout.Store(int64(time.Duration(cfg.TIMEOUT) * time.Second))
+}
+
+func (h *GraphQLHandler) requestTimeout() time.Duration {
+	return time.Duration(h.timeout.Load())
+}
+
+// Query godoc
+// @Summary      Run a GraphQL request
+// @Description  Runs a GraphQL query or mutation against the product schema, published at /graphql/schema. Errors of the query itself are reported in the errors of a 200 response with a code in extensions.code; documents longer than 16 KiB or with more than 250 selections, and queries nested deeper than GRAPHQL_MAX_DEPTH or more complex than GRAPHQL_MAX_COMPLEXITY, are rejected without being run.
+// @Tags         graphql
+// @Accept       json
+// @Produce      json
+// @Param        payload   body   graphql.Request   true  "GraphQL request"
+// @Success      200  {object}  graphql.Response
+// @Failure      400  {object}  ProblemDetails
+// @Failure      413  {object}  ProblemDetails
+// @Failure      415  {object}  ProblemDetails
+// @Router       /graphql [post]
+func (h *GraphQLHandler) Query(w http.ResponseWriter, r *http.Request) {
+	if _, err := checkContentType(r, jsonContentType); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	data, err := readBody(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var req graphql.Request
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", ErrInvalidJSON, err))
+		return
+	}
+	h.execute(w, r, req, false)
+}
+
+// QueryGet godoc
+// @Summary      Run a GraphQL query
+// @Description  Runs a GraphQL query given in the query string, for requests that should be cacheable. Mutations are only run over POST.
+// @Tags         graphql
+// @Produce      json
+// @Param        query          query  string  true   "GraphQL document"
+// @Param        operationName  query  string  false  "Operation to run if the document has several"
+// @Param        variables      query  string  false  "Variables as a JSON object"
+// @Success      200  {object}  graphql.Response
+// @Failure      400  {object}  ProblemDetails
+// @Router       /graphql [get]
+func (h *GraphQLHandler) QueryGet(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := graphql.Request{Query: q.Get("query"), OperationName: q.Get("operationName")}
+	if vars := q.Get("variables"); vars != "" {
+		dec := json.NewDecoder(bytes.NewReader([]byte(vars)))
+		dec.UseNumber()
+		if err := dec.Decode(&req.Variables); err != nil {
+			writeError(w, r, fmt.Errorf("%w: variables must be a JSON object", ErrInvalidParameter))
+			return
+		}
+	}
+	h.execute(w, r, req, true)
+}
+
+func (h *GraphQLHandler) execute(w http.ResponseWriter, r *http.Request, req graphql.Request, queryOnly bool) {
+	if req.Query == "" {
+		var v validator
+		v.add("/query", ruleRequired, "must not be empty")
+		writeError(w, r, v.err())
+		return
+	}
+
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+
+	res := h.schema.Execute(ctx, req, graphql.Limits{
+		MaxDepth: h.maxDepth,
+		MaxComplexity: h.maxComplexity,
+		QueryOnly: queryOnly,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
+
+// Schema godoc
+// @Summary      Get the GraphQL schema
+// @Description  Returns the GraphQL schema in the schema definition language, for clients that generate code from it.
+// @Tags         graphql
+// @Produce      plain
+// @Success      200  {string}  string
+// @Router       /graphql/schema [get]
+func (h *GraphQLHandler) Schema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write([]byte(h.schema.SDL())); err != nil {
+		slog.Error("Failed to write response", "err", err)
+	}
+}
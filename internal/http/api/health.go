@@ -2,12 +2,12 @@ package api
 
 import (
 	"net/http"
-	"log"
+	"log/slog"
 )
 
 func HealthHandler(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write([]byte("OK")); err != nil {
-		log.Printf("write error: %v", err)
+		slog.Error("Failed to write response", "err", err)
 	}
 }
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/importer"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+const (
+	csvContentType = "text/csv"
+	ndjsonContentType = "application/x-ndjson"
+	ndjsonAltContentType = "application/ndjson"
+
+	// exportFlushRows is how many exported products are buffered before
+	// they are flushed to the client.
+	exportFlushRows = 500
+)
+
+// importOptions parses the query parameters of an import.
+func importOptions(query url.Values) (service.ImportOptions, error) {
+	var opts service.ImportOptions
+	if s := query.Get("dry_run"); s != "" {
+		dryRun, err := strconv.ParseBool(s)
+		if err != nil {
+			return opts, fmt.Errorf("%w: dry_run must be true or false", ErrInvalidParameter)
+		}
+		opts.DryRun = dryRun
+	}
+	switch query.Get("on_conflict") {
+		case "", "fail":
+		case "upsert":
+			opts.Upsert = true
+		default:
+			return opts, fmt.Errorf("%w: on_conflict must be fail or upsert", ErrInvalidParameter)
+	}
+	return opts, nil
+}
+
+// importChunk writes one chunk of an import. Every chunk gets the full
+// request timeout, so large imports are limited by the body size rather
+// than by time.
+func (h *ProductHandler) importChunk(ctx context.Context, products []model.Product, opts service.ImportOptions) ([]service.ImportResult, error) {
+	ctx, cancel := context.WithTimeoutCause(ctx, h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+	return h.service.ImportProducts(ctx, products, opts)
+}
+
+// fileError reports an import body over the size limit as ErrBodyTooLarge
+// rather than as the malformed file the importer takes it for.
+func fileError(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return bodyError(maxErr, err)
+	}
+	return err
+}
+
+// extendDeadlines gives a long-running import or export another timeout to
+// make progress, so the server timeouts only cut off stalled transfers.
+func extendDeadlines(rc *http.ResponseController, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	// Not every ResponseWriter supports deadlines; the server timeouts
+	// then apply as usual.
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+}
+
+// ImportProducts godoc
+// @Summary      Import products
+// @Description  Streams products from a CSV file with a header row naming the id, name and price columns, or from NDJSON with one product object per line. Rows are validated on their own and written in chunks of one transaction each; invalid rows and rows that conflict with existing products are listed in the report with their line and do not stop the import. A row without an id is matched to an existing product by name. With on_conflict=upsert existing products are updated, otherwise such rows fail with product_already_exists. A dry run validates and reports without writing anything.
+// @Tags         products
+// @Accept       text/csv
+// @Accept       application/x-ndjson
+// @Produce      json
+// @Param        dry_run      query  bool    false  "Report without writing"
+// @Param        on_conflict  query  string  false  "What to do with products that already exist"  Enums(fail, upsert)
+// @Param        payload      body   string  true   "CSV or NDJSON products"
+// @Success      200  {object}  ImportReport
+// @Failure      400  {object}  ProblemDetails
+// @Failure      408  {object}  ProblemDetails
+// @Failure      413  {object}  ProblemDetails
+// @Failure      415  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Failure      503  {object}  ProblemDetails
+// @Router       /products:import [post]
+func (h *ProductHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	mediaType, err := checkContentType(r, csvContentType, ndjsonContentType, ndjsonAltContentType)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	opts, err := importOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var rows importer.Reader
+	if mediaType == csvContentType {
+		if rows, err = importer.NewCSVReader(r.Body); err != nil {
+			writeError(w, r, fileError(err))
+			return
+		}
+	} else {
+		rows = importer.NewNDJSONReader(r.Body)
+	}
+
+	rc := http.NewResponseController(w)
+	extendDeadlines(rc, h.requestTimeout())
+	report, err := importer.Import(r.Context(), rows, h.importChunk, importer.Options{
+		ImportOptions: opts,
+		ChunkSize: h.importChunkSize,
+		Progress: func() { extendDeadlines(rc, h.requestTimeout()) },
+	})
+	if err != nil {
+		writeError(w, r, fileError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
+
+// exportWriter encodes exported products.
+type exportWriter interface {
+	start() error
+	write(p model.Product) error
+	flush() error
+}
+
+type csvExport struct {
+	w *csv.Writer
+}
+
+func (e csvExport) start() error {
+	return e.w.Write(importer.Columns)
+}
+
+func (e csvExport) write(p model.Product) error {
+	return e.w.Write([]string{p.ID, p.Name, strconv.FormatInt(p.Price, 10)})
+}
+
+func (e csvExport) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonExport struct {
+	w *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e ndjsonExport) start() error {
+	return nil
+}
+
+func (e ndjsonExport) write(p model.Product) error {
+	return e.enc.Encode(p)
+}
+
+func (e ndjsonExport) flush() error {
+	return e.w.Flush()
+}
+
+// ExportProducts godoc
+// @Summary      Export products
+// @Description  Streams every product in ID order as CSV with an id, name and price header row, or as NDJSON with one product object per line. The export is read a page at a time, so it reflects concurrent changes made while it runs. If reading fails midway the connection is closed without completing the response.
+// @Tags         products
+// @Produce      application/x-ndjson
+// @Produce      text/csv
+// @Param        format  query  string  false  "File format, ndjson by default"  Enums(ndjson, csv)
+// @Success      200  {string}  string  "CSV or NDJSON products"
+// @Failure      400  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Failure      503  {object}  ProblemDetails
+// @Router       /products:export [get]
+func (h *ProductHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	var out exportWriter
+	var contentType, ext string
+	switch format := r.URL.Query().Get("format"); format {
+		case "", "ndjson":
+			buf := bufio.NewWriter(w)
+			out, contentType, ext = ndjsonExport{w: buf, enc: json.NewEncoder(buf)}, ndjsonContentType, "ndjson"
+		case "csv":
+			out, contentType, ext = csvExport{w: csv.NewWriter(w)}, csvContentType+"; charset=utf-8", "csv"
+		default:
+			writeError(w, r, fmt.Errorf("%w: format must be ndjson or csv", ErrInvalidParameter))
+			return
+	}
+
+	rc := http.NewResponseController(w)
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="products.`+ext+`"`)
+		return out.start()
+	}
+
+	n := 0
+	for p, err := range h.service.AllProducts(r.Context()) {
+		if err == nil && !started {
+			err = start()
+		}
+		if err == nil {
+			err = out.write(p)
+		}
+		if n++; err == nil && n % exportFlushRows == 0 {
+			extendDeadlines(rc, h.requestTimeout())
+			if err = out.flush(); err == nil {
+				err = rc.Flush()
+			}
+		}
+		if err != nil {
+			h.abortExport(w, r, started, err)
+			return
+		}
+	}
+
+	var err error
+	if !started {
+		err = start()
+	}
+	if err == nil {
+		err = out.flush()
+	}
+	if err != nil {
+		h.abortExport(w, r, started, err)
+	}
+}
+
+// abortExport ends a failed export. Before anything was written the error
+// is reported as usual; afterwards the status is already sent, so the
+// connection is dropped to keep the client from taking a partial file for a
+// complete one.
+func (h *ProductHandler) abortExport(w http.ResponseWriter, r *http.Request, started bool, err error) {
+	if !started {
+		writeError(w, r, err)
+		return
+	}
+	if !errors.Is(err, context.Canceled) {
+		slog.Error("Export aborted after the response started", "err", err)
+	}
+	panic(http.ErrAbortHandler)
+}
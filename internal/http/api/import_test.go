@@ -0,0 +1,386 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/importer"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func TestProductHandler_Import(t *testing.T) {
+	stored := []model.Product{{ID: "1", Name: "Coffee", Price: 499}}
+
+	tests := []struct {
+		name string
+		query string
+		contentType string
+		body string
+		wantStatus int
+		wantCode string
+		wantReport ImportReport
+		wantErrors []ImportError
+		wantProducts []model.Product
+	}{
+		{
+			name: "CSV",
+			contentType: "text/csv",
+			body: "name,price\nTea,250\n\"Cake, chocolate\",399\n",
+			wantStatus: http.StatusOK,
+			wantReport: ImportReport{Rows: 2, Created: 2},
+			wantProducts: []model.Product{stored[0], {ID: "new-1", Name: "Tea", Price: 250}, {ID: "new-2", Name: "Cake, chocolate", Price: 399}},
+		},
+		{
+			name: "CSV with BOM, reordered columns and IDs",
+			contentType: "text/csv; charset=utf-8",
+			body: "\ufeffPrice,ID,Name\r\n250,2,Tea\r\n",
+			wantStatus: http.StatusOK,
+			wantReport: ImportReport{Rows: 1, Created: 1},
+			wantProducts: []model.Product{stored[0], {ID: "2", Name: "Tea", Price: 250}},
+		},
+		{
+			name: "NDJSON",
+			contentType: "application/x-ndjson",
+			body: "{\"name\":\"Tea\",\"price\":250}\n\n{\"id\":\"2\",\"name\":\"Cake\",\"price\":399}",
+			wantStatus: http.StatusOK,
+			wantReport: ImportReport{Rows: 2, Created: 2},
+			wantProducts: []model.Product{stored[0], {ID: "new-1", Name: "Tea", Price: 250}, {ID: "2", Name: "Cake", Price: 399}},
+		},
+		{
+			name: "Invalid rows",
+			contentType: "text/csv",
+			body: "name,price\nTea,abc\n,0\nCake,399\n\"Pie,1\n",
+			wantStatus: http.StatusOK,
+			wantReport: ImportReport{Rows: 4, Created: 1, Failed: 3},
+			wantErrors: []ImportError{
+				{Line: 2, Code: "validation_failed"},
+				{Line: 3, Code: "validation_failed"},
+				{Line: 5, Code: "invalid_csv"},
+			},
+			wantProducts: []model.Product{stored[0], {ID: "new-1", Name: "Cake", Price: 399}},
+		},
+		{
+			name: "Invalid NDJSON lines",
+			contentType: "application/x-ndjson",
+			body: "{\"name\":\"Tea\"\n{\"name\":\"Tea\",\"price\":250,\"color\":\"red\"}\n{\"name\":\"Tea\",\"price\":250} 1\n",
+			wantStatus: http.StatusOK,
+			wantReport: ImportReport{Rows: 3, Failed: 3},
+			wantErrors: []ImportError{
+				{Line: 1, Code: "invalid_json"},
+				{Line: 2, Code: "validation_failed"},
+				{Line: 3, Code: "invalid_json"},
+			},
+			wantProducts: stored,
+		},
+		{
+			name: "Existing product fails",
+			contentType: "text/csv",
+			body: "name,price\nCoffee,599\n",
+			wantStatus: http.StatusOK,
+			wantReport: ImportReport{Rows: 1, Failed: 1},
+			wantErrors: []ImportError{{Line: 2, Code: "product_already_exists"}},
+			wantProducts: stored,
+		},
+		{
+			name: "Upsert",
+			query: "?on_conflict=upsert",
+			contentType: "text/csv",
+			body: "name,price\nCoffee,599\n",
+			wantStatus: http.StatusOK,
+			wantReport: ImportReport{Rows: 1, Updated: 1},
+			wantProducts: []model.Product{{ID: "1", Name: "Coffee", Price: 599}},
+		},
+		{
+			name: "Dry run",
+			query: "?dry_run=true&on_conflict=upsert",
+			contentType: "text/csv",
+			body: "name,price\nCoffee,599\nTea,250\n",
+			wantStatus: http.StatusOK,
+			wantReport: ImportReport{DryRun: true, Rows: 2, Created: 1, Updated: 1},
+			wantProducts: stored,
+		},
+		{
+			name: "Unknown column",
+			contentType: "text/csv",
+			body: "name,price,color\nTea,250,red\n",
+			wantStatus: http.StatusBadRequest,
+			wantCode: "invalid_csv",
+			wantProducts: stored,
+		},
+		{
+			name: "Missing column",
+			contentType: "text/csv",
+			body: "id,name\n2,Tea\n",
+			wantStatus: http.StatusBadRequest,
+			wantCode: "invalid_csv",
+			wantProducts: stored,
+		},
+		{
+			name: "Empty CSV",
+			contentType: "text/csv",
+			wantStatus: http.StatusBadRequest,
+			wantCode: "invalid_csv",
+			wantProducts: stored,
+		},
+		{
+			name: "Invalid parameter",
+			query: "?on_conflict=ignore",
+			contentType: "text/csv",
+			body: "name,price\nTea,250\n",
+			wantStatus: http.StatusBadRequest,
+			wantCode: "invalid_parameter",
+			wantProducts: stored,
+		},
+		{
+			name: "Unsupported media type",
+			contentType: "application/json",
+			body: `[{"name":"Tea","price":250}]`,
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantCode: "unsupported_media_type",
+			wantProducts: stored,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := &fakeProductService{products: append([]model.Product(nil), stored...)}
+			handler := NewProductHandler(svc, config.Default())
+
+			req := httptest.NewRequest(http.MethodPost, "/products:import"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+
+			handler.ImportProducts(rec, req)
+
+			res := rec.Result()
+			defer func () {
+				if err := res.Body.Close(); err != nil {
+					t.Fatalf("Failed to close response body: %v", err)
+				}
+			}()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, res.StatusCode, rec.Body)
+			}
+			if tt.wantCode != "" {
+				var p problem.Details
+				if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+					t.Fatalf("Failed to decode problem: %v", err)
+				}
+				if p.Code != tt.wantCode {
+					t.Fatalf("Expected code %q, got %q", tt.wantCode, p.Code)
+				}
+			} else {
+				var report ImportReport
+				if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+					t.Fatalf("Failed to decode report: %v", err)
+				}
+				if len(report.Errors) != len(tt.wantErrors) {
+					t.Fatalf("Expected errors %+v, got %+v", tt.wantErrors, report.Errors)
+				}
+				for i, want := range tt.wantErrors {
+					if got := report.Errors[i]; got.Line != want.Line || got.Code != want.Code {
+						t.Fatalf("Expected error %d to be %+v, got %+v", i, want, got)
+					}
+				}
+				report.Errors = nil
+				if !reflect.DeepEqual(report, tt.wantReport) {
+					t.Fatalf("Expected report %+v, got %+v", tt.wantReport, report)
+				}
+			}
+
+			if len(svc.products) != len(tt.wantProducts) {
+				t.Fatalf("Expected products %+v, got %+v", tt.wantProducts, svc.products)
+			}
+			for i := range tt.wantProducts {
+				if svc.products[i] != tt.wantProducts[i] {
+					t.Fatalf("Expected products %+v, got %+v", tt.wantProducts, svc.products)
+				}
+			}
+		})
+	}
+}
+
+func TestProductHandler_Import_Chunks(t *testing.T) {
+	cfg := config.Default()
+	cfg.IMPORT_CHUNK_SIZE = 2
+	svc := &fakeProductService{}
+	handler := NewProductHandler(svc, cfg)
+
+	body := "name,price\nA,1\nB,2\nC,3\nD,4\nE,5\n"
+	req := httptest.NewRequest(http.MethodPost, "/products:import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+
+	handler.ImportProducts(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if svc.importCalls != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", svc.importCalls)
+	}
+	if len(svc.products) != 5 {
+		t.Fatalf("Expected 5 products, got %d", len(svc.products))
+	}
+}
+
+func TestProductHandler_Import_DryRunChunks(t *testing.T) {
+	cfg := config.Default()
+	cfg.IMPORT_CHUNK_SIZE = 1
+	svc := &fakeProductService{}
+	handler := NewProductHandler(svc, cfg)
+
+	body := "name,price\nTea,250\nTea,300\n"
+	req := httptest.NewRequest(http.MethodPost, "/products:import?dry_run=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+
+	handler.ImportProducts(rec, req)
+
+	var report ImportReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Created != 1 || report.Failed != 1 || len(report.Errors) != 1 || report.Errors[0].Code != "product_already_exists" {
+		t.Fatalf("Expected the repeated name to fail as in a real import, got %+v", report)
+	}
+	if len(svc.products) != 0 {
+		t.Fatalf("Expected no products to be written, got %+v", svc.products)
+	}
+}
+
+func TestProductHandler_Import_ErrorsTruncated(t *testing.T) {
+	handler := NewProductHandler(&fakeProductService{}, config.Default())
+
+	body := "name,price\n" + strings.Repeat("Tea,0\n", importer.MaxErrors+1)
+	req := httptest.NewRequest(http.MethodPost, "/products:import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+
+	handler.ImportProducts(rec, req)
+
+	var report ImportReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Failed != importer.MaxErrors+1 || len(report.Errors) != importer.MaxErrors || !report.ErrorsTruncated {
+		t.Fatalf("Expected %d failures with %d listed, got %d with %d listed", importer.MaxErrors+1, importer.MaxErrors, report.Failed, len(report.Errors))
+	}
+}
+
+func TestProductHandler_Export(t *testing.T) {
+	products := []model.Product{
+		{ID: "1", Name: "Coffee", Price: 499},
+		{ID: "2", Name: "Cake, chocolate", Price: 399},
+	}
+
+	tests := []struct {
+		name string
+		query string
+		err error
+		wantStatus int
+		wantType string
+		wantBody string
+	}{
+		{
+			name: "NDJSON by default",
+			wantStatus: http.StatusOK,
+			wantType: "application/x-ndjson",
+			wantBody: "{\"id\":\"1\",\"name\":\"Coffee\",\"price\":499}\n{\"id\":\"2\",\"name\":\"Cake, chocolate\",\"price\":399}\n",
+		},
+		{
+			name: "CSV",
+			query: "?format=csv",
+			wantStatus: http.StatusOK,
+			wantType: "text/csv; charset=utf-8",
+			wantBody: "id,name,price\n1,Coffee,499\n2,\"Cake, chocolate\",399\n",
+		},
+		{
+			name: "Unknown format",
+			query: "?format=xml",
+			wantStatus: http.StatusBadRequest,
+			wantType: problem.ContentType,
+		},
+		{
+			name: "Service error",
+			err: service.ErrOverloaded,
+			wantStatus: http.StatusServiceUnavailable,
+			wantType: problem.ContentType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			handler := NewProductHandler(&fakeProductService{products: products, err: tt.err}, config.Default())
+
+			req := httptest.NewRequest(http.MethodGet, "/products:export"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ExportProducts(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Fatalf("Expected content type %q, got %q", tt.wantType, got)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Fatalf("Expected body %q, got %q", tt.wantBody, rec.Body)
+			}
+		})
+	}
+}
+
+func TestProductHandler_Export_Empty(t *testing.T) {
+	handler := NewProductHandler(&fakeProductService{}, config.Default())
+
+	req := httptest.NewRequest(http.MethodGet, "/products:export?format=csv", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ExportProducts(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "id,name,price\n" {
+		t.Fatalf("Expected only the header row, got %d %q", rec.Code, rec.Body)
+	}
+}
+
+// failingExport fails after the first exported product.
+type failingExport struct {
+	fakeProductService
+}
+
+func (f *failingExport) AllProducts(ctx context.Context) iter.Seq2[model.Product, error] {
+	return func(yield func(model.Product, error) bool) {
+		if yield(model.Product{ID: "1", Name: "Coffee", Price: 499}, nil) {
+			yield(model.Product{}, errors.New("database is gone"))
+		}
+	}
+}
+
+func TestProductHandler_Export_AbortsAfterStart(t *testing.T) {
+	handler := NewProductHandler(&failingExport{}, config.Default())
+
+	req := httptest.NewRequest(http.MethodGet, "/products:export", nil)
+	rec := httptest.NewRecorder()
+
+	defer func () {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Fatalf("Expected the handler to abort, got %v", r)
+		}
+	}()
+	handler.ExportProducts(rec, req)
+	t.Fatalf("Expected the handler to abort")
+}
@@ -2,15 +2,18 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"net/http"
 	"context"
-	"strings"
-	"log"
+	"iter"
+	"log/slog"
 	"time"
-	"errors"
-	"syscall"
+	"sync/atomic"
 
 	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/patch"
 	"github.com/v-kuu/mini-marketplace/internal/service"
 	"github.com/v-kuu/mini-marketplace/internal/config"
 )
@@ -19,29 +22,52 @@ type ProductService interface {
 	ListProducts(ctx context.Context) ([]model.Product, error)
 	GetProduct(ctx context.Context, id string) (*model.Product, error)
 	CreateProduct(ctx context.Context, name string, price int64) (string, error)
-	UpdateProduct(ctx context.Context, id string, name string, price int64) error
-	PatchProduct(ctx context.Context, id string, name *string, price *int64) error
+	UpdateProduct(ctx context.Context, id string, name string, price int64) (*model.Product, error)
+	PatchProduct(ctx context.Context, id string, name *string, price *int64) (*model.Product, error)
+	ModifyProduct(ctx context.Context, id string, fn func(model.Product) (model.Product, error)) (*model.Product, error)
 	DeleteProduct(ctx context.Context, id string) error
+	ImportProducts(ctx context.Context, products []model.Product, opts service.ImportOptions) ([]service.ImportResult, error)
+	AllProducts(ctx context.Context) iter.Seq2[model.Product, error]
+	BatchProducts(ctx context.Context, ops []service.BatchOp, atomic bool) ([]service.BatchResult, error)
+	ProductEvents(ctx context.Context, after int64, limit int) ([]service.ProductEvent, error)
+	LatestEventID(ctx context.Context) (int64, error)
+	SubscribeChanges() (<-chan struct{}, func())
 }
 
 type ProductHandler struct {
 	service ProductService
-	timeout time.Duration
+	timeout atomic.Int64
+	importChunkSize int
+	batchMaxSize int
+	heartbeat time.Duration
+	// done is closed when the server shuts down, to end event streams.
+	done <-chan struct{}
+	wsConns atomic.Int64
+	wsMaxConns int64
+	wsMaxSubs int
 }
 
 func NewProductHandler(s ProductService, cfg *config.Config) *ProductHandler {
-	return &ProductHandler{service: s, timeout: time.Duration(cfg.TIMEOUT) * time.Second}
+	h := &ProductHandler{
+		service: s,
+		importChunkSize: int(cfg.IMPORT_CHUNK_SIZE),
+		batchMaxSize: int(cfg.BATCH_MAX_SIZE),
+		heartbeat: time.Duration(cfg.EVENTS_HEARTBEAT) * time.Second,
+		wsMaxConns: cfg.WS_MAX_CONNECTIONS,
+		wsMaxSubs: int(cfg.WS_MAX_SUBSCRIPTIONS),
+	}
+	h.Reconfigure(cfg)
+	return h
 }
 
-func (h *ProductHandler) Products(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-		case http.MethodGet:
-			h.listProducts(w, r)
-		case http.MethodPost:
-			h.createProduct(w, r)
-		default:
-			writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
+// Reconfigure applies the reloadable handler settings. It is safe to call
+// while requests are being served.
+func (h *ProductHandler) Reconfigure(cfg *config.Config) {
+	h.timeout.Store(int64(time.Duration(cfg.TIMEOUT) * time.Second))
+}
+
+func (h *ProductHandler) requestTimeout() time.Duration {
+	return time.Duration(h.timeout.Load())
 }
 
 // ListProducts godoc
@@ -50,70 +76,55 @@ func (h *ProductHandler) Products(w http.ResponseWriter, r *http.Request) {
 // @Tags         products
 // @Produce      json
 // @Success      200  {array}  model.Product
-// @Failure      408  {object}  api.ErrorResponse
-// @Failure      500  {object}  api.ErrorResponse
+// @Failure      408  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Failure      503  {object}  ProblemDetails
 // @Router       /products [get]
-func (h *ProductHandler) listProducts(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeoutCause(r.Context(), h.timeout, context.DeadlineExceeded)
+func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
 	defer cancel()
 
 	products, err := h.service.ListProducts(ctx)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			writeJSONError(w, "Request timeout", http.StatusRequestTimeout)
-		} else if !errors.Is(err, context.Canceled) {
-			log.Printf("ListProducts: %v", err)
-			writeJSONError(w, "Internal error", http.StatusInternalServerError)
-		}
+		writeError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(products); err != nil {
-		log.Printf("json encoding error: %v", err)
+		slog.Error("Failed to encode JSON response", "err", err)
 	}
 }
 
 // CreateProduct godoc
 // @Summary      Create a new product
-// @Description  Creates a new product with idempotency
+// @Description  Creates a new product with idempotency. Every invalid or unknown field is listed in the violations of a validation_failed problem.
 // @Tags         products
 // @Accept       json
 // @Produce      json
 // @Param        payload   body   CreateProductRequest   true  "Product to create"
 // @Success      201  {object}  model.Product
-// @Failure      400  {object}  api.ErrorResponse
-// @Failure      408  {object}  api.ErrorResponse
-// @Failure      409  {object}  api.ErrorResponse
-// @Failure      500  {object}  api.ErrorResponse
+// @Failure      400  {object}  ProblemDetails
+// @Failure      408  {object}  ProblemDetails
+// @Failure      409  {object}  ProblemDetails
+// @Failure      413  {object}  ProblemDetails
+// @Failure      415  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Failure      503  {object}  ProblemDetails
 // @Router       /products [post]
-func (h *ProductHandler) createProduct(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeoutCause(r.Context(), h.timeout, context.DeadlineExceeded)
+func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
 	defer cancel()
 
 	var req CreateProductRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSONError(w, "Invalid json", http.StatusBadRequest)
-		return
-	} else if err := validateCreate(req); err != nil {
-		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	if err := readRequest(r, &req); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	id, err := h.service.CreateProduct(ctx, req.Name, req.Price)
 	if err != nil {
-		switch {
-			case errors.Is(err, service.ErrInvalidProduct):
-				writeJSONError(w, err.Error(), http.StatusBadRequest)
-			case errors.Is(err, service.ErrProductAlreadyExists):
-				writeJSONError(w, err.Error(), http.StatusConflict)
-			case errors.Is(err, context.Canceled):
-			case errors.Is(err, context.DeadlineExceeded):
-				writeJSONError(w, "Request timeout", http.StatusRequestTimeout)
-			default:
-				log.Printf("CreateProduct: %v", err)
-				writeJSONError(w, "Internal error", http.StatusInternalServerError)
-		}
+		writeError(w, r, err)
 		return
 	}
 
@@ -121,24 +132,7 @@ func (h *ProductHandler) createProduct(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(p); err != nil {
-		log.Printf("json encoding error: %v", err)
-	}
-}
-
-func (h *ProductHandler) ProductByID(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/products/")
-
-	switch r.Method {
-		case http.MethodGet:
-			h.getProduct(w, r, id)
-		case http.MethodPut:
-			h.updateProduct(w, r, id)
-		case http.MethodPatch:
-			h.patchProduct(w, r, id)
-		case http.MethodDelete:
-			h.deleteProduct(w, r, id)
-		default:
-			writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		slog.Error("Failed to encode JSON response", "err", err)
 	}
 }
 
@@ -149,142 +143,172 @@ func (h *ProductHandler) ProductByID(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param        id   path      string  true  "Product ID"
 // @Success      200  {object}  model.Product
-// @Failure      404  {object}  api.ErrorResponse
-// @Failure      408  {object}  api.ErrorResponse
-// @Failure      500  {object}  api.ErrorResponse
+// @Failure      404  {object}  ProblemDetails
+// @Failure      408  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Failure      503  {object}  ProblemDetails
 // @Router       /products/{id} [get]
-func (h *ProductHandler) getProduct(w http.ResponseWriter, r *http.Request, id string) {
-	ctx, cancel := context.WithTimeoutCause(r.Context(), h.timeout, context.DeadlineExceeded)
+func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
 	defer cancel()
 
 	product, err := h.service.GetProduct(ctx, id)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			writeJSONError(w, "Request timeout", http.StatusRequestTimeout)
-		} else if !errors.Is(err, context.Canceled) {
-			log.Printf("GetProduct: %v", err)
-			writeJSONError(w, "Internal error", http.StatusInternalServerError)
-		}
+		writeError(w, r, err)
 		return
 	}
 
 	if product == nil {
-		http.NotFound(w, r)
+		writeError(w, r, service.ErrProductNotFound)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(product); err != nil {
-		log.Printf("json encoding error: %v", err)
+		slog.Error("Failed to encode JSON response", "err", err)
 	}
 }
 
 // UpdateProduct godoc
 // @Summary      Update a product
-// @Description  Updates an existing product by ID
+// @Description  Updates an existing product by ID and returns it as stored. Every invalid or unknown field is listed in the violations of a validation_failed problem.
 // @Tags         products
 // @Accept       json
 // @Produce      json
 // @Param        id       path      string               true  "Product ID"
 // @Param        payload  body      UpdateProductRequest  true  "Updated product data"
 // @Success      200      {object}  model.Product
-// @Failure      400      {object}  ErrorResponse
-// @Failure      404      {object}  ErrorResponse
-// @Failure      408      {object}  ErrorResponse
-// @Failure      500      {object}  ErrorResponse
+// @Failure      400      {object}  ProblemDetails
+// @Failure      404      {object}  ProblemDetails
+// @Failure      408      {object}  ProblemDetails
+// @Failure      413      {object}  ProblemDetails
+// @Failure      415      {object}  ProblemDetails
+// @Failure      500      {object}  ProblemDetails
+// @Failure      503      {object}  ProblemDetails
 // @Router       /products/{id} [put]
-func (h *ProductHandler) updateProduct(w http.ResponseWriter, r *http.Request, id string) {
-	ctx, cancel := context.WithTimeoutCause(r.Context(), h.timeout, context.DeadlineExceeded)
+func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
 	defer cancel()
 
 	var req UpdateProductRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSONError(w, "invalid json", http.StatusBadRequest)
-		return
-	} else if err := validateUpdate(req); err != nil {
-		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	if err := readRequest(r, &req); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	err := h.service.UpdateProduct(ctx, id, req.Name, req.Price)
+	product, err := h.service.UpdateProduct(ctx, id, req.Name, req.Price)
 	if err != nil {
-		switch {
-		case errors.Is(err, service.ErrInvalidProduct):
-			writeJSONError(w, err.Error(), http.StatusBadRequest)
-		case errors.Is(err, service.ErrProductNotFound):
-			writeJSONError(w, err.Error(), http.StatusNotFound)
-		case errors.Is(err, context.Canceled):
-		case errors.Is(err, context.DeadlineExceeded):
-			writeJSONError(w, "Request timeout", http.StatusRequestTimeout)
-		default:
-			log.Printf("UpdateProduct: %v", err)
-			writeJSONError(w, "Internal error", http.StatusInternalServerError)
-		}
+		writeError(w, r, err)
 		return
 	}
 
-	p := model.Product{ID: id, Name: req.Name, Price: req.Price}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(p); err != nil {
-		log.Printf("json encoding error: %v", err)
+	if err := json.NewEncoder(w).Encode(product); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
 	}
 }
 
 // PatchProduct godoc
 // @Summary      Patch a product
-// @Description  Partially updates a product by ID
+// @Description  Partially updates a product by ID and returns the full product as stored. A plain JSON body sets the fields it contains. An RFC 7396 merge patch or an RFC 6902 JSON patch is applied to the stored product atomically; a failing JSON patch test operation returns patch_test_failed. Every invalid or unknown field is listed in the violations of a validation_failed problem.
 // @Tags         products
 // @Accept       json
+// @Accept       application/merge-patch+json
+// @Accept       application/json-patch+json
 // @Produce      json
 // @Param        id       path      string              true  "Product ID"
 // @Param        payload  body      PatchProductRequest  true  "Fields to update"
 // @Success      200      {object}  model.Product
-// @Failure      400      {object}  ErrorResponse
-// @Failure      404      {object}  ErrorResponse
-// @Failure      408      {object}  ErrorResponse
-// @Failure      500      {object}  ErrorResponse
+// @Failure      400      {object}  ProblemDetails
+// @Failure      404      {object}  ProblemDetails
+// @Failure      408      {object}  ProblemDetails
+// @Failure      409      {object}  ProblemDetails
+// @Failure      413      {object}  ProblemDetails
+// @Failure      415      {object}  ProblemDetails
+// @Failure      422      {object}  ProblemDetails
+// @Failure      500      {object}  ProblemDetails
+// @Failure      503      {object}  ProblemDetails
 // @Router       /products/{id} [patch]
-func (h *ProductHandler) patchProduct(w http.ResponseWriter, r *http.Request, id string) {
-	ctx, cancel := context.WithTimeoutCause(r.Context(), h.timeout, context.DeadlineExceeded)
+func (h *ProductHandler) PatchProduct(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
 	defer cancel()
 
-	var req PatchProductRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSONError(w, "Invalid json", http.StatusBadRequest)
+	mediaType, err := checkContentType(r, jsonContentType, patch.MergePatchContentType, patch.JSONPatchContentType)
+	if err != nil {
+		w.Header().Set("Accept-Patch", strings.Join([]string{jsonContentType, patch.MergePatchContentType, patch.JSONPatchContentType}, ", "))
+		writeError(w, r, err)
 		return
 	}
-	if err := validatePatch(req); err != nil {
-		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	if mediaType != jsonContentType {
+		h.applyPatch(ctx, w, r, id, mediaType)
 		return
 	}
 
-	err := h.service.PatchProduct(ctx, id, req.Name, req.Price)
+	var req PatchProductRequest
+	if err := readRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	product, err := h.service.PatchProduct(ctx, id, req.Name, req.Price)
 	if err != nil {
-		switch {
-			case errors.Is(err, service.ErrProductNotFound):
-				writeJSONError(w, err.Error(), http.StatusNotFound)
-			case errors.Is(err, context.Canceled):
-			case errors.Is(err, context.DeadlineExceeded):
-				writeJSONError(w, "Request timeout", http.StatusRequestTimeout)
-			default:
-				log.Printf("PatchProduct: %v", err)
-				writeJSONError(w, "Internal error", http.StatusInternalServerError)
-		}
+		writeError(w, r, err)
 		return
 	}
 
-	p := model.Product{ID: id}
-	if req.Name != nil {
-		p.Name = *req.Name
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(product); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
+
+// applyPatch applies a merge patch or JSON patch to the stored product. The
+// patch runs inside the write transaction, so test operations are checked
+// against exactly the state that is replaced. Violations point into the
+// patched product rather than into the patch.
+func (h *ProductHandler) applyPatch(ctx context.Context, w http.ResponseWriter, r *http.Request, id, mediaType string) {
+	data, err := readBody(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if req.Price != nil {
-		p.Price = *req.Price
+	p, err := patch.Decode(mediaType, data)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+
+	product, err := h.service.ModifyProduct(ctx, id, func(current model.Product) (model.Product, error) {
+		doc, err := json.Marshal(current)
+		if err != nil {
+			return current, err
+		}
+		patched, err := p.Apply(doc)
+		if err != nil {
+			return current, err
+		}
+
+		next := productDocument{storedID: current.ID}
+		if err := decodeRequest(patched, &next); errors.Is(err, ErrInvalidJSON) {
+			return current, fmt.Errorf("%w: the patched product is not a JSON object", patch.ErrInvalidPatch)
+		} else if err != nil {
+			return current, err
+		}
+		return model.Product{ID: current.ID, Name: next.Name, Price: next.Price}, nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(p); err != nil {
-		log.Printf("json encoding error: %v", err)
+	if err := json.NewEncoder(w).Encode(product); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
 	}
 }
 
@@ -294,41 +318,22 @@ func (h *ProductHandler) patchProduct(w http.ResponseWriter, r *http.Request, id
 // @Tags         products
 // @Param        id  path      string  true  "Product ID"
 // @Success      204  "No content"
-// @Failure      400  {object}  ErrorResponse
-// @Failure      404  {object}  ErrorResponse
-// @Failure      408  {object}  ErrorResponse
-// @Failure      500  {object}  ErrorResponse
+// @Failure      400  {object}  ProblemDetails
+// @Failure      404  {object}  ProblemDetails
+// @Failure      408  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Failure      503  {object}  ProblemDetails
 // @Router       /products/{id} [delete]
-func (h *ProductHandler) deleteProduct(w http.ResponseWriter, r *http.Request, id string) {
-	ctx, cancel := context.WithTimeoutCause(r.Context(), h.timeout, context.DeadlineExceeded)
+func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
 	defer cancel()
 
 	err := h.service.DeleteProduct(ctx, id)
 	if err != nil {
-		switch {
-			case errors.Is(err, service.ErrInvalidProduct):
-				writeJSONError(w, err.Error(), http.StatusBadRequest)
-			case errors.Is(err, service.ErrProductNotFound):
-				writeJSONError(w, err.Error(), http.StatusNotFound)
-			case errors.Is(err, context.Canceled):
-			case errors.Is(err, context.DeadlineExceeded):
-				writeJSONError(w, "Request timeout", http.StatusRequestTimeout)
-			default:
-				log.Printf("DeleteProduct: %v", err)
-				writeJSONError(w, "Internal error", http.StatusInternalServerError)
-		}
+		writeError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
-
-func writeJSONError(w http.ResponseWriter, message string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	if err := json.NewEncoder(w).Encode(ErrorResponse{message}); err != nil {
-		if err != syscall.EPIPE && err != syscall.ECONNRESET {
-			log.Printf("json encoding error: %v", err)
-		}
-	}
-}
@@ -8,15 +8,27 @@ import (
 	"encoding/json"
 	"context"
 	"strings"
+	"fmt"
+	"iter"
+	"slices"
 
 	"github.com/v-kuu/mini-marketplace/internal/model"
 	"github.com/v-kuu/mini-marketplace/internal/service"
 	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/http/middleware"
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
 )
 
 type fakeProductService struct {
 	products []model.Product
 	err error
+	// importCalls counts the chunks passed to ImportProducts.
+	importCalls int
+	// events is the change log served to event streams, latest its last
+	// ID, and changes wakes up subscribers.
+	events []service.ProductEvent
+	latest int64
+	changes chan struct{}
 }
 
 func (f *fakeProductService) ListProducts(ctx context.Context) ([]model.Product, error) {
@@ -61,20 +73,21 @@ func (f *fakeProductService) DeleteProduct(ctx context.Context, id string) error
 	return service.ErrProductNotFound
 }
 
-func (f *fakeProductService) UpdateProduct(ctx context.Context, id string, name string, price int64) error {
+func (f *fakeProductService) UpdateProduct(ctx context.Context, id string, name string, price int64) (*model.Product, error) {
 	for i, product := range f.products {
 		if product.ID == id {
 			f.products[i].Name = name
 			f.products[i].Price = price
-			return nil
+			p := f.products[i]
+			return &p, nil
 		}
 	}
-	return service.ErrProductNotFound
+	return nil, service.ErrProductNotFound
 }
 
-func (f *fakeProductService) PatchProduct(ctx context.Context, id string, name *string, price *int64) error {
+func (f *fakeProductService) PatchProduct(ctx context.Context, id string, name *string, price *int64) (*model.Product, error) {
 	if id == "" {
-		return service.ErrInvalidProduct
+		return nil, service.ErrInvalidProduct
 	}
 
 	for i, product := range f.products {
@@ -85,11 +98,137 @@ func (f *fakeProductService) PatchProduct(ctx context.Context, id string, name *
 			if price != nil {
 				f.products[i].Price = *price
 			}
-			return nil
+			p := f.products[i]
+			return &p, nil
 		}
 	}
 
-	return service.ErrProductNotFound
+	return nil, service.ErrProductNotFound
+}
+
+func (f *fakeProductService) ModifyProduct(ctx context.Context, id string, fn func(model.Product) (model.Product, error)) (*model.Product, error) {
+	for i, product := range f.products {
+		if product.ID == id {
+			next, err := fn(product)
+			if err != nil {
+				return nil, err
+			}
+			f.products[i] = next
+			return &next, nil
+		}
+	}
+	return nil, service.ErrProductNotFound
+}
+
+func (f *fakeProductService) ImportProducts(ctx context.Context, products []model.Product, opts service.ImportOptions) ([]service.ImportResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.importCalls++
+
+	stored := slices.Clone(f.products)
+	results := make([]service.ImportResult, len(products))
+	for i, p := range products {
+		j := slices.IndexFunc(stored, func(s model.Product) bool {
+			return (p.ID != "" && s.ID == p.ID) || (p.ID == "" && s.Name == p.Name)
+		})
+		switch {
+			case j >= 0 && opts.Upsert:
+				stored[j].Name, stored[j].Price = p.Name, p.Price
+				results[i] = service.ImportResult{Outcome: service.ImportUpdated, ID: stored[j].ID}
+			case j >= 0:
+				results[i] = service.ImportResult{Outcome: service.ImportFailed, Err: service.ErrProductAlreadyExists}
+			default:
+				if p.ID == "" {
+					p.ID = fmt.Sprintf("new-%d", len(stored))
+				}
+				stored = append(stored, p)
+				results[i] = service.ImportResult{Outcome: service.ImportCreated, ID: p.ID}
+		}
+	}
+	if !opts.DryRun {
+		f.products = stored
+	}
+	return results, nil
+}
+
+func (f *fakeProductService) AllProducts(ctx context.Context) iter.Seq2[model.Product, error] {
+	return func(yield func(model.Product, error) bool) {
+		if f.err != nil {
+			yield(model.Product{}, f.err)
+			return
+		}
+		for _, p := range f.products {
+			if !yield(p, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (f *fakeProductService) BatchProducts(ctx context.Context, ops []service.BatchOp, atomic bool) ([]service.BatchResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	stored := slices.Clone(f.products)
+	results := make([]service.BatchResult, len(ops))
+	failed := false
+	for i, op := range ops {
+		p := op.Product
+		j := slices.IndexFunc(stored, func(s model.Product) bool { return s.ID == p.ID })
+		switch {
+			case op.Action == service.BatchCreate:
+				p.ID = fmt.Sprintf("new-%d", len(stored))
+				stored = append(stored, p)
+				results[i].Product = &p
+			case j < 0:
+				results[i].Err = service.ErrProductNotFound
+				failed = true
+			case op.Action == service.BatchUpdate:
+				stored[j] = p
+				results[i].Product = &p
+			default:
+				stored = slices.Delete(stored, j, j+1)
+		}
+	}
+	if atomic && failed {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i] = service.BatchResult{Err: service.ErrBatchAborted}
+			}
+		}
+		return results, nil
+	}
+	f.products = stored
+	return results, nil
+}
+
+func (f *fakeProductService) ProductEvents(ctx context.Context, after int64, limit int) ([]service.ProductEvent, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if after > f.latest || (len(f.events) > 0 && after + 1 < f.events[0].ID) {
+		return nil, service.ErrEventsExpired
+	}
+	var events []service.ProductEvent
+	for _, e := range f.events {
+		if e.ID > after && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (f *fakeProductService) LatestEventID(ctx context.Context) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.latest, nil
+}
+
+func (f *fakeProductService) SubscribeChanges() (<-chan struct{}, func()) {
+	return f.changes, func() {}
 }
 
 func TestProductHandler_List(t *testing.T) {
@@ -117,17 +256,24 @@ func TestProductHandler_List(t *testing.T) {
 			},
 			wantStatus: http.StatusInternalServerError,
 		},
+		{
+			name: "Overloaded",
+			service: &fakeProductService{
+				err: service.ErrOverloaded,
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			handler := NewProductHandler(tt.service, config.Load())
+			handler := NewProductHandler(tt.service, config.Default())
 
 			req := httptest.NewRequest(http.MethodGet, "/products", nil)
 			rec := httptest.NewRecorder()
 
-			handler.Products(rec, req)
+			handler.ListProducts(rec, req)
 
 			res := rec.Result()
 			defer func () {
@@ -140,6 +286,10 @@ func TestProductHandler_List(t *testing.T) {
 				t.Fatalf("Expected status %d, got %d", tt.wantStatus, res.StatusCode)
 			}
 
+			if tt.wantStatus == http.StatusServiceUnavailable && res.Header.Get("Retry-After") == "" {
+				t.Fatalf("Expected Retry-After header on 503")
+			}
+
 			if tt.wantStatus == http.StatusOK {
 				var products []model.Product
 				if err := json.NewDecoder(res.Body).Decode(&products); err != nil {
@@ -193,12 +343,13 @@ func TestProductHandler_Get(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			handler := NewProductHandler(tt.service, config.Load())
+			handler := NewProductHandler(tt.service, config.Default())
 
 			req := httptest.NewRequest(http.MethodGet, "/products/2", nil)
+			req.SetPathValue("id", "2")
 			rec := httptest.NewRecorder()
 
-			handler.ProductByID(rec, req)
+			handler.GetProduct(rec, req)
 
 			res := rec.Result()
 			defer func () {
@@ -249,13 +400,13 @@ func TestProductHandler_Create(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			handler := NewProductHandler(tt.service, config.Load())
+			handler := NewProductHandler(tt.service, config.Default())
 
 			req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(tt.body))
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 
-			handler.Products(rec, req)
+			handler.CreateProduct(rec, req)
 
 			res := rec.Result()
 			defer func () {
@@ -328,12 +479,13 @@ func TestProductHandler_Delete(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			handler := NewProductHandler(tt.service, config.Load())
+			handler := NewProductHandler(tt.service, config.Default())
 
 			req := httptest.NewRequest(http.MethodDelete, "/products/"+tt.id, nil)
+			req.SetPathValue("id", tt.id)
 			rec := httptest.NewRecorder()
 
-			handler.ProductByID(rec, req)
+			handler.DeleteProduct(rec, req)
 
 			res := rec.Result()
 			defer func () {
@@ -440,13 +592,14 @@ func TestProductHandler_Update(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			handler := NewProductHandler(tt.service, config.Load())
+			handler := NewProductHandler(tt.service, config.Default())
 
 			req := httptest.NewRequest(http.MethodPut, "/products/"+tt.id, strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 
-			handler.ProductByID(rec, req)
+			handler.UpdateProduct(rec, req)
 
 			res := rec.Result()
 			defer func () {
@@ -530,13 +683,14 @@ func TestProductHandler_Patch(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			handler := NewProductHandler(tt.service, config.Load())
+			handler := NewProductHandler(tt.service, config.Default())
 
 			req := httptest.NewRequest(http.MethodPatch, "/products/"+tt.id, strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
 			req.Header.Set("Content-Type", "application/json")
 			rec := httptest.NewRecorder()
 
-			handler.ProductByID(rec, req)
+			handler.PatchProduct(rec, req)
 
 			res := rec.Result()
 			defer func () {
@@ -564,3 +718,341 @@ func TestProductHandler_Patch(t *testing.T) {
 		})
 	}
 }
+
+func TestProductHandler_Body(t *testing.T) {
+	tests := []struct {
+		name string
+		method string
+		contentType string
+		body string
+		wantStatus int
+		wantCode string
+	}{
+		{
+			name: "Charset parameter",
+			method: http.MethodPost,
+			contentType: "application/json; charset=utf-8",
+			body: `{"name":"Tea","price":499}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "Trailing whitespace",
+			method: http.MethodPut,
+			contentType: "application/json",
+			body: "{\"name\":\"Tea\",\"price\":499}\n\t ",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Too large",
+			method: http.MethodPost,
+			contentType: "application/json",
+			body: `{"name":"` + strings.Repeat("a", maxProductBody) + `","price":499}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode: "body_too_large",
+		},
+		{
+			name: "Trailing data",
+			method: http.MethodPost,
+			contentType: "application/json",
+			body: `{"name":"Tea","price":499}garbage`,
+			wantStatus: http.StatusBadRequest,
+			wantCode: "invalid_json",
+		},
+		{
+			name: "Second JSON value",
+			method: http.MethodPatch,
+			contentType: "application/json",
+			body: `{"name":"Tea"} {"price":1}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode: "invalid_json",
+		},
+		{
+			name: "Unknown field",
+			method: http.MethodPatch,
+			contentType: "application/json",
+			body: `{"name":"Tea","discount":10}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode: "validation_failed",
+		},
+		{
+			name: "Wrong content type",
+			method: http.MethodPut,
+			contentType: "text/plain",
+			body: `{"name":"Tea","price":499}`,
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantCode: "unsupported_media_type",
+		},
+		{
+			name: "Missing content type",
+			method: http.MethodPost,
+			body: `{"name":"Tea","price":499}`,
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantCode: "unsupported_media_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := &fakeProductService{
+				products: []model.Product{
+					{ID: "1", Name: "Coffee", Price: 499},
+				},
+			}
+			handler := NewProductHandler(svc, config.Default())
+
+			path, serve := "/products", handler.CreateProduct
+			switch tt.method {
+				case http.MethodPut:
+					path, serve = "/products/1", handler.UpdateProduct
+				case http.MethodPatch:
+					path, serve = "/products/1", handler.PatchProduct
+			}
+			req := httptest.NewRequest(tt.method, path, strings.NewReader(tt.body))
+			req.SetPathValue("id", "1")
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+
+			middleware.BodyLimit(http.HandlerFunc(serve), maxProductBody).ServeHTTP(rec, req)
+
+			res := rec.Result()
+			defer func () {
+				if err := res.Body.Close(); err != nil {
+					t.Fatalf("Failed to close response body: %v", err)
+				}
+			}()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, res.StatusCode)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			var p problem.Details
+			if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if p.Code != tt.wantCode {
+				t.Fatalf("Expected code %s, got %s", tt.wantCode, p.Code)
+			}
+		})
+	}
+}
+
+func TestProductHandler_PatchDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		contentType string
+		body string
+		wantStatus int
+		wantCode string
+		want model.Product
+	}{
+		{
+			name: "Merge patch",
+			contentType: "application/merge-patch+json",
+			body: `{"price":599}`,
+			wantStatus: http.StatusOK,
+			want: model.Product{ID: "1", Name: "Coffee", Price: 599},
+		},
+		{
+			name: "Merge patch unsetting a required field",
+			contentType: "application/merge-patch+json",
+			body: `{"name":null}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode: "invalid_name",
+			want: model.Product{ID: "1", Name: "Coffee", Price: 499},
+		},
+		{
+			name: "Merge patch replacing the product",
+			contentType: "application/merge-patch+json",
+			body: `"Tea"`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode: "invalid_patch",
+			want: model.Product{ID: "1", Name: "Coffee", Price: 499},
+		},
+		{
+			name: "JSON patch with passing test",
+			contentType: "application/json-patch+json",
+			body: `[{"op":"test","path":"/price","value":499},{"op":"replace","path":"/name","value":"Espresso"}]`,
+			wantStatus: http.StatusOK,
+			want: model.Product{ID: "1", Name: "Espresso", Price: 499},
+		},
+		{
+			name: "JSON patch with failing test",
+			contentType: "application/json-patch+json",
+			body: `[{"op":"test","path":"/price","value":1},{"op":"replace","path":"/name","value":"Espresso"}]`,
+			wantStatus: http.StatusConflict,
+			wantCode: "patch_test_failed",
+			want: model.Product{ID: "1", Name: "Coffee", Price: 499},
+		},
+		{
+			name: "JSON patch changing the ID",
+			contentType: "application/json-patch+json",
+			body: `[{"op":"replace","path":"/id","value":"2"}]`,
+			wantStatus: http.StatusBadRequest,
+			wantCode: "validation_failed",
+			want: model.Product{ID: "1", Name: "Coffee", Price: 499},
+		},
+		{
+			name: "JSON patch adding an unknown field",
+			contentType: "application/json-patch+json",
+			body: `[{"op":"add","path":"/color","value":"red"}]`,
+			wantStatus: http.StatusBadRequest,
+			wantCode: "validation_failed",
+			want: model.Product{ID: "1", Name: "Coffee", Price: 499},
+		},
+		{
+			name: "JSON patch removing a missing member",
+			contentType: "application/json-patch+json",
+			body: `[{"op":"remove","path":"/color"}]`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode: "invalid_patch",
+			want: model.Product{ID: "1", Name: "Coffee", Price: 499},
+		},
+		{
+			name: "Malformed JSON patch",
+			contentType: "application/json-patch+json",
+			body: `{"op":"remove","path":"/name"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode: "invalid_patch",
+			want: model.Product{ID: "1", Name: "Coffee", Price: 499},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := &fakeProductService{
+				products: []model.Product{
+					{ID: "1", Name: "Coffee", Price: 499},
+				},
+			}
+			handler := NewProductHandler(svc, config.Default())
+
+			req := httptest.NewRequest(http.MethodPatch, "/products/1", strings.NewReader(tt.body))
+			req.SetPathValue("id", "1")
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+
+			handler.PatchProduct(rec, req)
+
+			res := rec.Result()
+			defer func () {
+				if err := res.Body.Close(); err != nil {
+					t.Fatalf("Failed to close response body: %v", err)
+				}
+			}()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, res.StatusCode)
+			}
+			if svc.products[0] != tt.want {
+				t.Fatalf("Expected stored %+v, got %+v", tt.want, svc.products[0])
+			}
+
+			if tt.wantCode == "" {
+				var got model.Product
+				if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if got != tt.want {
+					t.Fatalf("Expected %+v, got %+v", tt.want, got)
+				}
+				return
+			}
+			var p problem.Details
+			if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if p.Code != tt.wantCode {
+				t.Fatalf("Expected code %s, got %s", tt.wantCode, p.Code)
+			}
+		})
+	}
+}
+
+// storingProductService stores names without surrounding whitespace, so its
+// results differ from the request the way a database default or trigger
+// would make them differ.
+type storingProductService struct {
+	fakeProductService
+}
+
+func (s *storingProductService) UpdateProduct(ctx context.Context, id string, name string, price int64) (*model.Product, error) {
+	return s.fakeProductService.UpdateProduct(ctx, id, strings.TrimSpace(name), price)
+}
+
+func TestProductHandler_ReturnsStoredProduct(t *testing.T) {
+	tests := []struct {
+		name string
+		method string
+		body string
+		want model.Product
+	}{
+		{
+			name: "Patch name only keeps price",
+			method: http.MethodPatch,
+			body: `{"name":"Tea"}`,
+			want: model.Product{ID: "1", Name: "Tea", Price: 499},
+		},
+		{
+			name: "Patch price only keeps name",
+			method: http.MethodPatch,
+			body: `{"price":599}`,
+			want: model.Product{ID: "1", Name: "Coffee", Price: 599},
+		},
+		{
+			name: "Put renders stored state",
+			method: http.MethodPut,
+			body: `{"name":"  Tea  ","price":599}`,
+			want: model.Product{ID: "1", Name: "Tea", Price: 599},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := &storingProductService{fakeProductService{
+				products: []model.Product{
+					{ID: "1", Name: "Coffee", Price: 499},
+				},
+			}}
+			handler := NewProductHandler(svc, config.Default())
+
+			req := httptest.NewRequest(tt.method, "/products/1", strings.NewReader(tt.body))
+			req.SetPathValue("id", "1")
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			if tt.method == http.MethodPut {
+				handler.UpdateProduct(rec, req)
+			} else {
+				handler.PatchProduct(rec, req)
+			}
+
+			res := rec.Result()
+			defer func () {
+				if err := res.Body.Close(); err != nil {
+					t.Fatalf("Failed to close response body: %v", err)
+				}
+			}()
+
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+			}
+			var got model.Product
+			if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Expected %+v, got %+v", tt.want, got)
+			}
+			if svc.products[0] != got {
+				t.Fatalf("Response %+v differs from stored %+v", got, svc.products[0])
+			}
+		})
+	}
+}
@@ -1,42 +1,202 @@
 package api
 
 import (
+	"maps"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
-	"github.com/v-kuu/mini-marketplace/internal/service"
-	"github.com/v-kuu/mini-marketplace/internal/repository/sqlite"
-	"github.com/v-kuu/mini-marketplace/internal/metrics"
 	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/graphql"
 	"github.com/v-kuu/mini-marketplace/internal/http/middleware"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
-func AddRoutes() (*http.ServeMux, error) {
-	metrics.Register()
+// Dependencies are the services the HTTP API is built on. They are created
+// by the caller so the API can be served against any database.
+type Dependencies struct {
+	Products ProductService
+	// Webhooks, if set together with ADMIN_TOKEN, serves the webhook
+	// management routes.
+	Webhooks WebhookService
+	// GraphQL, if set, serves the GraphQL endpoint.
+	GraphQL graphql.ProductService
+	// Backups, if set together with ADMIN_TOKEN, serves the backup routes
+	// below /admin.
+	Backups BackupService
+	// Watcher, if set, delivers reloaded configuration to the handlers.
+	Watcher *config.Watcher
+	// Done, if set, is closed on shutdown to end long-lived event streams.
+	Done <-chan struct{}
+}
 
-	db, err := sqlite.OpenDB("file:products.db?_foreign_keys=on")
-	if err != nil {
-		return nil, err
-	}
+const (
+	// noBody is the body limit of routes that take no request body, so
+	// that one sent anyway is never read.
+	noBody = 0
+	// maxProductBody is the largest product payload or patch document
+	// accepted. A product payload is well below a kilobyte.
+	maxProductBody = 16 << 10
+)
 
+func AddRoutes(cfg *config.Config, deps Dependencies) http.Handler {
 	mux := http.NewServeMux()
 
-	cfg := config.Load()
-	repo := sqlite.NewProductRepository(db, cfg)
-	svc := service.NewProductService(repo)
-	handler := NewProductHandler(svc, cfg)
-	ProductsHandler := http.HandlerFunc(handler.Products)
-	ProductByIDHandler := http.HandlerFunc(handler.ProductByID)
-	mux.Handle("/products", middleware.Metrics(ProductsHandler, "/products"))
-	mux.Handle("/products/", middleware.Metrics(ProductByIDHandler, "/products/"))
-	mux.HandleFunc("/health", HealthHandler)
-	mux.Handle("/metrics", promhttp.Handler())
-	mux.Handle("/swagger/", httpSwagger.WrapHandler)
+	handler := NewProductHandler(deps.Products, cfg)
+	handler.done = deps.Done
+	var webhooks *WebhookHandler
+	if deps.Webhooks != nil {
+		webhooks = NewWebhookHandler(deps.Webhooks, cfg)
+	}
+	var gql *GraphQLHandler
+	if deps.GraphQL != nil {
+		gql = NewGraphQLHandler(deps.GraphQL, cfg)
+	}
+	rateLimiter := middleware.NewRateLimiter(cfg.RATE_LIMIT, cfg.RATE_BURST)
+	if deps.Watcher != nil {
+		deps.Watcher.Subscribe(func(cfg *config.Config) {
+			handler.Reconfigure(cfg)
+			if webhooks != nil {
+				webhooks.Reconfigure(cfg)
+			}
+			if gql != nil {
+				gql.Reconfigure(cfg)
+			}
+			rateLimiter.SetLimit(cfg.RATE_LIMIT, cfg.RATE_BURST)
+		})
+	}
+
+	// limited rate-limits h and caps its request body at limit bytes. Each
+	// route gets the limit of the bodies it takes.
+	limited := func(h http.HandlerFunc, limit int64) http.Handler {
+		return middleware.RateLimit(middleware.BodyLimit(h, limit), rateLimiter)
+	}
+	handleMethods(mux, "/products", map[string]http.Handler{
+		http.MethodGet: limited(handler.ListProducts, noBody),
+		http.MethodPost: limited(handler.CreateProduct, maxProductBody),
+	})
+	handleMethods(mux, "/products/{id}", map[string]http.Handler{
+		http.MethodGet: limited(handler.GetProduct, noBody),
+		http.MethodPut: limited(handler.UpdateProduct, maxProductBody),
+		http.MethodPatch: limited(handler.PatchProduct, maxProductBody),
+		http.MethodDelete: limited(handler.DeleteProduct, noBody),
+	})
+	handleMethods(mux, "/products/batch", map[string]http.Handler{
+		http.MethodPost: limited(handler.BatchProducts, cfg.BATCH_MAX_SIZE * maxBatchOperationBody),
+	})
+	handleMethods(mux, "/products/events", map[string]http.Handler{
+		http.MethodGet: limited(handler.ProductEvents, noBody),
+	})
+	handleMethods(mux, "/products/ws", map[string]http.Handler{
+		http.MethodGet: limited(handler.ProductUpdates, noBody),
+	})
+	handleMethods(mux, "/products:import", map[string]http.Handler{
+		http.MethodPost: limited(handler.ImportProducts, cfg.IMPORT_MAX_BYTES),
+	})
+	handleMethods(mux, "/products:export", map[string]http.Handler{
+		http.MethodGet: limited(handler.ExportProducts, noBody),
+	})
+	// Anything else below /products, such as /products/a/b, is not a
+	// resource rather than a request for the web UI.
+	mux.HandleFunc("/products/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, ErrNotFound)
+	})
+
+	// Webhooks make the server send requests to URLs of the caller's
+	// choosing, so they are managed with the admin token only.
+	if webhooks != nil && cfg.ADMIN_TOKEN != "" {
+		webhook := func(h http.HandlerFunc, limit int64) http.Handler {
+			return middleware.BearerToken(limited(h, limit), cfg.ADMIN_TOKEN)
+		}
+		handleMethods(mux, "/webhooks", map[string]http.Handler{
+			http.MethodGet: webhook(webhooks.ListWebhooks, noBody),
+			http.MethodPost: webhook(webhooks.CreateWebhook, maxWebhookBody),
+		})
+		handleMethods(mux, "/webhooks/{id}", map[string]http.Handler{
+			http.MethodGet: webhook(webhooks.GetWebhook, noBody),
+			http.MethodPut: webhook(webhooks.UpdateWebhook, maxWebhookBody),
+			http.MethodDelete: webhook(webhooks.DeleteWebhook, noBody),
+		})
+		handleMethods(mux, "/webhooks/{id}/deliveries", map[string]http.Handler{
+			http.MethodGet: webhook(webhooks.ListDeliveries, noBody),
+		})
+		handleMethods(mux, "/webhooks/{id}/deliveries/{delivery}", map[string]http.Handler{
+			http.MethodGet: webhook(webhooks.GetDelivery, noBody),
+		})
+		handleMethods(mux, "/webhooks/{id}/deliveries/{delivery}/retry", map[string]http.Handler{
+			http.MethodPost: webhook(webhooks.RetryDelivery, noBody),
+		})
+		mux.HandleFunc("/webhooks/", func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, r, ErrNotFound)
+		})
+	}
+
+	if gql != nil {
+		handleMethods(mux, "/graphql", map[string]http.Handler{
+			http.MethodGet: limited(gql.QueryGet, noBody),
+			http.MethodPost: limited(gql.Query, maxGraphQLBody),
+		})
+		handleMethods(mux, "/graphql/schema", map[string]http.Handler{
+			http.MethodGet: http.HandlerFunc(gql.Schema),
+		})
+	}
+
+	if deps.Backups != nil && cfg.ADMIN_TOKEN != "" {
+		admin := NewAdminHandler(deps.Backups)
+		authorized := func(h http.HandlerFunc) http.Handler {
+			return middleware.BearerToken(h, cfg.ADMIN_TOKEN)
+		}
+		handleMethods(mux, "/admin/backups", map[string]http.Handler{
+			http.MethodGet: authorized(admin.ListBackups),
+			http.MethodPost: authorized(admin.CreateBackup),
+		})
+		mux.HandleFunc("/admin/", func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, r, ErrNotFound)
+		})
+	}
+
+	mux.HandleFunc("GET /health", HealthHandler)
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.Handle("GET /swagger/", httpSwagger.WrapHandler)
 
 	fs := http.FileServer(http.Dir("./web"))
 	mux.Handle("/", fs)
 
-	return mux, nil
+	return middleware.Metrics(mux)
+}
+
+// standardMethods are the methods answered with 405 on routes that do not
+// support them.
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodOptions, http.MethodTrace, http.MethodConnect,
+}
+
+// handleMethods registers a handler per method for path. Other standard
+// methods get 405 with an Allow header listing the supported ones. GET also
+// serves HEAD, as it does on the mux. The 405 handlers are registered per
+// method rather than for the bare path, so that a fixed path such as
+// /products/batch does not conflict with a wildcard route next to it.
+func handleMethods(mux *http.ServeMux, path string, handlers map[string]http.Handler) {
+	allowed := slices.Collect(maps.Keys(handlers))
+	if _, ok := handlers[http.MethodGet]; ok {
+		allowed = append(allowed, http.MethodHead)
+	}
+	slices.Sort(allowed)
+	allow := strings.Join(allowed, ", ")
+
+	for method, h := range handlers {
+		mux.Handle(method+" "+path, h)
+	}
+	for _, method := range standardMethods {
+		if slices.Contains(allowed, method) {
+			continue
+		}
+		mux.HandleFunc(method+" "+path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", allow)
+			writeError(w, r, ErrMethodNotAllowed)
+		})
+	}
 }
@@ -0,0 +1,745 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/v-kuu/mini-marketplace/internal/backup"
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/repository/sqlite"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/internal/testdb"
+	"github.com/v-kuu/mini-marketplace/internal/webhook"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server, _, _ := newTestStack(t)
+	return server
+}
+
+// testAdminToken is the ADMIN_TOKEN of newTestStack.
+const testAdminToken = "0123456789abcdef"
+
+// newTestStack serves the API against a fresh database and also returns
+// the services behind it, for tests that run background workers.
+func newTestStack(t *testing.T) (*httptest.Server, *service.ProductService, *service.WebhookService) {
+	t.Helper()
+
+	db := testdb.Open(t)
+	db.Config.ADMIN_TOKEN = testAdminToken
+	svc := service.NewProductService(db.Products)
+	webhooks := service.NewWebhookService(sqlite.NewWebhookRepository(db.Products))
+	server := httptest.NewServer(AddRoutes(db.Config, Dependencies{Products: svc, Webhooks: webhooks, GraphQL: svc}))
+	t.Cleanup(server.Close)
+
+	return server, svc, webhooks
+}
+
+func TestAddRoutes_Products(t *testing.T) {
+	server := newTestServer(t)
+
+	res, err := http.Post(server.URL+"/products", "application/json", strings.NewReader(`{"name":"Coffee","price":499}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	var created model.Product
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if err := res.Body.Close(); err != nil {
+		t.Fatalf("Failed to close response body: %v", err)
+	}
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, res.StatusCode)
+	}
+
+	res, err = http.Get(server.URL + "/products/" + created.ID)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func () {
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	var got model.Product
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got != created {
+		t.Fatalf("Expected %+v, got %+v", created, got)
+	}
+}
+
+func TestAddRoutes_Health(t *testing.T) {
+	server := newTestServer(t)
+
+	res, err := http.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func () {
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestAddRoutes_MethodNotAllowed(t *testing.T) {
+	server := newTestServer(t)
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/products/1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer func () {
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected status %d, got %d", http.StatusMethodNotAllowed, res.StatusCode)
+	}
+	if allow := res.Header.Get("Allow"); allow != "DELETE, GET, HEAD, PATCH, PUT" {
+		t.Fatalf("Unexpected Allow header %q", allow)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("Expected content type %s, got %s", problem.ContentType, ct)
+	}
+}
+
+func TestAddRoutes_NestedPath(t *testing.T) {
+	server := newTestServer(t)
+
+	res, err := http.Get(server.URL + "/products/a/b")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func () {
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}()
+
+	var p problem.Details
+	if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if res.StatusCode != http.StatusNotFound || p.Code != "not_found" {
+		t.Fatalf("Expected not_found problem, got %d %+v", res.StatusCode, p)
+	}
+}
+
+func TestAddRoutes_MetricsPattern(t *testing.T) {
+	server := newTestServer(t)
+	counter := metrics.HttpRequestsTotal.WithLabelValues(http.MethodGet, "/products/{id}", "404")
+	before := testutil.ToFloat64(counter)
+
+	for _, id := range []string{"missing-1", "missing-2"} {
+		res, err := http.Get(server.URL + "/products/" + id)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Fatalf("Expected 2 requests labelled with the route pattern, got %v", got)
+	}
+}
+
+func TestAddRoutes_PatchReturnsStoredProduct(t *testing.T) {
+	server := newTestServer(t)
+
+	res, err := http.Post(server.URL+"/products", "application/json", strings.NewReader(`{"name":"Coffee","price":499}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	var created model.Product
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if err := res.Body.Close(); err != nil {
+		t.Fatalf("Failed to close response body: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, server.URL+"/products/"+created.ID, strings.NewReader(`{"name":"Tea"}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PATCH failed: %v", err)
+	}
+	defer func () {
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}()
+
+	var got model.Product
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if want := (model.Product{ID: created.ID, Name: "Tea", Price: 499}); got != want {
+		t.Fatalf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestAddRoutes_ImportExport(t *testing.T) {
+	server := newTestServer(t)
+
+	body := "name,price\nCoffee,499\nTea,299\nTea,abc\n"
+	res, err := http.Post(server.URL+"/products:import", "text/csv", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	var report ImportReport
+	if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if err := res.Body.Close(); err != nil {
+		t.Fatalf("Failed to close response body: %v", err)
+	}
+	if report.Created != 2 || report.Failed != 1 {
+		t.Fatalf("Expected 2 created and 1 failed row, got %+v", report)
+	}
+
+	res, err = http.Get(server.URL + "/products:export")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func () {
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}()
+
+	names := map[string]int64{}
+	dec := json.NewDecoder(res.Body)
+	for dec.More() {
+		var p model.Product
+		if err := dec.Decode(&p); err != nil {
+			t.Fatalf("Failed to decode product: %v", err)
+		}
+		names[p.Name] = p.Price
+	}
+	if len(names) != 2 || names["Coffee"] != 499 || names["Tea"] != 299 {
+		t.Fatalf("Expected the imported products, got %v", names)
+	}
+}
+
+func TestAddRoutes_BodyLimits(t *testing.T) {
+	server := newTestServer(t)
+
+	// A product body over its limit is refused with a problem.
+	large := `{"name":"` + strings.Repeat("a", maxProductBody) + `","price":499}`
+	res, err := http.Post(server.URL+"/products", "application/json", strings.NewReader(large))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	var p problem.Details
+	if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	if err := res.Body.Close(); err != nil {
+		t.Fatalf("Failed to close response body: %v", err)
+	}
+	if res.StatusCode != http.StatusRequestEntityTooLarge || p.Code != "body_too_large" {
+		t.Fatalf("Expected status %d with body_too_large, got %d with %+v", http.StatusRequestEntityTooLarge, res.StatusCode, p)
+	}
+
+	// The import route takes files far larger than a product body.
+	var csv strings.Builder
+	csv.WriteString("name,price\n")
+	for i := 0; csv.Len() <= maxProductBody; i++ {
+		fmt.Fprintf(&csv, "Product %d,%d\n", i, i+1)
+	}
+	res, err = http.Post(server.URL+"/products:import", "text/csv", strings.NewReader(csv.String()))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	if err := res.Body.Close(); err != nil {
+		t.Fatalf("Failed to close response body: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d for a large import, got %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestAddRoutes_Batch(t *testing.T) {
+	server := newTestServer(t)
+
+	body := `{"operations":[{"op":"create","name":"Coffee","price":499},{"op":"create","name":"Tea","price":299}]}`
+	res, err := http.Post(server.URL+"/products/batch", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer func () {
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	var resp BatchResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Committed || len(resp.Results) != 2 || resp.Results[1].Product == nil {
+		t.Fatalf("Expected both products to be created, got %+v", resp)
+	}
+
+	got, err := http.Get(server.URL + "/products/" + resp.Results[1].Product.ID)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	if err := got.Body.Close(); err != nil {
+		t.Fatalf("Failed to close response body: %v", err)
+	}
+	if got.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the created product to exist, got status %d", got.StatusCode)
+	}
+}
+
+func TestAddRoutes_Events(t *testing.T) {
+	server := newTestServer(t)
+
+	res, err := http.Get(server.URL + "/products/events")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func () {
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	stream := bufio.NewReader(res.Body)
+	if block := readEventBlock(t, stream); block != "retry: 3000" {
+		t.Fatalf("Expected the retry interval, got %q", block)
+	}
+
+	created, err := http.Post(server.URL+"/products", "application/json", strings.NewReader(`{"name":"Coffee","price":499}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	if err := created.Body.Close(); err != nil {
+		t.Fatalf("Failed to close response body: %v", err)
+	}
+
+	block := readEventBlock(t, stream)
+	if !strings.HasPrefix(block, "id: 1\nevent: created\ndata: ") || !strings.Contains(block, `"name":"Coffee"`) {
+		t.Fatalf("Expected a created event, got %q", block)
+	}
+
+	// A client resuming from before the change receives it from the log.
+	resumed, err := http.Get(server.URL + "/products/events?last_event_id=0")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func () {
+		if err := resumed.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}()
+	stream = bufio.NewReader(resumed.Body)
+	readEventBlock(t, stream)
+	if got := readEventBlock(t, stream); got != block {
+		t.Fatalf("Expected the resumed stream to replay %q, got %q", block, got)
+	}
+}
+
+func TestAddRoutes_WebSocket(t *testing.T) {
+	server := newTestServer(t)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/products/ws", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var msg WebSocketMessage
+	if err := conn.WriteJSON(map[string]any{"type": "subscribe", "id": "cheap", "max_price": 400}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "subscribed" {
+		t.Fatalf("Expected the subscription to be confirmed, got %+v (%v)", msg, err)
+	}
+
+	for _, body := range []string{`{"name":"Coffee","price":499}`, `{"name":"Tea","price":299}`} {
+		res, err := http.Post(server.URL+"/products", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}
+
+	// Only the product within the price range is delivered.
+	msg = WebSocketMessage{}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if msg.Type != "event" || msg.Event != "created" || msg.EventID != 2 || msg.Product == nil || msg.Product.Name != "Tea" {
+		t.Fatalf("Expected the Tea created event, got %+v", msg)
+	}
+	if len(msg.Subscriptions) != 1 || msg.Subscriptions[0] != "cheap" {
+		t.Fatalf("Expected the event for subscription cheap, got %v", msg.Subscriptions)
+	}
+}
+
+func TestAddRoutes_Webhooks(t *testing.T) {
+	server, svc, webhooks := newTestStack(t)
+
+	type delivery struct {
+		header http.Header
+		body []byte
+	}
+	received := make(chan delivery, 10)
+	fail := true
+	var mu sync.Mutex
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{header: r.Header, body: body}
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	do := func(method, path, body string, wantStatus int, v any) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("NewRequest failed: %v", err)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer func () {
+			if err := res.Body.Close(); err != nil {
+				t.Fatalf("Failed to close response body: %v", err)
+			}
+		}()
+		if res.StatusCode != wantStatus {
+			t.Fatalf("%s %s: expected status %d, got %d", method, path, wantStatus, res.StatusCode)
+		}
+		if v != nil {
+			if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+	}
+
+	// The webhook routes need the admin token.
+	for _, auth := range []string{"", "Bearer wrong-token-wrong-token"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/webhooks", nil)
+		if err != nil {
+			t.Fatalf("NewRequest failed: %v", err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /webhooks failed: %v", err)
+		}
+		res.Body.Close() //nolint:all
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401 with Authorization %q, got %d", auth, res.StatusCode)
+		}
+	}
+
+	var invalid problem.Details
+	do(http.MethodPost, "/webhooks", `{"url":"ftp://partner.example","events":["created","renamed"]}`, http.StatusBadRequest, &invalid)
+	if invalid.Code != "validation_failed" || len(invalid.Violations) != 2 {
+		t.Fatalf("Expected two violations, got %+v", invalid)
+	}
+
+	var hook model.Webhook
+	do(http.MethodPost, "/webhooks", `{"url":"`+receiver.URL+`","events":["created"]}`, http.StatusCreated, &hook)
+	if hook.Secret == "" || len(hook.Events) != 1 {
+		t.Fatalf("Expected a created webhook with its secret, got %+v", hook)
+	}
+	var listed []model.Webhook
+	do(http.MethodGet, "/webhooks", "", http.StatusOK, &listed)
+	if len(listed) != 1 || listed[0].ID != hook.ID || listed[0].Secret != "" {
+		t.Fatalf("Expected the webhook without its secret, got %+v", listed)
+	}
+
+	// The worker retries after a second and dead-letters the delivery on
+	// the second failure.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, unsubscribe := svc.SubscribeChanges()
+	defer unsubscribe()
+	go webhook.NewWorker(webhooks, webhook.Options{
+		MaxAttempts: 2,
+		BackoffBase: time.Second,
+		BackoffMax: time.Second,
+		Timeout: time.Second,
+		Concurrency: 1,
+		PollInterval: 50 * time.Millisecond,
+		AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+	}).Run(ctx, changes)
+
+	do(http.MethodPost, "/products", `{"name":"Coffee","price":499}`, http.StatusCreated, nil)
+	var id string
+	for i := range 2 {
+		select {
+			case d := <-received:
+				if err := webhook.Verify(hook.Secret, d.header.Get(webhook.SignatureHeader), d.body, time.Minute, time.Now()); err != nil {
+					t.Fatalf("Expected a valid signature, got %v", err)
+				}
+				if i == 1 && d.header.Get("X-Webhook-Delivery") != id {
+					t.Fatalf("Expected the retry of delivery %s, got %s", id, d.header.Get("X-Webhook-Delivery"))
+				}
+				id = d.header.Get("X-Webhook-Delivery")
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Expected delivery attempt %d", i+1)
+		}
+	}
+
+	var dead model.WebhookDelivery
+	for deadline := time.Now().Add(5 * time.Second); dead.Status != model.DeliveryDead; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a dead delivery, got %+v", dead)
+		}
+		time.Sleep(10 * time.Millisecond)
+		do(http.MethodGet, "/webhooks/"+hook.ID+"/deliveries/"+id, "", http.StatusOK, &dead)
+	}
+	if dead.Event != "created" || dead.Attempts != 2 || len(dead.AttemptLog) != 2 || dead.AttemptLog[1].Error != model.AttemptHTTPStatus || dead.LastStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Unexpected dead delivery %+v", dead)
+	}
+	var deadList []model.WebhookDelivery
+	do(http.MethodGet, "/webhooks/"+hook.ID+"/deliveries?status=dead", "", http.StatusOK, &deadList)
+	if len(deadList) != 1 {
+		t.Fatalf("Expected 1 dead delivery, got %d", len(deadList))
+	}
+
+	// A manual retry reaches the fixed receiver.
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	do(http.MethodPost, "/webhooks/"+hook.ID+"/deliveries/"+id+"/retry", "", http.StatusAccepted, nil)
+	select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the retried delivery")
+	}
+	var delivered model.WebhookDelivery
+	for deadline := time.Now().Add(5 * time.Second); delivered.Status != model.DeliveryDelivered; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a delivered delivery, got %+v", delivered)
+		}
+		time.Sleep(10 * time.Millisecond)
+		do(http.MethodGet, "/webhooks/"+hook.ID+"/deliveries/"+id, "", http.StatusOK, &delivered)
+	}
+
+	do(http.MethodGet, "/webhooks/"+hook.ID+"/deliveries?limit=0", "", http.StatusBadRequest, nil)
+	do(http.MethodGet, "/webhooks/"+hook.ID+"/deliveries/abc", "", http.StatusNotFound, nil)
+	do(http.MethodGet, "/webhooks/"+hook.ID+"/deliveries/"+id+"/retry", "", http.StatusMethodNotAllowed, nil)
+	do(http.MethodGet, "/webhooks/"+hook.ID+"/a/b/c", "", http.StatusNotFound, nil)
+
+	var updated model.Webhook
+	do(http.MethodPut, "/webhooks/"+hook.ID, `{"url":"`+receiver.URL+`/v2"}`, http.StatusOK, &updated)
+	if updated.URL != receiver.URL+"/v2" || len(updated.Events) != 3 {
+		t.Fatalf("Expected the changed webhook, got %+v", updated)
+	}
+	if updated.Secret == "" || updated.Secret == hook.Secret {
+		t.Fatalf("Expected a new secret for the new URL, got %q", updated.Secret)
+	}
+	do(http.MethodDelete, "/webhooks/"+hook.ID, "", http.StatusNoContent, nil)
+	do(http.MethodGet, "/webhooks/"+hook.ID, "", http.StatusNotFound, nil)
+	do(http.MethodGet, "/webhooks/"+hook.ID+"/deliveries", "", http.StatusNotFound, nil)
+}
+
+func TestAddRoutes_GraphQL(t *testing.T) {
+	server := newTestServer(t)
+
+	type response struct {
+		Data map[string]json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+			Extensions map[string]any `json:"extensions"`
+		} `json:"errors"`
+	}
+	do := func(method, path, body string, wantStatus int, v any) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("NewRequest failed: %v", err)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer func () {
+			if err := res.Body.Close(); err != nil {
+				t.Fatalf("Failed to close response body: %v", err)
+			}
+		}()
+		if res.StatusCode != wantStatus {
+			t.Fatalf("Expected status %d, got %d", wantStatus, res.StatusCode)
+		}
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+
+	var created response
+	do(http.MethodPost, "/graphql", `{"query":"mutation ($in: CreateProductInput!) { createProduct(input: $in) { id name } }","variables":{"in":{"name":"Coffee","price":499}}}`, http.StatusOK, &created)
+	var product model.Product
+	if err := json.Unmarshal(created.Data["createProduct"], &product); err != nil || product.ID == "" || len(created.Errors) != 0 {
+		t.Fatalf("Expected the created product, got %+v", created)
+	}
+
+	var got response
+	query := `{ product(id: "` + product.ID + `") { name history { type price } } }`
+	do(http.MethodGet, "/graphql?query="+url.QueryEscape(query), "", http.StatusOK, &got)
+	if want := `{"name":"Coffee","history":[{"type":"CREATED","price":499}]}`; string(got.Data["product"]) != want {
+		t.Fatalf("Expected %s, got %s", want, got.Data["product"])
+	}
+
+	var rejected response
+	do(http.MethodGet, "/graphql?query="+url.QueryEscape(`mutation { deleteProduct(id: "`+product.ID+`") }`), "", http.StatusOK, &rejected)
+	if len(rejected.Errors) != 1 || rejected.Errors[0].Extensions["code"] != "validation_failed" {
+		t.Fatalf("Expected a mutation over GET to be rejected, got %+v", rejected)
+	}
+
+	var empty problem.Details
+	do(http.MethodPost, "/graphql", `{"query":""}`, http.StatusBadRequest, &empty)
+	if empty.Code != "validation_failed" || len(empty.Violations) != 1 || empty.Violations[0].Pointer != "/query" {
+		t.Fatalf("Expected a violation for the empty query, got %+v", empty)
+	}
+
+	res, err := http.Get(server.URL + "/graphql/schema")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func () {
+		if err := res.Body.Close(); err != nil {
+			t.Fatalf("Failed to close response body: %v", err)
+		}
+	}()
+	sdl, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if !strings.Contains(string(sdl), "type Query {") {
+		t.Fatalf("Expected the schema, got %q", sdl)
+	}
+}
+
+func TestAddRoutes_AdminBackups(t *testing.T) {
+	db := testdb.Open(t)
+	cfg := db.Config
+	cfg.ADMIN_TOKEN = "0123456789abcdef"
+	svc := service.NewProductService(db.Products)
+	backups := backup.NewManager(db.DB, filepath.Join(t.TempDir(), "backups"), 2)
+	server := httptest.NewServer(AddRoutes(cfg, Dependencies{Products: svc, Backups: backups}))
+	t.Cleanup(server.Close)
+
+	do := func(method, token string, wantStatus int, v any) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+"/admin/backups", nil)
+		if err != nil {
+			t.Fatalf("NewRequest failed: %v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		defer func () {
+			if err := res.Body.Close(); err != nil {
+				t.Fatalf("Failed to close response body: %v", err)
+			}
+		}()
+		if res.StatusCode != wantStatus {
+			t.Fatalf("%s with token %q: expected status %d, got %d", method, token, wantStatus, res.StatusCode)
+		}
+		if v != nil {
+			if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+	}
+
+	var denied problem.Details
+	do(http.MethodPost, "", http.StatusUnauthorized, &denied)
+	if denied.Code != "unauthorized" {
+		t.Fatalf("Expected an unauthorized problem, got %+v", denied)
+	}
+	do(http.MethodGet, "wrong-token", http.StatusUnauthorized, nil)
+
+	var created backup.Info
+	do(http.MethodPost, cfg.ADMIN_TOKEN, http.StatusCreated, &created)
+	if created.Name == "" || created.Size == 0 {
+		t.Fatalf("Expected the created backup, got %+v", created)
+	}
+	var listed []backup.Info
+	do(http.MethodGet, cfg.ADMIN_TOKEN, http.StatusOK, &listed)
+	if len(listed) != 1 || listed[0].Name != created.Name {
+		t.Fatalf("Expected the backup to be listed, got %+v", listed)
+	}
+	do(http.MethodDelete, cfg.ADMIN_TOKEN, http.StatusMethodNotAllowed, nil)
+
+	// Without a token the admin routes do not exist.
+	cfg.ADMIN_TOKEN = ""
+	server = httptest.NewServer(AddRoutes(cfg, Dependencies{Products: svc, Backups: backups}))
+	t.Cleanup(server.Close)
+	do(http.MethodGet, "", http.StatusNotFound, nil)
+}
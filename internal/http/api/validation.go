@@ -1,39 +1,326 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
 	"strings"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+const (
+	maxNameLength = model.MaxNameLength
+	nameSymbols = model.NameSymbols
+)
+
+// Validation rules reported in violations. They are part of the API
+// contract like the problem codes. The rules of product fields are those
+// of model.ValidateProduct.
+const (
+	ruleRequired = model.RuleRequired
+	ruleMaxLength = model.RuleMaxLength
+	rulePattern = model.RulePattern
+	ruleMinimum = model.RuleMinimum
+	ruleMaximum = model.RuleMaximum
+	ruleType = "type"
+	ruleUnknownField = "unknown_field"
+	ruleMinProperties = "min_properties"
+	ruleReadOnly = "read_only"
+	ruleEnum = "enum"
+	ruleMinItems = "min_items"
+	ruleMaxItems = "max_items"
 )
 
-func validateCreate(req CreateProductRequest) error {
-	if strings.TrimSpace(req.Name) == "" {
-		return ErrInvalidName
+// ValidationError reports every violation found in a request body.
+type ValidationError struct {
+	Violations []problem.Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Pointer + ": " + v.Message
+	}
+	return ErrValidation.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns ErrValidation, or the error with the older code of the
+// failure if there is one: ErrInvalidName or ErrInvalidPrice if only the
+// product name or price is invalid, ErrEmptyPatch for a patch that sets no
+// field.
+func (e *ValidationError) Unwrap() error {
+	switch {
+		case len(e.Violations) == 1 && e.Violations[0].Rule == ruleMinProperties:
+			return ErrEmptyPatch
+		case e.only("/name"):
+			return ErrInvalidName
+		case e.only("/price"):
+			return ErrInvalidPrice
+	}
+	return ErrValidation
+}
+
+// only reports whether every violation is at pointer.
+func (e *ValidationError) only(pointer string) bool {
+	for _, v := range e.Violations {
+		if v.Pointer != pointer {
+			return false
+		}
+	}
+	return len(e.Violations) > 0
+}
+
+// validator collects violations so a request is rejected with all of its
+// problems at once instead of only the first one.
+type validator struct {
+	violations []problem.Violation
+}
+
+func (v *validator) add(pointer, rule, message string) {
+	v.violations = append(v.violations, problem.Violation{Pointer: pointer, Rule: rule, Message: message})
+}
+
+// failed reports whether pointer already has a violation, so a mistyped
+// field is not reported a second time by its value rules.
+func (v *validator) failed(pointer string) bool {
+	for _, violation := range v.violations {
+		if violation.Pointer == pointer {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: v.violations}
+}
+
+// product adds the violations of a product field at pointer, unless the
+// field was already found to be mistyped.
+func (v *validator) product(pointer string, violations []model.Violation) {
+	if v.failed(pointer) {
+		return
+	}
+	for _, violation := range violations {
+		v.add(pointer, violation.Rule, violation.Message)
+	}
+}
+
+func (v *validator) name(pointer, name string) {
+	v.product(pointer, model.ValidateName(name))
+}
+
+func (v *validator) price(pointer string, price int64) {
+	v.product(pointer, model.ValidatePrice(price))
+}
+
+// request is a decoded request body that knows its own rules.
+type request interface {
+	validate(v *validator)
+}
+
+// readRequest decodes the JSON body of r into req and validates it. Unknown
+// fields and values of the wrong type are reported as violations together
+// with the rules of req. The body must be exactly one JSON value sent as
+// application/json; anything else fails with ErrUnsupportedMediaType,
+// ErrBodyTooLarge or ErrInvalidJSON.
+func readRequest(r *http.Request, req request) error {
+	if _, err := checkContentType(r, jsonContentType); err != nil {
+		return err
+	}
+	data, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	return decodeRequest(data, req)
+}
+
+// decodeRequest decodes and validates a JSON object held in data.
+func decodeRequest(data []byte, req request) error {
+	var v validator
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !isUnknownField(err) && (!errors.As(err, &typeErr) || typeErr.Field == "") {
+			return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+		}
+		if err := decodeFields(data, req, &v); err != nil {
+			return err
+		}
+	}
+
+	req.validate(&v)
+	return v.err()
+}
+
+const jsonContentType = "application/json"
+
+// checkContentType returns the media type of the request body and fails
+// with ErrUnsupportedMediaType unless it is one of allowed. Parameters such
+// as charset are ignored.
+func checkContentType(r *http.Request, allowed ...string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !slices.Contains(allowed, mediaType) {
+		return "", fmt.Errorf("%w: expected %s", ErrUnsupportedMediaType, strings.Join(allowed, " or "))
+	}
+	return mediaType, nil
+}
+
+// readBody reads the whole body and checks that it holds a single JSON
+// value, so trailing data is not silently ignored.
+func readBody(r *http.Request) ([]byte, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, bodyError(err, ErrInvalidJSON)
+	}
+	if err := checkSingleValue(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// bodyError classifies an error reading the request body: an exceeded body
+// limit is ErrBodyTooLarge, anything else wraps malformed.
+func bodyError(err, malformed error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return fmt.Errorf("%w: the request body exceeds %d bytes", ErrBodyTooLarge, maxErr.Limit)
+	}
+	return fmt.Errorf("%w: %v", malformed, err)
+}
+
+// checkSingleValue fails with ErrInvalidJSON unless data is exactly one
+// JSON value.
+func checkSingleValue(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var value json.RawMessage
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
 	}
-	if req.Price <= 0 {
-		return ErrInvalidPrice
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("%w: unexpected data after the JSON value", ErrInvalidJSON)
 	}
-	
 	return nil
 }
 
-func validateUpdate(req UpdateProductRequest) error {
-	if strings.TrimSpace(req.Name) == "" {
-		return ErrInvalidName
+// isUnknownField reports whether err comes from DisallowUnknownFields. The
+// decoder has no typed error for it.
+func isUnknownField(err error) bool {
+	return strings.HasPrefix(err.Error(), "json: unknown field ")
+}
+
+// decodeFields decodes data into req one field at a time, so that every
+// unknown or mistyped field is found rather than only the first.
+func decodeFields(data []byte, req any, v *validator) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
 	}
-	if req.Price <= 0 {
-		return ErrInvalidPrice
+
+	fields := jsonFields(req)
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		value := raw[key]
+		f, ok := lookupField(fields, key)
+		if !ok {
+			v.add(pointer(key), ruleUnknownField, "is not a known field")
+			continue
+		}
+		if err := json.Unmarshal(value, f.Addr().Interface()); err != nil {
+			v.add(pointer(key), ruleType, "must be "+describe(f.Type()))
+		}
 	}
 	return nil
 }
 
-func validatePatch(req PatchProductRequest) error {
-	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
-		return ErrInvalidName
+func jsonFields(req any) map[string]reflect.Value {
+	s := reflect.ValueOf(req).Elem()
+	fields := make(map[string]reflect.Value)
+	for i := range s.NumField() {
+		name, _, _ := strings.Cut(s.Type().Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = s.Field(i)
+		}
 	}
-	if req.Price != nil && *req.Price <= 0 {
-		return ErrInvalidPrice
+	return fields
+}
+
+// lookupField matches key the way encoding/json does, preferring an exact
+// match over a case-insensitive one.
+func lookupField(fields map[string]reflect.Value, key string) (reflect.Value, bool) {
+	if f, ok := fields[key]; ok {
+		return f, true
+	}
+	for name, f := range fields {
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func describe(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return describe(t.Elem())
+	case reflect.String:
+		return "a string"
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.Slice:
+		return "an array"
+	default:
+		return "a " + t.Kind().String()
 	}
+}
+
+// pointer returns the RFC 6901 JSON pointer to a top-level member.
+func pointer(key string) string {
+	return "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+func (req *CreateProductRequest) validate(v *validator) {
+	v.name("/name", req.Name)
+	v.price("/price", req.Price)
+}
+
+func (req *UpdateProductRequest) validate(v *validator) {
+	v.name("/name", req.Name)
+	v.price("/price", req.Price)
+}
+
+func (req *PatchProductRequest) validate(v *validator) {
 	if req.Name == nil && req.Price == nil {
-		return ErrEmptyPatch
+		if len(v.violations) > 0 {
+			return
+		}
+		v.add("", ruleMinProperties, "at least one of name or price must be set")
+		return
 	}
-	return nil
+	if req.Name != nil {
+		v.name("/name", *req.Name)
+	}
+	if req.Price != nil {
+		v.price("/price", *req.Price)
+	}
+}
+
+func (d *productDocument) validate(v *validator) {
+	if d.ID != d.storedID {
+		v.add("/id", ruleReadOnly, "cannot be changed")
+	}
+	v.name("/name", d.Name)
+	v.price("/price", d.Price)
 }
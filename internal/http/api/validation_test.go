@@ -0,0 +1,153 @@
+package api
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+)
+
+func TestReadRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req request
+		body string
+		want []problem.Violation
+		wantErr error
+	}{
+		{
+			name: "Valid create",
+			req: &CreateProductRequest{},
+			body: `{"name":"Café au lait (large)","price":499}`,
+		},
+		{
+			name: "All create violations",
+			req: &CreateProductRequest{},
+			body: `{"name":"","price":0}`,
+			want: []problem.Violation{
+				{Pointer: "/name", Rule: "required", Message: "must not be empty"},
+				{Pointer: "/price", Rule: "minimum", Message: "must be greater than 0"},
+			},
+		},
+		{
+			name: "Name too long and price too high",
+			req: &UpdateProductRequest{},
+			body: `{"name":"` + strings.Repeat("a", maxNameLength+1) + `","price":100000001}`,
+			want: []problem.Violation{
+				{Pointer: "/name", Rule: "max_length", Message: "must be at most 100 characters"},
+				{Pointer: "/price", Rule: "maximum", Message: "must be at most 100000000"},
+			},
+		},
+		{
+			name: "Disallowed characters",
+			req: &UpdateProductRequest{},
+			body: `{"name":"<script>","price":1}`,
+			want: []problem.Violation{
+				{Pointer: "/name", Rule: "pattern", Message: "may only contain letters, digits, spaces and " + nameSymbols},
+			},
+		},
+		{
+			name: "Unknown and mistyped fields",
+			req: &CreateProductRequest{},
+			body: `{"name":"Tea","price":"cheap","color":"red","a/b":1}`,
+			want: []problem.Violation{
+				{Pointer: "/a~1b", Rule: "unknown_field", Message: "is not a known field"},
+				{Pointer: "/color", Rule: "unknown_field", Message: "is not a known field"},
+				{Pointer: "/price", Rule: "type", Message: "must be an integer"},
+			},
+		},
+		{
+			name: "Empty patch",
+			req: &PatchProductRequest{},
+			body: `{}`,
+			want: []problem.Violation{
+				{Pointer: "", Rule: "min_properties", Message: "at least one of name or price must be set"},
+			},
+		},
+		{
+			name: "Mistyped patch",
+			req: &PatchProductRequest{},
+			body: `{"name":42}`,
+			want: []problem.Violation{
+				{Pointer: "/name", Rule: "type", Message: "must be a string"},
+			},
+		},
+		{
+			name: "Patch checks only present fields",
+			req: &PatchProductRequest{},
+			body: `{"price":-1}`,
+			want: []problem.Violation{
+				{Pointer: "/price", Rule: "minimum", Message: "must be greater than 0"},
+			},
+		},
+		{
+			name: "Valid webhook",
+			req: &WebhookRequest{},
+			body: `{"url":"https://partner.example/hooks?source=market","events":["created","deleted"]}`,
+		},
+		{
+			name: "Webhook violations",
+			req: &WebhookRequest{},
+			body: `{"url":"partner.example/hooks","events":["created","renamed"]}`,
+			want: []problem.Violation{
+				{Pointer: "/url", Rule: "pattern", Message: "must be an absolute http or https URL"},
+				{Pointer: "/events/1", Rule: "enum", Message: "must be created, updated or deleted"},
+			},
+		},
+		{
+			name: "Webhook without URL",
+			req: &WebhookRequest{},
+			body: `{"events":"created"}`,
+			want: []problem.Violation{
+				{Pointer: "/events", Rule: "type", Message: "must be an array"},
+				{Pointer: "/url", Rule: "required", Message: "must not be empty"},
+			},
+		},
+		{
+			name: "Malformed JSON",
+			req: &CreateProductRequest{},
+			body: `{"name":`,
+			wantErr: ErrInvalidJSON,
+		},
+		{
+			name: "Not an object",
+			req: &CreateProductRequest{},
+			body: `["Tea"]`,
+			wantErr: ErrInvalidJSON,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("POST", "/products", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			err := readRequest(r, tt.req)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Expected a ValidationError, got %v", err)
+			}
+			if !reflect.DeepEqual(verr.Violations, tt.want) {
+				t.Fatalf("Expected violations %+v, got %+v", tt.want, verr.Violations)
+			}
+		})
+	}
+}
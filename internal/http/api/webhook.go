@@ -0,0 +1,400 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+const (
+	maxWebhookURL = 2048
+	// maxWebhookBody is the largest webhook registration accepted: a URL
+	// and a few event names.
+	maxWebhookBody = 8 << 10
+	defaultDeliveryPage = 50
+	maxDeliveryPage = 100
+)
+
+var webhookEvents = []string{string(service.EventCreated), string(service.EventUpdated), string(service.EventDeleted)}
+
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, url string, events []string) (*model.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]model.Webhook, error)
+	GetWebhook(ctx context.Context, id string) (*model.Webhook, error)
+	UpdateWebhook(ctx context.Context, id string, url string, events []string) (*model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	ListDeliveries(ctx context.Context, webhookID string, status model.DeliveryStatus, before int64, limit int) ([]model.WebhookDelivery, error)
+	GetDelivery(ctx context.Context, webhookID string, id int64) (*model.WebhookDelivery, error)
+	RetryDelivery(ctx context.Context, webhookID string, id int64) (*model.WebhookDelivery, error)
+}
+
+type WebhookHandler struct {
+	service WebhookService
+	timeout atomic.Int64
+}
+
+func NewWebhookHandler(s WebhookService, cfg *config.Config) *WebhookHandler {
+	h := &WebhookHandler{service: s}
+	h.Reconfigure(cfg)
+	return h
+}
+
+// Reconfigure applies the reloadable handler settings. It is safe to call
+// while requests are being served.
+func (h *WebhookHandler) Reconfigure(cfg *config.Config) {
+	h.timeout.Store(int64(time.Duration(cfg.TIMEOUT) * time.Second))
+}
+
+func (h *WebhookHandler) requestTimeout() time.Duration {
+	return time.Duration(h.timeout.Load())
+}
+
+func (req *WebhookRequest) validate(v *validator) {
+	if !v.failed("/url") {
+		u, err := url.Parse(req.URL)
+		switch {
+			case req.URL == "":
+				v.add("/url", ruleRequired, "must not be empty")
+			case len(req.URL) > maxWebhookURL:
+				v.add("/url", ruleMaxLength, fmt.Sprintf("must be at most %d characters", maxWebhookURL))
+			case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+				v.add("/url", rulePattern, "must be an absolute http or https URL")
+		}
+	}
+	if v.failed("/events") {
+		return
+	}
+	for i, e := range req.Events {
+		if !slices.Contains(webhookEvents, e) {
+			v.add("/events/"+strconv.Itoa(i), ruleEnum, "must be created, updated or deleted")
+		}
+	}
+}
+
+// ListWebhooks godoc
+// @Summary      List webhooks
+// @Description  Returns every registered webhook. Secrets are not included.
+// @Tags         webhooks
+// @Produce      json
+// @Security     AdminToken
+// @Success      200  {array}   model.Webhook
+// @Failure      401  {object}  ProblemDetails
+// @Failure      408  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Failure      503  {object}  ProblemDetails
+// @Router       /webhooks [get]
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+
+	webhooks, err := h.service.ListWebhooks(ctx)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(webhooks); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
+
+// CreateWebhook godoc
+// @Summary      Register a webhook
+// @Description  Registers a URL that receives the product changes made from now on, limited to the given event types. The response contains the secret that signs every delivery; it is not shown again.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     AdminToken
+// @Param        payload  body      WebhookRequest  true  "Webhook to register"
+// @Success      201      {object}  model.Webhook
+// @Failure      400      {object}  ProblemDetails
+// @Failure      401      {object}  ProblemDetails
+// @Failure      408      {object}  ProblemDetails
+// @Failure      413      {object}  ProblemDetails
+// @Failure      415      {object}  ProblemDetails
+// @Failure      500      {object}  ProblemDetails
+// @Failure      503      {object}  ProblemDetails
+// @Router       /webhooks [post]
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+
+	var req WebhookRequest
+	if err := readRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	webhook, err := h.service.CreateWebhook(ctx, req.URL, req.Events)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/webhooks/"+webhook.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(webhook); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
+
+// GetWebhook godoc
+// @Summary      Get a webhook
+// @Tags         webhooks
+// @Produce      json
+// @Security     AdminToken
+// @Param        id   path      string  true  "Webhook ID"
+// @Success      200  {object}  model.Webhook
+// @Failure      401  {object}  ProblemDetails
+// @Failure      404  {object}  ProblemDetails
+// @Failure      408  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Failure      503  {object}  ProblemDetails
+// @Router       /webhooks/{id} [get]
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+
+	webhook, err := h.service.GetWebhook(ctx, r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if webhook == nil {
+		writeError(w, r, service.ErrWebhookNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(webhook); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
+
+// UpdateWebhook godoc
+// @Summary      Change a webhook
+// @Description  Replaces the URL and event types of a webhook. A new URL also gets a new secret, which is returned in the response and not shown again; changing only the event types keeps the secret.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     AdminToken
+// @Param        id       path      string          true  "Webhook ID"
+// @Param        payload  body      WebhookRequest  true  "New URL and event types"
+// @Success      200      {object}  model.Webhook
+// @Failure      400      {object}  ProblemDetails
+// @Failure      401      {object}  ProblemDetails
+// @Failure      404      {object}  ProblemDetails
+// @Failure      408      {object}  ProblemDetails
+// @Failure      413      {object}  ProblemDetails
+// @Failure      415      {object}  ProblemDetails
+// @Failure      500      {object}  ProblemDetails
+// @Failure      503      {object}  ProblemDetails
+// @Router       /webhooks/{id} [put]
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+
+	var req WebhookRequest
+	if err := readRequest(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	webhook, err := h.service.UpdateWebhook(ctx, r.PathValue("id"), req.URL, req.Events)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(webhook); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
+
+// DeleteWebhook godoc
+// @Summary      Delete a webhook
+// @Description  Deletes a webhook together with its delivery log. Pending deliveries are not sent.
+// @Tags         webhooks
+// @Security     AdminToken
+// @Param        id   path  string  true  "Webhook ID"
+// @Success      204
+// @Failure      401  {object}  ProblemDetails
+// @Failure      404  {object}  ProblemDetails
+// @Failure      408  {object}  ProblemDetails
+// @Failure      500  {object}  ProblemDetails
+// @Failure      503  {object}  ProblemDetails
+// @Router       /webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+
+	if err := h.service.DeleteWebhook(ctx, r.PathValue("id")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deliveryQuery reads the filters of a delivery listing.
+func deliveryQuery(q url.Values) (model.DeliveryStatus, int64, int, error) {
+	status := model.DeliveryStatus(q.Get("status"))
+	switch status {
+		case "", model.DeliveryPending, model.DeliveryDelivered, model.DeliveryDead:
+		default:
+			return "", 0, 0, fmt.Errorf("%w: status must be pending, delivered or dead", ErrInvalidParameter)
+	}
+
+	var before int64
+	if s := q.Get("before"); s != "" {
+		var err error
+		if before, err = strconv.ParseInt(s, 10, 64); err != nil || before < 1 {
+			return "", 0, 0, fmt.Errorf("%w: before must be a delivery ID", ErrInvalidParameter)
+		}
+	}
+
+	limit := defaultDeliveryPage
+	if s := q.Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > maxDeliveryPage {
+			return "", 0, 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidParameter, maxDeliveryPage)
+		}
+	}
+	return status, before, limit, nil
+}
+
+// ListDeliveries godoc
+// @Summary      List the deliveries of a webhook
+// @Description  Returns the delivery log of a webhook, newest first. Pass the last ID of a page as before to get the next one. Dead deliveries failed on every attempt and are no longer retried.
+// @Tags         webhooks
+// @Produce      json
+// @Security     AdminToken
+// @Param        id      path      string  true   "Webhook ID"
+// @Param        status  query     string  false  "Only deliveries with this status"  Enums(pending, delivered, dead)
+// @Param        before  query     int     false  "Only deliveries older than this delivery ID"
+// @Param        limit   query     int     false  "Page size, 1 to 100"  default(50)
+// @Success      200     {array}   model.WebhookDelivery
+// @Failure      400     {object}  ProblemDetails
+// @Failure      401     {object}  ProblemDetails
+// @Failure      404     {object}  ProblemDetails
+// @Failure      408     {object}  ProblemDetails
+// @Failure      500     {object}  ProblemDetails
+// @Failure      503     {object}  ProblemDetails
+// @Router       /webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+
+	status, before, limit, err := deliveryQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(ctx, r.PathValue("id"), status, before, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
+
+// deliveryID parses the delivery ID of the path. Anything but a positive
+// integer names no delivery.
+func deliveryID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("delivery"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, service.ErrDeliveryNotFound
+	}
+	return id, nil
+}
+
+// GetDelivery godoc
+// @Summary      Get a webhook delivery
+// @Description  Returns a delivery with the log of its attempts. The error of a failed attempt only names the kind of failure; the server log has the full error.
+// @Tags         webhooks
+// @Produce      json
+// @Security     AdminToken
+// @Param        id        path      string  true  "Webhook ID"
+// @Param        delivery  path      int     true  "Delivery ID"
+// @Success      200       {object}  model.WebhookDelivery
+// @Failure      401       {object}  ProblemDetails
+// @Failure      404       {object}  ProblemDetails
+// @Failure      408       {object}  ProblemDetails
+// @Failure      500       {object}  ProblemDetails
+// @Failure      503       {object}  ProblemDetails
+// @Router       /webhooks/{id}/deliveries/{delivery} [get]
+func (h *WebhookHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+
+	id, err := deliveryID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	delivery, err := h.service.GetDelivery(ctx, r.PathValue("id"), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if delivery == nil {
+		writeError(w, r, service.ErrDeliveryNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(delivery); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
+
+// RetryDelivery godoc
+// @Summary      Retry a webhook delivery
+// @Description  Sends a dead or delivered delivery once more, typically after the receiver was fixed. Retrying a pending delivery fails with delivery_pending.
+// @Tags         webhooks
+// @Produce      json
+// @Security     AdminToken
+// @Param        id        path      string  true  "Webhook ID"
+// @Param        delivery  path      int     true  "Delivery ID"
+// @Success      202       {object}  model.WebhookDelivery
+// @Failure      401       {object}  ProblemDetails
+// @Failure      404       {object}  ProblemDetails
+// @Failure      408       {object}  ProblemDetails
+// @Failure      409       {object}  ProblemDetails
+// @Failure      500       {object}  ProblemDetails
+// @Failure      503       {object}  ProblemDetails
+// @Router       /webhooks/{id}/deliveries/{delivery}/retry [post]
+func (h *WebhookHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	defer cancel()
+
+	id, err := deliveryID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	delivery, err := h.service.RetryDelivery(ctx, r.PathValue("id"), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(delivery); err != nil {
+		slog.Error("Failed to encode JSON response", "err", err)
+	}
+}
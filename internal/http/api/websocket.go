@@ -0,0 +1,333 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+const (
+	wsSubscribe = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+
+	// wsMaxMessage is the largest client message accepted. A subscription
+	// with the most product IDs is well below it.
+	wsMaxMessage = 8 << 10
+	wsMaxSubscriptionID = 64
+	wsMaxProductIDs = 100
+)
+
+// wsUpgrader keeps the default origin check, so browsers can only connect
+// from pages served by the API itself.
+var wsUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+func (req *WebSocketRequest) validate(v *validator) {
+	if !v.failed("/type") {
+		switch req.Type {
+			case wsSubscribe, wsUnsubscribe:
+			case "":
+				v.add("/type", ruleRequired, "must be subscribe or unsubscribe")
+			default:
+				v.add("/type", ruleEnum, "must be subscribe or unsubscribe")
+		}
+	}
+	if !v.failed("/id") {
+		if req.ID == "" {
+			v.add("/id", ruleRequired, "must not be empty")
+		} else if len(req.ID) > wsMaxSubscriptionID {
+			v.add("/id", ruleMaxLength, fmt.Sprintf("must be at most %d characters", wsMaxSubscriptionID))
+		}
+	}
+	if req.Type != wsSubscribe {
+		return
+	}
+
+	if !v.failed("/product_ids") {
+		if len(req.ProductIDs) > wsMaxProductIDs {
+			v.add("/product_ids", ruleMaxItems, fmt.Sprintf("must contain at most %d IDs", wsMaxProductIDs))
+		}
+		for i, id := range req.ProductIDs {
+			if id == "" {
+				v.add("/product_ids/"+strconv.Itoa(i), ruleRequired, "must not be empty")
+			}
+		}
+	}
+	if req.MinPrice != nil && *req.MinPrice < 0 {
+		v.add("/min_price", ruleMinimum, "must not be negative")
+	}
+	if req.MaxPrice != nil && !v.failed("/max_price") {
+		if *req.MaxPrice < 0 {
+			v.add("/max_price", ruleMinimum, "must not be negative")
+		} else if req.MinPrice != nil && *req.MaxPrice < *req.MinPrice {
+			v.add("/max_price", ruleMinimum, "must not be less than min_price")
+		}
+	}
+}
+
+// productFilter selects the changes a subscription receives. Deleted
+// products are matched as they were last stored.
+type productFilter struct {
+	ids map[string]struct{}
+	minPrice *int64
+	maxPrice *int64
+}
+
+func newProductFilter(req *WebSocketRequest) productFilter {
+	f := productFilter{minPrice: req.MinPrice, maxPrice: req.MaxPrice}
+	if len(req.ProductIDs) > 0 {
+		f.ids = make(map[string]struct{}, len(req.ProductIDs))
+		for _, id := range req.ProductIDs {
+			f.ids[id] = struct{}{}
+		}
+	}
+	return f
+}
+
+func (f productFilter) matches(p model.Product) bool {
+	if f.ids != nil {
+		if _, ok := f.ids[p.ID]; !ok {
+			return false
+		}
+	}
+	if f.minPrice != nil && p.Price < *f.minPrice {
+		return false
+	}
+	return f.maxPrice == nil || p.Price <= *f.maxPrice
+}
+
+// wsClient is the state of one WebSocket connection. Only the handler
+// goroutine writes messages; gorilla/websocket allows a single writer.
+type wsClient struct {
+	conn *websocket.Conn
+	filters map[string]productFilter
+	maxFilters int
+}
+
+func (c *wsClient) send(msg WebSocketMessage) error {
+	// A client that does not accept a message in time is too slow and is
+	// disconnected, so messages never queue up in server memory.
+	if err := c.conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout)); err != nil {
+		return err
+	}
+	return c.conn.WriteJSON(msg)
+}
+
+// handle applies one client request and returns the reply.
+func (c *wsClient) handle(data []byte) WebSocketMessage {
+	var req WebSocketRequest
+	err := checkSingleValue(data)
+	if err == nil {
+		err = decodeRequest(data, &req)
+	}
+	if err == nil {
+		err = c.apply(&req)
+	}
+	if err != nil {
+		p, ok := problemFor(err)
+		if !ok {
+			slog.Error("WebSocket request failed", "err", err)
+			p = problem.New(http.StatusInternalServerError, "internal_error", "Internal error", "")
+		}
+		return WebSocketMessage{Type: "error", ID: req.ID, Error: &p}
+	}
+	if req.Type == wsUnsubscribe {
+		return WebSocketMessage{Type: "unsubscribed", ID: req.ID}
+	}
+	return WebSocketMessage{Type: "subscribed", ID: req.ID}
+}
+
+func (c *wsClient) apply(req *WebSocketRequest) error {
+	_, exists := c.filters[req.ID]
+	switch req.Type {
+		case wsSubscribe:
+			if !exists && len(c.filters) >= c.maxFilters {
+				return fmt.Errorf("%w: a connection can have at most %d subscriptions", ErrTooManySubscriptions, c.maxFilters)
+			}
+			if !exists {
+				metrics.WebSocketSubscriptions.Inc()
+			}
+			c.filters[req.ID] = newProductFilter(req)
+		case wsUnsubscribe:
+			if !exists {
+				return fmt.Errorf("%w: %q", ErrSubscriptionNotFound, req.ID)
+			}
+			delete(c.filters, req.ID)
+			metrics.WebSocketSubscriptions.Dec()
+	}
+	return nil
+}
+
+// matching returns the subscriptions that match p, in a stable order.
+func (c *wsClient) matching(p model.Product) []string {
+	var ids []string
+	for id, f := range c.filters {
+		if f.matches(p) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// ProductUpdates godoc
+// @Summary      Subscribe to product updates over WebSocket
+// @Description  Upgrades to a WebSocket on which the client subscribes to filtered product changes. Clients send WebSocketRequest messages to subscribe to product IDs and price ranges or to unsubscribe, and receive WebSocketMessage messages: a confirmation or error per request, and an event with the ids of every matching subscription per change made after the connection opened. A reset message means changes were missed. The server pings every EVENTS_HEARTBEAT seconds and closes connections that do not answer, or that do not accept messages in time. At most WS_MAX_CONNECTIONS connections with WS_MAX_SUBSCRIPTIONS subscriptions each are served.
+// @Tags         products
+// @Param        payload  body      WebSocketRequest  false  "Messages sent by the client"
+// @Success      101      {object}  WebSocketMessage  "Messages sent by the server"
+// @Failure      400      {object}  ProblemDetails
+// @Failure      500      {object}  ProblemDetails
+// @Failure      503      {object}  ProblemDetails
+// @Router       /products/ws [get]
+func (h *ProductHandler) ProductUpdates(w http.ResponseWriter, r *http.Request) {
+	if h.wsConns.Add(1) > h.wsMaxConns {
+		h.wsConns.Add(-1)
+		writeError(w, r, fmt.Errorf("%w: at most %d WebSocket connections are served", ErrTooManyConnections, h.wsMaxConns))
+		return
+	}
+	defer h.wsConns.Add(-1)
+
+	// Subscribe before reading the latest position, so a change in between
+	// is not missed.
+	changes, unsubscribe := h.service.SubscribeChanges()
+	defer unsubscribe()
+
+	ctx, cancel := context.WithTimeoutCause(r.Context(), h.requestTimeout(), context.DeadlineExceeded)
+	after, err := h.service.LatestEventID(ctx)
+	cancel()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered the request.
+		return
+	}
+	defer conn.Close()
+
+	metrics.WebSocketConnections.Inc()
+	defer metrics.WebSocketConnections.Dec()
+	c := &wsClient{conn: conn, filters: make(map[string]productFilter), maxFilters: h.wsMaxSubs}
+	defer func () {
+		metrics.WebSocketSubscriptions.Sub(float64(len(c.filters)))
+	}()
+
+	// Pings go out every heartbeat; a client that answers neither them nor
+	// with a message of its own for two heartbeats is gone.
+	pongWait := 2 * h.heartbeat
+	conn.SetReadLimit(wsMaxMessage)
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	requests := make(chan []byte)
+	readErr := make(chan error, 1)
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+			select {
+				case requests <- data:
+				case <-stopped:
+					return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(h.heartbeat)
+	defer ping.Stop()
+	for err == nil {
+		select {
+			case <-h.done:
+				_ = conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+					time.Now().Add(time.Second),
+				)
+				return
+			case err = <-readErr:
+				if isTimeout(err) {
+					metrics.WebSocketDropped.WithLabelValues("pong_timeout").Inc()
+				}
+				return
+			case data := <-requests:
+				err = c.send(c.handle(data))
+			case <-changes:
+				after, err = h.sendUpdates(r.Context(), c, after)
+			case <-ping.C:
+				err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout))
+				if err == nil {
+					// Also catches changes made by other server instances.
+					after, err = h.sendUpdates(r.Context(), c, after)
+				}
+		}
+	}
+
+	if isTimeout(err) {
+		metrics.WebSocketDropped.WithLabelValues("slow_client").Inc()
+	} else if !errors.Is(err, net.ErrClosed) && !errors.Is(err, context.Canceled) {
+		slog.Warn("WebSocket closed", "method", r.Method, "path", r.URL.Path, "err", err)
+		_ = conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, ""),
+			time.Now().Add(time.Second),
+		)
+	}
+}
+
+// sendUpdates sends every change after the given one that matches a
+// subscription of c and returns the ID of the last change seen.
+func (h *ProductHandler) sendUpdates(ctx context.Context, c *wsClient, after int64) (int64, error) {
+	return h.pageEvents(
+		ctx, after,
+		func(int64) error {
+			return c.send(WebSocketMessage{Type: "reset"})
+		},
+		func(events []service.ProductEvent) error {
+			for _, e := range events {
+				subs := c.matching(e.Product)
+				if len(subs) == 0 {
+					continue
+				}
+				err := c.send(WebSocketMessage{
+					Type: "event",
+					Subscriptions: subs,
+					EventID: e.ID,
+					Event: string(e.Type),
+					Product: &e.Product,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	)
+}
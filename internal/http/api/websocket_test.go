@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+)
+
+func dialProductUpdates(t *testing.T, handler *ProductHandler) (*websocket.Conn, *httptest.Server) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(handler.ProductUpdates))
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func () {
+		conn.Close()
+	})
+	return conn, srv
+}
+
+func TestProductHandler_Updates_Requests(t *testing.T) {
+	handler := NewProductHandler(&fakeProductService{}, config.Default())
+	handler.wsMaxSubs = 1
+	conn, _ := dialProductUpdates(t, handler)
+
+	tests := []struct {
+		name string
+		request string
+		wantType string
+		wantCode string
+		wantPointers []string
+	}{
+		{
+			name: "Subscribe",
+			request: `{"type":"subscribe","id":"cheap","max_price":500}`,
+			wantType: "subscribed",
+		},
+		{
+			name: "Replace subscription",
+			request: `{"type":"subscribe","id":"cheap","product_ids":["1","2"]}`,
+			wantType: "subscribed",
+		},
+		{
+			name: "Too many subscriptions",
+			request: `{"type":"subscribe","id":"other"}`,
+			wantType: "error",
+			wantCode: "too_many_subscriptions",
+		},
+		{
+			name: "Invalid request",
+			request: `{"type":"watch","product_ids":[""],"min_price":500,"max_price":100,"extra":1}`,
+			wantType: "error",
+			wantCode: "validation_failed",
+			wantPointers: []string{"/extra", "/type", "/id"},
+		},
+		{
+			name: "Invalid filter",
+			request: `{"type":"subscribe","id":"x","product_ids":[""],"min_price":500,"max_price":100}`,
+			wantType: "error",
+			wantCode: "validation_failed",
+			wantPointers: []string{"/product_ids/0", "/max_price"},
+		},
+		{
+			name: "Invalid JSON",
+			request: `{"type":`,
+			wantType: "error",
+			wantCode: "invalid_json",
+		},
+		{
+			name: "Unsubscribe",
+			request: `{"type":"unsubscribe","id":"cheap"}`,
+			wantType: "unsubscribed",
+		},
+		{
+			name: "Unsubscribe unknown",
+			request: `{"type":"unsubscribe","id":"cheap"}`,
+			wantType: "error",
+			wantCode: "subscription_not_found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.request)); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			var msg WebSocketMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if msg.Type != tt.wantType {
+				t.Fatalf("Expected a %s message, got %+v", tt.wantType, msg)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			if msg.Error == nil || msg.Error.Code != tt.wantCode {
+				t.Fatalf("Expected error %q, got %+v", tt.wantCode, msg.Error)
+			}
+			var pointers []string
+			for _, v := range msg.Error.Violations {
+				pointers = append(pointers, v.Pointer)
+			}
+			if strings.Join(pointers, " ") != strings.Join(tt.wantPointers, " ") {
+				t.Fatalf("Expected violations at %v, got %+v", tt.wantPointers, msg.Error.Violations)
+			}
+		})
+	}
+}
+
+func TestProductHandler_Updates_ConnectionLimit(t *testing.T) {
+	handler := NewProductHandler(&fakeProductService{}, config.Default())
+	handler.wsMaxConns = 1
+	_, srv := dialProductUpdates(t, handler)
+
+	_, res, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err == nil {
+		t.Fatal("Expected the second connection to be refused")
+	}
+	if res == nil || res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %+v", res)
+	}
+	if res.Header.Get("Retry-After") == "" {
+		t.Fatal("Expected a Retry-After header")
+	}
+}
+
+func TestProductHandler_Updates_PongTimeout(t *testing.T) {
+	dropped := metrics.WebSocketDropped.WithLabelValues("pong_timeout")
+	before := testutil.ToFloat64(dropped)
+
+	handler := NewProductHandler(&fakeProductService{}, config.Default())
+	handler.heartbeat = 20 * time.Millisecond
+	conn, _ := dialProductUpdates(t, handler)
+
+	// The client answers pings only while it reads, so it misses them all.
+	time.Sleep(100 * time.Millisecond)
+
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("SetReadDeadline failed: %v", err)
+	}
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if got := testutil.ToFloat64(dropped); got != before + 1 {
+		t.Fatalf("Expected one connection dropped for missing pongs, got %v", got - before)
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+)
+
+// BearerToken lets through only requests that carry token in an
+// Authorization: Bearer header and answers the others with 401. The tokens
+// are compared as hashes, in constant time, so that neither their contents
+// nor their length leak through response times.
+func BearerToken(next http.Handler, token string) http.Handler {
+	want := sha256.Sum256([]byte(token))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, got, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		sum := sha256.Sum256([]byte(strings.TrimSpace(got)))
+		if !ok || !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare(sum[:], want[:]) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			problem.Write(w, r, problem.New(
+				http.StatusUnauthorized,
+				"unauthorized",
+				"Unauthorized",
+				"a valid bearer token is required",
+			))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
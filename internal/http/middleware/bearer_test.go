@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	handler := BearerToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), "0123456789abcdef")
+
+	tests := []struct {
+		header string
+		want int
+	}{
+		{"Bearer 0123456789abcdef", http.StatusNoContent},
+		{"bearer 0123456789abcdef", http.StatusNoContent},
+		{"", http.StatusUnauthorized},
+		{"Bearer", http.StatusUnauthorized},
+		{"Bearer 0123456789abcde", http.StatusUnauthorized},
+		{"Basic 0123456789abcdef", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/admin/backups", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("Authorization %q: expected status %d, got %d", tt.header, tt.want, rec.Code)
+		}
+		if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q: expected a WWW-Authenticate challenge", tt.header)
+		}
+	}
+}
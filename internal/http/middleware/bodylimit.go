@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// BodyLimit caps request bodies at limit bytes. Reading past the limit
+// fails with *http.MaxBytesError, which the handler reports like any other
+// error reading the body. A body that declares a larger Content-Length is
+// not read at all: its first read fails the same way, so a streaming
+// handler rejects it before acting on any of it.
+func BodyLimit(next http.Handler, limit int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			// The unread body cannot be drained, so the connection cannot
+			// be reused.
+			w.Header().Set("Connection", "close")
+			r.Body = tooLarge{limit: limit}
+		} else {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tooLarge replaces a body that is known to exceed limit.
+type tooLarge struct {
+	limit int64
+}
+
+func (b tooLarge) Read([]byte) (int, error) {
+	return 0, &http.MaxBytesError{Limit: b.limit}
+}
+
+func (b tooLarge) Close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	var readErr error
+	called := false
+	handler := BodyLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		_, readErr = io.ReadAll(r.Body)
+	}), 8)
+
+	// A declared length above the limit fails the first read.
+	req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader("0123456789"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var maxErr *http.MaxBytesError
+	if !called || !errors.As(readErr, &maxErr) || maxErr.Limit != 8 {
+		t.Fatalf("Expected the handler to fail reading with MaxBytesError, got %v", readErr)
+	}
+	if rec.Header().Get("Connection") != "close" {
+		t.Fatalf("Expected the connection to be closed")
+	}
+
+	// Without a Content-Length the body is only cut off while reading.
+	req = httptest.NewRequest(http.MethodPost, "/products", io.NopCloser(strings.NewReader("0123456789")))
+	req.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !errors.As(readErr, &maxErr) || maxErr.Limit != 8 {
+		t.Fatalf("Expected MaxBytesError, got %v", readErr)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/products", strings.NewReader("01234567"))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if readErr != nil {
+		t.Fatalf("Body within the limit failed: %v", readErr)
+	}
+}
@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"bufio"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/v-kuu/mini-marketplace/internal/metrics"
@@ -18,7 +21,26 @@ func (r *statusRecorder) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
-func Metrics(next http.Handler, path string) http.Handler {
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack lets WebSocket upgrades take over the connection, which the
+// upgrader expects the writer itself to support. A hijacked request is
+// recorded as 101 Switching Protocols.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Metrics records request metrics for every request served by mux. The
+// path label is the route pattern the mux matched, such as
+// /products/{id}, so that IDs do not create new series.
+func Metrics(mux *http.ServeMux) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rec := &statusRecorder{
 			ResponseWriter: w,
@@ -29,10 +51,11 @@ func Metrics(next http.Handler, path string) http.Handler {
 		metrics.HttpInFlight.Inc()
 		defer metrics.HttpInFlight.Dec()
 
-		next.ServeHTTP(rec, r)
+		mux.ServeHTTP(rec, r)
 
 		duration := time.Since(start).Seconds()
 		status := strconv.Itoa(rec.status)
+		path := routeLabel(r.Pattern)
 
 		metrics.HttpRequestsTotal.WithLabelValues(
 			r.Method,
@@ -46,3 +69,15 @@ func Metrics(next http.Handler, path string) http.Handler {
 		).Observe(duration)
 	})
 }
+
+// routeLabel strips the method from a mux pattern. Requests the mux did not
+// match share a single label.
+func routeLabel(pattern string) string {
+	if pattern == "" {
+		return "unmatched"
+	}
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
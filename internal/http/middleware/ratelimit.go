@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+)
+
+// RateLimiter is a token bucket shared by every request it wraps. A rate of
+// zero disables limiting. The rate can be changed while serving.
+type RateLimiter struct {
+	mu sync.Mutex
+	rate float64
+	burst float64
+	tokens float64
+	last time.Time
+}
+
+func NewRateLimiter(rate, burst int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetLimit(rate, burst)
+	return l
+}
+
+// SetLimit changes the rate in requests per second and the burst size.
+func (l *RateLimiter) SetLimit(rate, burst int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = float64(rate)
+	l.burst = float64(max(burst, 1))
+	l.tokens = math.Min(l.tokens, l.burst)
+	if l.last.IsZero() {
+		l.tokens = l.burst
+	}
+}
+
+// allow takes a token if one is available, otherwise it reports how long
+// until the next one is.
+func (l *RateLimiter) allow(now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return true, 0
+	}
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+func RateLimit(next http.Handler, l *RateLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.allow(time.Now())
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+			problem.Write(w, r, problem.New(
+				http.StatusTooManyRequests,
+				"rate_limited",
+				"Too many requests",
+				"the request rate limit was exceeded",
+			))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	l := NewRateLimiter(10, 2)
+	now := time.Now()
+
+	for i := range 2 {
+		if ok, _ := l.allow(now); !ok {
+			t.Fatalf("Request %d within burst was rejected", i)
+		}
+	}
+	ok, wait := l.allow(now)
+	if ok {
+		t.Fatalf("Request above burst was allowed")
+	}
+	if wait <= 0 || wait > 100*time.Millisecond {
+		t.Fatalf("Unexpected wait %v", wait)
+	}
+
+	if ok, _ := l.allow(now.Add(100 * time.Millisecond)); !ok {
+		t.Fatalf("Token was not refilled")
+	}
+
+	l.SetLimit(0, 1)
+	for range 10 {
+		if ok, _ := l.allow(now); !ok {
+			t.Fatalf("Disabled limiter rejected a request")
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	handler := RateLimit(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), l)
+
+	tests := []struct {
+		name string
+		wantStatus int
+	}{
+		{name: "Allowed", wantStatus: http.StatusNoContent},
+		{name: "Limited", wantStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rec.Code)
+		}
+		if tt.wantStatus == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("%s: expected Retry-After header", tt.name)
+		}
+	}
+}
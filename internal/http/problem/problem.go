@@ -0,0 +1,62 @@
+// Package problem renders RFC 9457 problem details responses.
+package problem
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"syscall"
+)
+
+const ContentType = "application/problem+json"
+
+// typeBase is the prefix of every problem type URI. The URI is relative to
+// the API and stable, so clients can match on it as well as on Code.
+const typeBase = "/problems/"
+
+// Details is an RFC 9457 problem details object extended with a stable,
+// machine-readable error code.
+type Details struct {
+	Type string `json:"type" example:"/problems/product_not_found"`
+	Title string `json:"title" example:"Product not found"`
+	Status int `json:"status" example:"404"`
+	Detail string `json:"detail,omitempty" example:"product not found"`
+	Instance string `json:"instance,omitempty" example:"/products/42"`
+	Code string `json:"code" example:"product_not_found"`
+	// Violations lists every invalid field of a rejected request body.
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation describes one invalid field. Pointer is an RFC 6901 JSON
+// pointer into the request body and Rule the name of the failed check.
+type Violation struct {
+	Pointer string `json:"pointer" example:"/name"`
+	Rule string `json:"rule" example:"max_length"`
+	Message string `json:"message" example:"must be at most 100 characters"`
+}
+
+func New(status int, code, title, detail string) Details {
+	return Details{
+		Type: typeBase + code,
+		Title: title,
+		Status: status,
+		Detail: detail,
+		Code: code,
+	}
+}
+
+// Write sends p as the response, using the request path as the instance
+// when none is set.
+func Write(w http.ResponseWriter, r *http.Request, p Details) {
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		if err != syscall.EPIPE && err != syscall.ECONNRESET {
+			slog.Error("Failed to encode JSON response", "err", err)
+		}
+	}
+}
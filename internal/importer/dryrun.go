@@ -0,0 +1,76 @@
+package importer
+
+import (
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// dryRun remembers the products that earlier chunks of a dry run would
+// have written. Each chunk is rolled back, so the database cannot tell a
+// later chunk about them; without this a name repeated in two chunks would
+// be reported as created twice. Names freed by renaming a stored product
+// are not known here and stay taken.
+type dryRun struct {
+	// names maps the name of every product written so far to its ID, and
+	// ids the other way around.
+	names map[string]string
+	ids map[string]string
+}
+
+func newDryRun() *dryRun {
+	return &dryRun{names: make(map[string]string), ids: make(map[string]string)}
+}
+
+// resolve sets the results of the rows that conflict with products of
+// earlier chunks, as the database would have. It returns the other rows,
+// which are left to the database, with their indexes in products.
+func (d *dryRun) resolve(products []model.Product, results []service.ImportResult, upsert bool) ([]model.Product, []int) {
+	var rest []model.Product
+	var index []int
+	for i, p := range products {
+		res, ok := d.result(p, upsert)
+		if !ok {
+			rest = append(rest, p)
+			index = append(index, i)
+			continue
+		}
+		results[i] = res
+	}
+	return rest, index
+}
+
+func (d *dryRun) result(p model.Product, upsert bool) (service.ImportResult, bool) {
+	exists := service.ImportResult{Outcome: service.ImportFailed, Err: service.ErrProductAlreadyExists}
+	owner, named := d.names[p.Name]
+	if p.ID == "" {
+		switch {
+			case !named:
+				return service.ImportResult{}, false
+			case upsert:
+				return service.ImportResult{Outcome: service.ImportUpdated, ID: owner}, true
+		}
+		return exists, true
+	}
+
+	if _, ok := d.ids[p.ID]; ok {
+		if upsert && (!named || owner == p.ID) {
+			return service.ImportResult{Outcome: service.ImportUpdated, ID: p.ID}, true
+		}
+		return exists, true
+	}
+	if named {
+		// The name belongs to another product, so both an insert and an
+		// update of p.ID would break the unique name.
+		return exists, true
+	}
+	return service.ImportResult{}, false
+}
+
+// add records that the product id would now be named name.
+func (d *dryRun) add(id, name string) {
+	if old, ok := d.ids[id]; ok {
+		delete(d.names, old)
+	}
+	d.ids[id] = name
+	d.names[name] = id
+}
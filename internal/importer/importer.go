@@ -0,0 +1,201 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// MaxErrors caps the failed rows listed in a report; the counts stay exact.
+const MaxErrors = 1000
+
+// Report is the outcome of a product import. Rows counts the records
+// read; each of them was created, updated or failed.
+type Report struct {
+	DryRun bool `json:"dry_run" example:"false"`
+	Rows int `json:"rows" example:"1000"`
+	Created int `json:"created" example:"990"`
+	Updated int `json:"updated" example:"8"`
+	Failed int `json:"failed" example:"2"`
+	Errors []Error `json:"errors"`
+	// ErrorsTruncated is set when more rows failed than are listed.
+	ErrorsTruncated bool `json:"errors_truncated,omitempty"`
+}
+
+// Error explains why one row of an import failed. Code is the problem
+// code the row would have caused as a single request, except that invalid
+// fields are always validation_failed.
+type Error struct {
+	Line int `json:"line" example:"42"`
+	Code string `json:"code" example:"validation_failed"`
+	Detail string `json:"detail,omitempty" example:"the row has invalid fields"`
+	Violations []problem.Violation `json:"violations,omitempty"`
+}
+
+// rowCodes are the problem codes of the errors a row can fail with. They
+// are those of the API, which answers the same problems in single requests
+// with them.
+var rowCodes = []struct {
+	err error
+	code string
+}{
+	{ErrInvalidJSON, "invalid_json"},
+	{ErrInvalidCSV, "invalid_csv"},
+	{service.ErrInvalidProduct, "invalid_product"},
+	{service.ErrProductAlreadyExists, "product_already_exists"},
+}
+
+// WriteFunc writes one chunk of products in a single transaction, as
+// service.ProductService.ImportProducts does.
+type WriteFunc func(ctx context.Context, products []model.Product, opts service.ImportOptions) ([]service.ImportResult, error)
+
+// Options control an import.
+type Options struct {
+	service.ImportOptions
+	// ChunkSize is the number of valid rows written per transaction.
+	ChunkSize int
+	// Progress, if set, is called every ChunkSize rows read, so that long
+	// imports can extend their deadlines.
+	Progress func()
+}
+
+// importer writes valid rows in chunks and builds the report.
+type importer struct {
+	write WriteFunc
+	opts Options
+
+	chunk []model.Product
+	lines []int
+	// committed is the number of rows written by finished chunks.
+	committed int
+	// dryRun is set for dry runs, so that chunks see the rows of those
+	// before them.
+	dryRun *dryRun
+	report Report
+}
+
+// Import reads every row, writes the valid ones in chunks of one
+// transaction each and reports on every row. Invalid rows and rows that
+// conflict with stored products are listed in the report and do not stop
+// the import; an error reading the file or writing a chunk does.
+func Import(ctx context.Context, rows Reader, write WriteFunc, opts Options) (*Report, error) {
+	im := &importer{
+		write: write,
+		opts: opts,
+		report: Report{DryRun: opts.DryRun, Errors: []Error{}},
+	}
+	if opts.DryRun {
+		im.dryRun = newDryRun()
+	}
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = im.add(ctx, row)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if opts.Progress != nil && im.report.Rows % opts.ChunkSize == 0 {
+			opts.Progress()
+		}
+	}
+	if err := im.flush(ctx); err != nil {
+		return nil, err
+	}
+	return &im.report, nil
+}
+
+func (im *importer) add(ctx context.Context, row Row) error {
+	im.report.Rows++
+	if row.Err != nil {
+		im.fail(row.Line, row.Err)
+		return nil
+	}
+
+	im.chunk = append(im.chunk, row.Product)
+	im.lines = append(im.lines, row.Line)
+	if len(im.chunk) < im.opts.ChunkSize {
+		return nil
+	}
+	return im.flush(ctx)
+}
+
+func (im *importer) flush(ctx context.Context) error {
+	if len(im.chunk) == 0 {
+		return nil
+	}
+
+	results := make([]service.ImportResult, len(im.chunk))
+	rest, index := im.chunk, []int(nil)
+	if im.dryRun != nil {
+		rest, index = im.dryRun.resolve(im.chunk, results, im.opts.Upsert)
+	}
+	if len(rest) > 0 {
+		written, err := im.write(ctx, rest, im.opts.ImportOptions)
+		if err != nil {
+			return fmt.Errorf("import stopped at line %d after %d rows were written: %w", im.lines[0], im.committed, err)
+		}
+		for i, res := range written {
+			if index != nil {
+				results[index[i]] = res
+			} else {
+				results[i] = res
+			}
+		}
+	}
+
+	for i, res := range results {
+		switch res.Outcome {
+			case service.ImportCreated:
+				im.report.Created++
+			case service.ImportUpdated:
+				im.report.Updated++
+			default:
+				im.fail(im.lines[i], res.Err)
+				continue
+		}
+		if im.dryRun != nil {
+			im.dryRun.add(res.ID, im.chunk[i].Name)
+		}
+	}
+	if !im.opts.DryRun {
+		im.committed = im.report.Created + im.report.Updated
+	}
+	im.chunk = im.chunk[:0]
+	im.lines = im.lines[:0]
+	return nil
+}
+
+func (im *importer) fail(line int, err error) {
+	im.report.Failed++
+	if len(im.report.Errors) >= MaxErrors {
+		im.report.ErrorsTruncated = true
+		return
+	}
+
+	e := Error{Line: line, Code: "internal_error"}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		e.Code, e.Detail, e.Violations = "validation_failed", "the row has invalid fields", verr.Violations
+	} else {
+		for _, rc := range rowCodes {
+			if errors.Is(err, rc.err) {
+				e.Code, e.Detail = rc.code, err.Error()
+				break
+			}
+		}
+	}
+	if e.Code == "internal_error" {
+		slog.Error("Import row failed", "line", line, "err", err)
+	}
+	im.report.Errors = append(im.report.Errors, e)
+}
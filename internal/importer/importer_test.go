@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func TestNewCSVReader_Header(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		wantErr bool
+	}{
+		{name: "valid", body: "\ufeffPrice, ID ,Name\n"},
+		{name: "missing", body: "", wantErr: true},
+		{name: "duplicate column", body: "name,price,Name\n", wantErr: true},
+		{name: "unknown column", body: "name,price,color\n", wantErr: true},
+		{name: "missing column", body: "id,name\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCSVReader(strings.NewReader(tt.body))
+			if tt.wantErr && !errors.Is(err, ErrInvalidCSV) {
+				t.Fatalf("Expected ErrInvalidCSV, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNDJSONReader(t *testing.T) {
+	body := "{\"id\":\"1\",\"Name\":\"Tea\",\"price\":250}\n\n" +
+		"{\"name\":1,\"price\":0,\"color\":\"red\"}\n" +
+		"{\"name\":\"Tea\"\n"
+	rows := NewNDJSONReader(strings.NewReader(body))
+
+	row, err := rows.Next()
+	if err != nil || row.Err != nil || row.Line != 1 || row.Product != (model.Product{ID: "1", Name: "Tea", Price: 250}) {
+		t.Fatalf("Expected Tea on line 1, got %+v, %v", row, err)
+	}
+
+	row, err = rows.Next()
+	var verr *ValidationError
+	if err != nil || row.Line != 3 || !errors.As(row.Err, &verr) {
+		t.Fatalf("Expected a validation error on line 3, got %+v, %v", row, err)
+	}
+	var got []string
+	for _, v := range verr.Violations {
+		got = append(got, v.Pointer + ":" + v.Rule)
+	}
+	if want := "/color:unknown_field /name:type /price:minimum"; strings.Join(got, " ") != want {
+		t.Fatalf("Expected violations %s, got %v", want, got)
+	}
+
+	row, err = rows.Next()
+	if err != nil || row.Line != 4 || !errors.Is(row.Err, ErrInvalidJSON) {
+		t.Fatalf("Expected invalid JSON on line 4, got %+v, %v", row, err)
+	}
+
+	if _, err := rows.Next(); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestNDJSONReader_LineTooLong(t *testing.T) {
+	body := `{"name":"` + strings.Repeat("a", MaxLine) + `","price":1}`
+	rows := NewNDJSONReader(strings.NewReader(body))
+
+	if _, err := rows.Next(); !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("Expected ErrInvalidJSON, got %v", err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	rows, err := NewCSVReader(strings.NewReader("name,price\nTea,250\nTea,abc\nCoffee,499\nCake,399\n"))
+	if err != nil {
+		t.Fatalf("Failed to read the header: %v", err)
+	}
+
+	var chunks int
+	write := func(ctx context.Context, products []model.Product, opts service.ImportOptions) ([]service.ImportResult, error) {
+		chunks++
+		results := make([]service.ImportResult, len(products))
+		for i, p := range products {
+			if p.Name == "Coffee" {
+				results[i] = service.ImportResult{Outcome: service.ImportFailed, Err: service.ErrProductAlreadyExists}
+			}
+		}
+		return results, nil
+	}
+
+	report, err := Import(context.Background(), rows, write, Options{ChunkSize: 2})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if chunks != 2 {
+		t.Fatalf("Expected 2 chunks, got %d", chunks)
+	}
+	if report.Rows != 4 || report.Created != 2 || report.Failed != 2 {
+		t.Fatalf("Expected 4 rows with 2 created and 2 failed, got %+v", report)
+	}
+	want := []Error{{Line: 3, Code: "validation_failed"}, {Line: 4, Code: "product_already_exists"}}
+	for i, e := range report.Errors {
+		if e.Line != want[i].Line || e.Code != want[i].Code {
+			t.Fatalf("Expected errors %+v, got %+v", want, report.Errors)
+		}
+	}
+}
+
+func TestImport_WriteFails(t *testing.T) {
+	rows := NewNDJSONReader(strings.NewReader("{\"name\":\"Tea\",\"price\":250}\n"))
+	write := func(ctx context.Context, products []model.Product, opts service.ImportOptions) ([]service.ImportResult, error) {
+		return nil, service.ErrOverloaded
+	}
+
+	if _, err := Import(context.Background(), rows, write, Options{ChunkSize: 10}); !errors.Is(err, service.ErrOverloaded) {
+		t.Fatalf("Expected ErrOverloaded, got %v", err)
+	}
+}
+
+// memoryStore imports into a map of names to IDs and rolls dry runs back,
+// as the database does.
+type memoryStore struct {
+	names map[string]string
+}
+
+func (m *memoryStore) write(ctx context.Context, products []model.Product, opts service.ImportOptions) ([]service.ImportResult, error) {
+	names := maps.Clone(m.names)
+	results := make([]service.ImportResult, len(products))
+	for i, p := range products {
+		id, ok := names[p.Name]
+		switch {
+			case ok && opts.Upsert:
+				results[i] = service.ImportResult{Outcome: service.ImportUpdated, ID: id}
+			case ok:
+				results[i] = service.ImportResult{Outcome: service.ImportFailed, Err: service.ErrProductAlreadyExists}
+			default:
+				names[p.Name] = p.Name
+				results[i] = service.ImportResult{Outcome: service.ImportCreated, ID: p.Name}
+		}
+	}
+	if !opts.DryRun {
+		m.names = names
+	}
+	return results, nil
+}
+
+func TestImport_DryRunAcrossChunks(t *testing.T) {
+	body := "name,price\nTea,250\nCoffee,499\nTea,300\n"
+
+	tests := []struct {
+		name string
+		upsert bool
+		want Report
+	}{
+		{name: "fail", want: Report{DryRun: true, Rows: 3, Created: 2, Failed: 1}},
+		{name: "upsert", upsert: true, want: Report{DryRun: true, Rows: 3, Created: 2, Updated: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reports []Report
+			for _, dryRun := range []bool{true, false} {
+				rows, err := NewCSVReader(strings.NewReader(body))
+				if err != nil {
+					t.Fatalf("Failed to read the header: %v", err)
+				}
+				store := &memoryStore{names: make(map[string]string)}
+				opts := Options{ImportOptions: service.ImportOptions{DryRun: dryRun, Upsert: tt.upsert}, ChunkSize: 1}
+				report, err := Import(context.Background(), rows, store.write, opts)
+				if err != nil {
+					t.Fatalf("Failed to import: %v", err)
+				}
+				report.Errors = nil
+				reports = append(reports, *report)
+			}
+
+			if !reflect.DeepEqual(reports[0], tt.want) {
+				t.Fatalf("Expected dry run report %+v, got %+v", tt.want, reports[0])
+			}
+			// The dry run reports what the real import does.
+			reports[1].DryRun = true
+			if !reflect.DeepEqual(reports[1], reports[0]) {
+				t.Fatalf("Expected the import to report %+v, got %+v", reports[0], reports[1])
+			}
+		})
+	}
+}
+
+func TestDryRun_Result(t *testing.T) {
+	d := newDryRun()
+	d.add("1", "Tea")
+
+	tests := []struct {
+		name string
+		product model.Product
+		upsert bool
+		want service.ImportOutcome
+		wantDB bool
+	}{
+		{name: "new name", product: model.Product{Name: "Cake"}, wantDB: true},
+		{name: "new ID", product: model.Product{ID: "2", Name: "Cake"}, wantDB: true},
+		{name: "same name", product: model.Product{Name: "Tea"}, want: service.ImportFailed},
+		{name: "same name upsert", product: model.Product{Name: "Tea"}, upsert: true, want: service.ImportUpdated},
+		{name: "same ID", product: model.Product{ID: "1", Name: "Cake"}, want: service.ImportFailed},
+		{name: "same ID upsert", product: model.Product{ID: "1", Name: "Cake"}, upsert: true, want: service.ImportUpdated},
+		{name: "name of another ID", product: model.Product{ID: "2", Name: "Tea"}, upsert: true, want: service.ImportFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, ok := d.result(tt.product, tt.upsert)
+			if ok == tt.wantDB {
+				t.Fatalf("Expected the database to decide: %v, got %v", tt.wantDB, !ok)
+			}
+			if ok && res.Outcome != tt.want {
+				t.Fatalf("Expected outcome %d, got %d", tt.want, res.Outcome)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+// Package importer reads product import files and writes them in chunks.
+// The import endpoint and marketctl both use it, so a file is read,
+// checked and reported on the same way wherever it is imported.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/problem"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+// MaxLine is the longest NDJSON line accepted by an import.
+const MaxLine = 64 << 10
+
+// Rules of violations that only come up while reading a row. The rules of
+// product fields are those of model.ValidateProduct.
+const (
+	RuleType = "type"
+	RuleUnknownField = "unknown_field"
+)
+
+var (
+	// ErrInvalidCSV and ErrInvalidJSON are returned for files that cannot
+	// be read as a whole, and set on rows that cannot be parsed.
+	ErrInvalidCSV = errors.New("invalid csv")
+	ErrInvalidJSON = errors.New("invalid json")
+)
+
+// Columns are the columns of import and export files, in export order.
+var Columns = []string{"id", "name", "price"}
+
+// ValidationError lists every invalid field of a row.
+type ValidationError struct {
+	Violations []problem.Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Pointer + ": " + v.Message
+	}
+	return "invalid fields: " + strings.Join(msgs, "; ")
+}
+
+// Row is one product read from an import file. Err is set if the row is
+// invalid; the rest of the file is still imported.
+type Row struct {
+	Line int
+	Product model.Product
+	Err error
+}
+
+// Reader reads the rows of an import file. Next returns io.EOF at the end
+// and any other error if the file cannot be read any further; such errors
+// wrap ErrInvalidCSV or ErrInvalidJSON.
+type Reader interface {
+	Next() (Row, error)
+}
+
+// csvReader reads a CSV file with a header row naming its columns.
+type csvReader struct {
+	r *csv.Reader
+	columns map[string]int
+}
+
+// NewCSVReader reads the header row of a CSV file and returns a reader of
+// the rows that follow it.
+func NewCSVReader(r io.Reader) (Reader, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the header row is missing", ErrInvalidCSV)
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCSV, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			// Spreadsheet programs often start UTF-8 files with a BOM.
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("%w: column %q appears twice", ErrInvalidCSV, name)
+		}
+		if !slices.Contains(Columns, name) {
+			return nil, fmt.Errorf("%w: unknown column %q, expected %s", ErrInvalidCSV, name, strings.Join(Columns, ", "))
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"name", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: the header row has no %q column", ErrInvalidCSV, name)
+		}
+	}
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvReader) Next() (Row, error) {
+	fields, err := c.r.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return Row{Line: parseErr.StartLine, Err: fmt.Errorf("%w: %v", ErrInvalidCSV, parseErr.Err)}, nil
+	} else if err == io.EOF {
+		return Row{}, io.EOF
+	} else if err != nil {
+		return Row{}, fmt.Errorf("%w: %w", ErrInvalidCSV, err)
+	}
+
+	row := Row{}
+	row.Line, _ = c.r.FieldPos(0)
+	row.Product.Name = fields[c.columns["name"]]
+	if i, ok := c.columns["id"]; ok {
+		row.Product.ID = strings.TrimSpace(fields[i])
+	}
+
+	var v violations
+	price, err := strconv.ParseInt(strings.TrimSpace(fields[c.columns["price"]]), 10, 64)
+	if err != nil {
+		v.add("/price", RuleType, "must be an integer")
+	}
+	row.Product.Price = price
+	row.Err = v.validate(row.Product)
+	return row, nil
+}
+
+// ndjsonReader reads one JSON object per line. Blank lines are skipped.
+type ndjsonReader struct {
+	s *bufio.Scanner
+	line int
+}
+
+// NewNDJSONReader returns a reader of the lines of an NDJSON file.
+func NewNDJSONReader(r io.Reader) Reader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 4096), MaxLine)
+	return &ndjsonReader{s: s}
+}
+
+func (n *ndjsonReader) Next() (Row, error) {
+	for n.s.Scan() {
+		n.line++
+		data := bytes.TrimSpace(n.s.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := Row{Line: n.line}
+		row.Product, row.Err = decodeLine(data)
+		return row, nil
+	}
+
+	err := n.s.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		return Row{}, fmt.Errorf("%w: line %d is longer than %d bytes", ErrInvalidJSON, n.line+1, MaxLine)
+	} else if err != nil {
+		return Row{}, fmt.Errorf("%w: %w", ErrInvalidJSON, err)
+	}
+	return Row{}, io.EOF
+}
+
+// decodeLine decodes the product object of an NDJSON line. A line that is
+// not exactly one JSON value fails with ErrInvalidJSON; unknown and
+// mistyped fields are reported as violations together with the product
+// rules.
+func decodeLine(data []byte) (model.Product, error) {
+	var p model.Product
+	var raw map[string]json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&raw); err != nil {
+		return p, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return p, fmt.Errorf("%w: unexpected data after the JSON value", ErrInvalidJSON)
+	}
+
+	var v violations
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		target, kind := field(&p, key)
+		if target == nil {
+			v.add(pointer(key), RuleUnknownField, "is not a known field")
+			continue
+		}
+		if err := json.Unmarshal(raw[key], target); err != nil {
+			v.add(pointer(key), RuleType, "must be "+kind)
+		}
+	}
+	return p, v.validate(p)
+}
+
+// field returns where the member key of a product object is decoded to and
+// what it must hold. Keys match case-insensitively, as with encoding/json.
+func field(p *model.Product, key string) (any, string) {
+	switch strings.ToLower(key) {
+		case "id":
+			return &p.ID, "a string"
+		case "name":
+			return &p.Name, "a string"
+		case "price":
+			return &p.Price, "an integer"
+	}
+	return nil, ""
+}
+
+// pointer returns the RFC 6901 JSON pointer to a top-level member.
+func pointer(key string) string {
+	return "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// violations collects the problems of a row, so it is reported with all of
+// them at once.
+type violations []problem.Violation
+
+func (v *violations) add(pointer, rule, message string) {
+	*v = append(*v, problem.Violation{Pointer: pointer, Rule: rule, Message: message})
+}
+
+// validate adds the product rules p breaks, except for fields that were
+// already found to be mistyped, and returns the error of the row.
+func (v *violations) validate(p model.Product) error {
+	mistyped := make(map[string]bool, len(*v))
+	for _, violation := range *v {
+		mistyped[violation.Pointer] = true
+	}
+	for _, violation := range model.ValidateProduct(p.Name, p.Price) {
+		if ptr := "/" + violation.Field; !mistyped[ptr] {
+			v.add(ptr, violation.Rule, violation.Message)
+		}
+	}
+	if len(*v) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: *v}
+}
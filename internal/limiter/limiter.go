@@ -0,0 +1,294 @@
+// Package limiter implements an adaptive concurrency limiter that sits in
+// front of the database and sheds low-priority work under load.
+package limiter
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+)
+
+// ErrOverloaded is returned when a low-priority request is rejected because
+// the queue in front of the database is already too slow.
+var ErrOverloaded = errors.New("limiter overloaded")
+
+type Priority int
+
+const (
+	PriorityHigh Priority = iota
+	PriorityLow
+)
+
+type Options struct {
+	// Name identifies the limiter in metrics.
+	Name string
+	// Min and Max bound the concurrency limit. The limiter starts at Max.
+	Min int64
+	Max int64
+	// TargetWait is the queueing delay above which low-priority requests are
+	// shed instead of waiting for a slot.
+	TargetWait time.Duration
+}
+
+// Limiter is a weighted, gradient-style concurrency limiter. The limit
+// shrinks when the short-term latency of held slots grows relative to the
+// long-term baseline and grows back when latency recovers. Queueing delay is
+// tracked separately and used to reject low-priority requests early, CoDel
+// style.
+type Limiter struct {
+	mu sync.Mutex
+	limitGauge prometheus.Gauge
+
+	limit float64
+	min float64
+	max float64
+	inUse int64
+	queue list.List
+
+	targetWait time.Duration
+
+	shortRTT float64
+	longRTT float64
+}
+
+type waiter struct {
+	priority Priority
+	weight int64
+	enqueued time.Time
+	ready chan struct{}
+}
+
+const (
+	shortAlpha = 0.2
+	longAlpha = 0.01
+	smoothing = 0.2
+	minGradient = 0.5
+)
+
+func New(opts Options) *Limiter {
+	opts = opts.normalize()
+
+	l := &Limiter{
+		limitGauge: metrics.DbConcurrencyLimit.WithLabelValues(opts.Name),
+		limit: float64(opts.Max),
+		min: float64(opts.Min),
+		max: float64(opts.Max),
+		targetWait: opts.TargetWait,
+	}
+	l.limitGauge.Set(l.limit)
+	return l
+}
+
+func (o Options) normalize() Options {
+	if o.Min < 1 {
+		o.Min = 1
+	}
+	if o.Max < o.Min {
+		o.Max = o.Min
+	}
+	return o
+}
+
+// SetBounds changes the limit bounds and target wait of a running limiter.
+// The current limit is clamped into the new bounds; Name is ignored.
+func (l *Limiter) SetBounds(opts Options) {
+	opts = opts.normalize()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// A limiter sitting at its old maximum was not being held back by
+	// latency, so it follows a raised maximum straight away.
+	if l.limit >= l.max {
+		l.limit = float64(opts.Max)
+	}
+	l.min = float64(opts.Min)
+	l.max = float64(opts.Max)
+	l.limit = math.Max(l.min, math.Min(l.max, l.limit))
+	l.targetWait = opts.TargetWait
+	l.limitGauge.Set(math.Floor(l.limit))
+
+	// A higher limit may let queued waiters through right away.
+	l.grant()
+}
+
+// Acquire blocks until weight units of the limit are available, ctx is done,
+// or the request is shed. The returned release func must be called when the
+// caller is finished with the database; extra calls are no-ops.
+func (l *Limiter) Acquire(ctx context.Context, p Priority, weight int64) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	l.mu.Lock()
+	if l.queue.Len() == 0 && l.fits(weight) {
+		l.inUse += weight
+		l.mu.Unlock()
+		return l.granted(weight), nil
+	}
+	if p == PriorityLow && l.overloaded(start) {
+		l.mu.Unlock()
+		return nil, ErrOverloaded
+	}
+
+	w := &waiter{priority: p, weight: weight, enqueued: start, ready: make(chan struct{})}
+	elem := l.enqueue(w)
+	targetWait := l.targetWait
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if p == PriorityLow && targetWait > 0 {
+		timer := time.NewTimer(targetWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-w.ready:
+		return l.granted(weight), nil
+	case <-ctx.Done():
+		if l.abandon(w, elem) {
+			return l.granted(weight), nil
+		}
+		return nil, ctx.Err()
+	case <-timeout:
+		if l.abandon(w, elem) {
+			return l.granted(weight), nil
+		}
+		return nil, ErrOverloaded
+	}
+}
+
+// Limit reports the current concurrency limit.
+func (l *Limiter) Limit() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.capacity()
+}
+
+func (l *Limiter) capacity() int64 {
+	return int64(l.limit)
+}
+
+// fits reports whether weight more units can be granted. A request heavier
+// than the whole limit is let through on its own so it cannot starve.
+// Callers must hold l.mu.
+func (l *Limiter) fits(weight int64) bool {
+	return l.inUse+weight <= l.capacity() || l.inUse == 0
+}
+
+// overloaded reports whether the oldest waiter has been queued for longer
+// than the target. Callers must hold l.mu.
+func (l *Limiter) overloaded(now time.Time) bool {
+	if l.targetWait <= 0 {
+		return false
+	}
+	front := l.queue.Front()
+	if front == nil {
+		return false
+	}
+	return now.Sub(front.Value.(*waiter).enqueued) > l.targetWait
+}
+
+// enqueue places high-priority waiters ahead of all low-priority ones.
+// Callers must hold l.mu.
+func (l *Limiter) enqueue(w *waiter) *list.Element {
+	if w.priority == PriorityHigh {
+		for e := l.queue.Front(); e != nil; e = e.Next() {
+			if e.Value.(*waiter).priority == PriorityLow {
+				return l.queue.InsertBefore(w, e)
+			}
+		}
+	}
+	return l.queue.PushBack(w)
+}
+
+// abandon removes a waiter that gave up. It returns true if the waiter was
+// granted a slot concurrently, in which case the caller now owns that slot.
+func (l *Limiter) abandon(w *waiter, elem *list.Element) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return true
+	default:
+	}
+	l.queue.Remove(elem)
+	// The abandoned waiter may have been blocking smaller ones behind it.
+	l.grant()
+	return false
+}
+
+func (l *Limiter) granted(weight int64) func() {
+	held := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.release(weight, time.Since(held))
+		})
+	}
+}
+
+func (l *Limiter) release(weight int64, rtt time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.update(rtt.Seconds(), l.inUse)
+	l.inUse -= weight
+	l.grant()
+}
+
+// grant hands out capacity to waiters in queue order. It stops at the first
+// waiter that does not fit so heavy requests are not overtaken forever.
+// Callers must hold l.mu.
+func (l *Limiter) grant() {
+	for l.queue.Len() > 0 {
+		w := l.queue.Front().Value.(*waiter)
+		if !l.fits(w.weight) {
+			return
+		}
+		l.queue.Remove(l.queue.Front())
+		l.inUse += w.weight
+		close(w.ready)
+	}
+}
+
+// update applies the gradient algorithm to a completed sample. Callers must
+// hold l.mu.
+func (l *Limiter) update(rtt float64, inFlight int64) {
+	if l.longRTT == 0 {
+		l.shortRTT = rtt
+		l.longRTT = rtt
+		return
+	}
+	l.shortRTT = l.shortRTT*(1-shortAlpha) + rtt*shortAlpha
+	l.longRTT = l.longRTT*(1-longAlpha) + rtt*longAlpha
+
+	// Let the baseline come back down quickly once a latency spike is over
+	// so it does not mask the next one.
+	if l.longRTT/l.shortRTT > 2 {
+		l.longRTT *= 0.95
+	}
+
+	// Only adjust when the limit is actually being used.
+	if float64(inFlight) < l.limit/2 {
+		return
+	}
+
+	gradient := math.Max(minGradient, math.Min(1, l.longRTT/l.shortRTT))
+	next := l.limit*gradient + math.Sqrt(l.limit)
+	next = l.limit*(1-smoothing) + next*smoothing
+	l.limit = math.Max(l.min, math.Min(l.max, next))
+
+	l.limitGauge.Set(math.Floor(l.limit))
+}
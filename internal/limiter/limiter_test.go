@@ -0,0 +1,202 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter_AcquireRelease(t *testing.T) {
+	l := New(Options{Min: 1, Max: 2, TargetWait: time.Second})
+
+	r1, err := l.Acquire(context.Background(), PriorityHigh, 1)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	r2, err := l.Acquire(context.Background(), PriorityHigh, 1)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := l.Acquire(context.Background(), PriorityHigh, 1)
+		if err != nil {
+			t.Errorf("Acquire failed: %v", err)
+			return
+		}
+		release()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("Acquire should block while the limit is reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	r1()
+	r1()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("Waiter was not woken up after release")
+	}
+	r2()
+}
+
+func TestLimiter_ContextCancelled(t *testing.T) {
+	l := New(Options{Min: 1, Max: 1})
+
+	release, err := l.Acquire(context.Background(), PriorityHigh, 1)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := l.Acquire(ctx, PriorityHigh, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if l.queue.Len() != 0 {
+		t.Fatalf("Abandoned waiter was left in the queue")
+	}
+}
+
+func TestLimiter_ShedsLowPriority(t *testing.T) {
+	l := New(Options{Min: 1, Max: 1, TargetWait: 10 * time.Millisecond})
+
+	release, err := l.Acquire(context.Background(), PriorityHigh, 1)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer release()
+
+	start := time.Now()
+	if _, err := l.Acquire(context.Background(), PriorityLow, 1); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Expected ErrOverloaded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("Low priority request waited too long before being shed")
+	}
+
+	// A high priority request queued long enough marks the limiter as
+	// overloaded, so new low priority requests are rejected immediately.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		if release, err := l.Acquire(ctx, PriorityHigh, 1); err == nil {
+			release()
+		}
+	}()
+	time.Sleep(30 * time.Millisecond)
+
+	start = time.Now()
+	if _, err := l.Acquire(context.Background(), PriorityLow, 1); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Expected ErrOverloaded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Millisecond {
+		t.Fatalf("Low priority request should have been rejected without queueing")
+	}
+}
+
+func TestLimiter_HighPriorityFirst(t *testing.T) {
+	l := New(Options{Min: 1, Max: 1})
+
+	release, err := l.Acquire(context.Background(), PriorityHigh, 1)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	order := make(chan Priority, 2)
+	for _, p := range []Priority{PriorityLow, PriorityHigh} {
+		go func() {
+			r, err := l.Acquire(context.Background(), p, 1)
+			if err != nil {
+				t.Errorf("Acquire failed: %v", err)
+				return
+			}
+			order <- p
+			r()
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	release()
+	if first := <-order; first != PriorityHigh {
+		t.Fatalf("Expected high priority waiter to be served first")
+	}
+	<-order
+}
+
+func TestLimiter_AdaptsToLatency(t *testing.T) {
+	l := New(Options{Min: 2, Max: 50})
+
+	for range 20 {
+		l.update(0.001, 50)
+	}
+	if got := l.Limit(); got != 50 {
+		t.Fatalf("Expected limit to stay at max, got %d", got)
+	}
+
+	for range 50 {
+		l.update(0.1, 50)
+	}
+	if got := l.Limit(); got >= 50 {
+		t.Fatalf("Expected limit to shrink under rising latency, got %d", got)
+	}
+	if got := l.Limit(); got < 2 {
+		t.Fatalf("Limit dropped below minimum: %d", got)
+	}
+}
+
+func TestLimiter_Weighted(t *testing.T) {
+	l := New(Options{Min: 4, Max: 4})
+
+	heavy, err := l.Acquire(context.Background(), PriorityHigh, 3)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	light, err := l.Acquire(context.Background(), PriorityHigh, 1)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, PriorityHigh, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected Acquire to block once the weight is used up, got %v", err)
+	}
+
+	heavy()
+	light()
+
+	// Requests heavier than the whole limit still run, one at a time.
+	huge, err := l.Acquire(context.Background(), PriorityHigh, 10)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	huge()
+}
+
+func TestLimiter_SetBounds(t *testing.T) {
+	l := New(Options{Min: 1, Max: 10})
+
+	l.SetBounds(Options{Min: 1, Max: 20})
+	if got := l.Limit(); got != 20 {
+		t.Fatalf("Expected limit to follow the raised maximum, got %d", got)
+	}
+
+	l.SetBounds(Options{Min: 1, Max: 5})
+	if got := l.Limit(); got != 5 {
+		t.Fatalf("Expected limit to be clamped to 5, got %d", got)
+	}
+
+	l.SetBounds(Options{Min: 8, Max: 12})
+	if got := l.Limit(); got != 12 {
+		t.Fatalf("Expected limit to follow the raised maximum, got %d", got)
+	}
+}
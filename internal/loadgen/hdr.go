@@ -0,0 +1,135 @@
+package loadgen
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Histogram is a high dynamic range histogram of non-negative values, as
+// described at https://hdrhistogram.org. Buckets grow with powers of two
+// and each holds the same number of linear sub-buckets, so every recorded
+// value is kept with a fixed number of significant digits at a fixed memory
+// cost however wide the range is. Values above the highest trackable value
+// are recorded as the highest.
+type Histogram struct {
+	highest int64
+	subBucketHalfCountMagnitude int
+	subBucketHalfCount int64
+	subBucketMask int64
+	counts []int64
+	total int64
+	min, max int64
+	sum float64
+}
+
+// NewHistogram returns a histogram of the values from 1 to highest, kept
+// with digits significant decimal digits, between 1 and 5.
+func NewHistogram(highest int64, digits int) *Histogram {
+	digits = min(max(digits, 1), 5)
+	highest = max(highest, 2)
+
+	// The sub-buckets of a bucket must tell apart values that differ in
+	// the last significant digit.
+	largestSingleUnit := 2 * int64(math.Pow10(digits))
+	subBucketCountMagnitude := bits.Len64(uint64(largestSingleUnit - 1))
+	h := &Histogram{
+		highest: highest,
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		subBucketHalfCount: 1 << (subBucketCountMagnitude - 1),
+		subBucketMask: 1 << subBucketCountMagnitude - 1,
+		min: math.MaxInt64,
+	}
+
+	buckets := 1
+	for trackable := int64(1) << subBucketCountMagnitude; trackable <= highest; trackable <<= 1 {
+		buckets++
+		if trackable > math.MaxInt64 / 2 {
+			break
+		}
+	}
+	h.counts = make([]int64, (buckets + 1) * int(h.subBucketHalfCount))
+	return h
+}
+
+func (h *Histogram) bucketIndex(v int64) int {
+	return bits.Len64(uint64(v | h.subBucketMask)) - (h.subBucketHalfCountMagnitude + 1)
+}
+
+func (h *Histogram) countsIndex(v int64) int {
+	bucket := h.bucketIndex(v)
+	subBucket := v >> bucket
+	return (bucket + 1) << h.subBucketHalfCountMagnitude + int(subBucket - h.subBucketHalfCount)
+}
+
+// valueAt returns the highest value counted at index i.
+func (h *Histogram) valueAt(i int) int64 {
+	bucket := i >> h.subBucketHalfCountMagnitude - 1
+	subBucket := int64(i) & (h.subBucketHalfCount - 1) + h.subBucketHalfCount
+	if bucket < 0 {
+		subBucket -= h.subBucketHalfCount
+		bucket = 0
+	}
+	return (subBucket + 1) << bucket - 1
+}
+
+// Record counts one value.
+func (h *Histogram) Record(v int64) {
+	v = min(max(v, 0), h.highest)
+	h.counts[h.countsIndex(v)]++
+	h.total++
+	h.sum += float64(v)
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+}
+
+// Merge adds the values counted by o, which must have been created with
+// the same arguments.
+func (h *Histogram) Merge(o *Histogram) {
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	h.total += o.total
+	h.sum += o.sum
+	h.min = min(h.min, o.min)
+	h.max = max(h.max, o.max)
+}
+
+// Count returns the number of values recorded.
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+func (h *Histogram) Min() int64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.min
+}
+
+func (h *Histogram) Max() int64 {
+	return h.max
+}
+
+func (h *Histogram) Mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / float64(h.total)
+}
+
+// Quantile returns the value below or at which the fraction q of the
+// values lies, within the precision of the histogram.
+func (h *Histogram) Quantile(q float64) int64 {
+	if h.total == 0 {
+		return 0
+	}
+	want := max(int64(math.Ceil(min(max(q, 0), 1) * float64(h.total))), 1)
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= want {
+			return min(h.valueAt(i), h.max)
+		}
+	}
+	return h.max
+}
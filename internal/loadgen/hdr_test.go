@@ -0,0 +1,60 @@
+package loadgen
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestHistogram_Precision(t *testing.T) {
+	h := NewHistogram(3_600_000_000, 3)
+	r := rand.New(rand.NewPCG(1, 2))
+	values := make([]int64, 100_000)
+	for i := range values {
+		// Spread over many powers of two, like latencies do.
+		values[i] = int64(r.ExpFloat64() * 5000) + 1
+		h.Record(values[i])
+	}
+	slices.Sort(values)
+
+	for _, q := range []float64{0, 0.5, 0.9, 0.99, 0.999, 1} {
+		i := max(int(q * float64(len(values))) - 1, 0)
+		want, got := values[i], h.Quantile(q)
+		if diff := float64(got - want) / float64(want); diff < -0.001 || diff > 0.001 {
+			t.Errorf("Quantile(%v) = %d, want %d within 0.1%%", q, got, want)
+		}
+	}
+	if h.Min() != values[0] || h.Max() != values[len(values) - 1] || h.Count() != int64(len(values)) {
+		t.Errorf("Unexpected min %d, max %d or count %d", h.Min(), h.Max(), h.Count())
+	}
+}
+
+func TestHistogram_SmallValuesExact(t *testing.T) {
+	h := NewHistogram(1_000_000, 3)
+	for v := int64(0); v < 2048; v++ {
+		h.Record(v)
+	}
+	for _, v := range []int64{0, 1, 7, 1000, 2047} {
+		if got := h.Quantile(float64(v + 1) / 2048); got != v {
+			t.Errorf("Expected %d to be kept exactly, got %d", v, got)
+		}
+	}
+}
+
+func TestHistogram_MergeAndClamp(t *testing.T) {
+	a, b := NewHistogram(1000, 2), NewHistogram(1000, 2)
+	a.Record(10)
+	b.Record(20)
+	b.Record(5000)
+	a.Merge(b)
+
+	if a.Count() != 3 || a.Min() != 10 || a.Max() != 1000 {
+		t.Fatalf("Expected 3 values from 10 to the clamped 1000, got %d from %d to %d", a.Count(), a.Min(), a.Max())
+	}
+	if got := a.Quantile(0.5); got != 20 {
+		t.Fatalf("Expected a median of 20, got %d", got)
+	}
+	if got := NewHistogram(1000, 2).Quantile(0.99); got != 0 {
+		t.Fatalf("Expected 0 from an empty histogram, got %d", got)
+	}
+}
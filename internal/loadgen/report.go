@@ -0,0 +1,169 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// Report is the outcome of a run. Latencies include failed requests.
+type Report struct {
+	Rate float64 `json:"rate"`
+	Arrival string `json:"arrival"`
+	Mix string `json:"mix"`
+	// Elapsed runs until the last response, so it may exceed the planned
+	// duration.
+	Elapsed time.Duration `json:"elapsed_ns"`
+	Sent int `json:"sent"`
+	// Skipped requests had no product to run on, such as deletes before
+	// the run created any product.
+	Skipped int `json:"skipped"`
+	// Dropped requests were due while MaxInFlight requests were waiting
+	// for a response.
+	Dropped int `json:"dropped"`
+	Errors int `json:"errors"`
+	// Throughput is the number of successful responses per second.
+	Throughput float64 `json:"throughput"`
+	Latency Latency `json:"latency"`
+	Scenarios []ScenarioReport `json:"scenarios"`
+	// ErrorCounts breaks the errors down by status and problem code.
+	ErrorCounts map[string]int `json:"error_counts"`
+}
+
+// ScenarioReport is the outcome of one scenario.
+type ScenarioReport struct {
+	Name string `json:"name"`
+	Requests int `json:"requests"`
+	Errors int `json:"errors"`
+	// Skipped requests had no product to run on.
+	Skipped int `json:"skipped"`
+	Latency Latency `json:"latency"`
+	ErrorCounts map[string]int `json:"error_counts"`
+}
+
+// Latency summarizes a latency histogram.
+type Latency struct {
+	Min time.Duration `json:"min_ns"`
+	Mean time.Duration `json:"mean_ns"`
+	P50 time.Duration `json:"p50_ns"`
+	P90 time.Duration `json:"p90_ns"`
+	P99 time.Duration `json:"p99_ns"`
+	P999 time.Duration `json:"p999_ns"`
+	Max time.Duration `json:"max_ns"`
+}
+
+func summarize(h *Histogram) Latency {
+	us := func(v int64) time.Duration { return time.Duration(v) * time.Microsecond }
+	return Latency{
+		Min: us(h.Min()),
+		Mean: time.Duration(h.Mean() * float64(time.Microsecond)),
+		P50: us(h.Quantile(0.5)),
+		P90: us(h.Quantile(0.9)),
+		P99: us(h.Quantile(0.99)),
+		P999: us(h.Quantile(0.999)),
+		Max: us(h.Max()),
+	}
+}
+
+// ErrorRate returns the share of the requests that failed or were
+// dropped. Skipped requests do not count.
+func (r *Report) ErrorRate() float64 {
+	if r.Sent + r.Dropped == 0 {
+		return 0
+	}
+	return float64(r.Errors + r.Dropped) / float64(r.Sent + r.Dropped)
+}
+
+func (g *generator) report(elapsed time.Duration, sent, dropped int) *Report {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	r := &Report{
+		Rate: g.Rate,
+		Arrival: g.Arrival,
+		Mix: g.Mix.String(),
+		Elapsed: elapsed,
+		Sent: sent,
+		Dropped: dropped,
+		Scenarios: []ScenarioReport{},
+		ErrorCounts: make(map[string]int),
+	}
+	all := NewHistogram(highestLatency, 3)
+	for _, name := range scenarios {
+		st, ok := g.stats[name]
+		if !ok {
+			continue
+		}
+		all.Merge(st.latency)
+		s := ScenarioReport{
+			Name: name,
+			Requests: int(st.latency.Count()),
+			Skipped: st.skipped,
+			Latency: summarize(st.latency),
+			ErrorCounts: st.errors,
+		}
+		for kind, n := range st.errors {
+			s.Errors += n
+			r.ErrorCounts[kind] += n
+		}
+		r.Errors += s.Errors
+		r.Skipped += s.Skipped
+		r.Scenarios = append(r.Scenarios, s)
+	}
+	r.Sent -= r.Skipped
+	r.Latency = summarize(all)
+	if elapsed > 0 {
+		r.Throughput = float64(int(all.Count()) - r.Errors) / elapsed.Seconds()
+	}
+	return r
+}
+
+// Print writes the report as tables.
+func (r *Report) Print(w io.Writer) error {
+	fmt.Fprintf(w, "Target %.1f req/s (%s arrival), mix %s\n", r.Rate, r.Arrival, r.Mix)
+	fmt.Fprintf(w, "Sent %d requests in %s: %.1f successful/s, %d errors, %d dropped (%.2f%%)\n\n",
+		r.Sent, r.Elapsed.Round(time.Millisecond), r.Throughput, r.Errors, r.Dropped, 100 * r.ErrorRate())
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "SCENARIO\tREQUESTS\tERRORS\tSKIPPED\tMEAN\tP50\tP90\tP99\tP99.9\tMAX\t")
+	row := func(name string, requests, errors, skipped int, l Latency) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n", name, requests, errors, skipped,
+			round(l.Mean), round(l.P50), round(l.P90), round(l.P99), round(l.P999), round(l.Max))
+	}
+	for _, s := range r.Scenarios {
+		row(s.Name, s.Requests, s.Errors, s.Skipped, s.Latency)
+	}
+	row("total", r.Sent, r.Errors, r.Skipped, r.Latency)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.ErrorCounts) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ERROR\tCOUNT")
+	for _, kind := range slices.Sorted(maps.Keys(r.ErrorCounts)) {
+		fmt.Fprintf(tw, "%s\t%d\n", kind, r.ErrorCounts[kind])
+	}
+	return tw.Flush()
+}
+
+// round shortens a latency to three significant digits, like the
+// histograms keep them.
+func round(d time.Duration) time.Duration {
+	switch {
+		case d >= 100 * time.Millisecond:
+			return d.Round(time.Millisecond)
+		case d >= 10 * time.Millisecond:
+			return d.Round(100 * time.Microsecond)
+		case d >= time.Millisecond:
+			return d.Round(10 * time.Microsecond)
+		default:
+			return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,259 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Arrival processes.
+const (
+	// ArrivalConstant sends requests at even intervals.
+	ArrivalConstant = "constant"
+	// ArrivalPoisson sends requests at exponentially distributed
+	// intervals, like independent clients do.
+	ArrivalPoisson = "poisson"
+)
+
+// highestLatency is the longest latency histograms keep apart, in
+// microseconds.
+const highestLatency = int64(time.Hour / time.Microsecond)
+
+// Options describe a load test.
+type Options struct {
+	// BaseURL is the API root, such as http://localhost:8080.
+	BaseURL string
+	// Client sends the requests. Use HandlerClient to test a handler in
+	// the same process.
+	Client *http.Client
+	// Rate is the number of requests started per second.
+	Rate float64
+	Duration time.Duration
+	// Arrival is ArrivalConstant, the default, or ArrivalPoisson.
+	Arrival string
+	Mix Mix
+	// IDs are the existing products that get, patch and delete requests
+	// are made for.
+	IDs []string
+	// MaxInFlight caps the requests waiting for a response. Requests due
+	// while the cap is reached are dropped and counted, instead of
+	// delaying the schedule.
+	MaxInFlight int
+	// Timeout is the timeout of a single request.
+	Timeout time.Duration
+	// Seed makes the sequence of scenarios, products and prices
+	// repeatable.
+	Seed uint64
+}
+
+// generator is the state of one run.
+type generator struct {
+	Options
+	baseURL string
+	runID string
+	ids *pool
+	created atomic.Int64
+
+	mu sync.Mutex
+	stats map[string]*stats
+}
+
+// stats are the results of one scenario.
+type stats struct {
+	latency *Histogram
+	errors map[string]int
+	skipped int
+}
+
+// Run sends requests at opts.Rate for opts.Duration, waits for the
+// outstanding responses and reports on them.
+//
+// Arrival is open-loop: requests are started on schedule whether or not
+// earlier ones have been answered, and latency is measured from the time a
+// request was due rather than from when it was sent. A server that stalls
+// therefore shows up in the latencies of every request it kept waiting,
+// instead of slowing the test down and hiding them.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if opts.Rate <= 0 {
+		return nil, errors.New("rate must be greater than 0")
+	}
+	if opts.Duration <= 0 {
+		return nil, errors.New("duration must be greater than 0")
+	}
+	if opts.Arrival == "" {
+		opts.Arrival = ArrivalConstant
+	}
+	if opts.Arrival != ArrivalConstant && opts.Arrival != ArrivalPoisson {
+		return nil, fmt.Errorf("arrival must be %s or %s", ArrivalConstant, ArrivalPoisson)
+	}
+	if opts.Mix == nil {
+		opts.Mix = DefaultMix()
+	}
+	if err := opts.Mix.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = 10_000
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	g := &generator{
+		Options: opts,
+		baseURL: strings.TrimSuffix(opts.BaseURL, "/"),
+		runID: strconv.FormatInt(time.Now().UnixNano(), 36),
+		ids: &pool{seeded: append([]string(nil), opts.IDs...)},
+		stats: make(map[string]*stats),
+	}
+	for name, w := range opts.Mix {
+		if w > 0 {
+			g.stats[name] = &stats{latency: NewHistogram(highestLatency, 3), errors: make(map[string]int)}
+		}
+	}
+
+	r := rand.New(rand.NewPCG(opts.Seed, 0x6c6f6164))
+	total := opts.Mix.total()
+	inFlight := make(chan struct{}, opts.MaxInFlight)
+	var wg sync.WaitGroup
+	// sent counts the requests that were not dropped, including those the
+	// report finds were skipped.
+	sent, dropped := 0, 0
+
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var offset time.Duration
+	for offset < opts.Duration {
+		due := start.Add(offset)
+		timer.Reset(time.Until(due))
+		select {
+			case <-ctx.Done():
+				wg.Wait()
+				return nil, context.Cause(ctx)
+			case <-timer.C:
+		}
+
+		c := newCall(opts.Mix, total, r)
+		select {
+			case inFlight <- struct{}{}:
+				sent++
+				wg.Go(func () {
+					defer func () { <-inFlight }()
+					g.do(ctx, c, due)
+				})
+			default:
+				dropped++
+		}
+
+		if opts.Arrival == ArrivalPoisson {
+			offset += time.Duration(r.ExpFloat64() / opts.Rate * float64(time.Second))
+		} else {
+			offset = time.Duration(float64(sent + dropped) / opts.Rate * float64(time.Second))
+		}
+	}
+	wg.Wait()
+
+	return g.report(time.Since(start), sent, dropped), nil
+}
+
+// do sends one request and records its outcome.
+func (g *generator) do(ctx context.Context, c call, due time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, g.Timeout)
+	defer cancel()
+
+	st := g.stats[c.scenario]
+	req, done, err := g.request(ctx, c)
+	if errors.Is(err, errSkipped) {
+		g.mu.Lock()
+		st.skipped++
+		g.mu.Unlock()
+		return
+	}
+
+	var status int
+	var body []byte
+	if err == nil {
+		var resp *http.Response
+		resp, err = g.Client.Do(req)
+		if err == nil {
+			status = resp.StatusCode
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close() //nolint:all
+		}
+	}
+	latency := time.Since(due)
+	if err == nil && done != nil {
+		done(status, body)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st.latency.Record(int64(latency / time.Microsecond))
+	if kind := failure(status, body, err); kind != "" {
+		st.errors[kind]++
+	}
+}
+
+// failure names what went wrong with a request, or returns "" if nothing
+// did. Error responses are told apart by their problem code.
+func failure(status int, body []byte, err error) string {
+	var netErr net.Error
+	switch {
+		case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+			return "timeout"
+		case errors.Is(err, context.Canceled):
+			return "canceled"
+		case err != nil:
+			return "transport error"
+		case status < 400:
+			return ""
+	}
+	var problem struct {
+		Code string `json:"code"`
+	}
+	if json.Unmarshal(body, &problem) == nil && problem.Code != "" {
+		return fmt.Sprintf("%d %s", status, problem.Code)
+	}
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
+
+// HandlerClient returns a client that serves every request with h in the
+// same process, without a network connection, so that a test measures the
+// handler and not the network stack.
+func HandlerClient(h http.Handler) *http.Client {
+	return &http.Client{Transport: handlerTransport{h}}
+}
+
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.RequestURI = r.URL.RequestURI()
+	r.RemoteAddr = "127.0.0.1:0"
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	rec := httptest.NewRecorder()
+	t.h.ServeHTTP(rec, r)
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	return rec.Result(), nil
+}
@@ -0,0 +1,147 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/api"
+	"github.com/v-kuu/mini-marketplace/internal/seed"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/internal/testdb"
+)
+
+// newTestAPI serves the product API on a temporary database with 50 seeded
+// products and returns it with their IDs.
+func newTestAPI(t *testing.T) (http.Handler, []string) {
+	t.Helper()
+
+	db := testdb.Open(t)
+	m, err := seed.Run(context.Background(), db.Products, seed.DefaultSpec(), seed.Options{Seed: 1, Count: 50, BatchSize: 50})
+	if err != nil {
+		t.Fatalf("Failed to seed db: %v", err)
+	}
+	return api.AddRoutes(db.Config, api.Dependencies{Products: service.NewProductService(db.Products)}), m.IDs()
+}
+
+func TestRun_InProcess(t *testing.T) {
+	h, ids := newTestAPI(t)
+
+	report, err := Run(context.Background(), Options{
+		BaseURL: "http://marketplace",
+		Client: HandlerClient(h),
+		Rate: 400,
+		Duration: 500 * time.Millisecond,
+		Mix: Mix{ScenarioList: 1, ScenarioGet: 4, ScenarioCreate: 2, ScenarioPatch: 2, ScenarioDelete: 1},
+		IDs: ids,
+		Seed: 3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+
+	if report.Sent + report.Skipped + report.Dropped != 200 {
+		t.Fatalf("Expected 200 requests at 400/s over 500ms, got %d sent, %d skipped and %d dropped", report.Sent, report.Skipped, report.Dropped)
+	}
+	if report.Errors != 0 {
+		t.Fatalf("Expected no errors, got %v", report.ErrorCounts)
+	}
+	if len(report.Scenarios) != 5 {
+		t.Fatalf("Expected a report per scenario, got %+v", report.Scenarios)
+	}
+	requests := 0
+	for _, s := range report.Scenarios {
+		requests += s.Requests
+		if s.Requests > 0 && (s.Latency.P50 <= 0 || s.Latency.P50 > s.Latency.P99 || s.Latency.P99 > s.Latency.Max) {
+			t.Errorf("Expected ordered latencies for %s, got %+v", s.Name, s.Latency)
+		}
+	}
+	if requests != report.Sent {
+		t.Errorf("Expected every sent request in a scenario, got %d of %d", requests, report.Sent)
+	}
+	if report.Throughput <= 0 {
+		t.Errorf("Expected a throughput, got %v", report.Throughput)
+	}
+
+	var out bytes.Buffer
+	if err := report.Print(&out); err != nil {
+		t.Fatalf("Failed to print report: %v", err)
+	}
+	for _, want := range []string{"SCENARIO", "patch", "total"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the report, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	h, _ := newTestAPI(t)
+
+	// Unknown IDs are not found.
+	report, err := Run(context.Background(), Options{
+		BaseURL: "http://marketplace",
+		Client: HandlerClient(h),
+		Rate: 200,
+		Duration: 100 * time.Millisecond,
+		Mix: Mix{ScenarioGet: 1, ScenarioPatch: 1},
+		IDs: []string{"missing"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if report.Errors != report.Sent || report.ErrorCounts["404 product_not_found"] != report.Sent {
+		t.Fatalf("Expected every request to find no product, got %v of %d", report.ErrorCounts, report.Sent)
+	}
+
+	report, err = Run(context.Background(), Options{
+		BaseURL: "http://marketplace",
+		Client: HandlerClient(h),
+		Rate: 200,
+		Duration: 50 * time.Millisecond,
+		Mix: Mix{ScenarioDelete: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if report.Sent != 0 || report.Skipped == 0 || report.Scenarios[0].Skipped != report.Skipped {
+		t.Fatalf("Expected deletes without created products to be skipped, got %+v", report.Scenarios[0])
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	m, err := ParseMix("get=10, list=2,delete=0")
+	if err != nil {
+		t.Fatalf("Failed to parse mix: %v", err)
+	}
+	if m.String() != "list=2,get=10" {
+		t.Fatalf("Unexpected mix %v", m)
+	}
+	for _, s := range []string{"get", "buy=1", "get=-1", "get=0"} {
+		if _, err := ParseMix(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestFailure(t *testing.T) {
+	tests := []struct {
+		status int
+		body string
+		err error
+		want string
+	}{
+		{200, "", nil, ""},
+		{404, `{"code":"product_not_found"}`, nil, "404 product_not_found"},
+		{502, "bad gateway", nil, "502 Bad Gateway"},
+		{0, "", context.DeadlineExceeded, "timeout"},
+		{0, "", context.Canceled, "canceled"},
+	}
+	for _, tt := range tests {
+		if got := failure(tt.status, []byte(tt.body), tt.err); got != tt.want {
+			t.Errorf("failure(%d, %q, %v) = %q, want %q", tt.status, tt.body, tt.err, got, tt.want)
+		}
+	}
+}
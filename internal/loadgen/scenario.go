@@ -0,0 +1,213 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Scenarios, in report order.
+const (
+	ScenarioList = "list"
+	ScenarioGet = "get"
+	ScenarioCreate = "create"
+	ScenarioPatch = "patch"
+	ScenarioDelete = "delete"
+)
+
+var scenarios = []string{ScenarioList, ScenarioGet, ScenarioCreate, ScenarioPatch, ScenarioDelete}
+
+// Mix is the relative weight of every scenario. Scenarios that are missing
+// are not run.
+type Mix map[string]int
+
+// DefaultMix is a read-heavy catalog workload.
+func DefaultMix() Mix {
+	return Mix{ScenarioList: 2, ScenarioGet: 10, ScenarioCreate: 1, ScenarioPatch: 2, ScenarioDelete: 1}
+}
+
+// ParseMix reads a mix like "get=10,list=2,create=1".
+func ParseMix(s string) (Mix, error) {
+	m := make(Mix)
+	for part := range strings.SplitSeq(s, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not scenario=weight", part)
+		}
+		if !slices.Contains(scenarios, name) {
+			return nil, fmt.Errorf("unknown scenario %q, expected one of %s", name, strings.Join(scenarios, ", "))
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("the weight of %s must be a non-negative integer", name)
+		}
+		m[name] = w
+	}
+	return m, m.validate()
+}
+
+func (m Mix) validate() error {
+	total := 0
+	for name, w := range m {
+		if !slices.Contains(scenarios, name) {
+			return fmt.Errorf("unknown scenario %q", name)
+		}
+		total += w
+	}
+	if total <= 0 {
+		return errors.New("the mix needs at least one scenario with a weight above 0")
+	}
+	return nil
+}
+
+func (m Mix) String() string {
+	var parts []string
+	for _, name := range scenarios {
+		if m[name] > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", name, m[name]))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// pick returns the scenario that x, between 0 and the total weight, falls
+// on.
+func (m Mix) pick(x int) string {
+	for _, name := range scenarios {
+		if x < m[name] {
+			return name
+		}
+		x -= m[name]
+	}
+	return ""
+}
+
+func (m Mix) total() int {
+	total := 0
+	for _, w := range m {
+		total += w
+	}
+	return total
+}
+
+// errSkipped marks a request that was not sent because there was nothing
+// to run it on, such as a delete before the run created any product.
+var errSkipped = errors.New("skipped")
+
+// pool holds the IDs requests are made for. Products created by the run go
+// to a separate list, and only those are deleted, so that the seeded
+// products stay in place for the next run.
+type pool struct {
+	mu sync.Mutex
+	seeded []string
+	created []string
+}
+
+func (p *pool) any(x uint64) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.seeded) + len(p.created)
+	if n == 0 {
+		return "", false
+	}
+	i := int(x % uint64(n))
+	if i < len(p.seeded) {
+		return p.seeded[i], true
+	}
+	return p.created[i - len(p.seeded)], true
+}
+
+func (p *pool) add(id string) {
+	p.mu.Lock()
+	p.created = append(p.created, id)
+	p.mu.Unlock()
+}
+
+// take removes and returns a product the run created.
+func (p *pool) take(x uint64) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.created) == 0 {
+		return "", false
+	}
+	i := int(x % uint64(len(p.created)))
+	id := p.created[i]
+	p.created[i] = p.created[len(p.created) - 1]
+	p.created = p.created[:len(p.created) - 1]
+	return id, true
+}
+
+// call is one scheduled request. x and n are drawn by the scheduler, so
+// that the same seed picks the same products and prices.
+type call struct {
+	scenario string
+	x uint64
+	n int64
+}
+
+// newCall draws the next request of the mix.
+func newCall(m Mix, total int, r *rand.Rand) call {
+	return call{scenario: m.pick(r.IntN(total)), x: r.Uint64(), n: r.Int64N(100_000) + 1}
+}
+
+// request builds the HTTP request of c. done is called with the response
+// status and body once it has been read.
+func (g *generator) request(ctx context.Context, c call) (req *http.Request, done func(status int, body []byte), err error) {
+	path := func(id string) string { return g.baseURL + "/products/" + id }
+	jsonBody := func(v any) *bytes.Reader {
+		data, _ := json.Marshal(v)
+		return bytes.NewReader(data)
+	}
+
+	switch c.scenario {
+		case ScenarioList:
+			req, err = http.NewRequestWithContext(ctx, http.MethodGet, g.baseURL + "/products", nil)
+		case ScenarioGet:
+			id, ok := g.ids.any(c.x)
+			if !ok {
+				return nil, nil, errSkipped
+			}
+			req, err = http.NewRequestWithContext(ctx, http.MethodGet, path(id), nil)
+		case ScenarioCreate:
+			name := fmt.Sprintf("Loadgen %s %d", g.runID, g.created.Add(1))
+			req, err = http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL + "/products", jsonBody(map[string]any{"name": name, "price": c.n}))
+			done = func(status int, body []byte) {
+				var p struct {
+					ID string `json:"id"`
+				}
+				if status == http.StatusCreated && json.Unmarshal(body, &p) == nil && p.ID != "" {
+					g.ids.add(p.ID)
+				}
+			}
+		case ScenarioPatch:
+			id, ok := g.ids.any(c.x)
+			if !ok {
+				return nil, nil, errSkipped
+			}
+			req, err = http.NewRequestWithContext(ctx, http.MethodPatch, path(id), jsonBody(map[string]any{"price": c.n}))
+		case ScenarioDelete:
+			id, ok := g.ids.take(c.x)
+			if !ok {
+				return nil, nil, errSkipped
+			}
+			req, err = http.NewRequestWithContext(ctx, http.MethodDelete, path(id), nil)
+		default:
+			return nil, nil, fmt.Errorf("unknown scenario %q", c.scenario)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", "loadgen")
+	return req, done, nil
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	BackupsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "marketplace",
+			Subsystem: "backup",
+			Name: "backups_total",
+			Help: "Total number of database backups by result",
+		},
+		[]string{"result"},
+	)
+
+	BackupLastSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "marketplace",
+			Subsystem: "backup",
+			Name: "last_success_timestamp_seconds",
+			Help: "Unix time of the last successful database backup",
+		},
+	)
+
+	BackupSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "marketplace",
+			Subsystem: "backup",
+			Name: "last_size_bytes",
+			Help: "Size of the last successful database backup in bytes",
+		},
+	)
+)
@@ -0,0 +1,24 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	ConfigReloadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "marketplace",
+			Subsystem: "config",
+			Name: "reloads_total",
+			Help: "Total number of configuration reloads by result",
+		},
+		[]string{"result"},
+	)
+
+	ConfigLastReloadSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "marketplace",
+			Subsystem: "config",
+			Name: "last_reload_success_timestamp_seconds",
+			Help: "Unix time of the last successful configuration reload",
+		},
+	)
+)
@@ -3,7 +3,7 @@ package metrics
 import "github.com/prometheus/client_golang/prometheus"
 
 var (
-	DbSemaphoreWaitDuration = prometheus.NewHistogram(
+	DbSemaphoreWaitDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: "marketplace",
 			Subsystem: "db",
@@ -11,14 +11,36 @@ var (
 			Help: "Time spent waiting for database semaphore",
 			Buckets: prometheus.DefBuckets,
 		},
+		[]string{"pool", "op"},
 	)
 
-	DbSemaphoreInUse = prometheus.NewGauge(
+	DbSemaphoreInUse = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: "marketplace",
 			Subsystem: "db",
 			Name: "semaphore_in_use",
-			Help: "Current number of database operations in progress",
+			Help: "Current weight of database operations in progress",
 		},
+		[]string{"pool", "op"},
+	)
+
+	DbConcurrencyLimit = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "marketplace",
+			Subsystem: "db",
+			Name: "concurrency_limit",
+			Help: "Current adaptive limit on concurrent database operations",
+		},
+		[]string{"pool"},
+	)
+
+	DbRequestsShed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "marketplace",
+			Subsystem: "db",
+			Name: "requests_shed_total",
+			Help: "Total number of low-priority database requests rejected by the limiter",
+		},
+		[]string{"pool", "op"},
 	)
 )
@@ -0,0 +1,23 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	EventStreamsActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "marketplace",
+			Subsystem: "events",
+			Name: "streams_active",
+			Help: "Current number of connected product event streams",
+		},
+	)
+
+	EventStreamsDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "marketplace",
+			Subsystem: "events",
+			Name: "slow_clients_dropped_total",
+			Help: "Total number of event streams closed because the client did not keep up",
+		},
+	)
+)
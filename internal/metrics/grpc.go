@@ -0,0 +1,38 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// The gRPC metrics use the labels of the HTTP metrics. method is always
+// POST, which is how gRPC calls travel over HTTP/2, path is the full RPC
+// name and status is the gRPC status code, such as OK or NotFound.
+var (
+	GrpcRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "marketplace",
+			Subsystem: "grpc",
+			Name: "requests_total",
+			Help: "Total number of gRPC requests",
+		},
+		[]string{"method", "path", "status"},
+	)
+
+	GrpcRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "marketplace",
+			Subsystem: "grpc",
+			Name: "request_duration_seconds",
+			Help: "gRPC request latency",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "path"},
+	)
+
+	GrpcInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "marketplace",
+			Subsystem: "grpc",
+			Name: "in_flight_requests",
+			Help: "Current number of in-flight gRPC requests",
+		},
+	)
+)
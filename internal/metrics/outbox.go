@@ -0,0 +1,32 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	OutboxRelayLag = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "marketplace",
+			Subsystem: "outbox",
+			Name: "relay_lag_seconds",
+			Help: "Age of the oldest unpublished outbox event, 0 when the outbox is empty",
+		},
+	)
+
+	OutboxPublished = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "marketplace",
+			Subsystem: "outbox",
+			Name: "events_published_total",
+			Help: "Total number of outbox events published",
+		},
+	)
+
+	OutboxPublishFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "marketplace",
+			Subsystem: "outbox",
+			Name: "publish_failures_total",
+			Help: "Total number of failed outbox event publishes",
+		},
+	)
+)
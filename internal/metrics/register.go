@@ -1,13 +1,44 @@
 package metrics
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
 
 func Register() {
 	prometheus.MustRegister(
 		HttpRequestsTotal,
 		HttpRequestDuration,
 		HttpInFlight,
+		GrpcRequestsTotal,
+		GrpcRequestDuration,
+		GrpcInFlight,
 		DbSemaphoreWaitDuration,
 		DbSemaphoreInUse,
+		DbConcurrencyLimit,
+		DbRequestsShed,
+		ConfigReloadsTotal,
+		ConfigLastReloadSuccess,
+		EventStreamsActive,
+		EventStreamsDropped,
+		WebSocketConnections,
+		WebSocketSubscriptions,
+		WebSocketDropped,
+		WebhookAttempts,
+		WebhookAttemptDuration,
+		OutboxRelayLag,
+		OutboxPublished,
+		OutboxPublishFailures,
+		BackupsTotal,
+		BackupLastSuccess,
+		BackupSize,
 	)
 }
+
+// RegisterDB exports the sql.DBStats of a connection pool, labelled with
+// db_name.
+func RegisterDB(name string, db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
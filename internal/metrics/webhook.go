@@ -0,0 +1,25 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	WebhookAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "marketplace",
+			Subsystem: "webhook",
+			Name: "attempts_total",
+			Help: "Total number of webhook delivery attempts, by outcome",
+		},
+		[]string{"result"},
+	)
+
+	WebhookAttemptDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "marketplace",
+			Subsystem: "webhook",
+			Name: "attempt_duration_seconds",
+			Help: "Duration of webhook delivery attempts",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+)
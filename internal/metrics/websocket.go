@@ -0,0 +1,33 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	WebSocketConnections = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "marketplace",
+			Subsystem: "websocket",
+			Name: "connections_active",
+			Help: "Current number of open product WebSocket connections",
+		},
+	)
+
+	WebSocketSubscriptions = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "marketplace",
+			Subsystem: "websocket",
+			Name: "subscriptions_active",
+			Help: "Current number of product subscriptions across all WebSocket connections",
+		},
+	)
+
+	WebSocketDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "marketplace",
+			Subsystem: "websocket",
+			Name: "clients_dropped_total",
+			Help: "Total number of WebSocket connections closed by the server, by reason",
+		},
+		[]string{"reason"},
+	)
+)
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent is a domain event recorded in the transaction of the change
+// it describes. Type names the event, such as product.created, and Data
+// holds the product as it was after the change, or before a delete.
+type OutboxEvent struct {
+	ID int64 `json:"id"`
+	Type string `json:"type"`
+	AggregateID string `json:"aggregate_id"`
+	Data json.RawMessage `json:"data"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
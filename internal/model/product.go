@@ -1,7 +1,34 @@
 package model
 
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxNameLength is the longest product name accepted, in characters.
+	MaxNameLength = 100
+	// MaxPrice is the highest product price accepted, in cents.
+	MaxPrice = 100_000_000
+	// NameSymbols are the characters besides letters, digits and spaces
+	// allowed in product names.
+	NameSymbols = "-_.,&'()/+#%!:"
+)
+
 type Product struct {
 	ID string `json:"id"`
 	Name string `json:"name"`
 	Price int64 `json:"price"`
 }
+
+// NameCharsAllowed reports whether name only contains letters, digits,
+// spaces and NameSymbols. Every API checks names with it, so products
+// written through one can be written back through any other.
+func NameCharsAllowed(name string) bool {
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsMark(c) && !unicode.IsDigit(c) && c != ' ' && !strings.ContainsRune(NameSymbols, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rules broken by invalid product fields. The APIs report them with each
+// violation and they are part of their contracts.
+const (
+	RuleRequired = "required"
+	RuleMaxLength = "max_length"
+	RulePattern = "pattern"
+	RuleMinimum = "minimum"
+	RuleMaximum = "maximum"
+)
+
+// Violation is a rule that a product field breaks. Field is the JSON name
+// of the field; each API turns it into its own way of pointing at input.
+type Violation struct {
+	Field string
+	Rule string
+	Message string
+}
+
+// ValidateProduct returns every rule that name and price break. All APIs
+// check products with it, so a product rejected by one is rejected by all
+// of them, with the same rules and messages.
+func ValidateProduct(name string, price int64) []Violation {
+	return append(ValidateName(name), ValidatePrice(price)...)
+}
+
+// ValidateName returns the rules a product name breaks. An empty name
+// only breaks the required rule.
+func ValidateName(name string) []Violation {
+	if strings.TrimSpace(name) == "" {
+		return []Violation{{Field: "name", Rule: RuleRequired, Message: "must not be empty"}}
+	}
+	var violations []Violation
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		violations = append(violations, Violation{Field: "name", Rule: RuleMaxLength, Message: fmt.Sprintf("must be at most %d characters", MaxNameLength)})
+	}
+	if !NameCharsAllowed(name) {
+		violations = append(violations, Violation{Field: "name", Rule: RulePattern, Message: "may only contain letters, digits, spaces and " + NameSymbols})
+	}
+	return violations
+}
+
+// ValidatePrice returns the rule a product price breaks, if any.
+func ValidatePrice(price int64) []Violation {
+	switch {
+		case price <= 0:
+			return []Violation{{Field: "price", Rule: RuleMinimum, Message: "must be greater than 0"}}
+		case price > MaxPrice:
+			return []Violation{{Field: "price", Rule: RuleMaximum, Message: fmt.Sprintf("must be at most %d", MaxPrice)}}
+	}
+	return nil
+}
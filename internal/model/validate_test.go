@@ -0,0 +1,37 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateProduct(t *testing.T) {
+	tests := []struct {
+		name string
+		productName string
+		price int64
+		want []string
+	}{
+		{name: "valid", productName: "Coffee (1 kg)", price: 499},
+		{name: "empty name", productName: "  ", price: 1, want: []string{"name:required"}},
+		{name: "long name with symbols", productName: strings.Repeat("a", MaxNameLength) + "<", price: 1, want: []string{"name:max_length", "name:pattern"}},
+		{name: "zero price", productName: "Tea", price: 0, want: []string{"price:minimum"}},
+		{name: "everything", productName: "", price: MaxPrice + 1, want: []string{"name:required", "price:maximum"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range ValidateProduct(tt.productName, tt.price) {
+				if v.Message == "" {
+					t.Errorf("Expected a message for %s", v.Rule)
+				}
+				got = append(got, v.Field + ":" + v.Rule)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expected violations %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
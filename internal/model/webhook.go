@@ -0,0 +1,76 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook is a partner endpoint that receives product changes. Events
+// lists the change types it receives. The secret signs every delivery and
+// is only returned when the webhook is created.
+type Webhook struct {
+	ID string `json:"id"`
+	URL string `json:"url"`
+	Events []string `json:"events"`
+	Secret string `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead marks a delivery that failed on every attempt and is no
+	// longer retried.
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// WebhookDelivery is one product change to be sent to one webhook.
+type WebhookDelivery struct {
+	ID int64 `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	EventID int64 `json:"event_id"`
+	Event string `json:"event"`
+	Payload json.RawMessage `json:"payload" swaggertype:"object"`
+	Status DeliveryStatus `json:"status"`
+	Attempts int `json:"attempts"`
+	// NextAttemptAt is set while the delivery is pending.
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatusCode int `json:"last_status_code,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// AttemptLog is only filled in when a single delivery is read.
+	AttemptLog []WebhookAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookAttempt is the outcome of one POST of a delivery. StatusCode is 0
+// if no response was received. Error is empty if the receiver accepted the
+// delivery and otherwise one of the attempt errors below. It only says what
+// kind of failure it was; the server log has the full error.
+type WebhookAttempt struct {
+	Attempt int `json:"attempt"`
+	At time.Time `json:"at"`
+	DurationMS int64 `json:"duration_ms"`
+	StatusCode int `json:"status_code,omitempty"`
+	Error string `json:"error,omitempty" enums:"timeout,blocked_address,connection_failed,http_status"`
+}
+
+// Errors of failed attempts.
+const (
+	// AttemptTimeout is an attempt that did not finish within the timeout.
+	AttemptTimeout = "timeout"
+	// AttemptBlockedAddress is a receiver that resolved to an address
+	// webhooks may not reach.
+	AttemptBlockedAddress = "blocked_address"
+	// AttemptConnectionFailed is any other error of the connection.
+	AttemptConnectionFailed = "connection_failed"
+	// AttemptHTTPStatus is a response with a status other than 2xx.
+	AttemptHTTPStatus = "http_status"
+)
+
+// Succeeded reports whether the receiver accepted the delivery.
+func (a WebhookAttempt) Succeeded() bool {
+	return a.Error == ""
+}
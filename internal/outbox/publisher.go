@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+// EventPublisher sends outbox events to where other systems consume them.
+// Publish returns only once the event is handed over durably, because the
+// relay deletes it from the outbox afterwards.
+type EventPublisher interface {
+	Publish(ctx context.Context, e model.OutboxEvent) error
+	Close() error
+}
+
+// LogPublisher writes every event to a structured log. It suits
+// development, where nothing consumes the events yet.
+type LogPublisher struct {
+	logger *slog.Logger
+}
+
+func NewLogPublisher(logger *slog.Logger) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, e model.OutboxEvent) error {
+	p.logger.InfoContext(
+		ctx, "Outbox event",
+		"id", e.ID, "type", e.Type, "aggregate_id", e.AggregateID, "data", string(e.Data),
+	)
+	return nil
+}
+
+func (p *LogPublisher) Close() error {
+	return nil
+}
+
+// FilePublisher appends every event as a line of JSON to a file and syncs
+// it before Publish returns.
+type FilePublisher struct {
+	mu sync.Mutex
+	f *os.File
+}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{f: f}, nil
+}
+
+func (p *FilePublisher) Publish(ctx context.Context, e model.OutboxEvent) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return p.f.Sync()
+}
+
+func (p *FilePublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.f.Close()
+}
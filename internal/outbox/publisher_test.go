@@ -0,0 +1,191 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+func testEvent(id int64) model.OutboxEvent {
+	return model.OutboxEvent{
+		ID: id,
+		Type: "product.updated",
+		AggregateID: "p1",
+		Data: json.RawMessage(`{"id":"p1","name":"Coffee","price":549}`),
+		OccurredAt: time.UnixMilli(1_700_000_000_000).UTC(),
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.ndjson")
+	pub, err := NewFilePublisher(path)
+	if err != nil {
+		t.Fatalf("NewFilePublisher failed: %v", err)
+	}
+	for id := range int64(2) {
+		if err := pub.Publish(context.Background(), testEvent(id+1)); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+	if err := pub.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", data)
+	}
+	var e model.OutboxEvent
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatalf("Failed to decode line: %v", err)
+	}
+	if e.ID != 2 || e.Type != "product.updated" || e.AggregateID != "p1" || string(e.Data) != string(testEvent(2).Data) {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+// natsServer accepts one connection at a time and speaks enough of the
+// NATS protocol to receive publishes. It answers -ERR to the publish of
+// the subject in reject.
+type natsServer struct {
+	ln net.Listener
+	msgs chan string
+	reject string
+}
+
+func newNATSServer(t *testing.T, reject string) *natsServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := &natsServer{ln: ln, msgs: make(chan string, 10), reject: reject}
+	t.Cleanup(func () {
+		if err := ln.Close(); err != nil {
+			t.Errorf("Failed to close listener: %v", err)
+		}
+	})
+	go s.serve()
+	return s
+}
+
+func (s *natsServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.handle(conn)
+	}
+}
+
+func (s *natsServer) handle(conn net.Conn) {
+	defer conn.Close() //nolint:all
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+			case len(fields) == 0:
+			case fields[0] == "CONNECT":
+				s.msgs <- strings.TrimSpace(line)
+			case fields[0] == "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			case fields[0] == "PUB" && len(fields) == 3:
+				n, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, n+2)
+				if _, err := io.ReadFull(r, payload); err != nil {
+					return
+				}
+				if fields[1] == s.reject {
+					fmt.Fprint(conn, "-ERR 'Permissions Violation'\r\n")
+					return
+				}
+				s.msgs <- fields[1] + " " + string(payload[:n])
+		}
+	}
+}
+
+func TestNATSPublisher(t *testing.T) {
+	server := newNATSServer(t, "marketplace.product.deleted")
+	pub, err := NewNATSPublisher("nats://relay:secret@"+server.ln.Addr().String(), "marketplace", time.Second)
+	if err != nil {
+		t.Fatalf("NewNATSPublisher failed: %v", err)
+	}
+	defer func () {
+		if err := pub.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	}()
+
+	if err := pub.Publish(context.Background(), testEvent(1)); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if connect := <-server.msgs; !strings.Contains(connect, `"user":"relay"`) || !strings.Contains(connect, `"pass":"secret"`) {
+		t.Errorf("Expected CONNECT with credentials, got %q", connect)
+	}
+	subject, payload, _ := strings.Cut(<-server.msgs, " ")
+	if subject != "marketplace.product.updated" {
+		t.Errorf("Expected subject marketplace.product.updated, got %q", subject)
+	}
+	var e model.OutboxEvent
+	if err := json.Unmarshal([]byte(payload), &e); err != nil || e.ID != 1 {
+		t.Errorf("Expected event 1 as payload, got %q (%v)", payload, err)
+	}
+
+	// A rejected publish fails and the next one reconnects.
+	deleted := testEvent(2)
+	deleted.Type = "product.deleted"
+	if err := pub.Publish(context.Background(), deleted); err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Fatalf("Expected the server error, got %v", err)
+	}
+	if err := pub.Publish(context.Background(), testEvent(3)); err != nil {
+		t.Fatalf("Publish after reconnect failed: %v", err)
+	}
+	<-server.msgs
+	if subject, _, _ := strings.Cut(<-server.msgs, " "); subject != "marketplace.product.updated" {
+		t.Errorf("Expected the event after reconnecting, got %q", subject)
+	}
+}
+
+func TestNATSPublisher_Unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	addr := ln.Addr().String()
+	if err := ln.Close(); err != nil {
+		t.Fatalf("Failed to close listener: %v", err)
+	}
+
+	pub, err := NewNATSPublisher("nats://"+addr, "marketplace", time.Second)
+	if err != nil {
+		t.Fatalf("NewNATSPublisher failed: %v", err)
+	}
+	if err := pub.Publish(context.Background(), testEvent(1)); err == nil {
+		t.Fatal("Expected an error from an unreachable server")
+	}
+	if _, err := NewNATSPublisher("http://"+addr, "marketplace", time.Second); err == nil {
+		t.Fatal("Expected an error for a non-NATS URL")
+	}
+}
@@ -0,0 +1,103 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+// Store is the outbox the relay drains.
+type Store interface {
+	// PendingEvents returns up to limit unpublished events, oldest first.
+	PendingEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error)
+	// DeletePublished removes the events up to and including through.
+	DeletePublished(ctx context.Context, through int64) error
+}
+
+// Relay publishes outbox events in order. Delivery is at least once: an
+// event is deleted only after it was published, so an event whose delete
+// fails, or that was in flight when the relay stopped, is published again.
+// Consumers should ignore event IDs they have already seen.
+type Relay struct {
+	store Store
+	pub EventPublisher
+	batchSize int
+	pollInterval time.Duration
+	now func() time.Time
+}
+
+// NewRelay creates a relay that publishes batchSize events at a time. It
+// looks for new events every pollInterval, and whenever Run is signalled.
+func NewRelay(store Store, pub EventPublisher, batchSize int, pollInterval time.Duration) *Relay {
+	return &Relay{store: store, pub: pub, batchSize: batchSize, pollInterval: pollInterval, now: time.Now}
+}
+
+// Run relays events until ctx is done. A publish failure stops the current
+// round, so events are never published out of order; the failed event is
+// tried again at the next poll.
+func (r *Relay) Run(ctx context.Context, changes <-chan struct{}) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.relay(ctx)
+		select {
+			case <-ctx.Done():
+				return
+			case <-changes:
+			case <-ticker.C:
+		}
+	}
+}
+
+// relay publishes pending events until the outbox is empty or an error
+// occurs. The lag metric is the age of the oldest unpublished event, so it
+// is set at the start of every batch and while a backlog is worked off.
+func (r *Relay) relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := r.store.PendingEvents(ctx, r.batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Failed to read outbox", "err", err)
+			}
+			return
+		}
+		if len(events) == 0 {
+			metrics.OutboxRelayLag.Set(0)
+			return
+		}
+		metrics.OutboxRelayLag.Set(r.now().Sub(events[0].OccurredAt).Seconds())
+
+		published := 0
+		for _, e := range events {
+			if err := r.pub.Publish(ctx, e); err != nil {
+				if ctx.Err() == nil {
+					metrics.OutboxPublishFailures.Inc()
+					slog.Error("Failed to publish outbox event", "id", e.ID, "err", err)
+				}
+				break
+			}
+			published++
+		}
+		if published < len(events) {
+			metrics.OutboxRelayLag.Set(r.now().Sub(events[published].OccurredAt).Seconds())
+		}
+		if published == 0 {
+			return
+		}
+
+		metrics.OutboxPublished.Add(float64(published))
+		if err := r.store.DeletePublished(ctx, events[published-1].ID); err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Failed to delete published outbox events", "err", err)
+			}
+			return
+		}
+		if published < len(events) {
+			return
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+type fakeStore struct {
+	mu sync.Mutex
+	events []model.OutboxEvent
+	deleteErr error
+}
+
+func (f *fakeStore) PendingEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.events[:min(limit, len(f.events))]), nil
+}
+
+func (f *fakeStore) DeletePublished(ctx context.Context, through int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.deleteErr != nil {
+		return f.deleteErr
+	}
+	f.events = slices.DeleteFunc(f.events, func(e model.OutboxEvent) bool { return e.ID <= through })
+	return nil
+}
+
+type fakePublisher struct {
+	mu sync.Mutex
+	published []int64
+	// failAt fails the publish of the event with this ID.
+	failAt int64
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, e model.OutboxEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if e.ID == f.failAt {
+		return errors.New("broker unavailable")
+	}
+	f.published = append(f.published, e.ID)
+	return nil
+}
+
+func (f *fakePublisher) Close() error {
+	return nil
+}
+
+func testEvents(now time.Time, n int) []model.OutboxEvent {
+	events := make([]model.OutboxEvent, n)
+	for i := range events {
+		events[i] = model.OutboxEvent{
+			ID: int64(i + 1),
+			Type: "product.created",
+			AggregateID: "p",
+			OccurredAt: now.Add(time.Duration(i-n) * time.Second),
+		}
+	}
+	return events
+}
+
+func TestRelay(t *testing.T) {
+	now := time.Now()
+	store := &fakeStore{events: testEvents(now, 5)}
+	pub := &fakePublisher{failAt: 4}
+	relay := NewRelay(store, pub, 2, time.Hour)
+	relay.now = func() time.Time { return now }
+
+	// A failure stops the round, so nothing after the failed event is
+	// published ahead of it.
+	relay.relay(context.Background())
+	if !slices.Equal(pub.published, []int64{1, 2, 3}) {
+		t.Fatalf("Expected events 1 to 3 published, got %v", pub.published)
+	}
+	if len(store.events) != 2 || store.events[0].ID != 4 {
+		t.Fatalf("Expected events 4 and 5 left, got %v", store.events)
+	}
+	if lag := testutil.ToFloat64(metrics.OutboxRelayLag); lag != 2 {
+		t.Errorf("Expected a lag of 2s, the age of event 4, got %v", lag)
+	}
+
+	pub.failAt = 0
+	relay.relay(context.Background())
+	if !slices.Equal(pub.published, []int64{1, 2, 3, 4, 5}) || len(store.events) != 0 {
+		t.Fatalf("Expected every event published once, got %v with %d left", pub.published, len(store.events))
+	}
+	if lag := testutil.ToFloat64(metrics.OutboxRelayLag); lag != 0 {
+		t.Errorf("Expected no lag on an empty outbox, got %v", lag)
+	}
+}
+
+// slowPublisher takes a second of the relay's clock for every event and
+// records the lag metric at the time of each publish.
+type slowPublisher struct {
+	now time.Time
+	lags []float64
+}
+
+func (s *slowPublisher) Publish(ctx context.Context, e model.OutboxEvent) error {
+	s.lags = append(s.lags, testutil.ToFloat64(metrics.OutboxRelayLag))
+	s.now = s.now.Add(time.Second)
+	return nil
+}
+
+func (s *slowPublisher) Close() error {
+	return nil
+}
+
+func TestRelay_LagDuringBacklog(t *testing.T) {
+	now := time.Now()
+	store := &fakeStore{events: testEvents(now, 6)}
+	pub := &slowPublisher{now: now}
+	relay := NewRelay(store, pub, 2, time.Hour)
+	relay.now = func() time.Time { return pub.now }
+	metrics.OutboxRelayLag.Set(0)
+
+	// Every batch starts with the age of its oldest event, so the lag shows
+	// while the backlog is worked off rather than only once it is gone.
+	relay.relay(context.Background())
+	if want := []float64{6, 6, 6, 6, 6, 6}; !slices.Equal(pub.lags, want) {
+		t.Fatalf("Expected lags %v while publishing, got %v", want, pub.lags)
+	}
+	if lag := testutil.ToFloat64(metrics.OutboxRelayLag); lag != 0 {
+		t.Errorf("Expected no lag on an empty outbox, got %v", lag)
+	}
+}
+
+func TestRelay_AtLeastOnce(t *testing.T) {
+	store := &fakeStore{events: testEvents(time.Now(), 2), deleteErr: errors.New("database is locked")}
+	pub := &fakePublisher{}
+	relay := NewRelay(store, pub, 10, time.Hour)
+
+	// Events whose delete failed are published again.
+	relay.relay(context.Background())
+	store.deleteErr = nil
+	relay.relay(context.Background())
+	if !slices.Equal(pub.published, []int64{1, 2, 1, 2}) || len(store.events) != 0 {
+		t.Fatalf("Expected events 1 and 2 published twice, got %v with %d left", pub.published, len(store.events))
+	}
+}
+
+func TestRelay_Run(t *testing.T) {
+	store := &fakeStore{}
+	pub := &fakePublisher{}
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		NewRelay(store, pub, 10, time.Hour).Run(ctx, changes)
+		close(done)
+	}()
+
+	// A change signal makes the relay look for events without waiting for
+	// the poll interval.
+	store.mu.Lock()
+	store.events = testEvents(time.Now(), 1)
+	store.mu.Unlock()
+	changes <- struct{}{}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		pub.mu.Lock()
+		published := slices.Clone(pub.published)
+		pub.mu.Unlock()
+		if slices.Equal(published, []int64{1}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected event 1 published after a change, got %v", published)
+		}
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,379 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// JSONPatch is an RFC 6902 JSON patch: a list of operations applied in
+// order. If any operation fails, including a test, none of them apply.
+type JSONPatch []Operation
+
+// Operation is one JSON Patch operation.
+type Operation struct {
+	Op string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+
+	path pointer
+	from pointer
+}
+
+func DecodeJSONPatch(data []byte) (JSONPatch, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: a JSON patch must be an array of operations: %v", ErrInvalidPatch, err)
+	}
+
+	ops := make(JSONPatch, len(raw))
+	for i, fields := range raw {
+		op, err := decodeOperation(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+		}
+		ops[i] = op
+	}
+	return ops, nil
+}
+
+func decodeOperation(fields map[string]json.RawMessage) (Operation, error) {
+	var op Operation
+	str := func(name string, dst *string) error {
+		raw, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("missing %q", name)
+		}
+		if err := json.Unmarshal(raw, dst); err != nil {
+			return fmt.Errorf("%q must be a string", name)
+		}
+		return nil
+	}
+
+	if err := str("op", &op.Op); err != nil {
+		return op, err
+	}
+	if err := str("path", &op.Path); err != nil {
+		return op, err
+	}
+	var err error
+	if op.path, err = parsePointer(op.Path); err != nil {
+		return op, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		value, ok := fields["value"]
+		if !ok {
+			return op, fmt.Errorf("%s requires a value", op.Op)
+		}
+		op.Value = value
+	case "move", "copy":
+		if err := str("from", &op.From); err != nil {
+			return op, err
+		}
+		if op.from, err = parsePointer(op.From); err != nil {
+			return op, err
+		}
+		if op.Op == "move" && op.from.isProperPrefixOf(op.path) {
+			return op, fmt.Errorf("cannot move %q into its own child %q", op.From, op.Path)
+		}
+	case "remove":
+	default:
+		return op, fmt.Errorf("unknown op %q", op.Op)
+	}
+	return op, nil
+}
+
+func (p JSONPatch) Apply(doc []byte) ([]byte, error) {
+	v, err := unmarshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	for i, op := range p {
+		if v, err = op.apply(v); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(v)
+}
+
+func (op Operation) apply(doc any) (any, error) {
+	switch op.Op {
+	case "add":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+	case "remove":
+		return remove(doc, op.path)
+	case "replace":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := get(doc, op.path); err != nil {
+			return nil, err
+		}
+		if len(op.path) == 0 {
+			return value, nil
+		}
+		if doc, err = remove(doc, op.path); err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+	case "move":
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = remove(doc, op.from); err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+	case "copy":
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, clone(value))
+	case "test":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(doc, op.path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrTestFailed, err)
+		}
+		if !equal(actual, value) {
+			return nil, fmt.Errorf("%w: value at %q does not match", ErrTestFailed, op.Path)
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+// value decodes the operation value afresh, so it is never shared between
+// documents.
+func (op Operation) value() (any, error) {
+	v, err := unmarshal(op.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid value: %v", ErrInvalidPatch, err)
+	}
+	return v, nil
+}
+
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = clone(e)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, e := range v {
+			s[i] = clone(e)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// equal compares JSON values as RFC 6902 requires: numbers by value,
+// objects regardless of member order.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okA := new(big.Rat).SetString(a.String())
+		y, okB := new(big.Rat).SetString(b.String())
+		return okA && okB && x.Cmp(y) == 0
+	default:
+		return a == b
+	}
+}
+
+// pointer is a parsed RFC 6901 JSON pointer. The empty pointer refers to
+// the whole document.
+type pointer []string
+
+func parsePointer(s string) (pointer, error) {
+	if s == "" {
+		return pointer{}, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func (p pointer) isProperPrefixOf(q pointer) bool {
+	if len(p) >= len(q) {
+		return false
+	}
+	for i := range p {
+		if p[i] != q[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func get(doc any, p pointer) (any, error) {
+	for _, token := range p {
+		switch c := doc.(type) {
+		case map[string]any:
+			v, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q does not exist", ErrInvalidPatch, token)
+			}
+			doc = v
+		case []any:
+			i, err := index(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("%w: cannot reference %q in a scalar", ErrInvalidPatch, token)
+		}
+	}
+	return doc, nil
+}
+
+// index parses an array index token, which must not exceed maxIndex.
+func index(token string, maxIndex int) (int, error) {
+	i := 0
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+		}
+		i = i*10 + int(c-'0')
+		if i > maxIndex {
+			return 0, fmt.Errorf("%w: array index %s is out of bounds", ErrInvalidPatch, token)
+		}
+	}
+	return i, nil
+}
+
+// update replaces the container holding the last token of p with what fn
+// returns for it and returns the new document. Arrays change identity when
+// they grow or shrink, so every ancestor is rewritten on the way back.
+func update(doc any, p pointer, fn func(container any, token string) (any, error)) (any, error) {
+	if len(p) == 1 {
+		return fn(doc, p[0])
+	}
+
+	child, err := get(doc, p[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = update(child, p[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := doc.(type) {
+	case map[string]any:
+		c[p[0]] = child
+	case []any:
+		i, err := index(p[0], len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = child
+	}
+	return doc, nil
+}
+
+func add(doc any, p pointer, value any) (any, error) {
+	if len(p) == 0 {
+		return value, nil
+	}
+	return update(doc, p, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			if token == "-" {
+				return append(c, value), nil
+			}
+			i, err := index(token, len(c))
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		default:
+			return nil, fmt.Errorf("%w: cannot add %q to a scalar", ErrInvalidPatch, token)
+		}
+	})
+}
+
+func remove(doc any, p pointer) (any, error) {
+	if len(p) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+	return update(doc, p, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("%w: member %q does not exist", ErrInvalidPatch, token)
+			}
+			delete(c, token)
+			return c, nil
+		case []any:
+			i, err := index(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:i], c[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: cannot remove %q from a scalar", ErrInvalidPatch, token)
+		}
+	})
+}
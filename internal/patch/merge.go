@@ -0,0 +1,53 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MergePatch is an RFC 7396 merge patch. Members set to null are removed
+// from the target, objects are merged recursively and every other value
+// replaces the target member.
+type MergePatch struct {
+	raw []byte
+}
+
+func DecodeMergePatch(data []byte) (*MergePatch, error) {
+	if _, err := unmarshal(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return &MergePatch{raw: data}, nil
+}
+
+func (p *MergePatch) Apply(doc []byte) ([]byte, error) {
+	target, err := unmarshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	// The patch is decoded again so the result never shares values with
+	// an earlier application.
+	patch, err := unmarshal(p.raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(merge(target, patch))
+}
+
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = merge(t[k], v)
+		}
+	}
+	return t
+}
@@ -0,0 +1,60 @@
+// Package patch applies RFC 7396 JSON Merge Patch and RFC 6902 JSON Patch
+// documents to JSON values.
+//
+// Patches are decoded once and can then be applied to any number of
+// documents. Applying a patch never modifies its input; a patch either
+// applies completely or returns an error and no result.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalidPatch means the patch is malformed or cannot be applied to
+	// the document, for example because a path does not exist.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrTestFailed means a JSON Patch test operation did not match.
+	ErrTestFailed = errors.New("patch test failed")
+)
+
+// Patch is a decoded patch document.
+type Patch interface {
+	Apply(doc []byte) ([]byte, error)
+}
+
+// Decode decodes data as a patch of the given media type.
+func Decode(contentType string, data []byte) (Patch, error) {
+	switch contentType {
+	case MergePatchContentType:
+		return DecodeMergePatch(data)
+	case JSONPatchContentType:
+		return DecodeJSONPatch(data)
+	default:
+		return nil, fmt.Errorf("%w: unsupported media type %s", ErrInvalidPatch, contentType)
+	}
+}
+
+// unmarshal decodes a JSON value keeping numbers exact, so integers such as
+// prices survive a round trip unchanged.
+func unmarshal(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return v, nil
+}
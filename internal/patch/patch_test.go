@@ -0,0 +1,157 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// sameJSON compares documents independent of member order and formatting.
+func sameJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+
+	g, err := unmarshal(got)
+	if err != nil {
+		t.Fatalf("Invalid result %s: %v", got, err)
+	}
+	w, err := unmarshal([]byte(want))
+	if err != nil {
+		t.Fatalf("Invalid expectation %s: %v", want, err)
+	}
+	return equal(g, w)
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396, Appendix A.
+	tests := []struct {
+		doc string
+		patch string
+		want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		p, err := DecodeMergePatch([]byte(tt.patch))
+		if err != nil {
+			t.Fatalf("DecodeMergePatch(%s) failed: %v", tt.patch, err)
+		}
+		got, err := p.Apply([]byte(tt.doc))
+		if err != nil {
+			t.Fatalf("Apply(%s, %s) failed: %v", tt.doc, tt.patch, err)
+		}
+		if !sameJSON(t, got, tt.want) {
+			t.Fatalf("Apply(%s, %s) = %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	// Mostly examples from RFC 6902, Appendix A.
+	tests := []struct {
+		name string
+		doc string
+		patch string
+		want string
+		wantErr error
+	}{
+		{"Add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+		{"Add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{"Append", `{"foo":[1]}`, `[{"op":"add","path":"/foo/-","value":2}]`, `{"foo":[1,2]}`, nil},
+		{"Remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"Remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{"Replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+		{"Move", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"Move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+		{"Copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, nil},
+		{"Test success", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, `{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"Escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`, nil},
+		{"Null value", `{}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`, nil},
+		{"Replace root", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, nil},
+		{"Test failure", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, ErrTestFailed},
+		{"Test of missing member", `{}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, ErrTestFailed},
+		{"Failure applies nothing", `{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":2}]`, ``, ErrTestFailed},
+		{"Missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``, ErrInvalidPatch},
+		{"Remove missing", `{}`, `[{"op":"remove","path":"/a"}]`, ``, ErrInvalidPatch},
+		{"Index out of bounds", `{"foo":[1]}`, `[{"op":"add","path":"/foo/2","value":3}]`, ``, ErrInvalidPatch},
+		{"Leading zero index", `{"foo":[1,2]}`, `[{"op":"remove","path":"/foo/01"}]`, ``, ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := DecodeJSONPatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("DecodeJSONPatch failed: %v", err)
+			}
+			doc := []byte(tt.doc)
+			got, err := p.Apply(doc)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if !sameJSON(t, got, tt.want) {
+				t.Fatalf("Expected %s, got %s", tt.want, got)
+			}
+			if !bytes.Equal(doc, []byte(tt.doc)) {
+				t.Fatalf("Apply modified its input")
+			}
+		})
+	}
+}
+
+func TestDecodeJSONPatch_Invalid(t *testing.T) {
+	patches := []string{
+		`{"op":"add","path":"/a","value":1}`,
+		`[{"path":"/a"}]`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"frobnicate","path":"/a"}]`,
+		`[{"op":"remove","path":"a"}]`,
+		`[{"op":"copy","path":"/a"}]`,
+		`[{"op":"move","from":"/a","path":"/a/b"}]`,
+	}
+
+	for _, p := range patches {
+		if _, err := DecodeJSONPatch([]byte(p)); !errors.Is(err, ErrInvalidPatch) {
+			t.Fatalf("DecodeJSONPatch(%s): expected ErrInvalidPatch, got %v", p, err)
+		}
+	}
+}
+
+func TestApply_KeepsIntegers(t *testing.T) {
+	p, err := Decode(MergePatchContentType, []byte(`{"name":"Tea"}`))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	got, err := p.Apply([]byte(`{"name":"Coffee","price":9007199254740993}`))
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	var v struct{ Price int64 }
+	if err := json.Unmarshal(got, &v); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if v.Price != 9007199254740993 {
+		t.Fatalf("Price lost precision: %d", v.Price)
+	}
+}
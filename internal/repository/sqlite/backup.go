@@ -0,0 +1,198 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrDatabaseInUse is returned by Restore while another connection has the
+// database open, such as a running server.
+var ErrDatabaseInUse = errors.New("database is in use")
+
+// Snapshot writes a consistent copy of the database to path while it keeps
+// serving traffic. VACUUM INTO reads inside a single read transaction, so
+// the copy sees every write committed before it started and none after,
+// and, being a reader in WAL mode, it blocks no one. The copy is written
+// next to path first and renamed into place, so path is either absent or
+// complete.
+func (db *DB) Snapshot(ctx context.Context, path string) error {
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if _, err := db.Reader.ExecContext(ctx, `VACUUM INTO ?`, tmp); err != nil {
+		return errors.Join(fmt.Errorf("snapshot: %w", err), removeIfExists(tmp))
+	}
+	if err := syncFile(tmp); err != nil {
+		return errors.Join(err, removeIfExists(tmp))
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Join(err, removeIfExists(tmp))
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// FilePath returns the file of a data source name such as
+// file:products.db?_busy_timeout=1000. In-memory databases have none.
+func FilePath(dsn string) (string, error) {
+	path, query, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if path == "" || path == ":memory:" || strings.Contains(query, "mode=memory") {
+		return "", fmt.Errorf("%s is not a database file", dsn)
+	}
+	return path, nil
+}
+
+// VerifyFile checks that the database file at path passes SQLite's
+// integrity check and holds the product schema. The file is opened read
+// only and left unchanged.
+func VerifyFile(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", "file:" + path + "?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint:all
+
+	rows, err := db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			rows.Close() //nolint:all
+			return err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s failed the integrity check: %s", path, strings.Join(problems, "; "))
+	}
+
+	var n int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'products'`).Scan(&n); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s has no products table", path)
+	}
+	return nil
+}
+
+// Restore replaces the database file at path with the backup, after
+// checking the backup with VerifyFile. It refuses with ErrDatabaseInUse
+// while any other connection has the database open, so the server has to
+// be stopped first. The replaced database is kept next to path, with a
+// .pre-restore suffix, and its name is returned; it is empty if there was
+// no database yet.
+func Restore(ctx context.Context, backup, path string) (string, error) {
+	if err := VerifyFile(ctx, backup); err != nil {
+		return "", err
+	}
+
+	// Copy first, so that a failure leaves the current database alone.
+	tmp := path + ".restore"
+	if err := copyFile(backup, tmp); err != nil {
+		return "", errors.Join(err, removeIfExists(tmp))
+	}
+
+	previous := ""
+	if _, err := os.Stat(path); err == nil {
+		if err := release(ctx, path); err != nil {
+			return "", errors.Join(err, removeIfExists(tmp))
+		}
+		previous = fmt.Sprintf("%s.pre-restore-%s", path, time.Now().UTC().Format("20060102T150405Z"))
+		if err := os.Rename(path, previous); err != nil {
+			return "", errors.Join(err, removeIfExists(tmp))
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", errors.Join(err, removeIfExists(tmp))
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return previous, err
+	}
+	return previous, syncDir(filepath.Dir(path))
+}
+
+// release makes sure nobody else has the database at path open and folds
+// its write-ahead log into the file, so that the file can be moved away
+// without leaving -wal and -shm files behind for the restored database to
+// pick up. Switching to rollback journaling needs exclusive access and
+// fails at once if another connection holds the database.
+func release(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite3", "file:" + path + "?_busy_timeout=0&_locking_mode=EXCLUSIVE")
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint:all
+
+	var mode string
+	if err := db.QueryRowContext(ctx, `PRAGMA journal_mode = DELETE`).Scan(&mode); err != nil {
+		if strings.Contains(err.Error(), "locked") || strings.Contains(err.Error(), "busy") {
+			return fmt.Errorf("%w: stop the server before restoring %s", ErrDatabaseInUse, path)
+		}
+		return err
+	}
+	if mode != "delete" {
+		return fmt.Errorf("%w: %s stayed in %s journal mode", ErrDatabaseInUse, path, mode)
+	}
+	return db.Close()
+}
+
+// copyFile copies src to dst and flushes dst to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:all
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return errors.Join(err, out.Close())
+	}
+	return errors.Join(out.Sync(), out.Close())
+}
+
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	return errors.Join(f.Sync(), f.Close())
+}
+
+// syncDir makes renames in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return errors.Join(d.Sync(), d.Close())
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
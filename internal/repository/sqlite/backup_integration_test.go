@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+func newBackupTestDB(t *testing.T, path string) (*DB, *ProductRepository) {
+	t.Helper()
+
+	cfg := config.Default()
+	db, err := OpenDB("file:" + path, cfg)
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	if err := Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Failed to migrate db: %v", err)
+	}
+	return db, NewProductRepository(db, cfg)
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "products.db")
+	db, repo := newBackupTestDB(t, path)
+
+	if err := repo.Create(ctx, model.Product{ID: "p1", Name: "Coffee", Price: 499}); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	backup := filepath.Join(dir, "backup.db")
+	if err := db.Snapshot(ctx, backup); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if err := VerifyFile(ctx, backup); err != nil {
+		t.Fatalf("Expected a valid snapshot, got %v", err)
+	}
+	if err := repo.Create(ctx, model.Product{ID: "p2", Name: "Tea", Price: 299}); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	if _, err := Restore(ctx, backup, path); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("Expected restoring an open database to fail, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close db: %v", err)
+	}
+
+	previous, err := Restore(ctx, backup, path)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if !strings.HasPrefix(previous, path + ".pre-restore-") {
+		t.Fatalf("Expected the replaced database to be kept, got %q", previous)
+	}
+	for _, suffix := range []string{"-wal", "-shm", ".restore"} {
+		if _, err := os.Stat(path + suffix); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected no %s file after the restore, got %v", suffix, err)
+		}
+	}
+
+	db, repo = newBackupTestDB(t, path)
+	defer db.Close() //nolint:all
+	products, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list products: %v", err)
+	}
+	if len(products) != 1 || products[0].ID != "p1" {
+		t.Fatalf("Expected only the product from before the snapshot, got %+v", products)
+	}
+	if err := VerifyFile(ctx, previous); err != nil {
+		t.Fatalf("Expected the replaced database to stay intact, got %v", err)
+	}
+}
+
+func TestVerifyFile_Invalid(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte(strings.Repeat("not a database ", 512)), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	empty := filepath.Join(dir, "empty.db")
+	db, err := OpenDB("file:" + empty, config.Default())
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close db: %v", err)
+	}
+
+	for _, path := range []string{garbage, empty, filepath.Join(dir, "missing.db")} {
+		if err := VerifyFile(ctx, path); err == nil {
+			t.Errorf("Expected %s to fail verification", filepath.Base(path))
+		}
+	}
+	if _, err := Restore(ctx, garbage, filepath.Join(dir, "products.db")); err == nil {
+		t.Fatalf("Expected restoring an invalid backup to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "products.db")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected a failed restore to leave no database, got %v", err)
+	}
+}
+
+func TestFilePath(t *testing.T) {
+	tests := map[string]string{
+		"file:products.db": "products.db",
+		"file:/var/lib/market/products.db?_busy_timeout=10": "/var/lib/market/products.db",
+		"products.db": "products.db",
+		":memory:": "",
+		"file:test.db?mode=memory&cache=shared": "",
+	}
+	for dsn, want := range tests {
+		got, err := FilePath(dsn)
+		if got != want || (err != nil) != (want == "") {
+			t.Errorf("FilePath(%q) = %q, %v; want %q", dsn, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// errBatchFailed rolls back an atomic batch after one of its operations
+// failed.
+var errBatchFailed = errors.New("batch operation failed")
+
+// Batch runs ops in one transaction while holding the writer slot once for
+// the whole batch. Each operation runs in its own savepoint, so a failed
+// operation leaves no partial changes behind. Errors that concern a single
+// product are reported in its result; any other error rolls everything
+// back and is returned.
+func (r *ProductRepository) Batch(ctx context.Context, ops []service.BatchOp, atomic bool) ([]service.BatchResult, error) {
+	results := make([]service.BatchResult, len(ops))
+
+	err := r.write(ctx, opBatch, func(tx *sql.Tx) error {
+		for i, op := range ops {
+			var stored *model.Product
+			err := savepoint(ctx, tx, func() error {
+				var err error
+				stored, err = batchOp(ctx, tx, op)
+				return err
+			})
+			if err != nil && !isProductError(err) {
+				return err
+			}
+			results[i] = service.BatchResult{Product: stored, Err: err}
+			if err != nil && atomic {
+				return errBatchFailed
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errBatchFailed) {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i] = service.BatchResult{Err: service.ErrBatchAborted}
+			}
+		}
+		return results, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func batchOp(ctx context.Context, tx *sql.Tx, op service.BatchOp) (*model.Product, error) {
+	switch op.Action {
+		case service.BatchCreate:
+			if err := insertProduct(ctx, tx, op.Product); err != nil {
+				return nil, err
+			}
+			return &op.Product, nil
+		case service.BatchUpdate:
+			return updateProduct(ctx, tx, op.Product)
+		case service.BatchDelete:
+			return nil, deleteProduct(ctx, tx, op.Product.ID)
+		default:
+			return nil, fmt.Errorf("%w: unknown batch action %q", service.ErrInvalidProduct, op.Action)
+	}
+}
+
+// savepoint runs fn inside a savepoint and undoes its changes if it fails,
+// leaving the rest of the transaction intact.
+func savepoint(ctx context.Context, tx *sql.Tx, fn func() error) error {
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT batch_op`); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, `ROLLBACK TO batch_op`); rbErr != nil {
+			return rbErr
+		}
+		if _, relErr := tx.ExecContext(ctx, `RELEASE batch_op`); relErr != nil {
+			return relErr
+		}
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `RELEASE batch_op`)
+	return err
+}
+
+// isProductError reports whether err concerns a single product rather than
+// the database.
+func isProductError(err error) bool {
+	return errors.Is(err, service.ErrProductNotFound) ||
+		errors.Is(err, service.ErrProductAlreadyExists) ||
+		errors.Is(err, service.ErrInvalidProduct)
+}
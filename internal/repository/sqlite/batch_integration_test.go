@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func TestProductRepository_Batch(t *testing.T) {
+	ops := []service.BatchOp{
+		{Action: service.BatchCreate, Product: model.Product{ID: "3", Name: "Cake", Price: 399}},
+		{Action: service.BatchUpdate, Product: model.Product{ID: "1", Name: "Espresso", Price: 299}},
+		{Action: service.BatchUpdate, Product: model.Product{ID: "2", Name: "Cake", Price: 199}},
+		{Action: service.BatchDelete, Product: model.Product{ID: "4"}},
+	}
+
+	tests := []struct {
+		name string
+		atomic bool
+		wantErrs []error
+		wantStored []model.Product
+	}{
+		{
+			name: "Atomic",
+			atomic: true,
+			wantErrs: []error{service.ErrBatchAborted, service.ErrBatchAborted, service.ErrProductAlreadyExists, service.ErrBatchAborted},
+			wantStored: []model.Product{
+				{ID: "1", Name: "Coffee", Price: 499},
+				{ID: "2", Name: "Tea", Price: 299},
+			},
+		},
+		{
+			name: "Best effort",
+			wantErrs: []error{nil, nil, service.ErrProductAlreadyExists, service.ErrProductNotFound},
+			wantStored: []model.Product{
+				{ID: "1", Name: "Espresso", Price: 299},
+				{ID: "2", Name: "Tea", Price: 299},
+				{ID: "3", Name: "Cake", Price: 399},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			defer func () {
+				if err := db.Close(); err != nil {
+					t.Fatalf("Failed to close db: %v", err)
+				}
+			}()
+			db.SetMaxOpenConns(1)
+
+			cfg := config.Default()
+			repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
+
+			ctx := context.Background()
+
+			_, err := db.Exec(`
+				CREATE UNIQUE INDEX products_name ON products (name);
+				INSERT INTO products (id, name, price) VALUES ('1', 'Coffee', 499), ('2', 'Tea', 299);
+			`)
+			if err != nil {
+				t.Fatalf("Failed to insert products: %v", err)
+			}
+
+			results, err := repo.Batch(ctx, ops, tt.atomic)
+			if err != nil {
+				t.Fatalf("Batch failed: %v", err)
+			}
+			for i, want := range tt.wantErrs {
+				if got := results[i].Err; !errors.Is(got, want) || (want == nil && got != nil) {
+					t.Fatalf("Expected operation %d to fail with %v, got %v", i, want, got)
+				}
+			}
+			if !tt.atomic && *results[1].Product != (model.Product{ID: "1", Name: "Espresso", Price: 299}) {
+				t.Fatalf("Expected the stored product, got %+v", results[1].Product)
+			}
+
+			stored, err := repo.ListPage(ctx, "", 10)
+			if err != nil {
+				t.Fatalf("ListPage failed: %v", err)
+			}
+			if len(stored) != len(tt.wantStored) {
+				t.Fatalf("Expected %+v, got %+v", tt.wantStored, stored)
+			}
+			for i := range stored {
+				if stored[i] != tt.wantStored[i] {
+					t.Fatalf("Expected %+v, got %+v", tt.wantStored, stored)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+)
+
+// DB holds the connection pools for one SQLite database. Readers share a
+// regular pool, while all writes go through a dedicated single-connection
+// pool so they queue in Go instead of fighting over SQLite's write lock.
+type DB struct {
+	Reader *sql.DB
+	Writer *sql.DB
+}
+
+// OpenDB opens the reader and writer pools for dataSourceName with WAL
+// journaling, a busy timeout and the configured synchronous level. Settings
+// already present in dataSourceName take precedence.
+func OpenDB(dataSourceName string, cfg *config.Config) (*DB, error) {
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", fmt.Sprint(cfg.DB_BUSY_TIMEOUT_MS))
+	params.Set("_synchronous", cfg.DB_SYNCHRONOUS)
+	params.Set("_foreign_keys", "on")
+
+	reader, err := open(withParams(dataSourceName, params))
+	if err != nil {
+		return nil, err
+	}
+	reader.SetMaxOpenConns(int(cfg.DB_MAX_OPEN_CONNS))
+	reader.SetMaxIdleConns(int(cfg.DB_MAX_IDLE_CONNS))
+	reader.SetConnMaxLifetime(time.Duration(cfg.DB_CONN_MAX_LIFETIME) * time.Second)
+
+	// BEGIN IMMEDIATE takes the write lock up front, so a transaction that
+	// reads before writing cannot fail halfway through with SQLITE_BUSY.
+	params.Set("_txlock", "immediate")
+	writer, err := open(withParams(dataSourceName, params))
+	if err != nil {
+		return nil, errors.Join(err, reader.Close())
+	}
+	writer.SetMaxOpenConns(1)
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxLifetime(0)
+
+	return &DB{Reader: reader, Writer: writer}, nil
+}
+
+func (db *DB) Close() error {
+	return errors.Join(db.Reader.Close(), db.Writer.Close())
+}
+
+func open(dataSourceName string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+
+	return db, nil
+}
+
+// withParams appends params to the DSN. go-sqlite3 uses the first value of
+// a repeated parameter, so anything set explicitly in dsn wins.
+func withParams(dsn string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + params.Encode()
+}
@@ -0,0 +1,47 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+)
+
+func TestOpenDB(t *testing.T) {
+	cfg := config.Default()
+	cfg.DB_MAX_OPEN_CONNS = 4
+	cfg.DB_BUSY_TIMEOUT_MS = 1234
+
+	db, err := OpenDB("file:"+filepath.Join(t.TempDir(), "test.db"), cfg)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer func () {
+		if err := db.Close(); err != nil {
+			t.Fatalf("Failed to close db: %v", err)
+		}
+	}()
+
+	var mode string
+	if err := db.Reader.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatalf("Failed to read journal mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Fatalf("Expected wal journal mode, got %s", mode)
+	}
+
+	var timeout int
+	if err := db.Writer.QueryRow(`PRAGMA busy_timeout`).Scan(&timeout); err != nil {
+		t.Fatalf("Failed to read busy timeout: %v", err)
+	}
+	if timeout != 1234 {
+		t.Fatalf("Expected busy timeout 1234, got %d", timeout)
+	}
+
+	if got := db.Reader.Stats().MaxOpenConnections; got != 4 {
+		t.Fatalf("Expected 4 reader connections, got %d", got)
+	}
+	if got := db.Writer.Stats().MaxOpenConnections; got != 1 {
+		t.Fatalf("Expected a single writer connection, got %d", got)
+	}
+}
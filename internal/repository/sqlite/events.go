@@ -0,0 +1,96 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func (r *ProductRepository) Changes(ctx context.Context, after int64, limit int) ([]service.ProductEvent, error) {
+	events := make([]service.ProductEvent, 0, limit)
+
+	err := r.read(ctx, opChanges, func() error {
+		rows, err := r.db.Reader.QueryContext(
+			ctx,
+			`SELECT seq, type, product_id, name, price FROM product_changes WHERE seq > ? ORDER BY seq LIMIT ?`,
+			after, limit,
+		)
+		if err != nil {
+			return err
+		}
+		defer func () {
+			if err := rows.Close(); err != nil {
+				slog.Error("Failed to close rows", "err", err)
+			}
+		}()
+
+		for rows.Next() {
+			var e service.ProductEvent
+			if err := rows.Scan(&e.ID, &e.Type, &e.Product.ID, &e.Product.Name, &e.Product.Price); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// ChangeBounds reads the latest change ID from sqlite_sequence rather than
+// the log itself, so it is known even when every entry has been pruned.
+func (r *ProductRepository) ChangeBounds(ctx context.Context) (int64, int64, error) {
+	var oldest sql.NullInt64
+	var latest int64
+
+	err := r.read(ctx, opChanges, func() error {
+		return r.db.Reader.QueryRowContext(
+			ctx,
+			`SELECT
+				(SELECT MIN(seq) FROM product_changes),
+				COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'product_changes'), 0)`,
+		).Scan(&oldest, &latest)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if !oldest.Valid {
+		return latest + 1, latest, nil
+	}
+	return oldest.Int64, latest, nil
+}
+
+// PruneChanges keeps changes that have not been fanned out to webhooks yet,
+// even beyond keep.
+func (r *ProductRepository) PruneChanges(ctx context.Context, keep int64) (int64, error) {
+	var pruned int64
+
+	err := r.write(ctx, opPrune, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM product_changes WHERE seq <= MIN(
+				(SELECT MAX(seq) FROM product_changes) - ?,
+				CASE WHEN EXISTS (SELECT 1 FROM webhooks)
+					THEN (SELECT seq FROM webhook_cursor)
+					ELSE (SELECT MAX(seq) FROM product_changes)
+				END
+			)`,
+			keep,
+		)
+		if err != nil {
+			return err
+		}
+		pruned, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pruned, nil
+}
@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func TestProductRepository_Changes(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	defer func () {
+		if err := db.Close(); err != nil {
+			t.Fatalf("Failed to close db: %v", err)
+		}
+	}()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	store := &DB{Reader: db, Writer: db}
+	if err := Migrate(ctx, store); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	repo := NewProductRepository(store, config.Default())
+
+	if oldest, latest, err := repo.ChangeBounds(ctx); err != nil || oldest != 1 || latest != 0 {
+		t.Fatalf("Expected empty bounds (1, 0), got (%d, %d, %v)", oldest, latest, err)
+	}
+
+	if err := repo.Create(ctx, model.Product{ID: "1", Name: "Coffee", Price: 499}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	// An update that changes nothing is not logged.
+	if _, err := repo.Update(ctx, model.Product{ID: "1", Name: "Coffee", Price: 499}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := repo.Update(ctx, model.Product{ID: "1", Name: "Coffee", Price: 399}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	// A rolled back batch leaves no trace.
+	ops := []service.BatchOp{
+		{Action: service.BatchCreate, Product: model.Product{ID: "2", Name: "Tea", Price: 299}},
+		{Action: service.BatchDelete, Product: model.Product{ID: "3"}},
+	}
+	if _, err := repo.Batch(ctx, ops, true); err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	if err := repo.Delete(ctx, "1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	want := []service.ProductEvent{
+		{ID: 1, Type: service.EventCreated, Product: model.Product{ID: "1", Name: "Coffee", Price: 499}},
+		{ID: 2, Type: service.EventUpdated, Product: model.Product{ID: "1", Name: "Coffee", Price: 399}},
+		{ID: 3, Type: service.EventDeleted, Product: model.Product{ID: "1", Name: "Coffee", Price: 399}},
+	}
+	events, err := repo.Changes(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("Changes failed: %v", err)
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Expected events %+v, got %+v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("Expected events %+v, got %+v", want, events)
+		}
+	}
+	if events, err := repo.Changes(ctx, 1, 1); err != nil || len(events) != 1 || events[0].ID != 2 {
+		t.Fatalf("Expected event 2 only, got %+v (%v)", events, err)
+	}
+
+	pruned, err := repo.PruneChanges(ctx, 1)
+	if err != nil || pruned != 2 {
+		t.Fatalf("Expected 2 events pruned, got %d (%v)", pruned, err)
+	}
+	if oldest, latest, err := repo.ChangeBounds(ctx); err != nil || oldest != 3 || latest != 3 {
+		t.Fatalf("Expected bounds (3, 3), got (%d, %d, %v)", oldest, latest, err)
+	}
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// errDryRun rolls back the transaction of a dry-run import.
+var errDryRun = errors.New("dry run")
+
+// Import writes rows in one transaction. A row that violates a constraint
+// fails on its own and the others are still written; any other error rolls
+// the whole chunk back. In dry-run mode the transaction is always rolled
+// back, so the results show what would have happened.
+func (r *ProductRepository) Import(ctx context.Context, rows []service.ImportRow, opts service.ImportOptions) ([]service.ImportResult, error) {
+	results := make([]service.ImportResult, len(rows))
+
+	err := r.write(ctx, opImport, func(tx *sql.Tx) error {
+		for i, row := range rows {
+			res, err := importRow(ctx, tx, row, opts.Upsert)
+			if err != nil {
+				return err
+			}
+			results[i] = res
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return results, nil
+}
+
+func importRow(ctx context.Context, tx *sql.Tx, row service.ImportRow, upsert bool) (service.ImportResult, error) {
+	p := row.Product
+	if upsert {
+		var stored model.Product
+		var err error
+		if p.ID != "" {
+			err = tx.QueryRowContext(
+				ctx,
+				`UPDATE products SET name = ?, price = ? WHERE id = ? RETURNING id, name, price`,
+				p.Name, p.Price, p.ID,
+			).Scan(&stored.ID, &stored.Name, &stored.Price)
+		} else {
+			err = tx.QueryRowContext(
+				ctx,
+				`UPDATE products SET price = ?
+				WHERE id = (SELECT id FROM products WHERE name = ? ORDER BY id LIMIT 1)
+				RETURNING id, name, price`,
+				p.Price, p.Name,
+			).Scan(&stored.ID, &stored.Name, &stored.Price)
+		}
+		if err == nil {
+			if err := addOutboxEvent(ctx, tx, service.EventUpdated, stored); err != nil {
+				return service.ImportResult{}, err
+			}
+			return service.ImportResult{Outcome: service.ImportUpdated, ID: stored.ID}, nil
+		} else if rowErr := constraintError(err); rowErr != nil {
+			return service.ImportResult{Outcome: service.ImportFailed, Err: rowErr}, nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return service.ImportResult{}, err
+		}
+	}
+
+	id := p.ID
+	if id == "" {
+		// Without an ID the name identifies the product, so importing the
+		// same file twice does not create duplicates.
+		var exists bool
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT EXISTS (SELECT 1 FROM products WHERE name = ?)`,
+			p.Name,
+		).Scan(&exists)
+		if err != nil {
+			return service.ImportResult{}, err
+		}
+		if exists {
+			return service.ImportResult{Outcome: service.ImportFailed, Err: service.ErrProductAlreadyExists}, nil
+		}
+		id = row.NewID
+	}
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO products (id, name, price) VALUES (?, ?, ?)`,
+		id, p.Name, p.Price,
+	)
+	if rowErr := constraintError(err); rowErr != nil {
+		return service.ImportResult{Outcome: service.ImportFailed, Err: rowErr}, nil
+	} else if err != nil {
+		return service.ImportResult{}, err
+	}
+	p.ID = id
+	if err := addOutboxEvent(ctx, tx, service.EventCreated, p); err != nil {
+		return service.ImportResult{}, err
+	}
+	return service.ImportResult{Outcome: service.ImportCreated, ID: id}, nil
+}
+
+// constraintError maps constraint violations to service errors and returns
+// nil for anything else.
+func constraintError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		return nil
+	}
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return service.ErrProductAlreadyExists
+	default:
+		return service.ErrInvalidProduct
+	}
+}
+
+func (r *ProductRepository) ListPage(ctx context.Context, after string, limit int) ([]model.Product, error) {
+	products := make([]model.Product, 0, limit)
+
+	err := r.read(ctx, opExport, func() error {
+		rows, err := r.db.Reader.QueryContext(
+			ctx,
+			`SELECT id, name, price FROM products WHERE id > ? ORDER BY id LIMIT ?`,
+			after, limit,
+		)
+		if err != nil {
+			return err
+		}
+		defer func () {
+			if err := rows.Close(); err != nil {
+				slog.Error("Failed to close rows", "err", err)
+			}
+		}()
+
+		for rows.Next() {
+			var p model.Product
+			if err := rows.Scan(&p.ID, &p.Name, &p.Price); err != nil {
+				return err
+			}
+			products = append(products, p)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
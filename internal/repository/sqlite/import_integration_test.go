@@ -0,0 +1,134 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func TestProductRepository_Import(t *testing.T) {
+	db := setupTestDB(t)
+	defer func () {
+		if err := db.Close(); err != nil {
+			t.Fatalf("Failed to close db: %v", err)
+		}
+	}()
+	db.SetMaxOpenConns(1)
+
+	cfg := config.Default()
+	repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
+
+	ctx := context.Background()
+
+	_, err := db.Exec(`INSERT INTO products (id, name, price) VALUES ('1', 'Coffee', 499)`)
+	if err != nil {
+		t.Fatalf("Failed to insert product: %v", err)
+	}
+
+	rows := []service.ImportRow{
+		{Product: model.Product{Name: "Coffee", Price: 599}, NewID: "2"},
+		{Product: model.Product{ID: "1", Name: "Espresso", Price: 299}},
+		{Product: model.Product{Name: "Tea", Price: 199}, NewID: "3"},
+		{Product: model.Product{ID: "4", Name: "Cake", Price: 399}},
+	}
+
+	tests := []struct {
+		name string
+		opts service.ImportOptions
+		want []service.ImportOutcome
+		wantStored []model.Product
+	}{
+		{
+			name: "Dry run",
+			opts: service.ImportOptions{DryRun: true, Upsert: true},
+			want: []service.ImportOutcome{service.ImportUpdated, service.ImportUpdated, service.ImportCreated, service.ImportCreated},
+			wantStored: []model.Product{{ID: "1", Name: "Coffee", Price: 499}},
+		},
+		{
+			name: "Fail on conflict",
+			want: []service.ImportOutcome{service.ImportFailed, service.ImportFailed, service.ImportCreated, service.ImportCreated},
+			wantStored: []model.Product{
+				{ID: "1", Name: "Coffee", Price: 499},
+				{ID: "3", Name: "Tea", Price: 199},
+				{ID: "4", Name: "Cake", Price: 399},
+			},
+		},
+		{
+			name: "Upsert",
+			opts: service.ImportOptions{Upsert: true},
+			want: []service.ImportOutcome{service.ImportUpdated, service.ImportUpdated, service.ImportUpdated, service.ImportUpdated},
+			wantStored: []model.Product{
+				{ID: "1", Name: "Espresso", Price: 299},
+				{ID: "3", Name: "Tea", Price: 199},
+				{ID: "4", Name: "Cake", Price: 399},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		results, err := repo.Import(ctx, rows, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: Import failed: %v", tt.name, err)
+		}
+		for i, res := range results {
+			if res.Outcome != tt.want[i] {
+				t.Fatalf("%s: expected row %d outcome %d, got %+v", tt.name, i, tt.want[i], res)
+			}
+			if res.Outcome == service.ImportFailed && !errors.Is(res.Err, service.ErrProductAlreadyExists) {
+				t.Fatalf("%s: expected ErrProductAlreadyExists, got %v", tt.name, res.Err)
+			}
+		}
+
+		stored, err := repo.ListPage(ctx, "", 10)
+		if err != nil {
+			t.Fatalf("%s: ListPage failed: %v", tt.name, err)
+		}
+		if len(stored) != len(tt.wantStored) {
+			t.Fatalf("%s: expected %+v, got %+v", tt.name, tt.wantStored, stored)
+		}
+		for i := range stored {
+			if stored[i] != tt.wantStored[i] {
+				t.Fatalf("%s: expected %+v, got %+v", tt.name, tt.wantStored, stored)
+			}
+		}
+	}
+}
+
+func TestProductRepository_ListPage(t *testing.T) {
+	db := setupTestDB(t)
+	defer func () {
+		if err := db.Close(); err != nil {
+			t.Fatalf("Failed to close db: %v", err)
+		}
+	}()
+
+	cfg := config.Default()
+	repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
+
+	ctx := context.Background()
+
+	_, err := db.Exec(`INSERT INTO products (id, name, price) VALUES ('c', 'Cake', 399), ('a', 'Coffee', 499), ('b', 'Tea', 299)`)
+	if err != nil {
+		t.Fatalf("Failed to insert products: %v", err)
+	}
+
+	page, err := repo.ListPage(ctx, "", 2)
+	if err != nil {
+		t.Fatalf("ListPage failed: %v", err)
+	}
+	if len(page) != 2 || page[0].ID != "a" || page[1].ID != "b" {
+		t.Fatalf("Expected products a and b, got %+v", page)
+	}
+
+	page, err = repo.ListPage(ctx, "b", 2)
+	if err != nil {
+		t.Fatalf("ListPage failed: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != "c" {
+		t.Fatalf("Expected product c, got %+v", page)
+	}
+}
@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/limiter"
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// operation describes how expensive a repository call is for the limiter.
+// Costs are in units of a single primary key lookup.
+type operation struct {
+	name string
+	cost int64
+	priority limiter.Priority
+}
+
+var (
+	opList = operation{name: "list", cost: 5, priority: limiter.PriorityLow}
+	opGet = operation{name: "get", cost: 1, priority: limiter.PriorityHigh}
+	// GraphQL lookups are batched, so one call stands for many single gets.
+	opGetMany = operation{name: "get_many", cost: 2, priority: limiter.PriorityHigh}
+	opFind = operation{name: "find", cost: 2, priority: limiter.PriorityLow}
+	opHistory = operation{name: "history", cost: 2, priority: limiter.PriorityHigh}
+	opCreate = operation{name: "create", cost: 1, priority: limiter.PriorityHigh}
+	opUpdate = operation{name: "update", cost: 1, priority: limiter.PriorityHigh}
+	opModify = operation{name: "modify", cost: 1, priority: limiter.PriorityHigh}
+	opImport = operation{name: "import", cost: 1, priority: limiter.PriorityHigh}
+	opBatch = operation{name: "batch", cost: 1, priority: limiter.PriorityHigh}
+	// Export pages are bounded, and shedding one would cut off a download
+	// that is already under way.
+	opExport = operation{name: "export", cost: 2, priority: limiter.PriorityHigh}
+	opDelete = operation{name: "delete", cost: 1, priority: limiter.PriorityHigh}
+	opChanges = operation{name: "changes", cost: 1, priority: limiter.PriorityHigh}
+	// Pruning runs in the background and simply tries again later.
+	opPrune = operation{name: "prune", cost: 1, priority: limiter.PriorityLow}
+	opWebhooks = operation{name: "webhooks", cost: 1, priority: limiter.PriorityHigh}
+	opWebhookWrite = operation{name: "webhook_write", cost: 1, priority: limiter.PriorityHigh}
+	opDeliveries = operation{name: "deliveries", cost: 1, priority: limiter.PriorityHigh}
+	// The delivery worker retries on its next poll if it is shed, but an
+	// attempt that was made is always recorded.
+	opEnqueue = operation{name: "enqueue", cost: 1, priority: limiter.PriorityLow}
+	opDeliver = operation{name: "deliver", cost: 1, priority: limiter.PriorityHigh}
+	// The outbox relay polls again if it is shed. Deleting published events
+	// is not shed, since every skipped delete is published twice.
+	opOutbox = operation{name: "outbox", cost: 1, priority: limiter.PriorityLow}
+	opOutboxDelete = operation{name: "outbox_delete", cost: 1, priority: limiter.PriorityHigh}
+)
+
+// pool is a named limiter. SQLite allows many concurrent readers but only a
+// single writer, so the repository keeps an adaptive reader pool and a
+// writer pool with room for exactly one transaction.
+type pool struct {
+	name string
+	limiter *limiter.Limiter
+}
+
+func newReaderPool(cfg *config.Config) *pool {
+	return &pool{
+		name: "reader",
+		limiter: limiter.New(readerOptions(cfg)),
+	}
+}
+
+func readerOptions(cfg *config.Config) limiter.Options {
+	return limiter.Options{
+		Name: "reader",
+		Min: cfg.SEM_MIN,
+		Max: cfg.SEM_MAX,
+		TargetWait: time.Duration(cfg.SEM_TARGET_WAIT_MS) * time.Millisecond,
+	}
+}
+
+func newWriterPool() *pool {
+	return &pool{
+		name: "writer",
+		limiter: limiter.New(limiter.Options{Name: "writer", Min: 1, Max: 1}),
+	}
+}
+
+func (p *pool) acquire(ctx context.Context, op operation) (func(), error) {
+	start := time.Now()
+
+	release, err := p.limiter.Acquire(ctx, op.priority, op.cost)
+	if errors.Is(err, limiter.ErrOverloaded) {
+		metrics.DbRequestsShed.WithLabelValues(p.name, op.name).Inc()
+		return nil, service.ErrOverloaded
+	} else if err != nil {
+		return nil, err
+	}
+
+	metrics.DbSemaphoreWaitDuration.WithLabelValues(p.name, op.name).Observe(time.Since(start).Seconds())
+	inUse := metrics.DbSemaphoreInUse.WithLabelValues(p.name, op.name)
+	inUse.Add(float64(op.cost))
+
+	return func() {
+		inUse.Sub(float64(op.cost))
+		release()
+	}, nil
+}
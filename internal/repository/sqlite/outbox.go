@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// addOutboxEvent records the domain event of a product write in the
+// transaction of the write.
+func addOutboxEvent(ctx context.Context, tx *sql.Tx, t service.EventType, p model.Product) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO outbox (type, aggregate_id, data, occurred_at) VALUES (?, ?, ?, ?)`,
+		"product."+string(t), p.ID, data, time.Now().UnixMilli(),
+	)
+	return err
+}
+
+// PendingEvents returns up to limit unpublished outbox events, oldest
+// first.
+func (r *ProductRepository) PendingEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+
+	err := r.read(ctx, opOutbox, func() error {
+		rows, err := r.db.Reader.QueryContext(
+			ctx,
+			`SELECT id, type, aggregate_id, data, occurred_at FROM outbox ORDER BY id LIMIT ?`,
+			limit,
+		)
+		if err != nil {
+			return err
+		}
+		defer func () {
+			if err := rows.Close(); err != nil {
+				slog.Error("Failed to close rows", "err", err)
+			}
+		}()
+
+		for rows.Next() {
+			var e model.OutboxEvent
+			var data string
+			var occurredAt int64
+			if err := rows.Scan(&e.ID, &e.Type, &e.AggregateID, &data, &occurredAt); err != nil {
+				return err
+			}
+			e.Data = json.RawMessage(data)
+			e.OccurredAt = fromMilli(occurredAt)
+			events = append(events, e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// DeletePublished removes the outbox events up to and including the event
+// with ID through.
+func (r *ProductRepository) DeletePublished(ctx context.Context, through int64) error {
+	return r.write(ctx, opOutboxDelete, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE id <= ?`, through)
+		return err
+	})
+}
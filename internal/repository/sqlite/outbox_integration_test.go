@@ -0,0 +1,93 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func TestProductRepository_Outbox(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	defer func () {
+		if err := db.Close(); err != nil {
+			t.Fatalf("Failed to close db: %v", err)
+		}
+	}()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	store := &DB{Reader: db, Writer: db}
+	if err := Migrate(ctx, store); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	repo := NewProductRepository(store, config.Default())
+
+	if err := repo.Create(ctx, model.Product{ID: "1", Name: "Coffee", Price: 499}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	// A failed write records no event.
+	if err := repo.Create(ctx, model.Product{ID: "2", Name: "Coffee", Price: 299}); err == nil {
+		t.Fatal("Expected a duplicate name to fail")
+	}
+	if _, err := repo.Update(ctx, model.Product{ID: "1", Price: 549}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := repo.Modify(ctx, "1", func(p model.Product) (model.Product, error) {
+		p.Name = "Espresso"
+		return p, nil
+	}); err != nil {
+		t.Fatalf("Modify failed: %v", err)
+	}
+	// A rolled back batch records no events either.
+	ops := []service.BatchOp{
+		{Action: service.BatchCreate, Product: model.Product{ID: "3", Name: "Tea", Price: 299}},
+		{Action: service.BatchDelete, Product: model.Product{ID: "4"}},
+	}
+	if _, err := repo.Batch(ctx, ops, true); err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	if err := repo.Delete(ctx, "1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	events, err := repo.PendingEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("PendingEvents failed: %v", err)
+	}
+	want := []struct {
+		typ string
+		product model.Product
+	}{
+		{"product.created", model.Product{ID: "1", Name: "Coffee", Price: 499}},
+		{"product.updated", model.Product{ID: "1", Name: "Coffee", Price: 549}},
+		{"product.updated", model.Product{ID: "1", Name: "Espresso", Price: 549}},
+		{"product.deleted", model.Product{ID: "1", Name: "Espresso", Price: 549}},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %+v", len(want), events)
+	}
+	for i, e := range events {
+		var p model.Product
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			t.Fatalf("Failed to decode event data: %v", err)
+		}
+		if e.Type != want[i].typ || e.AggregateID != "1" || p != want[i].product || e.OccurredAt.IsZero() {
+			t.Errorf("Expected event %d to be %s of %+v, got %+v", i, want[i].typ, want[i].product, e)
+		}
+	}
+
+	if err := repo.DeletePublished(ctx, events[1].ID); err != nil {
+		t.Fatalf("DeletePublished failed: %v", err)
+	}
+	if left, err := repo.PendingEvents(ctx, 10); err != nil || len(left) != 2 || left[0].ID != events[2].ID {
+		t.Fatalf("Expected the last 2 events left, got %+v, %v", left, err)
+	}
+}
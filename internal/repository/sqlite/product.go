@@ -4,70 +4,63 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"time"
-	"log"
+	"log/slog"
 
 	"github.com/mattn/go-sqlite3"
-	"golang.org/x/sync/semaphore"
 
 	"github.com/v-kuu/mini-marketplace/internal/model"
 	"github.com/v-kuu/mini-marketplace/internal/service"
-	"github.com/v-kuu/mini-marketplace/internal/metrics"
 	"github.com/v-kuu/mini-marketplace/internal/config"
 )
 
 type ProductRepository struct {
-	db *sql.DB
-	sem *semaphore.Weighted
+	db *DB
+	readers *pool
+	writer *pool
 }
 
-func OpenDB(dataSourceName string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dataSourceName)
-	if err != nil {
-		return nil, err
-	}
-	if err := db.Ping(); err != nil {
-		return nil, err
-	}
-
-	return db, nil
-}
-
-func NewProductRepository(db *sql.DB, cfg *config.Config) *ProductRepository {
+func NewProductRepository(db *DB, cfg *config.Config) *ProductRepository {
 	return &ProductRepository{
 		db: db,
-		sem: semaphore.NewWeighted(cfg.SEM_MAX),
+		readers: newReaderPool(cfg),
+		writer: newWriterPool(),
 	}
 }
 
-func (r *ProductRepository) List(ctx context.Context) ([]model.Product, error) {
-	rows, err := r.query(
-		ctx,
-		`SELECT id, name, price FROM products`,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer func () {
-		if err := rows.Close(); err != nil {
-			log.Printf("Failed to close rows: %v", err)
-		}
-	}()
+// Reconfigure applies reloadable limiter settings to the reader pool. The
+// writer pool always has a single slot.
+func (r *ProductRepository) Reconfigure(cfg *config.Config) {
+	r.readers.limiter.SetBounds(readerOptions(cfg))
+}
 
+func (r *ProductRepository) List(ctx context.Context) ([]model.Product, error) {
 	var products []model.Product
 
-	for rows.Next() {
-		var p model.Product
-		if err := rows.Scan(&p.ID, &p.Name, &p.Price); err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return nil, nil
+	err := r.read(ctx, opList, func() error {
+		rows, err := r.db.Reader.QueryContext(
+			ctx,
+			`SELECT id, name, price FROM products`,
+		)
+		if err != nil {
+			return err
+		}
+		defer func () {
+			if err := rows.Close(); err != nil {
+				slog.Error("Failed to close rows", "err", err)
+			}
+		}()
+
+		for rows.Next() {
+			var p model.Product
+			if err := rows.Scan(&p.ID, &p.Name, &p.Price); err != nil {
+				return err
 			}
-			return nil, err
+			products = append(products, p)
 		}
-		products = append(products, p)
-	}
 
-	if err := rows.Err(); err != nil {
+		return rows.Err()
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -75,160 +68,190 @@ func (r *ProductRepository) List(ctx context.Context) ([]model.Product, error) {
 }
 
 func (r *ProductRepository) GetByID(ctx context.Context, id string) (*model.Product, error) {
-	row, err := r.queryRow(
-		ctx,
-		`SELECT id, name, price FROM products WHERE id = ?`,
-		id,
-	)
-	if err != nil {
-		return nil, err
-	}
-
 	var p model.Product
-	if err := row.Scan(&p.ID, &p.Name, &p.Price); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
+
+	err := r.read(ctx, opGet, func() error {
+		return r.db.Reader.QueryRowContext(
+			ctx,
+			`SELECT id, name, price FROM products WHERE id = ?`,
+			id,
+		).Scan(&p.ID, &p.Name, &p.Price)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
 	return &p, nil
 }
 
 func (r *ProductRepository) Create(ctx context.Context, p model.Product) error {
-	return withTx(ctx, r.db, func(tx *sql.Tx) error {
-		_, err := r.exec(
-			ctx,
-			tx,
-			`INSERT INTO products (id, name, price) VALUES (?, ?, ?)`,
-			p.ID, p.Name, p.Price,
-		)
-		var sqliteErr sqlite3.Error
-		if errors.As(err, &sqliteErr) {
-			if sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-				return service.ErrProductAlreadyExists
-			}
+	return r.write(ctx, opCreate, func(tx *sql.Tx) error {
+		return insertProduct(ctx, tx, p)
+	})
+}
+
+func insertProduct(ctx context.Context, tx *sql.Tx, p model.Product) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO products (id, name, price) VALUES (?, ?, ?)`,
+		p.ID, p.Name, p.Price,
+	)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		if sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return service.ErrProductAlreadyExists
 		}
+	}
+	if err != nil {
 		return err
-	})
+	}
+	return addOutboxEvent(ctx, tx, service.EventCreated, p)
 }
 
 func (r *ProductRepository) Delete(ctx context.Context, id string) error {
-	return withTx(ctx, r.db, func(tx *sql.Tx) error {
-		res, err := r.exec(
-			ctx,
-			tx,
-			`DELETE FROM products WHERE id = ?`,
-			id,
-		)
-		if err != nil {
-			return err
-		}
+	return r.write(ctx, opDelete, func(tx *sql.Tx) error {
+		return deleteProduct(ctx, tx, id)
+	})
+}
 
-		rows, err := res.RowsAffected()
-		if err != nil {
-			return err
-		}
+func deleteProduct(ctx context.Context, tx *sql.Tx, id string) error {
+	var deleted model.Product
+	err := tx.QueryRowContext(
+		ctx,
+		`DELETE FROM products WHERE id = ? RETURNING id, name, price`,
+		id,
+	).Scan(&deleted.ID, &deleted.Name, &deleted.Price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.ErrProductNotFound
+	} else if err != nil {
+		return err
+	}
 
-		if rows == 0 {
-			return service.ErrProductNotFound
-		}
+	return addOutboxEvent(ctx, tx, service.EventDeleted, deleted)
+}
+
+// Update stores p and returns the row as persisted. An empty name or a
+// non-positive price keeps the stored value.
+func (r *ProductRepository) Update(ctx context.Context, p model.Product) (*model.Product, error) {
+	var stored *model.Product
 
-		return nil
+	err := r.write(ctx, opUpdate, func(tx *sql.Tx) error {
+		var err error
+		stored, err = updateProduct(ctx, tx, p)
+		return err
 	})
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
 }
 
-func (r *ProductRepository) Update(ctx context.Context, p model.Product) error {
-	return withTx(ctx, r.db, func(tx *sql.Tx) error {
-		row := tx.QueryRowContext(
-			ctx,
-			`SELECT id, name, price FROM products WHERE id = ?`,
-			p.ID,
-		)
+func updateProduct(ctx context.Context, tx *sql.Tx, p model.Product) (*model.Product, error) {
+	row := tx.QueryRowContext(
+		ctx,
+		`SELECT id, name, price FROM products WHERE id = ?`,
+		p.ID,
+	)
+
+	var prev model.Product
+	err := row.Scan(&prev.ID, &prev.Name, &prev.Price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, service.ErrProductNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		p.Name = prev.Name
+	}
+	if p.Price <= 0 {
+		p.Price = prev.Price
+	}
+
+	var stored model.Product
+	err = tx.QueryRowContext(
+		ctx,
+		`UPDATE products SET name = ?, price = ? WHERE id = ? RETURNING id, name, price`,
+		p.Name, p.Price, p.ID,
+	).Scan(&stored.ID, &stored.Name, &stored.Price)
+	var sqliteErr sqlite3.Error
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, service.ErrProductNotFound
+	} else if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return nil, service.ErrProductAlreadyExists
+	} else if err != nil {
+		return nil, err
+	}
+	if err := addOutboxEvent(ctx, tx, service.EventUpdated, stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
 
+// Modify reads the product with id, passes it to fn and stores the product
+// fn returns, all in one transaction. Other writers cannot change the row in
+// between, so fn sees exactly the state it replaces. An error from fn rolls
+// the transaction back and is returned unchanged.
+func (r *ProductRepository) Modify(ctx context.Context, id string, fn func(model.Product) (model.Product, error)) (*model.Product, error) {
+	var stored model.Product
+
+	err := r.write(ctx, opModify, func(tx *sql.Tx) error {
 		var prev model.Product
-		err := row.Scan(&prev.ID, &prev.Name, &prev.Price)
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT id, name, price FROM products WHERE id = ?`,
+			id,
+		).Scan(&prev.ID, &prev.Name, &prev.Price)
 		if errors.Is(err, sql.ErrNoRows) {
 			return service.ErrProductNotFound
 		} else if err != nil {
 			return err
 		}
-		if p.Name == "" {
-			p.Name = prev.Name
-		}
-		if p.Price <= 0 {
-			p.Price = prev.Price
-		}
-
-		res, err := r.exec(
-			ctx,
-			tx,
-			`UPDATE products SET name = ?, price = ? WHERE id = ?`,
-			p.Name, p.Price, p.ID,
-		)
 
+		next, err := fn(prev)
 		if err != nil {
 			return err
 		}
 
-		rows, err := res.RowsAffected()
-		if err != nil {
+		err = tx.QueryRowContext(
+			ctx,
+			`UPDATE products SET name = ?, price = ? WHERE id = ? RETURNING id, name, price`,
+			next.Name, next.Price, prev.ID,
+		).Scan(&stored.ID, &stored.Name, &stored.Price)
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return service.ErrProductAlreadyExists
+		} else if err != nil {
 			return err
 		}
-
-		if rows == 0 {
-			return service.ErrProductNotFound
-		}
-
-		return nil
+		return addOutboxEvent(ctx, tx, service.EventUpdated, stored)
 	})
-}
-
-func (r *ProductRepository) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	start := time.Now()
-
-	if err := r.sem.Acquire(ctx, 1); err != nil {
+	if err != nil {
 		return nil, err
 	}
-
-	metrics.DbSemaphoreWaitDuration.Observe(time.Since(start).Seconds())
-	metrics.DbSemaphoreInUse.Inc()
-	defer func () {
-		r.sem.Release(1)
-		metrics.DbSemaphoreInUse.Dec()
-	}()
-
-	return r.db.QueryContext(ctx, query, args...)
+	return &stored, nil
 }
 
-func (r *ProductRepository) exec(ctx context.Context, tx *sql.Tx, query string, args ...any) (sql.Result, error) {
-	start := time.Now()
-	if err := r.sem.Acquire(ctx, 1); err != nil {
-		return nil, err
+// read runs fn while holding op.cost units of the reader pool. Row iteration
+// must happen inside fn so the slot is held until the query is finished.
+func (r *ProductRepository) read(ctx context.Context, op operation, fn func() error) error {
+	release, err := r.readers.acquire(ctx, op)
+	if err != nil {
+		return err
 	}
+	defer release()
 
-	metrics.DbSemaphoreWaitDuration.Observe(time.Since(start).Seconds())
-	metrics.DbSemaphoreInUse.Inc()
-	defer func () {
-		r.sem.Release(1)
-		metrics.DbSemaphoreInUse.Dec()
-	}()
-
-	return tx.ExecContext(ctx, query, args...)
-	
+	return fn()
 }
 
-func (r *ProductRepository) queryRow(ctx context.Context, query string, args ...any) (*sql.Row, error) {
-	start := time.Now()
-
-	if err := r.sem.Acquire(ctx, 1); err != nil {
-		return nil, err
+// write runs fn in a transaction while holding the single writer slot, so
+// every statement in the transaction, reads included, is covered.
+func (r *ProductRepository) write(ctx context.Context, op operation, fn func(tx *sql.Tx) error) error {
+	release, err := r.writer.acquire(ctx, op)
+	if err != nil {
+		return err
 	}
-	metrics.DbSemaphoreWaitDuration.Observe(time.Since(start).Seconds())
-	metrics.DbSemaphoreInUse.Inc()
-	defer func () {
-		r.sem.Release(1)
-		metrics.DbSemaphoreInUse.Dec()
-	}()
-
-	return r.db.QueryRowContext(ctx, query, args...), nil
+	defer release()
+
+	return withTx(ctx, r.db.Writer, fn)
 }
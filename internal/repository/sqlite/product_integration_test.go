@@ -3,11 +3,14 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/v-kuu/mini-marketplace/internal/model"
 	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/service"
 )
 
 func setupTestDB(t *testing.T) *sql.DB {
@@ -24,6 +27,13 @@ func setupTestDB(t *testing.T) *sql.DB {
 		name TEXT NOT NULL,
 		price INTEGER NOT NULL
 	);
+	CREATE TABLE outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT NOT NULL,
+		aggregate_id TEXT NOT NULL,
+		data TEXT NOT NULL,
+		occurred_at INTEGER NOT NULL
+	);
 	`
 	
 	if _, err := db.Exec(schema); err != nil {
@@ -41,8 +51,8 @@ func TestProductRepository_List(t *testing.T) {
 		}
 	}()
 
-	cfg := config.Load()
-	repo := NewProductRepository(db, cfg)
+	cfg := config.Default()
+	repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
 
 	ctx := context.Background()
 
@@ -76,8 +86,8 @@ func TestProductRepository_List_ContextCancelled(t *testing.T) {
 		}
 	}()
 
-	cfg := config.Load()
-	repo := NewProductRepository(db, cfg)
+	cfg := config.Default()
+	repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
 	
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
@@ -96,8 +106,8 @@ func TestProductRepository_GetByID(t *testing.T) {
 		}
 	}()
 
-	cfg := config.Load()
-	repo := NewProductRepository(db, cfg)
+	cfg := config.Default()
+	repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
 
 	ctx := context.Background()
 
@@ -132,8 +142,8 @@ func TestProductRepository_Create(t *testing.T) {
 		}
 	}()
 
-	cfg := config.Load()
-	repo := NewProductRepository(db, cfg)
+	cfg := config.Default()
+	repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
 
 	ctx := context.Background()
 
@@ -158,8 +168,8 @@ func TestProductRepository_Delete(t *testing.T) {
 		}
 	}()
 
-	cfg := config.Load()
-	repo := NewProductRepository(db, cfg)
+	cfg := config.Default()
+	repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
 
 	ctx := context.Background()
 
@@ -203,8 +213,8 @@ func TestProductRepository_Update(t *testing.T) {
 		}
 	}()
 
-	cfg := config.Load()
-	repo := NewProductRepository(db, cfg)
+	cfg := config.Default()
+	repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
 
 	ctx := context.Background()
 
@@ -216,10 +226,13 @@ func TestProductRepository_Update(t *testing.T) {
 		t.Fatalf("Failed to insert product: %v", err)
 	}
 
-	err = repo.Update(ctx, model.Product{ID: "1", Name: "Tea", Price: 499})
+	updated, err := repo.Update(ctx, model.Product{ID: "1", Name: "Tea", Price: 0})
 	if err != nil {
 		t.Fatalf("Update failed: %v", err)
 	}
+	if want := (model.Product{ID: "1", Name: "Tea", Price: 499}); *updated != want {
+		t.Fatalf("Expected the stored row %+v, got %+v", want, *updated)
+	}
 
 	product, err := repo.GetByID(ctx, "1")
 	if err != nil {
@@ -229,8 +242,114 @@ func TestProductRepository_Update(t *testing.T) {
 		t.Fatalf("Expected Tea, got %s", product.Name)
 	}
 
-	err = repo.Update(ctx, model.Product{ID: "", Name: "", Price: 0})
+	_, err = repo.Update(ctx, model.Product{ID: "", Name: "", Price: 0})
 	if err == nil {
 		t.Fatalf("Update should have failed")
 	}
 }
+
+func TestProductRepository_UpdateHoldsWriterSlot(t *testing.T) {
+	db := setupTestDB(t)
+	defer func () {
+		if err := db.Close(); err != nil {
+			t.Fatalf("Failed to close db: %v", err)
+		}
+	}()
+
+	cfg := config.Default()
+	repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
+
+	_, err := db.Exec(
+		`INSERT INTO products (id, name, price) VALUES (?, ?, ?)`,
+		"1", "Coffee", 499,
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert product: %v", err)
+	}
+
+	release, err := repo.writer.acquire(context.Background(), opCreate)
+	if err != nil {
+		t.Fatalf("Failed to acquire writer slot: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = repo.Update(ctx, model.Product{ID: "1", Name: "Tea", Price: 499})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected Update to wait for the writer slot, got %v", err)
+	}
+
+	// Reads use their own pool and are not blocked by the writer.
+	if _, err := repo.GetByID(context.Background(), "1"); err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+}
+
+func TestProductRepository_Modify(t *testing.T) {
+	db := setupTestDB(t)
+	defer func () {
+		if err := db.Close(); err != nil {
+			t.Fatalf("Failed to close db: %v", err)
+		}
+	}()
+	db.SetMaxOpenConns(1)
+
+	cfg := config.Default()
+	repo := NewProductRepository(&DB{Reader: db, Writer: db}, cfg)
+
+	ctx := context.Background()
+
+	_, err := db.Exec(`
+		CREATE UNIQUE INDEX products_name ON products (name);
+		INSERT INTO products (id, name, price) VALUES ('1', 'Coffee', 499), ('2', 'Tea', 299);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to insert products: %v", err)
+	}
+
+	got, err := repo.Modify(ctx, "1", func(p model.Product) (model.Product, error) {
+		p.Price = 599
+		p.ID = "ignored"
+		return p, nil
+	})
+	if err != nil {
+		t.Fatalf("Modify failed: %v", err)
+	}
+	if want := (model.Product{ID: "1", Name: "Coffee", Price: 599}); *got != want {
+		t.Fatalf("Expected %+v, got %+v", want, *got)
+	}
+
+	errRejected := errors.New("rejected")
+	_, err = repo.Modify(ctx, "1", func(p model.Product) (model.Product, error) {
+		return p, errRejected
+	})
+	if !errors.Is(err, errRejected) {
+		t.Fatalf("Expected the error of fn, got %v", err)
+	}
+
+	_, err = repo.Modify(ctx, "1", func(p model.Product) (model.Product, error) {
+		p.Name = "Tea"
+		return p, nil
+	})
+	if !errors.Is(err, service.ErrProductAlreadyExists) {
+		t.Fatalf("Expected ErrProductAlreadyExists, got %v", err)
+	}
+
+	_, err = repo.Modify(ctx, "3", func(p model.Product) (model.Product, error) {
+		t.Fatalf("fn called for a missing product")
+		return p, nil
+	})
+	if !errors.Is(err, service.ErrProductNotFound) {
+		t.Fatalf("Expected ErrProductNotFound, got %v", err)
+	}
+
+	product, err := repo.GetByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if product.Name != "Coffee" || product.Price != 599 {
+		t.Fatalf("Failed modifications were stored: %+v", product)
+	}
+}
@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func (r *ProductRepository) Find(ctx context.Context, filter service.ProductFilter, after string, limit int) ([]model.Product, error) {
+	products := make([]model.Product, 0, limit)
+
+	err := r.read(ctx, opFind, func() error {
+		rows, err := r.db.Reader.QueryContext(
+			ctx,
+			`SELECT id, name, price FROM products
+			WHERE id > ?
+				AND (? = '' OR instr(lower(name), lower(?)) > 0)
+				AND (? = 0 OR price >= ?)
+				AND (? = 0 OR price <= ?)
+			ORDER BY id LIMIT ?`,
+			after,
+			filter.NameContains, filter.NameContains,
+			filter.MinPrice, filter.MinPrice,
+			filter.MaxPrice, filter.MaxPrice,
+			limit,
+		)
+		if err != nil {
+			return err
+		}
+		defer func () {
+			if err := rows.Close(); err != nil {
+				slog.Error("Failed to close rows", "err", err)
+			}
+		}()
+
+		for rows.Next() {
+			var p model.Product
+			if err := rows.Scan(&p.ID, &p.Name, &p.Price); err != nil {
+				return err
+			}
+			products = append(products, p)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (r *ProductRepository) GetByIDs(ctx context.Context, ids []string) ([]model.Product, error) {
+	products := make([]model.Product, 0, len(ids))
+
+	err := r.read(ctx, opGetMany, func() error {
+		rows, err := r.db.Reader.QueryContext(
+			ctx,
+			`SELECT id, name, price FROM products WHERE id IN (`+placeholders(len(ids))+`)`,
+			anySlice(ids)...,
+		)
+		if err != nil {
+			return err
+		}
+		defer func () {
+			if err := rows.Close(); err != nil {
+				slog.Error("Failed to close rows", "err", err)
+			}
+		}()
+
+		for rows.Next() {
+			var p model.Product
+			if err := rows.Scan(&p.ID, &p.Name, &p.Price); err != nil {
+				return err
+			}
+			products = append(products, p)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// History numbers the changes of every product newest first and keeps the
+// first limit of each, so all products are read with one query.
+func (r *ProductRepository) History(ctx context.Context, ids []string, limit int) (map[string][]service.ProductEvent, error) {
+	history := make(map[string][]service.ProductEvent)
+
+	err := r.read(ctx, opHistory, func() error {
+		rows, err := r.db.Reader.QueryContext(
+			ctx,
+			`SELECT seq, type, product_id, name, price FROM (
+				SELECT *, ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY seq DESC) AS n
+				FROM product_changes WHERE product_id IN (`+placeholders(len(ids))+`)
+			) WHERE n <= ? ORDER BY product_id, seq DESC`,
+			append(anySlice(ids), limit)...,
+		)
+		if err != nil {
+			return err
+		}
+		defer func () {
+			if err := rows.Close(); err != nil {
+				slog.Error("Failed to close rows", "err", err)
+			}
+		}()
+
+		for rows.Next() {
+			var e service.ProductEvent
+			if err := rows.Scan(&e.ID, &e.Type, &e.Product.ID, &e.Product.Name, &e.Product.Price); err != nil {
+				return err
+			}
+			history[e.Product.ID] = append(history[e.Product.ID], e)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// placeholders returns n comma-separated query parameters.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func anySlice[T any](values []T) []any {
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func TestProductRepository_Queries(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	defer func () {
+		if err := db.Close(); err != nil {
+			t.Fatalf("Failed to close db: %v", err)
+		}
+	}()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	store := &DB{Reader: db, Writer: db}
+	if err := Migrate(ctx, store); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	repo := NewProductRepository(store, config.Default())
+
+	for _, p := range []model.Product{
+		{ID: "1", Name: "Coffee", Price: 499},
+		{ID: "2", Name: "Tea", Price: 299},
+		{ID: "3", Name: "Iced coffee", Price: 599},
+	} {
+		if err := repo.Create(ctx, p); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	for _, price := range []int64{549, 579} {
+		if _, err := repo.Update(ctx, model.Product{ID: "1", Price: price}); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+	}
+
+	ids := func(products []model.Product) []string {
+		var ids []string
+		for _, p := range products {
+			ids = append(ids, p.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	tests := []struct {
+		name string
+		filter service.ProductFilter
+		after string
+		limit int
+		want []string
+	}{
+		{"all", service.ProductFilter{}, "", 10, []string{"1", "2", "3"}},
+		{"page", service.ProductFilter{}, "1", 1, []string{"2"}},
+		{"name ignores case", service.ProductFilter{NameContains: "COFFEE"}, "", 10, []string{"1", "3"}},
+		{"price range", service.ProductFilter{MinPrice: 300, MaxPrice: 580}, "", 10, []string{"1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := repo.Find(ctx, tt.filter, tt.after, tt.limit)
+			if err != nil {
+				t.Fatalf("Find failed: %v", err)
+			}
+			if got := ids(found); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	found, err := repo.GetByIDs(ctx, []string{"3", "missing", "1"})
+	if err != nil {
+		t.Fatalf("GetByIDs failed: %v", err)
+	}
+	if got := ids(found); !slices.Equal(got, []string{"1", "3"}) {
+		t.Errorf("Expected products 1 and 3, got %v", got)
+	}
+
+	history, err := repo.History(ctx, []string{"1", "2", "missing"}, 2)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected history of products 1 and 2, got %v", history)
+	}
+	latest := history["1"]
+	if len(latest) != 2 || latest[0].Product.Price != 579 || latest[1].Product.Price != 549 || latest[0].ID <= latest[1].ID {
+		t.Errorf("Expected the two latest changes of product 1 newest first, got %+v", latest)
+	}
+	if len(history["2"]) != 1 || history["2"][0].Type != service.EventCreated {
+		t.Errorf("Expected the creation of product 2, got %+v", history["2"])
+	}
+}
@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"context"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS products (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	price INTEGER NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_name
+ON products(name);
+
+-- product_changes is the change log behind the product event stream. The
+-- triggers write it in the transaction of the change itself, so it never
+-- shows changes that were rolled back. AUTOINCREMENT keeps sequence numbers
+-- increasing even after old entries are pruned.
+CREATE TABLE IF NOT EXISTS product_changes (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	product_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	price INTEGER NOT NULL
+);
+CREATE TRIGGER IF NOT EXISTS products_created AFTER INSERT ON products
+BEGIN
+	INSERT INTO product_changes (type, product_id, name, price)
+	VALUES ('created', NEW.id, NEW.name, NEW.price);
+END;
+CREATE TRIGGER IF NOT EXISTS products_updated AFTER UPDATE ON products
+WHEN OLD.name IS NOT NEW.name OR OLD.price IS NOT NEW.price
+BEGIN
+	INSERT INTO product_changes (type, product_id, name, price)
+	VALUES ('updated', NEW.id, NEW.name, NEW.price);
+END;
+CREATE TRIGGER IF NOT EXISTS products_deleted AFTER DELETE ON products
+BEGIN
+	INSERT INTO product_changes (type, product_id, name, price)
+	VALUES ('deleted', OLD.id, OLD.name, OLD.price);
+END;
+CREATE INDEX IF NOT EXISTS idx_product_changes_product
+ON product_changes(product_id, seq);
+
+-- outbox holds the domain events of product writes until the relay has
+-- published them. The writes add them in their own transaction, so an event
+-- exists exactly when its change was committed. occurred_at is in Unix
+-- milliseconds.
+CREATE TABLE IF NOT EXISTS outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	aggregate_id TEXT NOT NULL,
+	data TEXT NOT NULL,
+	occurred_at INTEGER NOT NULL
+);
+
+-- Webhooks receive the changes logged after after_seq whose type is in
+-- the comma-separated events. Times are Unix milliseconds. The error of an
+-- attempt is one of the classes of model.WebhookAttempt, never the network
+-- error itself.
+CREATE TABLE IF NOT EXISTS webhooks (
+	id TEXT PRIMARY KEY,
+	url TEXT NOT NULL,
+	events TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	after_seq INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook_id TEXT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_id INTEGER NOT NULL,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at INTEGER,
+	last_status_code INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook
+ON webhook_deliveries(webhook_id, id);
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+	delivery_id INTEGER NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+	attempt INTEGER NOT NULL,
+	attempted_at INTEGER NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	status_code INTEGER NOT NULL,
+	error TEXT NOT NULL,
+	PRIMARY KEY (delivery_id, attempt)
+);
+-- webhook_cursor is the last change fanned out into deliveries. It starts
+-- at the current end of the log, so existing history is not sent.
+CREATE TABLE IF NOT EXISTS webhook_cursor (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	seq INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO webhook_cursor (id, seq)
+SELECT 1, COALESCE(MAX(seq), 0) FROM product_changes;
+`
+
+// Migrate creates any missing tables and indexes. It is safe to run against
+// an existing database.
+func Migrate(ctx context.Context, db *DB) error {
+	_, err := db.Writer.ExecContext(ctx, schema)
+	return err
+}
@@ -0,0 +1,466 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// WebhookRepository stores webhooks and their deliveries in the product
+// database. It shares the pools of the product repository, so its writes
+// queue for the same single writer slot.
+type WebhookRepository struct {
+	r *ProductRepository
+}
+
+func NewWebhookRepository(products *ProductRepository) *WebhookRepository {
+	return &WebhookRepository{r: products}
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func fromMilli(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
+
+// The secret is only read to sign deliveries.
+const webhookColumns = `id, url, events, created_at`
+
+func scanWebhook(scan func(dest ...any) error) (model.Webhook, error) {
+	var w model.Webhook
+	var events string
+	var createdAt int64
+	if err := scan(&w.ID, &w.URL, &events, &createdAt); err != nil {
+		return w, err
+	}
+	w.Events = strings.Split(events, ",")
+	w.CreatedAt = fromMilli(createdAt)
+	return w, nil
+}
+
+func (wr *WebhookRepository) CreateWebhook(ctx context.Context, w model.Webhook) (*model.Webhook, error) {
+	err := wr.r.write(ctx, opWebhookWrite, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO webhooks (id, url, events, secret, after_seq, created_at)
+			VALUES (?, ?, ?, ?, COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'product_changes'), 0), ?)`,
+			w.ID, w.URL, strings.Join(w.Events, ","), w.Secret, w.CreatedAt.UnixMilli(),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (wr *WebhookRepository) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	webhooks := []model.Webhook{}
+
+	err := wr.r.read(ctx, opWebhooks, func() error {
+		rows, err := wr.r.db.Reader.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY created_at, id`)
+		if err != nil {
+			return err
+		}
+		defer func () {
+			if err := rows.Close(); err != nil {
+				slog.Error("Failed to close rows", "err", err)
+			}
+		}()
+
+		for rows.Next() {
+			w, err := scanWebhook(rows.Scan)
+			if err != nil {
+				return err
+			}
+			webhooks = append(webhooks, w)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (wr *WebhookRepository) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	var w model.Webhook
+
+	err := wr.r.read(ctx, opWebhooks, func() error {
+		var err error
+		row := wr.r.db.Reader.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id)
+		w, err = scanWebhook(row.Scan)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (wr *WebhookRepository) UpdateWebhook(ctx context.Context, w model.Webhook) (*model.Webhook, error) {
+	var stored model.Webhook
+
+	err := wr.r.write(ctx, opWebhookWrite, func(tx *sql.Tx) error {
+		var url string
+		err := tx.QueryRowContext(ctx, `SELECT url FROM webhooks WHERE id = ?`, w.ID).Scan(&url)
+		if errors.Is(err, sql.ErrNoRows) {
+			return service.ErrWebhookNotFound
+		} else if err != nil {
+			return err
+		}
+		rotate := url != w.URL && w.Secret != ""
+
+		if rotate {
+			_, err = tx.ExecContext(
+				ctx,
+				`UPDATE webhooks SET url = ?, events = ?, secret = ? WHERE id = ?`,
+				w.URL, strings.Join(w.Events, ","), w.Secret, w.ID,
+			)
+		} else {
+			_, err = tx.ExecContext(
+				ctx,
+				`UPDATE webhooks SET url = ?, events = ? WHERE id = ?`,
+				w.URL, strings.Join(w.Events, ","), w.ID,
+			)
+		}
+		if err != nil {
+			return err
+		}
+
+		row := tx.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, w.ID)
+		if stored, err = scanWebhook(row.Scan); err != nil {
+			return err
+		}
+		if rotate {
+			stored.Secret = w.Secret
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// DeleteWebhook deletes the deliveries itself rather than relying on the
+// foreign keys, which are only enforced on connections that enable them.
+func (wr *WebhookRepository) DeleteWebhook(ctx context.Context, id string) error {
+	return wr.r.write(ctx, opWebhookWrite, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM webhook_attempts WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE webhook_id = ?);
+			DELETE FROM webhook_deliveries WHERE webhook_id = ?;`,
+			id, id,
+		)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return service.ErrWebhookNotFound
+		}
+		return nil
+	})
+}
+
+// EnqueueDeliveries fans changes out to webhooks and advances the cursor
+// in one transaction, so every change is enqueued exactly once. Payloads
+// are built when enqueued, so retries send the same bytes.
+func (wr *WebhookRepository) EnqueueDeliveries(ctx context.Context, limit int, now time.Time) (int, error) {
+	var n int
+
+	err := wr.r.write(ctx, opEnqueue, func(tx *sql.Tx) error {
+		var cursor, upto int64
+		if err := tx.QueryRowContext(ctx, `SELECT seq FROM webhook_cursor`).Scan(&cursor); err != nil {
+			return err
+		}
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT COUNT(*), COALESCE(MAX(seq), ?) FROM (
+				SELECT seq FROM product_changes WHERE seq > ? ORDER BY seq LIMIT ?
+			)`,
+			cursor, cursor, limit,
+		).Scan(&n, &upto)
+		if err != nil || n == 0 {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO webhook_deliveries (
+				webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at, updated_at
+			)
+			SELECT
+				w.id, c.seq, c.type,
+				json_object(
+					'event_id', c.seq,
+					'event', c.type,
+					'product', json_object('id', c.product_id, 'name', c.name, 'price', c.price)
+				),
+				'pending', ?, ?, ?
+			FROM product_changes c
+			JOIN webhooks w
+				ON c.seq > w.after_seq AND instr(',' || w.events || ',', ',' || c.type || ',') > 0
+			WHERE c.seq > ? AND c.seq <= ?
+			ORDER BY c.seq, w.id`,
+			now.UnixMilli(), now.UnixMilli(), now.UnixMilli(), cursor, upto,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE webhook_cursor SET seq = ?`, upto)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+	d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.updated_at`
+
+func scanDelivery(scan func(dest ...any) error, extra ...any) (model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	var payload string
+	var next sql.NullInt64
+	var createdAt, updatedAt int64
+	dest := append([]any{
+		&d.ID, &d.WebhookID, &d.EventID, &d.Event, &payload, &d.Status, &d.Attempts,
+		&next, &d.LastStatusCode, &d.LastError, &createdAt, &updatedAt,
+	}, extra...)
+	if err := scan(dest...); err != nil {
+		return d, err
+	}
+	d.Payload = []byte(payload)
+	if next.Valid {
+		t := fromMilli(next.Int64)
+		d.NextAttemptAt = &t
+	}
+	d.CreatedAt = fromMilli(createdAt)
+	d.UpdatedAt = fromMilli(updatedAt)
+	return d, nil
+}
+
+func (wr *WebhookRepository) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]service.DeliveryJob, error) {
+	var jobs []service.DeliveryJob
+
+	err := wr.r.read(ctx, opDeliveries, func() error {
+		rows, err := wr.r.db.Reader.QueryContext(
+			ctx,
+			`SELECT `+deliveryColumns+`, w.url, w.secret
+			FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= ?
+			ORDER BY d.next_attempt_at, d.id
+			LIMIT ?`,
+			now.UnixMilli(), limit,
+		)
+		if err != nil {
+			return err
+		}
+		defer func () {
+			if err := rows.Close(); err != nil {
+				slog.Error("Failed to close rows", "err", err)
+			}
+		}()
+
+		for rows.Next() {
+			var job service.DeliveryJob
+			job.WebhookDelivery, err = scanDelivery(rows.Scan, &job.URL, &job.Secret)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// RecordAttempt does nothing if the delivery was deleted together with its
+// webhook while it was being sent.
+func (wr *WebhookRepository) RecordAttempt(ctx context.Context, id int64, attempt model.WebhookAttempt, status model.DeliveryStatus, next *time.Time) error {
+	var nextAt sql.NullInt64
+	if next != nil {
+		nextAt = sql.NullInt64{Int64: next.UnixMilli(), Valid: true}
+	}
+
+	return wr.r.write(ctx, opDeliver, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(
+			ctx,
+			`UPDATE webhook_deliveries
+			SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?, updated_at = ?
+			WHERE id = ?`,
+			status, attempt.Attempt, nextAt, attempt.StatusCode, attempt.Error, time.Now().UnixMilli(), id,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO webhook_attempts (delivery_id, attempt, attempted_at, duration_ms, status_code, error)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			id, attempt.Attempt, attempt.At.UnixMilli(), attempt.DurationMS, attempt.StatusCode, attempt.Error,
+		)
+		return err
+	})
+}
+
+func (wr *WebhookRepository) ListDeliveries(ctx context.Context, q service.DeliveryQuery) ([]model.WebhookDelivery, error) {
+	deliveries := []model.WebhookDelivery{}
+
+	err := wr.r.read(ctx, opDeliveries, func() error {
+		rows, err := wr.r.db.Reader.QueryContext(
+			ctx,
+			`SELECT `+deliveryColumns+` FROM webhook_deliveries d
+			WHERE d.webhook_id = ? AND (? = '' OR d.status = ?) AND (? = 0 OR d.id < ?)
+			ORDER BY d.id DESC
+			LIMIT ?`,
+			q.WebhookID, q.Status, q.Status, q.Before, q.Before, q.Limit,
+		)
+		if err != nil {
+			return err
+		}
+		defer func () {
+			if err := rows.Close(); err != nil {
+				slog.Error("Failed to close rows", "err", err)
+			}
+		}()
+
+		for rows.Next() {
+			d, err := scanDelivery(rows.Scan)
+			if err != nil {
+				return err
+			}
+			deliveries = append(deliveries, d)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (wr *WebhookRepository) GetDelivery(ctx context.Context, webhookID string, id int64) (*model.WebhookDelivery, error) {
+	var d *model.WebhookDelivery
+
+	err := wr.r.read(ctx, opDeliveries, func() error {
+		var err error
+		d, err = getDelivery(ctx, wr.r.db.Reader, webhookID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (wr *WebhookRepository) RetryDelivery(ctx context.Context, webhookID string, id int64, now time.Time) (*model.WebhookDelivery, error) {
+	var d *model.WebhookDelivery
+
+	err := wr.r.write(ctx, opDeliver, func(tx *sql.Tx) error {
+		var status model.DeliveryStatus
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT status FROM webhook_deliveries WHERE webhook_id = ? AND id = ?`,
+			webhookID, id,
+		).Scan(&status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return service.ErrDeliveryNotFound
+		} else if err != nil {
+			return err
+		}
+		if status == model.DeliveryPending {
+			return service.ErrDeliveryPending
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`UPDATE webhook_deliveries SET status = 'pending', next_attempt_at = ?, updated_at = ? WHERE id = ?`,
+			now.UnixMilli(), now.UnixMilli(), id,
+		)
+		if err != nil {
+			return err
+		}
+		d, err = getDelivery(ctx, tx, webhookID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// getDelivery reads a delivery with its attempt log. It returns nil if the
+// webhook has no such delivery.
+func getDelivery(ctx context.Context, q querier, webhookID string, id int64) (*model.WebhookDelivery, error) {
+	row := q.QueryRowContext(
+		ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries d WHERE d.webhook_id = ? AND d.id = ?`,
+		webhookID, id,
+	)
+	d, err := scanDelivery(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(
+		ctx,
+		`SELECT attempt, attempted_at, duration_ms, status_code, error
+		FROM webhook_attempts WHERE delivery_id = ? ORDER BY attempt`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func () {
+		if err := rows.Close(); err != nil {
+			slog.Error("Failed to close rows", "err", err)
+		}
+	}()
+
+	d.AttemptLog = []model.WebhookAttempt{}
+	for rows.Next() {
+		var a model.WebhookAttempt
+		var at int64
+		if err := rows.Scan(&a.Attempt, &at, &a.DurationMS, &a.StatusCode, &a.Error); err != nil {
+			return nil, err
+		}
+		a.At = fromMilli(at)
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
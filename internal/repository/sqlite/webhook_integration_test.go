@@ -0,0 +1,213 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func TestWebhookRepository_Deliveries(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	defer func () {
+		if err := db.Close(); err != nil {
+			t.Fatalf("Failed to close db: %v", err)
+		}
+	}()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	store := &DB{Reader: db, Writer: db}
+	if err := Migrate(ctx, store); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	repo := NewProductRepository(store, config.Default())
+	webhooks := NewWebhookRepository(repo)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	// History from before a webhook was registered is not sent to it.
+	if err := repo.Create(ctx, model.Product{ID: "1", Name: "Coffee", Price: 499}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	all, err := webhooks.CreateWebhook(ctx, model.Webhook{ID: "all", URL: "http://a.test", Events: []string{"created", "updated", "deleted"}, Secret: "s1", CreatedAt: now})
+	if err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+	if _, err := webhooks.CreateWebhook(ctx, model.Webhook{ID: "deleted", URL: "http://d.test", Events: []string{"deleted"}, Secret: "s2", CreatedAt: now}); err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+
+	if _, err := repo.Update(ctx, model.Product{ID: "1", Name: "Coffee", Price: 399}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := repo.Delete(ctx, "1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	if n, err := webhooks.EnqueueDeliveries(ctx, 100, now); err != nil || n != 3 {
+		t.Fatalf("Expected 3 changes enqueued, got %d, %v", n, err)
+	}
+	// Enqueued changes are not enqueued again.
+	if n, err := webhooks.EnqueueDeliveries(ctx, 100, now); err != nil || n != 0 {
+		t.Fatalf("Expected nothing enqueued, got %d, %v", n, err)
+	}
+
+	jobs, err := webhooks.DueDeliveries(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("DueDeliveries failed: %v", err)
+	}
+	var got []string
+	for _, job := range jobs {
+		got = append(got, job.WebhookID+":"+job.Event)
+	}
+	want := []string{"all:updated", "all:deleted", "deleted:deleted"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected deliveries %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected deliveries %v, got %v", want, got)
+		}
+	}
+	if jobs[0].URL != all.URL || jobs[0].Secret != "s1" {
+		t.Errorf("Expected the URL and secret of the webhook, got %q, %q", jobs[0].URL, jobs[0].Secret)
+	}
+	var payload struct {
+		EventID int64 `json:"event_id"`
+		Event string `json:"event"`
+		Product model.Product `json:"product"`
+	}
+	if err := json.Unmarshal(jobs[0].Payload, &payload); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if payload.EventID != jobs[0].EventID || payload.Event != "updated" || payload.Product != (model.Product{ID: "1", Name: "Coffee", Price: 399}) {
+		t.Errorf("Unexpected payload %s", jobs[0].Payload)
+	}
+
+	// A failed attempt postpones the delivery; a dead one is not due again.
+	first := jobs[0].ID
+	retryAt := now.Add(time.Minute)
+	if err := webhooks.RecordAttempt(ctx, first, model.WebhookAttempt{Attempt: 1, At: now, DurationMS: 5000, Error: model.AttemptTimeout}, model.DeliveryPending, &retryAt); err != nil {
+		t.Fatalf("RecordAttempt failed: %v", err)
+	}
+	if jobs, err := webhooks.DueDeliveries(ctx, now, 10); err != nil || len(jobs) != 2 {
+		t.Fatalf("Expected 2 due deliveries, got %d, %v", len(jobs), err)
+	}
+	if err := webhooks.RecordAttempt(ctx, first, model.WebhookAttempt{Attempt: 2, At: retryAt, DurationMS: 40, StatusCode: 503, Error: model.AttemptHTTPStatus}, model.DeliveryDead, nil); err != nil {
+		t.Fatalf("RecordAttempt failed: %v", err)
+	}
+	if jobs, err := webhooks.DueDeliveries(ctx, retryAt, 10); err != nil || len(jobs) != 2 {
+		t.Fatalf("Expected 2 due deliveries, got %d, %v", len(jobs), err)
+	}
+
+	d, err := webhooks.GetDelivery(ctx, "all", first)
+	if err != nil || d == nil {
+		t.Fatalf("GetDelivery failed: %v, %v", d, err)
+	}
+	if d.Status != model.DeliveryDead || d.Attempts != 2 || d.LastStatusCode != 503 || d.LastError != model.AttemptHTTPStatus || d.NextAttemptAt != nil || len(d.AttemptLog) != 2 {
+		t.Errorf("Unexpected dead delivery %+v", d)
+	}
+	if d.AttemptLog[0].Error != model.AttemptTimeout || d.AttemptLog[0].DurationMS != 5000 || !d.AttemptLog[0].At.Equal(now) {
+		t.Errorf("Unexpected first attempt %+v", d.AttemptLog[0])
+	}
+	if d.AttemptLog[1].StatusCode != 503 || d.AttemptLog[1].DurationMS != 40 {
+		t.Errorf("Unexpected second attempt %+v", d.AttemptLog[1])
+	}
+	if d, err := webhooks.GetDelivery(ctx, "deleted", first); err != nil || d != nil {
+		t.Errorf("Expected no delivery of another webhook, got %v, %v", d, err)
+	}
+
+	dead, err := webhooks.ListDeliveries(ctx, service.DeliveryQuery{WebhookID: "all", Status: model.DeliveryDead, Limit: 10})
+	if err != nil || len(dead) != 1 || dead[0].ID != first {
+		t.Fatalf("Expected the dead delivery, got %v, %v", dead, err)
+	}
+	page, err := webhooks.ListDeliveries(ctx, service.DeliveryQuery{WebhookID: "all", Before: jobs[1].ID, Limit: 10})
+	if err != nil || len(page) != 1 || page[0].ID != first {
+		t.Fatalf("Expected the older delivery, got %v, %v", page, err)
+	}
+
+	retried, err := webhooks.RetryDelivery(ctx, "all", first, retryAt)
+	if err != nil {
+		t.Fatalf("RetryDelivery failed: %v", err)
+	}
+	if retried.Status != model.DeliveryPending || retried.NextAttemptAt == nil || !retried.NextAttemptAt.Equal(retryAt) {
+		t.Errorf("Expected a pending delivery due at %v, got %+v", retryAt, retried)
+	}
+	if _, err := webhooks.RetryDelivery(ctx, "all", first, retryAt); !errors.Is(err, service.ErrDeliveryPending) {
+		t.Errorf("Expected ErrDeliveryPending, got %v", err)
+	}
+	if _, err := webhooks.RetryDelivery(ctx, "deleted", first, retryAt); !errors.Is(err, service.ErrDeliveryNotFound) {
+		t.Errorf("Expected ErrDeliveryNotFound, got %v", err)
+	}
+
+	if err := webhooks.DeleteWebhook(ctx, "all"); err != nil {
+		t.Fatalf("DeleteWebhook failed: %v", err)
+	}
+	if err := webhooks.DeleteWebhook(ctx, "all"); !errors.Is(err, service.ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+	if jobs, err := webhooks.DueDeliveries(ctx, retryAt, 10); err != nil || len(jobs) != 1 || jobs[0].WebhookID != "deleted" {
+		t.Errorf("Expected only the deliveries of the remaining webhook, got %v, %v", jobs, err)
+	}
+	var attempts int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM webhook_attempts`).Scan(&attempts); err != nil || attempts != 0 {
+		t.Errorf("Expected the attempt log deleted with the webhook, got %d, %v", attempts, err)
+	}
+}
+
+func TestWebhookRepository_UpdateWebhook(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	defer db.Close() //nolint:all
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	store := &DB{Reader: db, Writer: db}
+	if err := Migrate(ctx, store); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	webhooks := NewWebhookRepository(NewProductRepository(store, config.Default()))
+	if _, err := webhooks.CreateWebhook(ctx, model.Webhook{ID: "hook", URL: "http://a.test", Events: []string{"created"}, Secret: "s1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+	secret := func() string {
+		var s string
+		if err := db.QueryRow(`SELECT secret FROM webhooks WHERE id = 'hook'`).Scan(&s); err != nil {
+			t.Fatalf("Failed to read secret: %v", err)
+		}
+		return s
+	}
+
+	// Changing only the events keeps the secret.
+	w, err := webhooks.UpdateWebhook(ctx, model.Webhook{ID: "hook", URL: "http://a.test", Events: []string{"created", "deleted"}, Secret: "s2"})
+	if err != nil {
+		t.Fatalf("UpdateWebhook failed: %v", err)
+	}
+	if w.Secret != "" || secret() != "s1" || len(w.Events) != 2 {
+		t.Errorf("Expected the secret kept and not returned, got %+v with %q stored", w, secret())
+	}
+
+	// Moving the webhook replaces the secret and returns the new one.
+	w, err = webhooks.UpdateWebhook(ctx, model.Webhook{ID: "hook", URL: "http://b.test", Events: []string{"created"}, Secret: "s3"})
+	if err != nil {
+		t.Fatalf("UpdateWebhook failed: %v", err)
+	}
+	if w.Secret != "s3" || secret() != "s3" || w.URL != "http://b.test" {
+		t.Errorf("Expected the secret rotated, got %+v with %q stored", w, secret())
+	}
+
+	if _, err := webhooks.UpdateWebhook(ctx, model.Webhook{ID: "missing", URL: "http://b.test", Secret: "s4"}); !errors.Is(err, service.ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package seed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Product is a generated product and the category it was drawn from.
+type Product struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Price int64 `json:"price"`
+	Category string `json:"category"`
+}
+
+// Generator draws products from a spec. The same spec and seed always give
+// the same products in the same order, and the nth product always gets the
+// same ID, whatever the spec.
+type Generator struct {
+	spec Spec
+	rng *rand.Rand
+	ids *rand.ChaCha8
+	categories []picker
+	totalWeight float64
+	used map[string]bool
+	// suffixes counts the names that were drawn again per base name.
+	suffixes map[string]int
+}
+
+// picker draws the words of one category.
+type picker struct {
+	brands, adjectives, nouns, variants func() string
+}
+
+// NewGenerator returns a generator for a valid spec.
+func NewGenerator(spec Spec, seed uint64) (*Generator, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Products and IDs come from separate streams, so changing the spec
+	// does not change the IDs.
+	var key [32]byte
+	binary.LittleEndian.PutUint64(key[:], seed)
+	g := &Generator{
+		spec: spec,
+		rng: rand.New(rand.NewPCG(seed, 0x6d61726b6574)),
+		ids: rand.NewChaCha8(key),
+		used: make(map[string]bool),
+		suffixes: make(map[string]int),
+	}
+	for _, c := range spec.Categories {
+		g.totalWeight += c.Weight
+		g.categories = append(g.categories, picker{
+			brands: g.words(c.Brands, c.BrandSkew),
+			adjectives: g.words(c.Adjectives, 0),
+			nouns: g.words(c.Nouns, 0),
+			variants: g.words(c.Variants, 0),
+		})
+	}
+	return g, nil
+}
+
+// words returns a function that draws one of words, or "" if there are
+// none.
+func (g *Generator) words(words []string, skew float64) func() string {
+	switch {
+		case len(words) == 0:
+			return func() string { return "" }
+		case skew > 1:
+			z := rand.NewZipf(g.rng, skew, 1, uint64(len(words) - 1))
+			return func() string { return words[z.Uint64()] }
+		default:
+			return func() string { return words[g.rng.IntN(len(words))] }
+	}
+}
+
+// Next returns the next product. Names are unique: a name drawn before gets
+// a number, as in "Lumo Green Tea Bags 20 pcs #2".
+func (g *Generator) Next() Product {
+	i := g.category()
+	c, pick := g.spec.Categories[i], g.categories[i]
+
+	var parts []string
+	for _, w := range []string{pick.brands(), pick.adjectives(), pick.nouns(), pick.variants()} {
+		if w != "" {
+			parts = append(parts, w)
+		}
+	}
+	base := strings.Join(parts, " ")
+	name := base
+	for g.used[name] {
+		g.suffixes[base]++
+		name = fmt.Sprintf("%s #%d", base, g.suffixes[base] + 1)
+	}
+	g.used[name] = true
+
+	id, err := uuid.NewRandomFromReader(g.ids)
+	if err != nil {
+		// ChaCha8 reads never fail.
+		panic(err)
+	}
+	return Product{ID: id.String(), Name: name, Price: g.price(c.Price), Category: c.Name}
+}
+
+func (g *Generator) category() int {
+	x := g.rng.Float64() * g.totalWeight
+	for i, c := range g.spec.Categories {
+		if x < c.Weight {
+			return i
+		}
+		x -= c.Weight
+	}
+	return len(g.spec.Categories) - 1
+}
+
+func (g *Generator) price(p Price) int64 {
+	var cents int64
+	if p.Distribution == LogNormal {
+		x := float64(p.Median) * math.Exp(p.Sigma * g.rng.NormFloat64())
+		cents = min(max(int64(math.Round(x)), p.Min), p.Max)
+	} else {
+		cents = p.Min + g.rng.Int64N(p.Max - p.Min + 1)
+	}
+	if p.Charm {
+		charmed := (cents + 99) / 100 * 100 - 1
+		if charmed >= p.Min && charmed <= p.Max {
+			cents = charmed
+		}
+	}
+	return cents
+}
@@ -0,0 +1,219 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+func generate(t *testing.T, spec Spec, seed uint64, n int) []Product {
+	t.Helper()
+
+	g, err := NewGenerator(spec, seed)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	products := make([]Product, n)
+	for i := range products {
+		products[i] = g.Next()
+	}
+	return products
+}
+
+func TestGenerator_Deterministic(t *testing.T) {
+	a := generate(t, DefaultSpec(), 42, 500)
+	if b := generate(t, DefaultSpec(), 42, 500); !slices.Equal(a, b) {
+		t.Fatal("Expected the same seed to give the same products")
+	}
+	if c := generate(t, DefaultSpec(), 43, 500); slices.Equal(a, c) {
+		t.Fatal("Expected another seed to give other products")
+	}
+
+	small := Spec{Categories: []Category{{
+		Name: "Tea", Weight: 1, Nouns: []string{"Tea"}, Price: Price{Min: 100, Max: 100},
+	}}}
+	for i, p := range generate(t, small, 42, 500) {
+		if p.ID != a[i].ID {
+			t.Fatalf("Expected product %d to get ID %s whatever the spec, got %s", i, a[i].ID, p.ID)
+		}
+	}
+}
+
+func TestGenerator_Products(t *testing.T) {
+	spec := DefaultSpec()
+	byName := make(map[string]Category)
+	for _, c := range spec.Categories {
+		byName[c.Name] = c
+	}
+
+	names := make(map[string]bool)
+	counts := make(map[string]int)
+	products := generate(t, spec, 1, 5000)
+	for _, p := range products {
+		if names[p.Name] {
+			t.Fatalf("Expected unique names, got %q twice", p.Name)
+		}
+		names[p.Name] = true
+		if len([]rune(p.Name)) > model.MaxNameLength || !model.NameCharsAllowed(p.Name) {
+			t.Fatalf("Expected a valid name, got %q", p.Name)
+		}
+
+		c, ok := byName[p.Category]
+		if !ok {
+			t.Fatalf("Unexpected category %q", p.Category)
+		}
+		counts[p.Category]++
+		if p.Price < c.Price.Min || p.Price > c.Price.Max {
+			t.Fatalf("Expected the price of %q between %d and %d, got %d", p.Name, c.Price.Min, c.Price.Max, p.Price)
+		}
+		if p.Price % 100 != 99 {
+			t.Fatalf("Expected a charm price, got %d", p.Price)
+		}
+	}
+
+	// Coffee & Tea weighs 3 of 9, Furniture 0.5 of 9.
+	if got := float64(counts["Coffee & Tea"]) / float64(len(products)); got < 0.30 || got > 0.37 {
+		t.Errorf("Expected about a third of the products to be coffee and tea, got %.2f", got)
+	}
+	if got := float64(counts["Furniture"]) / float64(len(products)); got < 0.04 || got > 0.08 {
+		t.Errorf("Expected about 6%% of the products to be furniture, got %.2f", got)
+	}
+}
+
+func TestGenerator_BrandSkew(t *testing.T) {
+	spec := Spec{Categories: []Category{{
+		Name: "Tea", Weight: 1,
+		Brands: []string{"Common", "Rare", "Rarer", "Rarest"},
+		Nouns: []string{"Tea"},
+		BrandSkew: 2,
+		Price: Price{Min: 100, Max: 1000},
+	}}}
+	common := 0
+	for _, p := range generate(t, spec, 7, 1000) {
+		if strings.HasPrefix(p.Name, "Common ") {
+			common++
+		}
+	}
+	if common < 500 {
+		t.Fatalf("Expected the first brand to dominate, got %d of 1000", common)
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	spec, err := ParseSpec([]byte(`
+categories:
+  - name: Tea
+    weight: 1
+    nouns: [Green Tea, Black Tea]
+    price: {distribution: lognormal, min: 100, max: 1000, median: 300, sigma: 0.5}
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+	if got := spec.Categories[0]; got.Name != "Tea" || len(got.Nouns) != 2 || got.Price.Median != 300 {
+		t.Fatalf("Unexpected spec %+v", spec)
+	}
+
+	if _, err := ParseSpec([]byte("categories: []\nextra: 1\n")); err == nil {
+		t.Fatal("Expected unknown keys to be rejected")
+	}
+
+	_, err = ParseSpec([]byte(`
+categories:
+  - name: Tea
+    weight: 0
+    nouns: ["Tea?"]
+    price: {distribution: normal, min: 10, max: 1}
+`))
+	for _, want := range []string{"weight", `"Tea?"`, "distribution", "min <= max"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected an error about %s, got %v", want, err)
+		}
+	}
+}
+
+// fakeRepo stores imported rows by ID and fails rows whose name another
+// product has.
+type fakeRepo struct {
+	products map[string]model.Product
+	batches []int
+	err error
+}
+
+func (r *fakeRepo) Import(ctx context.Context, rows []service.ImportRow, opts service.ImportOptions) ([]service.ImportResult, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.batches = append(r.batches, len(rows))
+	results := make([]service.ImportResult, len(rows))
+	for i, row := range rows {
+		p := row.Product
+		taken := false
+		for _, stored := range r.products {
+			taken = taken || (stored.Name == p.Name && stored.ID != p.ID)
+		}
+		_, exists := r.products[p.ID]
+		switch {
+			case taken:
+				results[i] = service.ImportResult{Outcome: service.ImportFailed, Err: service.ErrProductAlreadyExists}
+				continue
+			case exists:
+				results[i] = service.ImportResult{Outcome: service.ImportUpdated, ID: p.ID}
+			default:
+				results[i] = service.ImportResult{Outcome: service.ImportCreated, ID: p.ID}
+		}
+		if !opts.DryRun {
+			r.products[p.ID] = p
+		}
+	}
+	return results, nil
+}
+
+func TestRun(t *testing.T) {
+	first := generate(t, DefaultSpec(), 9, 1)[0]
+	repo := &fakeRepo{products: map[string]model.Product{"other": {ID: "other", Name: first.Name, Price: 1}}}
+	opts := Options{Seed: 9, Count: 25, BatchSize: 10}
+
+	m, err := Run(context.Background(), repo, DefaultSpec(), opts)
+	if err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	if !slices.Equal(repo.batches, []int{10, 10, 5}) {
+		t.Fatalf("Expected batches of 10, got %v", repo.batches)
+	}
+	if m.Created != 24 || len(m.Products) != 24 || len(m.Skipped) != 1 || m.Skipped[0].ID != first.ID {
+		t.Fatalf("Expected the conflicting product to be skipped, got %+v", m)
+	}
+	for _, id := range m.IDs() {
+		if _, ok := repo.products[id]; !ok {
+			t.Fatalf("Expected manifest ID %s to be stored", id)
+		}
+	}
+
+	again, err := Run(context.Background(), repo, DefaultSpec(), opts)
+	if err != nil {
+		t.Fatalf("Failed to seed again: %v", err)
+	}
+	if again.Created != 0 || again.Updated != 24 || !slices.Equal(again.IDs(), m.IDs()) || len(repo.products) != 25 {
+		t.Fatalf("Expected seeding again to restore the same products, got %+v", again)
+	}
+
+	dry := &fakeRepo{products: map[string]model.Product{}}
+	m, err = Run(context.Background(), dry, DefaultSpec(), Options{Seed: 9, Count: 5, BatchSize: 10, DryRun: true})
+	if err != nil || m.Created != 5 || len(dry.products) != 0 {
+		t.Fatalf("Expected a dry run to write nothing, got %+v, %v", m, err)
+	}
+
+	failing := &fakeRepo{err: errors.New("disk full")}
+	if _, err := Run(context.Background(), failing, DefaultSpec(), opts); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Expected the repository error, got %v", err)
+	}
+	if _, err := Run(context.Background(), repo, DefaultSpec(), Options{Count: 0, BatchSize: 1}); err == nil {
+		t.Fatal("Expected a count of 0 to be rejected")
+	}
+}
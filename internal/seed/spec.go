@@ -0,0 +1,172 @@
+package seed
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+// Price distributions.
+const (
+	Uniform = "uniform"
+	LogNormal = "lognormal"
+)
+
+// Spec describes the products to generate.
+type Spec struct {
+	Categories []Category `yaml:"categories"`
+}
+
+// Category is a kind of product. Names are built from one brand, adjective
+// and noun, plus a variant if there are any, e.g. "Nordkaffe Dark Roast
+// Coffee Beans 500 g".
+type Category struct {
+	Name string `yaml:"name"`
+	// Weight is the share of products drawn from this category, relative
+	// to the weights of the others.
+	Weight float64 `yaml:"weight"`
+	Brands []string `yaml:"brands"`
+	Adjectives []string `yaml:"adjectives"`
+	Nouns []string `yaml:"nouns"`
+	Variants []string `yaml:"variants"`
+	// BrandSkew makes the first brands more common, the way a few brands
+	// dominate a shelf. 0 picks brands uniformly, like every other word;
+	// above 1 it is the exponent of a Zipf distribution.
+	BrandSkew float64 `yaml:"brand_skew"`
+	Price Price `yaml:"price"`
+}
+
+// Price is the distribution of prices in a category, in cents.
+type Price struct {
+	// Distribution is Uniform, the default, or LogNormal.
+	Distribution string `yaml:"distribution"`
+	Min int64 `yaml:"min"`
+	Max int64 `yaml:"max"`
+	// Median and Sigma shape the LogNormal distribution, whose values are
+	// clamped to Min and Max.
+	Median int64 `yaml:"median"`
+	Sigma float64 `yaml:"sigma"`
+	// Charm makes prices end in 99 cents, so 1234 becomes 1299 and 1200
+	// becomes 1199, as long as that stays between Min and Max.
+	Charm bool `yaml:"charm"`
+}
+
+// ParseSpec reads a spec from YAML or JSON. Unknown keys are rejected so
+// that typos do not go unnoticed.
+func ParseSpec(data []byte) (Spec, error) {
+	var spec Spec
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil {
+		return Spec{}, err
+	}
+	return spec, spec.Validate()
+}
+
+// Validate reports every problem of the spec at once. Every word has to be
+// allowed in product names, and the longest name that can be built has to
+// fit into model.MaxNameLength.
+func (s Spec) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(len(s.Categories) > 0, "at least one category is required")
+	names := make(map[string]bool)
+	for i, c := range s.Categories {
+		at := fmt.Sprintf("categories[%d]", i)
+		check(c.Name != "", "%s: name is required", at)
+		check(!names[c.Name], "%s: duplicate category %q", at, c.Name)
+		names[c.Name] = true
+		check(c.Weight > 0 && !math.IsInf(c.Weight, 0), "%s: weight must be greater than 0", at)
+		check(len(c.Nouns) > 0, "%s: at least one noun is required", at)
+		check(c.BrandSkew == 0 || c.BrandSkew > 1, "%s: brand_skew must be 0 or greater than 1", at)
+
+		longest := 0
+		for _, words := range [][]string{c.Brands, c.Adjectives, c.Nouns, c.Variants} {
+			n := 0
+			for _, w := range words {
+				check(strings.TrimSpace(w) == w && w != "", "%s: %q must not be empty or start or end with a space", at, w)
+				check(model.NameCharsAllowed(w), "%s: %q may only contain letters, digits, spaces and %s", at, w, model.NameSymbols)
+				n = max(n, len([]rune(w)))
+			}
+			if n > 0 {
+				longest += n + 1
+			}
+		}
+		// Duplicate names get a suffix like " #12".
+		check(longest + len(" #000000") <= model.MaxNameLength, "%s: names may be up to %d characters long, more than %d", at, longest, model.MaxNameLength - len(" #000000"))
+
+		p := c.Price
+		check(p.Distribution == "" || p.Distribution == Uniform || p.Distribution == LogNormal, "%s: price distribution must be %s or %s", at, Uniform, LogNormal)
+		check(p.Min > 0 && p.Min <= p.Max && p.Max <= model.MaxPrice, "%s: prices must satisfy 0 < min <= max <= %d", at, model.MaxPrice)
+		if p.Distribution == LogNormal {
+			check(p.Median >= p.Min && p.Median <= p.Max, "%s: price median must be between min and max", at)
+			check(p.Sigma > 0, "%s: price sigma must be greater than 0", at)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DefaultSpec is a general store: mostly groceries and household goods,
+// some electronics, and a long tail of expensive items.
+func DefaultSpec() Spec {
+	return Spec{Categories: []Category{
+		{
+			Name: "Coffee & Tea",
+			Weight: 3,
+			Brands: []string{"Nordkaffe", "Morning Hill", "Casa Verde", "Lumo", "Kettle & Co"},
+			Adjectives: []string{"Dark Roast", "Medium Roast", "Organic", "Decaf", "Single Origin", "Earl Grey", "Green", "Chai"},
+			Nouns: []string{"Coffee Beans", "Ground Coffee", "Espresso Pods", "Loose Leaf Tea", "Tea Bags"},
+			Variants: []string{"250 g", "500 g", "1 kg", "20 pcs", "50 pcs"},
+			BrandSkew: 1.5,
+			Price: Price{Distribution: LogNormal, Min: 199, Max: 4999, Median: 899, Sigma: 0.5, Charm: true},
+		},
+		{
+			Name: "Household",
+			Weight: 3,
+			Brands: []string{"Kotiväki", "CleanCo", "Sparkle", "Hjem", "Basics"},
+			Adjectives: []string{"Lemon", "Unscented", "Eco", "Heavy-Duty", "Sensitive", "Fresh"},
+			Nouns: []string{"Dish Soap", "Laundry Detergent", "Paper Towels", "Trash Bags", "Sponges", "Toilet Paper"},
+			Variants: []string{"1 l", "2 l", "3-pack", "6-pack", "12-pack"},
+			BrandSkew: 1.5,
+			Price: Price{Distribution: LogNormal, Min: 99, Max: 2999, Median: 449, Sigma: 0.6, Charm: true},
+		},
+		{
+			Name: "Electronics",
+			Weight: 1.5,
+			Brands: []string{"Voltra", "Pixelon", "Aurora", "Kestrel", "Sona"},
+			Adjectives: []string{"Wireless", "Noise-Cancelling", "Portable", "Smart", "4K", "Compact"},
+			Nouns: []string{"Headphones", "Speaker", "Charger", "Monitor", "Keyboard", "Webcam", "Power Bank"},
+			Variants: []string{"Black", "White", "Silver", "Gen 2", "Pro"},
+			BrandSkew: 1.2,
+			Price: Price{Distribution: LogNormal, Min: 999, Max: 199999, Median: 7999, Sigma: 0.9, Charm: true},
+		},
+		{
+			Name: "Outdoor",
+			Weight: 1,
+			Brands: []string{"Fjällrand", "Trailhead", "Polar", "Kivi"},
+			Adjectives: []string{"Waterproof", "Lightweight", "Insulated", "Ultralight", "Packable"},
+			Nouns: []string{"Jacket", "Tent", "Backpack", "Sleeping Bag", "Hiking Boots", "Headlamp"},
+			Variants: []string{"S", "M", "L", "XL", "2-person", "40 l"},
+			Price: Price{Distribution: Uniform, Min: 1999, Max: 49999, Charm: true},
+		},
+		{
+			Name: "Furniture",
+			Weight: 0.5,
+			Brands: []string{"Puu", "Oakline", "Studio Nord"},
+			Adjectives: []string{"Oak", "Walnut", "Birch", "Steel", "Upholstered"},
+			Nouns: []string{"Dining Table", "Armchair", "Bookshelf", "Desk", "Bed Frame", "Sofa"},
+			Price: Price{Distribution: LogNormal, Min: 4999, Max: 999999, Median: 39999, Sigma: 0.8, Charm: true},
+		},
+	}}
+}
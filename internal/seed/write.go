@@ -0,0 +1,105 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// MaxCount is the most products one run generates.
+const MaxCount = 999_999
+
+// Repository is the part of the product repository seeding writes through.
+type Repository interface {
+	Import(ctx context.Context, rows []service.ImportRow, opts service.ImportOptions) ([]service.ImportResult, error)
+}
+
+// Options control a seeding run.
+type Options struct {
+	Seed uint64
+	Count int
+	// BatchSize is the number of products written per transaction.
+	BatchSize int
+	// DryRun rolls every batch back, so the manifest shows what would
+	// have been written.
+	DryRun bool
+}
+
+// Manifest records what a run wrote. Load tests read the IDs of existing
+// products from it.
+type Manifest struct {
+	Seed uint64 `json:"seed"`
+	DryRun bool `json:"dry_run"`
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	// Products are the products that exist after the run, in the order
+	// they were generated.
+	Products []Product `json:"products"`
+	// Skipped are the products that could not be written, usually because
+	// another product already has the name.
+	Skipped []Skipped `json:"skipped"`
+}
+
+type Skipped struct {
+	Product
+	Error string `json:"error"`
+}
+
+// IDs returns the IDs of the products in the manifest.
+func (m *Manifest) IDs() []string {
+	ids := make([]string, len(m.Products))
+	for i, p := range m.Products {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+// Run generates opts.Count products and writes them through repo in
+// batches of one transaction each. Products are written under their
+// generated IDs and replace what is stored under those IDs, so running the
+// same seed again restores the same products instead of adding copies.
+func Run(ctx context.Context, repo Repository, spec Spec, opts Options) (*Manifest, error) {
+	if opts.Count < 1 || opts.Count > MaxCount {
+		return nil, fmt.Errorf("count must be between 1 and %d", MaxCount)
+	}
+	if opts.BatchSize < 1 {
+		return nil, errors.New("batch size must be at least 1")
+	}
+	g, err := NewGenerator(spec, opts.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Seed: opts.Seed, DryRun: opts.DryRun, Products: []Product{}, Skipped: []Skipped{}}
+	batch := make([]Product, 0, opts.BatchSize)
+	rows := make([]service.ImportRow, 0, opts.BatchSize)
+	for n := 0; n < opts.Count; n += len(batch) {
+		batch, rows = batch[:0], rows[:0]
+		for range min(opts.BatchSize, opts.Count - n) {
+			p := g.Next()
+			batch = append(batch, p)
+			rows = append(rows, service.ImportRow{Product: model.Product{ID: p.ID, Name: p.Name, Price: p.Price}})
+		}
+
+		results, err := repo.Import(ctx, rows, service.ImportOptions{Upsert: true, DryRun: opts.DryRun})
+		if err != nil {
+			return m, fmt.Errorf("seeding stopped after %d products: %w", n, err)
+		}
+		for i, res := range results {
+			switch res.Outcome {
+				case service.ImportCreated:
+					m.Created++
+				case service.ImportUpdated:
+					m.Updated++
+				default:
+					m.Skipped = append(m.Skipped, Skipped{Product: batch[i], Error: res.Err.Error()})
+					continue
+			}
+			m.Products = append(m.Products, batch[i])
+		}
+	}
+	return m, nil
+}
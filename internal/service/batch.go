@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+type BatchAction string
+
+const (
+	BatchCreate BatchAction = "create"
+	BatchUpdate BatchAction = "update"
+	BatchDelete BatchAction = "delete"
+)
+
+// BatchOp is one operation of a batch. Product.ID names the product to
+// update or delete; created products get a new ID.
+type BatchOp struct {
+	Action BatchAction
+	Product model.Product
+}
+
+// BatchResult is the outcome of one batch operation. Product is the stored
+// product after a create or update; Err is set if the operation failed.
+type BatchResult struct {
+	Product *model.Product
+	Err error
+}
+
+// BatchProducts runs ops in order in a single transaction. In atomic mode
+// the first failing operation rolls the whole batch back and every other
+// operation reports ErrBatchAborted. Otherwise failed operations are undone
+// on their own and the rest are committed. An error is only returned if the
+// batch as a whole could not run, in which case nothing was written.
+func (s *ProductService) BatchProducts(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+
+	ops = append([]BatchOp(nil), ops...)
+	for i := range ops {
+		if ops[i].Action == BatchCreate {
+			ops[i].Product.ID = uuid.New().String()
+		}
+	}
+	results, err := s.repo.Batch(ctx, ops, atomic)
+	if err == nil {
+		s.changes.notify()
+	}
+	return results, err
+}
@@ -6,4 +6,17 @@ var (
 	ErrInvalidProduct = errors.New("invalid product")
 	ErrProductNotFound = errors.New("product not found")
 	ErrProductAlreadyExists = errors.New("product already exists")
+	ErrOverloaded = errors.New("service overloaded")
+	// ErrBatchAborted is the result of batch operations that were rolled
+	// back or skipped because another operation of an atomic batch failed.
+	ErrBatchAborted = errors.New("batch aborted")
+	// ErrEventsExpired means events after the requested position are no
+	// longer in the change log, so a client cannot resume from it.
+	ErrEventsExpired = errors.New("events expired")
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrDeliveryPending is returned when retrying a delivery that has not
+	// finished yet.
+	ErrDeliveryPending = errors.New("webhook delivery still pending")
 )
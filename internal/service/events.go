@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+type EventType string
+
+const (
+	EventCreated EventType = "created"
+	EventUpdated EventType = "updated"
+	EventDeleted EventType = "deleted"
+)
+
+// ProductEvent is an entry of the product change log. IDs increase with
+// every change. A deleted event carries the product as it was last stored.
+type ProductEvent struct {
+	ID int64
+	Type EventType
+	Product model.Product
+}
+
+// ProductEvents returns up to limit events after the event with ID after, in
+// order. It fails with ErrEventsExpired if events after that position have
+// already been pruned, or if the position lies beyond the latest event.
+func (s *ProductService) ProductEvents(ctx context.Context, after int64, limit int) ([]ProductEvent, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+
+	events, err := s.repo.Changes(ctx, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > 0 && events[0].ID == after+1 {
+		return events, nil
+	}
+
+	oldest, latest, err := s.repo.ChangeBounds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if after+1 < oldest || after > latest {
+		return nil, ErrEventsExpired
+	}
+	return events, nil
+}
+
+// LatestEventID returns the ID of the latest event, or 0 if there has been
+// none.
+func (s *ProductService) LatestEventID(ctx context.Context) (int64, error) {
+	_, latest, err := s.repo.ChangeBounds(ctx)
+	return latest, err
+}
+
+// SubscribeChanges returns a channel that receives a value after products
+// were changed through this service, and a function that ends the
+// subscription. Changes made in the meantime are coalesced into one value,
+// so readers should fetch every event since their last one when woken.
+func (s *ProductService) SubscribeChanges() (<-chan struct{}, func()) {
+	return s.changes.subscribe()
+}
+
+// RunEventPruning keeps the latest keep events in the change log, checking
+// every interval until ctx is done.
+func (s *ProductService) RunEventPruning(ctx context.Context, keep int64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.repo.PruneChanges(ctx, keep); err != nil && ctx.Err() == nil {
+					slog.Error("Failed to prune product events", "err", err)
+				}
+		}
+	}
+}
+
+// broadcaster wakes up subscribers when products change. Each subscriber
+// has room for a single pending signal, so a writer never blocks on a slow
+// subscriber.
+type broadcaster struct {
+	mu sync.Mutex
+	subs map[chan struct{}]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subs: make(map[chan struct{}]struct{})}
+}
+
+func (b *broadcaster) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (b *broadcaster) notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+			case ch <- struct{}{}:
+			default:
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"iter"
+
+	"github.com/google/uuid"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+// exportPageSize is how many products AllProducts reads per query.
+const exportPageSize = 1000
+
+// ImportRow is one product of a bulk import. A row without an ID is matched
+// against existing products by name, and inserted under NewID if there is
+// none.
+type ImportRow struct {
+	Product model.Product
+	NewID string
+}
+
+// ImportOptions control how an import chunk is written.
+type ImportOptions struct {
+	// Upsert updates products that already exist instead of failing the
+	// row with ErrProductAlreadyExists.
+	Upsert bool
+	// DryRun reports what would happen and rolls every change back.
+	DryRun bool
+}
+
+type ImportOutcome int
+
+const (
+	ImportCreated ImportOutcome = iota
+	ImportUpdated
+	ImportFailed
+)
+
+// ImportResult is the outcome of one import row. Err is set for failed rows.
+type ImportResult struct {
+	Outcome ImportOutcome
+	ID string
+	Err error
+}
+
+// ImportProducts writes one chunk of an import in a single transaction and
+// reports the outcome of every product in order. Rows that conflict with
+// existing products fail on their own; an error is only returned if the
+// chunk as a whole could not be written, in which case none of it was.
+func (s *ProductService) ImportProducts(ctx context.Context, products []model.Product, opts ImportOptions) ([]ImportResult, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+
+	rows := make([]ImportRow, len(products))
+	for i, p := range products {
+		rows[i] = ImportRow{Product: p}
+		if p.ID == "" {
+			rows[i].NewID = uuid.New().String()
+		}
+	}
+	results, err := s.repo.Import(ctx, rows, opts)
+	if err == nil && !opts.DryRun {
+		s.changes.notify()
+	}
+	return results, err
+}
+
+// AllProducts iterates over every product in ID order. Products are read a
+// page at a time, so the table is never held in memory and no database slot
+// is held while the caller handles a page. Iteration stops at the first
+// error, which is yielded with a zero product.
+func (s *ProductService) AllProducts(ctx context.Context) iter.Seq2[model.Product, error] {
+	return func(yield func(model.Product, error) bool) {
+		after := ""
+		for {
+			page, err := s.repo.ListPage(ctx, after, exportPageSize)
+			if err != nil {
+				yield(model.Product{}, err)
+				return
+			}
+			for _, p := range page {
+				if !yield(p, nil) {
+					return
+				}
+			}
+			if len(page) < exportPageSize {
+				return
+			}
+			after = page[len(page)-1].ID
+		}
+	}
+}
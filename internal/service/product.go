@@ -13,15 +13,39 @@ type ProductRepository interface {
 	GetByID(ctx context.Context, id string) (*model.Product, error)
 	Create(ctx context.Context, p model.Product) error
 	Delete(ctx context.Context, id string) error
-	Update(ctx context.Context, p model.Product) error
+	Update(ctx context.Context, p model.Product) (*model.Product, error)
+	Modify(ctx context.Context, id string, fn func(model.Product) (model.Product, error)) (*model.Product, error)
+	Import(ctx context.Context, rows []ImportRow, opts ImportOptions) ([]ImportResult, error)
+	// ListPage returns up to limit products with an ID greater than after,
+	// in ID order.
+	ListPage(ctx context.Context, after string, limit int) ([]model.Product, error)
+	Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error)
+	// Changes returns up to limit change log entries with an ID greater
+	// than after, in ID order.
+	Changes(ctx context.Context, after int64, limit int) ([]ProductEvent, error)
+	// ChangeBounds returns the ID of the oldest retained and of the latest
+	// change. If no change is retained, oldest is latest+1.
+	ChangeBounds(ctx context.Context) (oldest, latest int64, err error)
+	// PruneChanges deletes all but the latest keep changes and returns how
+	// many were deleted.
+	PruneChanges(ctx context.Context, keep int64) (int64, error)
+	// Find returns up to limit products matching filter with an ID greater
+	// than after, in ID order.
+	Find(ctx context.Context, filter ProductFilter, after string, limit int) ([]model.Product, error)
+	// GetByIDs returns the products with the given IDs that exist.
+	GetByIDs(ctx context.Context, ids []string) ([]model.Product, error)
+	// History returns the latest limit changes of each of the given
+	// products, newest first, keyed by product ID.
+	History(ctx context.Context, ids []string, limit int) (map[string][]ProductEvent, error)
 }
 
 type ProductService struct {
 	repo ProductRepository
+	changes *broadcaster
 }
 
 func NewProductService(repo ProductRepository) *ProductService {
-	return &ProductService{repo: repo}
+	return &ProductService{repo: repo, changes: newBroadcaster()}
 }
 
 func (s *ProductService) ListProducts(ctx context.Context) ([]model.Product, error) {
@@ -71,7 +95,11 @@ func (s *ProductService) CreateProduct(ctx context.Context, name string, price i
 	}
 
 	p := model.Product{ID: id, Name: name, Price: price}
-	return id, s.repo.Create(ctx, p)
+	err := s.repo.Create(ctx, p)
+	if err == nil {
+		s.changes.notify()
+	}
+	return id, err
 }
 
 func (s *ProductService) DeleteProduct(ctx context.Context, id string) error {
@@ -93,33 +121,41 @@ func (s *ProductService) DeleteProduct(ctx context.Context, id string) error {
 		return ErrProductNotFound
 	}
 
-	return s.repo.Delete(ctx, id)
+	err = s.repo.Delete(ctx, id)
+	if err == nil {
+		s.changes.notify()
+	}
+	return err
 }
 
-func (s *ProductService) UpdateProduct(ctx context.Context, id string, name string, price int64) error {
+// UpdateProduct replaces the name and price of a product and returns the
+// stored result.
+func (s *ProductService) UpdateProduct(ctx context.Context, id string, name string, price int64) (*model.Product, error) {
 	select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return nil, ctx.Err()
 		default:
 	}
 
 	if id == "" {
-		return ErrInvalidProduct
+		return nil, ErrInvalidProduct
 	}
 
 	p := model.Product{ID: id, Name: name, Price: price}
-	return s.repo.Update(ctx, p)
+	return s.notify(s.repo.Update(ctx, p))
 }
 
-func (s *ProductService) PatchProduct(ctx context.Context, id string, name *string, price *int64) error {
+// PatchProduct changes the fields that are not nil and returns the stored
+// result, including the fields that were left alone.
+func (s *ProductService) PatchProduct(ctx context.Context, id string, name *string, price *int64) (*model.Product, error) {
 	select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return nil, ctx.Err()
 		default:
 	}
 
 	if id == "" {
-		return ErrInvalidProduct
+		return nil, ErrInvalidProduct
 	}
 	p := model.Product{ID: id}
 	if name != nil {
@@ -128,6 +164,31 @@ func (s *ProductService) PatchProduct(ctx context.Context, id string, name *stri
 	if price != nil {
 		p.Price = *price
 	}
-	err := s.repo.Update(ctx, p)
-	return err
+	return s.notify(s.repo.Update(ctx, p))
+}
+
+// ModifyProduct replaces the product with id by what fn returns for it and
+// returns the stored result. fn runs inside the write transaction, so it
+// must be quick and must not call back into the service. The ID cannot be
+// changed by fn.
+func (s *ProductService) ModifyProduct(ctx context.Context, id string, fn func(model.Product) (model.Product, error)) (*model.Product, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+
+	if id == "" {
+		return nil, ErrInvalidProduct
+	}
+	return s.notify(s.repo.Modify(ctx, id, fn))
+}
+
+// notify wakes up change subscribers after a successful write and passes
+// its result through.
+func (s *ProductService) notify(p *model.Product, err error) (*model.Product, error) {
+	if err == nil {
+		s.changes.notify()
+	}
+	return p, err
 }
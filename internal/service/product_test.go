@@ -4,6 +4,9 @@ import (
 	"testing"
 	"errors"
 	"context"
+	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/v-kuu/mini-marketplace/internal/model"
 )
@@ -11,6 +14,9 @@ import (
 type fakeProductRepo struct {
 	products []model.Product
 	err error
+	// events is the change log; latest is the last event ID ever logged.
+	events []ProductEvent
+	latest int64
 }
 
 func (f *fakeProductRepo) List(ctx context.Context) ([]model.Product, error) {
@@ -56,9 +62,9 @@ func (f *fakeProductRepo) Delete(ctx context.Context, id string) error {
 	return ErrProductNotFound
 }
 
-func (f *fakeProductRepo) Update(ctx context.Context, p model.Product) error {
+func (f *fakeProductRepo) Update(ctx context.Context, p model.Product) (*model.Product, error) {
 	if p.ID == "" {
-		return ErrInvalidProduct
+		return nil, ErrInvalidProduct
 	}
 
 	for i, product := range f.products {
@@ -69,10 +75,156 @@ func (f *fakeProductRepo) Update(ctx context.Context, p model.Product) error {
 			if p.Price > 0 {
 				f.products[i].Price = p.Price
 			}
-			return nil
+			stored := f.products[i]
+			return &stored, nil
 		}
 	}
-	return ErrProductNotFound
+	return nil, ErrProductNotFound
+}
+
+func (f *fakeProductRepo) Modify(ctx context.Context, id string, fn func(model.Product) (model.Product, error)) (*model.Product, error) {
+	for i, product := range f.products {
+		if product.ID == id {
+			next, err := fn(product)
+			if err != nil {
+				return nil, err
+			}
+			next.ID = id
+			f.products[i] = next
+			return &next, nil
+		}
+	}
+	return nil, ErrProductNotFound
+}
+
+func (f *fakeProductRepo) Import(ctx context.Context, rows []ImportRow, opts ImportOptions) ([]ImportResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	results := make([]ImportResult, len(rows))
+	for i, row := range rows {
+		p := row.Product
+		if p.ID == "" {
+			p.ID = row.NewID
+		}
+		if err := f.Create(ctx, p); err != nil {
+			results[i] = ImportResult{Outcome: ImportFailed, Err: err}
+			continue
+		}
+		results[i] = ImportResult{Outcome: ImportCreated, ID: p.ID}
+	}
+	return results, nil
+}
+
+func (f *fakeProductRepo) ListPage(ctx context.Context, after string, limit int) ([]model.Product, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	sorted := slices.SortedFunc(slices.Values(f.products), func(a, b model.Product) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	var page []model.Product
+	for _, p := range sorted {
+		if p.ID > after && len(page) < limit {
+			page = append(page, p)
+		}
+	}
+	return page, nil
+}
+
+func (f *fakeProductRepo) Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		switch op.Action {
+			case BatchCreate:
+				results[i].Err = f.Create(ctx, op.Product)
+			case BatchUpdate:
+				results[i].Product, results[i].Err = f.Update(ctx, op.Product)
+			case BatchDelete:
+				results[i].Err = f.Delete(ctx, op.Product.ID)
+		}
+	}
+	return results, nil
+}
+
+func (f *fakeProductRepo) Changes(ctx context.Context, after int64, limit int) ([]ProductEvent, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var events []ProductEvent
+	for _, e := range f.events {
+		if e.ID > after && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (f *fakeProductRepo) ChangeBounds(ctx context.Context) (int64, int64, error) {
+	if f.err != nil {
+		return 0, 0, f.err
+	}
+	if len(f.events) == 0 {
+		return f.latest + 1, f.latest, nil
+	}
+	return f.events[0].ID, f.latest, nil
+}
+
+func (f *fakeProductRepo) PruneChanges(ctx context.Context, keep int64) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	n := max(int64(len(f.events)) - keep, 0)
+	f.events = f.events[n:]
+	return n, nil
+}
+
+func (f *fakeProductRepo) Find(ctx context.Context, filter ProductFilter, after string, limit int) ([]model.Product, error) {
+	page, err := f.ListPage(ctx, after, len(f.products))
+	if err != nil {
+		return nil, err
+	}
+	var found []model.Product
+	for _, p := range page {
+		if !strings.Contains(strings.ToLower(p.Name), strings.ToLower(filter.NameContains)) ||
+			(filter.MinPrice > 0 && p.Price < filter.MinPrice) ||
+			(filter.MaxPrice > 0 && p.Price > filter.MaxPrice) {
+			continue
+		}
+		if len(found) < limit {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeProductRepo) GetByIDs(ctx context.Context, ids []string) ([]model.Product, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var found []model.Product
+	for _, p := range f.products {
+		if slices.Contains(ids, p.ID) {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeProductRepo) History(ctx context.Context, ids []string, limit int) (map[string][]ProductEvent, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	history := make(map[string][]ProductEvent)
+	for _, e := range slices.Backward(f.events) {
+		if slices.Contains(ids, e.Product.ID) && len(history[e.Product.ID]) < limit {
+			history[e.Product.ID] = append(history[e.Product.ID], e)
+		}
+	}
+	return history, nil
 }
 
 func TestProductService_ListProducts(t *testing.T) {
@@ -357,7 +509,7 @@ func TestProductService_Update(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			svc := NewProductService(tt.repo)
-			err := svc.UpdateProduct(context.Background(), tt.id, tt.pName, tt.pPrice)
+			got, err := svc.UpdateProduct(context.Background(), tt.id, tt.pName, tt.pPrice)
 
 			if tt.wantLen != len(tt.repo.products) {
 				t.Fatalf("expected %d elements, got %d", tt.wantLen, len(tt.repo.products))
@@ -377,6 +529,9 @@ func TestProductService_Update(t *testing.T) {
 				if tt.repo.products[0].Name != "Tea" {
 					t.Fatalf("expected tea, got %s", tt.repo.products[0].Name)
 				}
+				if *got != tt.repo.products[0] {
+					t.Fatalf("expected the stored product %+v, got %+v", tt.repo.products[0], *got)
+				}
 			}
 		})
 	}
@@ -443,7 +598,7 @@ func TestProductService_Patch(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			svc := NewProductService(tt.repo)
-			err := svc.PatchProduct(context.Background(), tt.id, tt.pName, tt.pPrice)
+			got, err := svc.PatchProduct(context.Background(), tt.id, tt.pName, tt.pPrice)
 
 			if tt.wantLen != len(tt.repo.products) {
 				t.Fatalf("expected %d elements, got %d", tt.wantLen, len(tt.repo.products))
@@ -463,7 +618,248 @@ func TestProductService_Patch(t *testing.T) {
 				if tt.wantP != tt.repo.products[0] {
 					t.Fatalf("expected %+v, got %+v", tt.wantP, tt.repo.products[0])
 				}
+				if *got != tt.wantP {
+					t.Fatalf("expected the stored product %+v, got %+v", tt.wantP, *got)
+				}
 			}
 		})
 	}
 }
+
+func TestProductService_Modify(t *testing.T) {
+	errRejected := errors.New("rejected")
+	tests := []struct {
+		name string
+		id string
+		fn func(model.Product) (model.Product, error)
+		wantErr error
+		want model.Product
+	}{
+		{
+			name: "Success",
+			id: "1",
+			fn: func(p model.Product) (model.Product, error) {
+				p.Price *= 2
+				return p, nil
+			},
+			want: model.Product{ID: "1", Name: "Coffee", Price: 998},
+		},
+		{
+			name: "Rejected",
+			id: "1",
+			fn: func(p model.Product) (model.Product, error) {
+				return p, errRejected
+			},
+			wantErr: errRejected,
+			want: model.Product{ID: "1", Name: "Coffee", Price: 499},
+		},
+		{
+			name: "Not found",
+			id: "2",
+			fn: func(p model.Product) (model.Product, error) {
+				return p, nil
+			},
+			wantErr: ErrProductNotFound,
+			want: model.Product{ID: "1", Name: "Coffee", Price: 499},
+		},
+		{
+			name: "Empty ID",
+			id: "",
+			wantErr: ErrInvalidProduct,
+			want: model.Product{ID: "1", Name: "Coffee", Price: 499},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeProductRepo{
+				products: []model.Product{{ID: "1", Name: "Coffee", Price: 499}},
+			}
+			svc := NewProductService(repo)
+
+			got, err := svc.ModifyProduct(context.Background(), tt.id, tt.fn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && *got != tt.want {
+				t.Fatalf("Expected %+v, got %+v", tt.want, *got)
+			}
+			if repo.products[0] != tt.want {
+				t.Fatalf("Expected stored %+v, got %+v", tt.want, repo.products[0])
+			}
+		})
+	}
+}
+
+func TestProductService_ImportProducts(t *testing.T) {
+	repo := &fakeProductRepo{}
+	s := NewProductService(repo)
+
+	results, err := s.ImportProducts(context.Background(), []model.Product{
+		{ID: "a", Name: "Coffee", Price: 100},
+		{Name: "Tea", Price: 200},
+		{ID: "b", Price: 300},
+	}, ImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportProducts failed: %v", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].Outcome != ImportCreated || results[0].ID != "a" {
+		t.Fatalf("Expected row 0 created as a, got %+v", results[0])
+	}
+	if results[1].Outcome != ImportCreated || results[1].ID == "" {
+		t.Fatalf("Expected row 1 created under a new ID, got %+v", results[1])
+	}
+	if results[2].Outcome != ImportFailed || !errors.Is(results[2].Err, ErrInvalidProduct) {
+		t.Fatalf("Expected row 2 to fail, got %+v", results[2])
+	}
+}
+
+func TestProductService_AllProducts(t *testing.T) {
+	repo := &fakeProductRepo{}
+	for i := range 2*exportPageSize + 1 {
+		repo.products = append(repo.products, model.Product{ID: fmt.Sprintf("%05d", i), Name: "Coffee", Price: 100})
+	}
+	s := NewProductService(repo)
+
+	var ids []string
+	for p, err := range s.AllProducts(context.Background()) {
+		if err != nil {
+			t.Fatalf("AllProducts failed: %v", err)
+		}
+		ids = append(ids, p.ID)
+	}
+
+	if len(ids) != len(repo.products) {
+		t.Fatalf("Expected %d products, got %d", len(repo.products), len(ids))
+	}
+	if !slices.IsSorted(ids) || len(slices.Compact(slices.Clone(ids))) != len(ids) {
+		t.Fatalf("Expected every product once in ID order")
+	}
+}
+
+func TestProductService_AllProducts_Error(t *testing.T) {
+	repoErr := errors.New("database is down")
+	s := NewProductService(&fakeProductRepo{err: repoErr})
+
+	for _, err := range s.AllProducts(context.Background()) {
+		if !errors.Is(err, repoErr) {
+			t.Fatalf("Expected %v, got %v", repoErr, err)
+		}
+		return
+	}
+	t.Fatalf("Expected the error to be yielded")
+}
+
+func TestProductService_BatchProducts(t *testing.T) {
+	repo := &fakeProductRepo{
+		products: []model.Product{{ID: "1", Name: "Coffee", Price: 499}},
+	}
+	s := NewProductService(repo)
+
+	ops := []BatchOp{
+		{Action: BatchCreate, Product: model.Product{Name: "Tea", Price: 299}},
+		{Action: BatchDelete, Product: model.Product{ID: "1"}},
+	}
+	results, err := s.BatchProducts(context.Background(), ops, true)
+	if err != nil {
+		t.Fatalf("BatchProducts failed: %v", err)
+	}
+
+	for i, res := range results {
+		if res.Err != nil {
+			t.Fatalf("Operation %d failed: %v", i, res.Err)
+		}
+	}
+	if ops[0].Product.ID != "" {
+		t.Fatalf("BatchProducts modified its input")
+	}
+	if len(repo.products) != 1 || repo.products[0].Name != "Tea" || repo.products[0].ID == "" {
+		t.Fatalf("Expected only Tea under a new ID, got %+v", repo.products)
+	}
+}
+
+func TestProductService_ProductEvents(t *testing.T) {
+	events := []ProductEvent{
+		{ID: 3, Type: EventCreated, Product: model.Product{ID: "1", Name: "Coffee", Price: 499}},
+		{ID: 4, Type: EventUpdated, Product: model.Product{ID: "1", Name: "Coffee", Price: 399}},
+		{ID: 5, Type: EventDeleted, Product: model.Product{ID: "1", Name: "Coffee", Price: 399}},
+	}
+
+	tests := []struct {
+		name string
+		after int64
+		limit int
+		wantIDs []int64
+		wantErr error
+	}{
+		{name: "From oldest", after: 2, limit: 10, wantIDs: []int64{3, 4, 5}},
+		{name: "Limited", after: 3, limit: 1, wantIDs: []int64{4}},
+		{name: "Up to date", after: 5, limit: 10},
+		{name: "Pruned", after: 1, limit: 10, wantErr: ErrEventsExpired},
+		{name: "Ahead of log", after: 6, limit: 10, wantErr: ErrEventsExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewProductService(&fakeProductRepo{events: events, latest: 5})
+
+			got, err := s.ProductEvents(context.Background(), tt.after, tt.limit)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			var ids []int64
+			for _, e := range got {
+				ids = append(ids, e.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Fatalf("Expected events %v, got %v", tt.wantIDs, ids)
+			}
+		})
+	}
+}
+
+func TestProductService_SubscribeChanges(t *testing.T) {
+	s := NewProductService(&fakeProductRepo{})
+	changes, unsubscribe := s.SubscribeChanges()
+
+	// Several writes before the subscriber looks are coalesced.
+	for range 3 {
+		if _, err := s.CreateProduct(context.Background(), "Coffee", 499); err != nil {
+			t.Fatalf("CreateProduct failed: %v", err)
+		}
+	}
+	select {
+		case <-changes:
+		default:
+			t.Fatal("Expected a change notification")
+	}
+	select {
+		case <-changes:
+			t.Fatal("Expected notifications to be coalesced")
+		default:
+	}
+
+	// Failed writes do not notify.
+	if err := s.DeleteProduct(context.Background(), "missing"); err == nil {
+		t.Fatal("Expected DeleteProduct to fail")
+	}
+	select {
+		case <-changes:
+			t.Fatal("Expected no notification for a failed write")
+		default:
+	}
+
+	unsubscribe()
+	if _, err := s.CreateProduct(context.Background(), "Tea", 299); err != nil {
+		t.Fatalf("CreateProduct failed: %v", err)
+	}
+	select {
+		case <-changes:
+			t.Fatal("Expected no notification after unsubscribing")
+		default:
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+// ProductFilter selects products. Zero fields do not filter.
+type ProductFilter struct {
+	// NameContains matches names that contain it, ignoring ASCII case.
+	NameContains string
+	MinPrice int64
+	MaxPrice int64
+}
+
+// FindProducts returns up to limit products matching filter with an ID
+// greater than after, in ID order.
+func (s *ProductService) FindProducts(ctx context.Context, filter ProductFilter, after string, limit int) ([]model.Product, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+	return s.repo.Find(ctx, filter, after, limit)
+}
+
+// ProductsByIDs returns the products with the given IDs in a single lookup.
+// IDs without a product are left out, so the result may be shorter and is
+// in no particular order.
+func (s *ProductService) ProductsByIDs(ctx context.Context, ids []string) ([]model.Product, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return s.repo.GetByIDs(ctx, ids)
+}
+
+// ProductHistory returns the latest limit retained changes of each of the
+// given products, newest first, in a single lookup. Products without
+// retained changes have no entry.
+func (s *ProductService) ProductHistory(ctx context.Context, ids []string, limit int) (map[string][]ProductEvent, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+	if len(ids) == 0 || limit <= 0 {
+		return map[string][]ProductEvent{}, nil
+	}
+	return s.repo.History(ctx, ids, limit)
+}
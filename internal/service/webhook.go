@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+// enqueueBatchSize is how many changes are fanned out per transaction.
+const enqueueBatchSize = 500
+
+type WebhookRepository interface {
+	// CreateWebhook stores w so that it receives changes logged from now
+	// on.
+	CreateWebhook(ctx context.Context, w model.Webhook) (*model.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]model.Webhook, error)
+	// GetWebhook returns nil if there is no webhook with the ID.
+	GetWebhook(ctx context.Context, id string) (*model.Webhook, error)
+	// UpdateWebhook replaces the URL and events of a webhook. If the URL
+	// changes, the secret is replaced with w.Secret and returned with the
+	// webhook.
+	UpdateWebhook(ctx context.Context, w model.Webhook) (*model.Webhook, error)
+	// DeleteWebhook deletes a webhook with all of its deliveries.
+	DeleteWebhook(ctx context.Context, id string) error
+	// EnqueueDeliveries creates the deliveries for up to limit changes
+	// after the last change it handled and returns how many changes it
+	// handled.
+	EnqueueDeliveries(ctx context.Context, limit int, now time.Time) (int, error)
+	// DueDeliveries returns up to limit pending deliveries that are due at
+	// now, the longest waiting first.
+	DueDeliveries(ctx context.Context, now time.Time, limit int) ([]DeliveryJob, error)
+	// RecordAttempt logs an attempt and moves the delivery to status. next
+	// is the time of the next attempt of a pending delivery.
+	RecordAttempt(ctx context.Context, id int64, attempt model.WebhookAttempt, status model.DeliveryStatus, next *time.Time) error
+	// ListDeliveries returns the deliveries of a webhook, newest first.
+	ListDeliveries(ctx context.Context, q DeliveryQuery) ([]model.WebhookDelivery, error)
+	// GetDelivery returns a delivery with its attempt log, or nil if the
+	// webhook has no delivery with the ID.
+	GetDelivery(ctx context.Context, webhookID string, id int64) (*model.WebhookDelivery, error)
+	// RetryDelivery makes a delivered or dead delivery pending again, due
+	// at now.
+	RetryDelivery(ctx context.Context, webhookID string, id int64, now time.Time) (*model.WebhookDelivery, error)
+}
+
+// DeliveryQuery selects deliveries of one webhook. Status and Before, a
+// delivery ID to page from, are optional.
+type DeliveryQuery struct {
+	WebhookID string
+	Status model.DeliveryStatus
+	Before int64
+	Limit int
+}
+
+// DeliveryJob is a due delivery with what is needed to send it.
+type DeliveryJob struct {
+	model.WebhookDelivery
+	URL string
+	Secret string
+}
+
+type WebhookService struct {
+	repo WebhookRepository
+	now func() time.Time
+}
+
+func NewWebhookService(repo WebhookRepository) *WebhookService {
+	return &WebhookService{repo: repo, now: time.Now}
+}
+
+// webhookEvents are the event types a webhook can receive, in the order
+// they are stored.
+var webhookEvents = []string{string(EventCreated), string(EventUpdated), string(EventDeleted)}
+
+// checkWebhook validates a webhook URL and returns its events in canonical
+// order. No events means all of them.
+func checkWebhook(rawURL string, events []string) ([]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if len(events) == 0 {
+		return webhookEvents, nil
+	}
+	for _, e := range events {
+		if !slices.Contains(webhookEvents, e) {
+			return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, e)
+		}
+	}
+	var canonical []string
+	for _, e := range webhookEvents {
+		if slices.Contains(events, e) {
+			canonical = append(canonical, e)
+		}
+	}
+	return canonical, nil
+}
+
+// CreateWebhook registers url to receive the given product change events
+// and returns the webhook with its signing secret.
+func (s *WebhookService) CreateWebhook(ctx context.Context, url string, events []string) (*model.Webhook, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+
+	events, err := checkWebhook(url, events)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.CreateWebhook(ctx, model.Webhook{
+		ID: uuid.New().String(),
+		URL: url,
+		Events: events,
+		Secret: secret,
+		CreatedAt: s.now().UTC().Truncate(time.Millisecond),
+	})
+}
+
+func (s *WebhookService) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+	return s.repo.ListWebhooks(ctx)
+}
+
+func (s *WebhookService) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+	return s.repo.GetWebhook(ctx, id)
+}
+
+// UpdateWebhook replaces the URL and events of a webhook. Moving a webhook
+// to another URL also gives it a new secret, which is returned with it, so
+// that the old receiver cannot sign requests the new one accepts.
+func (s *WebhookService) UpdateWebhook(ctx context.Context, id string, url string, events []string) (*model.Webhook, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+
+	events, err := checkWebhook(url, events)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateWebhook(ctx, model.Webhook{ID: id, URL: url, Events: events, Secret: secret})
+}
+
+// newSecret returns a random signing secret.
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+	}
+	return s.repo.DeleteWebhook(ctx, id)
+}
+
+// ListDeliveries returns up to limit deliveries of a webhook, newest first,
+// optionally only those with status or older than the delivery before.
+func (s *WebhookService) ListDeliveries(ctx context.Context, webhookID string, status model.DeliveryStatus, before int64, limit int) ([]model.WebhookDelivery, error) {
+	w, err := s.GetWebhook(ctx, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return nil, ErrWebhookNotFound
+	}
+	return s.repo.ListDeliveries(ctx, DeliveryQuery{WebhookID: webhookID, Status: status, Before: before, Limit: limit})
+}
+
+func (s *WebhookService) GetDelivery(ctx context.Context, webhookID string, id int64) (*model.WebhookDelivery, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+	return s.repo.GetDelivery(ctx, webhookID, id)
+}
+
+// RetryDelivery sends a delivered or dead delivery once more, as soon as
+// the worker gets to it.
+func (s *WebhookService) RetryDelivery(ctx context.Context, webhookID string, id int64) (*model.WebhookDelivery, error) {
+	select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+	}
+	return s.repo.RetryDelivery(ctx, webhookID, id, s.now())
+}
+
+// EnqueueDeliveries creates deliveries for every product change not
+// handled yet and returns how many changes it handled.
+func (s *WebhookService) EnqueueDeliveries(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := s.repo.EnqueueDeliveries(ctx, enqueueBatchSize, s.now())
+		total += n
+		if err != nil || n < enqueueBatchSize {
+			return total, err
+		}
+	}
+}
+
+// DueDeliveries returns up to limit deliveries to send now.
+func (s *WebhookService) DueDeliveries(ctx context.Context, limit int) ([]DeliveryJob, error) {
+	return s.repo.DueDeliveries(ctx, s.now(), limit)
+}
+
+// RecordAttempt logs an attempt of a delivery. A successful attempt
+// completes the delivery. Otherwise the delivery is tried again at
+// retryAt, or is dead-lettered if retryAt is nil.
+func (s *WebhookService) RecordAttempt(ctx context.Context, id int64, attempt model.WebhookAttempt, retryAt *time.Time) error {
+	status := model.DeliveryDead
+	if attempt.Succeeded() {
+		status, retryAt = model.DeliveryDelivered, nil
+	} else if retryAt != nil {
+		status = model.DeliveryPending
+	}
+	return s.repo.RecordAttempt(ctx, id, attempt, status, retryAt)
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+)
+
+// fakeWebhookRepo implements the parts of WebhookRepository the tests
+// use; calling any other method panics.
+type fakeWebhookRepo struct {
+	WebhookRepository
+	webhooks []model.Webhook
+	status model.DeliveryStatus
+	next *time.Time
+}
+
+func (f *fakeWebhookRepo) CreateWebhook(ctx context.Context, w model.Webhook) (*model.Webhook, error) {
+	f.webhooks = append(f.webhooks, w)
+	return &w, nil
+}
+
+func (f *fakeWebhookRepo) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	for _, w := range f.webhooks {
+		if w.ID == id {
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeWebhookRepo) ListDeliveries(ctx context.Context, q DeliveryQuery) ([]model.WebhookDelivery, error) {
+	return []model.WebhookDelivery{}, nil
+}
+
+func (f *fakeWebhookRepo) RecordAttempt(ctx context.Context, id int64, attempt model.WebhookAttempt, status model.DeliveryStatus, next *time.Time) error {
+	f.status, f.next = status, next
+	return nil
+}
+
+func TestWebhookService_CreateWebhook(t *testing.T) {
+	tests := []struct {
+		name string
+		url string
+		events []string
+		wantEvents []string
+		wantErr bool
+	}{
+		{name: "all events by default", url: "https://partner.example/hook", wantEvents: []string{"created", "updated", "deleted"}},
+		{name: "events in canonical order", url: "http://localhost:9000", events: []string{"deleted", "created", "deleted"}, wantEvents: []string{"created", "deleted"}},
+		{name: "unknown event", url: "https://partner.example/hook", events: []string{"renamed"}, wantErr: true},
+		{name: "relative URL", url: "/hook", wantErr: true},
+		{name: "unsupported scheme", url: "ftp://partner.example/hook", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := &fakeWebhookRepo{}
+			svc := NewWebhookService(repo)
+			w, err := svc.CreateWebhook(context.Background(), tt.url, tt.events)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidWebhook) || len(repo.webhooks) != 0 {
+					t.Fatalf("expected ErrInvalidWebhook and nothing stored, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(w.Events, tt.wantEvents) {
+				t.Errorf("expected events %v, got %v", tt.wantEvents, w.Events)
+			}
+			if w.ID == "" || w.URL != tt.url || !strings.HasPrefix(w.Secret, "whsec_") || len(w.Secret) != len("whsec_")+64 {
+				t.Errorf("unexpected webhook %+v", w)
+			}
+		})
+	}
+}
+
+func TestWebhookService_RecordAttempt(t *testing.T) {
+	retryAt := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name string
+		attempt model.WebhookAttempt
+		retryAt *time.Time
+		wantStatus model.DeliveryStatus
+		wantNext bool
+	}{
+		{name: "success", attempt: model.WebhookAttempt{Attempt: 1}, retryAt: &retryAt, wantStatus: model.DeliveryDelivered},
+		{name: "retried", attempt: model.WebhookAttempt{StatusCode: 500, Error: model.AttemptHTTPStatus}, retryAt: &retryAt, wantStatus: model.DeliveryPending, wantNext: true},
+		{name: "dead-lettered", attempt: model.WebhookAttempt{StatusCode: 500, Error: model.AttemptHTTPStatus}, wantStatus: model.DeliveryDead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := &fakeWebhookRepo{}
+			svc := NewWebhookService(repo)
+			if err := svc.RecordAttempt(context.Background(), 1, tt.attempt, tt.retryAt); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if repo.status != tt.wantStatus || (repo.next != nil) != tt.wantNext {
+				t.Errorf("expected status %s with next attempt %v, got %s with %v", tt.wantStatus, tt.wantNext, repo.status, repo.next)
+			}
+		})
+	}
+}
+
+func TestWebhookService_ListDeliveries(t *testing.T) {
+	svc := NewWebhookService(&fakeWebhookRepo{webhooks: []model.Webhook{{ID: "hook"}}})
+
+	if _, err := svc.ListDeliveries(context.Background(), "missing", "", 0, 10); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("expected ErrWebhookNotFound, got %v", err)
+	}
+	if d, err := svc.ListDeliveries(context.Background(), "hook", "", 0, 10); err != nil || d == nil {
+		t.Errorf("expected an empty page, got %v, %v", d, err)
+	}
+}
@@ -0,0 +1,43 @@
+// Package testdb opens the databases of tests that run against SQLite.
+package testdb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/v-kuu/mini-marketplace/internal/config"
+	"github.com/v-kuu/mini-marketplace/internal/repository/sqlite"
+)
+
+// DB is a migrated database in the temporary directory of a test.
+type DB struct {
+	*sqlite.DB
+	// Config is the default configuration, with DB_DSN set to the
+	// database.
+	Config *config.Config
+	Products *sqlite.ProductRepository
+}
+
+// Open opens and migrates a fresh database, which is closed when the test
+// ends.
+func Open(t testing.TB) *DB {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.DB_DSN = "file:" + filepath.Join(t.TempDir(), "products.db")
+
+	db, err := sqlite.OpenDB(cfg.DB_DSN, cfg)
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	t.Cleanup(func () {
+		if err := db.Close(); err != nil {
+			t.Errorf("Failed to close db: %v", err)
+		}
+	})
+	if err := sqlite.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Failed to migrate db: %v", err)
+	}
+	return &DB{DB: db, Config: cfg, Products: sqlite.NewProductRepository(db, cfg)}
+}
@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"event_id":1,"event":"created"}`)
+	header := Sign("whsec_test", now, body)
+
+	tests := []struct {
+		name string
+		secret string
+		header string
+		body []byte
+		now time.Time
+		wantErr bool
+	}{
+		{name: "valid", secret: "whsec_test", header: header, body: body, now: now},
+		{name: "within tolerance", secret: "whsec_test", header: header, body: body, now: now.Add(4 * time.Minute)},
+		{name: "wrong secret", secret: "whsec_other", header: header, body: body, now: now, wantErr: true},
+		{name: "tampered body", secret: "whsec_test", header: header, body: []byte(`{"event_id":2}`), now: now, wantErr: true},
+		{name: "too old", secret: "whsec_test", header: header, body: body, now: now.Add(6 * time.Minute), wantErr: true},
+		{name: "replayed with new timestamp", secret: "whsec_test", header: "t=1700000060," + header[len("t=1700000000,"):], body: body, now: now, wantErr: true},
+		{name: "malformed", secret: "whsec_test", header: "v1=zz", body: body, now: now, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now)
+			if tt.wantErr && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Expected ErrInvalidSignature, got %v", err)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("Expected a valid signature, got %v", err)
+			}
+		})
+	}
+}
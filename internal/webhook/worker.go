@@ -0,0 +1,230 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/metrics"
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+// errStatus is returned for a response with a status other than 2xx.
+var errStatus = errors.New("receiver did not accept the delivery")
+
+// maxResponseBody is how much of a receiver's response is read, so the
+// connection can be reused. The body itself is ignored.
+const maxResponseBody = 64 << 10
+
+// Service is the part of the webhook service the worker runs on.
+type Service interface {
+	EnqueueDeliveries(ctx context.Context) (int, error)
+	DueDeliveries(ctx context.Context, limit int) ([]service.DeliveryJob, error)
+	RecordAttempt(ctx context.Context, id int64, attempt model.WebhookAttempt, retryAt *time.Time) error
+}
+
+type Options struct {
+	// MaxAttempts is how often a delivery is tried before it is
+	// dead-lettered.
+	MaxAttempts int
+	// BackoffBase is the delay after the first failed attempt. It doubles
+	// with every further attempt, up to BackoffMax.
+	BackoffBase time.Duration
+	BackoffMax time.Duration
+	// Timeout bounds a single attempt, including reading the response.
+	Timeout time.Duration
+	// Concurrency is how many deliveries are sent at once.
+	Concurrency int
+	// PollInterval is how often due retries are looked for.
+	PollInterval time.Duration
+	// AllowedNetworks are internal networks receivers may be in. Loopback,
+	// private, link-local and other special-purpose addresses are refused
+	// unless they are in one of them.
+	AllowedNetworks []netip.Prefix
+}
+
+// Worker sends webhook deliveries. Deliveries are at least once: a worker
+// stopped during an attempt sends the delivery again after a restart.
+type Worker struct {
+	svc Service
+	client *http.Client
+	opts Options
+}
+
+func NewWorker(svc Service, opts Options) *Worker {
+	return &Worker{
+		svc: svc,
+		client: &http.Client{
+			Transport: newTransport(opts.Timeout, opts.AllowedNetworks),
+			Timeout: opts.Timeout,
+			// A redirect fails the attempt. Following it would send the
+			// payload somewhere the partner did not register.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		opts: opts,
+	}
+}
+
+// Run delivers webhooks until ctx is done. It picks up new changes when
+// changes is signalled and at every poll interval, which also catches
+// retries coming due and changes made by other server instances.
+func (w *Worker) Run(ctx context.Context, changes <-chan struct{}) {
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.work(ctx)
+		select {
+			case <-ctx.Done():
+				return
+			case <-changes:
+			case <-ticker.C:
+		}
+	}
+}
+
+// work enqueues new changes and sends every delivery that is due.
+func (w *Worker) work(ctx context.Context) {
+	if _, err := w.svc.EnqueueDeliveries(ctx); err != nil && ctx.Err() == nil {
+		slog.Error("Failed to enqueue webhook deliveries", "err", err)
+	}
+
+	for ctx.Err() == nil {
+		jobs, err := w.svc.DueDeliveries(ctx, w.opts.Concurrency)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Failed to read due webhook deliveries", "err", err)
+			}
+			return
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		failed := false
+		for _, job := range jobs {
+			wg.Go(func() {
+				if err := w.deliver(ctx, job); err != nil {
+					if ctx.Err() == nil {
+						slog.Error("Failed to record webhook delivery", "delivery_id", job.ID, "err", err)
+					}
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+			})
+		}
+		wg.Wait()
+
+		// Unrecorded attempts leave their deliveries due; they are sent
+		// again on the next poll rather than in a tight loop.
+		if failed || len(jobs) < w.opts.Concurrency {
+			return
+		}
+	}
+}
+
+// deliver makes one attempt of job and records its outcome.
+func (w *Worker) deliver(ctx context.Context, job service.DeliveryJob) error {
+	start := time.Now()
+	attempt := model.WebhookAttempt{Attempt: job.Attempts + 1, At: start.UTC()}
+	status, err := w.post(ctx, job, start)
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	attempt.StatusCode = status
+	if ctx.Err() != nil {
+		// Shutting down; the delivery stays due and is sent again.
+		return ctx.Err()
+	}
+	if err != nil {
+		slog.Warn("Webhook delivery attempt failed", "delivery_id", job.ID, "attempt", attempt.Attempt, "err", err)
+		attempt.Error = attemptError(err)
+	}
+
+	result := "delivered"
+	var retryAt *time.Time
+	if !attempt.Succeeded() {
+		result = "dead"
+		if attempt.Attempt < w.opts.MaxAttempts {
+			t := time.Now().Add(w.backoff(attempt.Attempt))
+			retryAt, result = &t, "failed"
+		}
+	}
+	metrics.WebhookAttempts.WithLabelValues(result).Inc()
+	metrics.WebhookAttemptDuration.Observe(time.Since(start).Seconds())
+
+	return w.svc.RecordAttempt(ctx, job.ID, attempt, retryAt)
+}
+
+// post sends the payload of job and returns the response status. It fails
+// unless the receiver answers with a 2xx status.
+func (w *Worker) post(ctx context.Context, job service.DeliveryJob, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mini-marketplace-webhooks/1.0")
+	req.Header.Set("X-Webhook-ID", job.WebhookID)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(job.ID, 10))
+	req.Header.Set("X-Webhook-Event", job.Event)
+	req.Header.Set(SignatureHeader, Sign(job.Secret, now, job.Payload))
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func () {
+		if err := res.Body.Close(); err != nil {
+			slog.Warn("Failed to close webhook response body", "err", err)
+		}
+	}()
+	if _, err := io.Copy(io.Discard, io.LimitReader(res.Body, maxResponseBody)); err != nil {
+		return res.StatusCode, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("%w: %s", errStatus, res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// attemptError returns the attempt error logged for err. It only tells the
+// kind of failure apart: the log is readable through the API, and the
+// network errors themselves would tell its readers more about whatever the
+// URL points at.
+func attemptError(err error) string {
+	var netErr net.Error
+	switch {
+		case errors.Is(err, ErrBlockedAddress):
+			return model.AttemptBlockedAddress
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return model.AttemptTimeout
+		case errors.Is(err, errStatus):
+			return model.AttemptHTTPStatus
+	}
+	return model.AttemptConnectionFailed
+}
+
+// backoff returns the delay after the given failed attempt. The delay
+// doubles with every attempt up to BackoffMax, and half of it is random so
+// that deliveries which failed together do not all retry at once.
+func (w *Worker) backoff(attempt int) time.Duration {
+	d := w.opts.BackoffMax
+	if attempt <= 32 {
+		if exp := w.opts.BackoffBase << (attempt - 1); exp > 0 && exp < d {
+			d = exp
+		}
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,285 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/model"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+)
+
+type recordedAttempt struct {
+	id int64
+	attempt model.WebhookAttempt
+	retryAt *time.Time
+}
+
+type fakeService struct {
+	mu sync.Mutex
+	due []service.DeliveryJob
+	enqueued int
+	attempts []recordedAttempt
+}
+
+func (f *fakeService) EnqueueDeliveries(ctx context.Context) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enqueued++
+	return 0, nil
+}
+
+func (f *fakeService) DueDeliveries(ctx context.Context, limit int) ([]service.DeliveryJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := min(limit, len(f.due))
+	jobs := f.due[:n]
+	f.due = f.due[n:]
+	return jobs, nil
+}
+
+func (f *fakeService) RecordAttempt(ctx context.Context, id int64, attempt model.WebhookAttempt, retryAt *time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts = append(f.attempts, recordedAttempt{id: id, attempt: attempt, retryAt: retryAt})
+	return nil
+}
+
+func testOptions() Options {
+	return Options{
+		MaxAttempts: 3,
+		BackoffBase: time.Second,
+		BackoffMax: time.Minute,
+		Timeout: time.Second,
+		Concurrency: 2,
+		PollInterval: time.Hour,
+		// The receivers of the tests listen on the loopback interface.
+		AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+	}
+}
+
+func testJob(id int64, url string, attempts int) service.DeliveryJob {
+	return service.DeliveryJob{
+		WebhookDelivery: model.WebhookDelivery{
+			ID: id,
+			WebhookID: "hook",
+			EventID: 7,
+			Event: "created",
+			Payload: json.RawMessage(`{"event_id":7,"event":"created","product":{"id":"1","name":"Coffee","price":499}}`),
+			Status: model.DeliveryPending,
+			Attempts: attempts,
+		},
+		URL: url,
+		Secret: "whsec_test",
+	}
+}
+
+func TestWorker_Deliver(t *testing.T) {
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	svc := &fakeService{due: []service.DeliveryJob{testJob(1, receiver.URL, 0), testJob(2, receiver.URL, 0), testJob(3, receiver.URL, 0)}}
+	NewWorker(svc, testOptions()).work(context.Background())
+
+	if len(received) != 3 || len(svc.attempts) != 3 {
+		t.Fatalf("Expected 3 deliveries and 3 recorded attempts, got %d and %d", len(received), len(svc.attempts))
+	}
+	for i, r := range received {
+		if err := Verify("whsec_test", r.Header.Get(SignatureHeader), bodies[i], time.Minute, time.Now()); err != nil {
+			t.Errorf("Expected a valid signature, got %v", err)
+		}
+		if r.Header.Get("X-Webhook-ID") != "hook" || r.Header.Get("X-Webhook-Event") != "created" || r.Header.Get("X-Webhook-Delivery") == "" {
+			t.Errorf("Expected webhook headers, got %v", r.Header)
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected application/json, got %q", r.Header.Get("Content-Type"))
+		}
+	}
+	for _, a := range svc.attempts {
+		if !a.attempt.Succeeded() || a.attempt.Attempt != 1 || a.retryAt != nil {
+			t.Errorf("Expected a successful first attempt, got %+v", a)
+		}
+	}
+}
+
+func TestWorker_DeliverFailure(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+			case "/redirect":
+				http.Redirect(w, r, "/elsewhere", http.StatusFound)
+			case "/slow":
+				time.Sleep(200 * time.Millisecond)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	tests := []struct {
+		name string
+		job service.DeliveryJob
+		wantError string
+		wantStatus int
+		wantRetry bool
+	}{
+		{name: "server error is retried", job: testJob(1, receiver.URL, 0), wantError: model.AttemptHTTPStatus, wantStatus: http.StatusInternalServerError, wantRetry: true},
+		{name: "redirect is not followed", job: testJob(1, receiver.URL+"/redirect", 1), wantError: model.AttemptHTTPStatus, wantStatus: http.StatusFound, wantRetry: true},
+		{name: "unreachable receiver", job: testJob(1, "http://127.0.0.1:1", 0), wantError: model.AttemptConnectionFailed, wantRetry: true},
+		{name: "slow receiver", job: testJob(1, receiver.URL+"/slow", 0), wantError: model.AttemptTimeout, wantRetry: true},
+		{name: "last attempt is dead-lettered", job: testJob(1, receiver.URL, 2), wantError: model.AttemptHTTPStatus, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeService{due: []service.DeliveryJob{tt.job}}
+			opts := testOptions()
+			opts.Timeout = 100 * time.Millisecond
+			before := time.Now()
+			NewWorker(svc, opts).work(context.Background())
+
+			if len(svc.attempts) != 1 {
+				t.Fatalf("Expected 1 recorded attempt, got %d", len(svc.attempts))
+			}
+			a := svc.attempts[0]
+			if a.attempt.Error != tt.wantError || a.attempt.StatusCode != tt.wantStatus || a.attempt.Attempt != tt.job.Attempts+1 {
+				t.Errorf("Expected failed attempt %d with error %s and status %d, got %+v", tt.job.Attempts+1, tt.wantError, tt.wantStatus, a.attempt)
+			}
+			if !tt.wantRetry {
+				if a.retryAt != nil {
+					t.Errorf("Expected no retry, got %v", a.retryAt)
+				}
+				return
+			}
+			if a.retryAt == nil {
+				t.Fatal("Expected a retry")
+			}
+			if delay := a.retryAt.Sub(before); delay < 0 || delay > testOptions().BackoffMax+time.Second {
+				t.Errorf("Expected a retry within the backoff, got %v", delay)
+			}
+		})
+	}
+}
+
+func TestWorker_BlockedAddress(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer receiver.Close()
+
+	opts := testOptions()
+	opts.AllowedNetworks = nil
+	svc := &fakeService{due: []service.DeliveryJob{testJob(1, receiver.URL, 0)}}
+	NewWorker(svc, opts).work(context.Background())
+
+	if calls.Load() != 0 {
+		t.Fatalf("Expected no request to a loopback receiver, got %d", calls.Load())
+	}
+	if len(svc.attempts) != 1 || svc.attempts[0].attempt.Error != model.AttemptBlockedAddress {
+		t.Fatalf("Expected a blocked address, got %+v", svc.attempts)
+	}
+}
+
+func TestBlocked(t *testing.T) {
+	allowed, err := ParseNetworks(" 10.1.0.0/16, fd00::/8")
+	if err != nil {
+		t.Fatalf("ParseNetworks failed: %v", err)
+	}
+	tests := map[string]bool{
+		"127.0.0.1": true,
+		"::1": true,
+		"::ffff:127.0.0.1": true,
+		"10.0.0.1": true,
+		"10.1.2.3": false,
+		"172.16.0.1": true,
+		"192.168.1.1": true,
+		"169.254.169.254": true,
+		"fe80::1": true,
+		"fd00::1": false,
+		"0.0.0.0": true,
+		"100.64.0.1": true,
+		"224.0.0.1": true,
+		"93.184.216.34": false,
+		"2606:2800:220:1::1": false,
+	}
+	for addr, want := range tests {
+		if got := blocked(netip.MustParseAddr(addr), allowed); got != want {
+			t.Errorf("blocked(%s) = %v, want %v", addr, got, want)
+		}
+	}
+	if _, err := ParseNetworks("10.0.0.0"); err == nil {
+		t.Error("Expected an address without prefix length to be rejected")
+	}
+}
+
+func TestWorker_Backoff(t *testing.T) {
+	w := NewWorker(&fakeService{}, testOptions())
+
+	tests := []struct {
+		attempt int
+		base time.Duration
+	}{
+		{attempt: 1, base: time.Second},
+		{attempt: 2, base: 2 * time.Second},
+		{attempt: 4, base: 8 * time.Second},
+		{attempt: 7, base: time.Minute},
+		{attempt: 100, base: time.Minute},
+	}
+
+	for _, tt := range tests {
+		for range 100 {
+			if d := w.backoff(tt.attempt); d < tt.base/2 || d > tt.base {
+				t.Fatalf("Expected the delay after attempt %d within [%v, %v], got %v", tt.attempt, tt.base/2, tt.base, d)
+			}
+		}
+	}
+}
+
+func TestWorker_Run(t *testing.T) {
+	delivered := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	svc := &fakeService{}
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		NewWorker(svc, testOptions()).Run(ctx, changes)
+		close(done)
+	}()
+
+	// A change signal makes the worker look for deliveries without
+	// waiting for the poll interval.
+	svc.mu.Lock()
+	svc.due = append(svc.due, testJob(1, receiver.URL, 0))
+	svc.mu.Unlock()
+	changes <- struct{}{}
+
+	select {
+		case <-delivered:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected a delivery after a change")
+	}
+	cancel()
+	<-done
+}
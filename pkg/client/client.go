@@ -0,0 +1,203 @@
+// Package client is a typed Go client for the marketplace product API. It
+// covers the product routes described in docs/swagger.yaml: CRUD, partial
+// updates, batches, imports, exports and the change feed. Every method takes
+// a context, and requests the server did not process because it was busy
+// are retried with backoff.
+//
+//	c, err := client.New("http://localhost:8080", client.Options{})
+//	p, err := c.CreateProduct(ctx, "Coffee", 499)
+//	if errors.Is(err, client.ErrInvalidProduct) { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 4
+	defaultBackoffBase = 100 * time.Millisecond
+	defaultBackoffMax = 5 * time.Second
+
+	// maxErrorBody bounds how much of an error response is read.
+	maxErrorBody = 64 << 10
+)
+
+type Options struct {
+	// HTTPClient sends the requests. http.DefaultClient is used if nil.
+	HTTPClient *http.Client
+	// MaxAttempts is how often a request is sent before its error is
+	// returned. 1 disables retries; 0 means 4.
+	MaxAttempts int
+	// BackoffBase is the delay before the first retry, 100ms if zero. It
+	// doubles with every further retry, up to BackoffMax, 5s if zero. A
+	// Retry-After header from the server takes precedence.
+	BackoffBase time.Duration
+	BackoffMax time.Duration
+	// UserAgent, if set, is sent with every request.
+	UserAgent string
+}
+
+// Client calls the product API of one server. It is safe for concurrent
+// use.
+type Client struct {
+	base *url.URL
+	http *http.Client
+	opts Options
+}
+
+// New returns a client for the server at baseURL, such as
+// http://localhost:8080.
+func New(baseURL string, opts Options) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", baseURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.BackoffBase <= 0 {
+		opts.BackoffBase = defaultBackoffBase
+	}
+	if opts.BackoffMax <= 0 {
+		opts.BackoffMax = defaultBackoffMax
+	}
+	c := &Client{base: base, http: opts.HTTPClient, opts: opts}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	return c, nil
+}
+
+// request is one API call. The body is kept in memory so the call can be
+// sent again.
+type request struct {
+	method string
+	// path is escaped, see productPath.
+	path string
+	query url.Values
+	header http.Header
+	contentType string
+	body []byte
+}
+
+// retryable reports whether the server did not handle a request and asks
+// for it to be sent again later: it timed out, was rate limited or shed
+// load.
+func retryable(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// do sends req, retrying as configured, and returns the response of the
+// first attempt that is not retried. Responses with an error status are
+// returned as *Error. The caller closes the body of a successful response.
+func (c *Client) do(ctx context.Context, req request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := c.send(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode < 400 {
+			return res, nil
+		}
+
+		apiErr := readError(res)
+		if !retryable(res.StatusCode) || attempt >= c.opts.MaxAttempts {
+			return nil, apiErr
+		}
+
+		timer := time.NewTimer(c.backoff(attempt, res.Header.Get("Retry-After")))
+		select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, fmt.Errorf("%w (last attempt: %w)", context.Cause(ctx), apiErr)
+			case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	u, err := url.Parse(c.base.String() + req.path)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = req.query.Encode()
+
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range req.header {
+		httpReq.Header[key] = values
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if c.opts.UserAgent != "" {
+		httpReq.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+	return c.http.Do(httpReq)
+}
+
+// backoff returns the delay before the retry after the given attempt. The
+// exponential delay is jittered so that clients shed together do not come
+// back together.
+func (c *Client) backoff(attempt int, retryAfter string) time.Duration {
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds) * time.Second, c.opts.BackoffMax)
+	}
+	d := c.opts.BackoffBase << (attempt - 1)
+	if d <= 0 || d > c.opts.BackoffMax {
+		d = c.opts.BackoffMax
+	}
+	return d/2 + rand.N(d/2 + 1)
+}
+
+// doJSON sends in as the JSON body of a request, if not nil, and decodes the
+// response into out, if not nil.
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out any) error {
+	req := request{method: method, path: path}
+	if in != nil {
+		body, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		req.body, req.contentType = body, "application/json"
+	}
+	return c.decode(ctx, req, out)
+}
+
+func (c *Client) decode(ctx context.Context, req request, out any) error {
+	res, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close() //nolint:all
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, res.Body)
+		return err
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", req.method, req.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/v-kuu/mini-marketplace/internal/http/api"
+	"github.com/v-kuu/mini-marketplace/internal/service"
+	"github.com/v-kuu/mini-marketplace/internal/testdb"
+)
+
+// newTestAPI returns the real API handler on a fresh database.
+func newTestAPI(t *testing.T) http.Handler {
+	t.Helper()
+
+	db := testdb.Open(t)
+	svc := service.NewProductService(db.Products)
+	return api.AddRoutes(db.Config, api.Dependencies{Products: svc})
+}
+
+func newTestClient(t *testing.T, h http.Handler, opts Options) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	c, err := New(server.URL, opts)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return c
+}
+
+func TestClient_Products(t *testing.T) {
+	c := newTestClient(t, newTestAPI(t), Options{})
+	ctx := context.Background()
+
+	created, err := c.CreateProduct(ctx, "Coffee", 499)
+	if err != nil {
+		t.Fatalf("CreateProduct failed: %v", err)
+	}
+	if created.ID == "" || created.Name != "Coffee" || created.Price != 499 {
+		t.Fatalf("Unexpected product %+v", created)
+	}
+
+	got, err := c.GetProduct(ctx, created.ID)
+	if err != nil || *got != *created {
+		t.Fatalf("Expected %+v, got %+v (%v)", created, got, err)
+	}
+
+	updated, err := c.UpdateProduct(ctx, created.ID, "Espresso", 299)
+	if err != nil || updated.Name != "Espresso" || updated.Price != 299 {
+		t.Fatalf("Expected the updated product, got %+v (%v)", updated, err)
+	}
+
+	price := int64(349)
+	patched, err := c.PatchProduct(ctx, created.ID, ProductPatch{Price: &price})
+	if err != nil || patched.Name != "Espresso" || patched.Price != 349 {
+		t.Fatalf("Expected only the price patched, got %+v (%v)", patched, err)
+	}
+
+	merged, err := c.MergePatchProduct(ctx, created.ID, map[string]any{"name": "Ristretto"})
+	if err != nil || merged.Name != "Ristretto" || merged.Price != 349 {
+		t.Fatalf("Expected only the name merged, got %+v (%v)", merged, err)
+	}
+
+	_, err = c.JSONPatchProduct(ctx, created.ID, []PatchOperation{
+		{Op: "test", Path: "/price", Value: 1},
+		{Op: "replace", Path: "/price", Value: 2},
+	})
+	if !errors.Is(err, ErrPatchTestFailed) {
+		t.Fatalf("Expected ErrPatchTestFailed, got %v", err)
+	}
+
+	products, err := c.ListProducts(ctx)
+	if err != nil || len(products) != 1 || products[0] != *merged {
+		t.Fatalf("Expected [%+v], got %+v (%v)", merged, products, err)
+	}
+
+	if err := c.DeleteProduct(ctx, created.ID); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+	if _, err := c.GetProduct(ctx, created.ID); !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("Expected ErrProductNotFound, got %v", err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	c := newTestClient(t, newTestAPI(t), Options{})
+	ctx := context.Background()
+
+	_, err := c.CreateProduct(ctx, "", 0)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrValidation) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	if apiErr.Status != http.StatusBadRequest || len(apiErr.Violations) != 2 || apiErr.Violations[0].Pointer != "/name" {
+		t.Fatalf("Expected violations for name and price, got %+v", apiErr)
+	}
+
+	if _, err := c.CreateProduct(ctx, "Coffee", 499); err != nil {
+		t.Fatalf("CreateProduct failed: %v", err)
+	}
+	if _, err := c.CreateProduct(ctx, "Coffee", 499); !errors.Is(err, ErrProductAlreadyExists) {
+		t.Fatalf("Expected ErrProductAlreadyExists, got %v", err)
+	}
+	if err := c.DeleteProduct(ctx, "a/b"); !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("Expected an escaped ID to be not found, got %v", err)
+	}
+	if errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Expected %v not to match ErrOverloaded", err)
+	}
+}
+
+func TestClient_BatchImportExport(t *testing.T) {
+	c := newTestClient(t, newTestAPI(t), Options{})
+	ctx := context.Background()
+
+	batch, err := c.Batch(ctx, BatchAtomic, []BatchOperation{
+		{Op: "create", Name: "Coffee", Price: 499},
+		{Op: "create", Name: "Coffee", Price: 299},
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	if batch.Committed || len(batch.Results) != 2 || !errors.Is(batch.Results[0].Error, ErrBatchAborted) || !errors.Is(batch.Results[1].Error, ErrProductAlreadyExists) {
+		t.Fatalf("Expected the batch aborted by the duplicate, got %+v", batch)
+	}
+
+	report, err := c.ImportProducts(ctx, strings.NewReader("name,price\nCoffee,499\nTea,0\n"), ImportOptions{Format: FormatCSV})
+	if err != nil {
+		t.Fatalf("ImportProducts failed: %v", err)
+	}
+	if report.Created != 1 || report.Failed != 1 || report.Errors[0].Line != 3 {
+		t.Fatalf("Expected one created and one failed row, got %+v", report)
+	}
+
+	export, err := c.ExportProducts(ctx, FormatNDJSON)
+	if err != nil {
+		t.Fatalf("ExportProducts failed: %v", err)
+	}
+	defer export.Close() //nolint:all
+	data, err := io.ReadAll(export)
+	if err != nil || !strings.Contains(string(data), `"name":"Coffee"`) {
+		t.Fatalf("Expected the imported product, got %q (%v)", data, err)
+	}
+
+	if _, err := c.ExportProducts(ctx, "xml"); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("Expected ErrInvalidRequest, got %v", err)
+	}
+}
+
+func TestClient_Events(t *testing.T) {
+	c := newTestClient(t, newTestAPI(t), Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+
+	stream, err := c.ProductEvents(ctx)
+	if err != nil {
+		t.Fatalf("ProductEvents failed: %v", err)
+	}
+	defer stream.Close() //nolint:all
+
+	created, err := c.CreateProduct(ctx, "Coffee", 499)
+	if err != nil {
+		t.Fatalf("CreateProduct failed: %v", err)
+	}
+	if err := c.DeleteProduct(ctx, created.ID); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+
+	first, err := stream.Next()
+	if err != nil || first.Type != EventCreated || first.Product == nil || *first.Product != *created {
+		t.Fatalf("Expected the created event, got %+v (%v)", first, err)
+	}
+	if stream.LastEventID() != first.ID {
+		t.Fatalf("Expected last event ID %d, got %d", first.ID, stream.LastEventID())
+	}
+
+	resumed, err := c.ResumeProductEvents(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("ResumeProductEvents failed: %v", err)
+	}
+	defer resumed.Close() //nolint:all
+	next, err := resumed.Next()
+	if err != nil || next.Type != EventDeleted || next.ID <= first.ID {
+		t.Fatalf("Expected the deleted event after resuming, got %+v (%v)", next, err)
+	}
+}
+
+// flaky answers the first failures requests with a problem of the given
+// status and code and passes the rest to next.
+func flaky(next http.Handler, status int, code string, failures int64, calls *atomic.Int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, `{"status":`+strconv.Itoa(status)+`,"code":"`+code+`"}`)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// roundTripFunc is an http.RoundTripper, for checking that requests go
+// through the configured client.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestClient_Retries(t *testing.T) {
+	tests := []struct {
+		name string
+		status int
+		code string
+		failures int64
+		wantCalls int64
+		wantStatus int
+	}{
+		{"overloaded then served", http.StatusServiceUnavailable, "overloaded", 2, 3, 0},
+		{"timeout then served", http.StatusRequestTimeout, "timeout", 1, 2, 0},
+		{"rate limited throughout", http.StatusTooManyRequests, "rate_limited", 10, 3, http.StatusTooManyRequests},
+		{"not retried", http.StatusInternalServerError, "internal_error", 1, 1, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls, sent atomic.Int64
+			transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				sent.Add(1)
+				return http.DefaultTransport.RoundTrip(r)
+			})
+			c := newTestClient(t, flaky(newTestAPI(t), tt.status, tt.code, tt.failures, &calls), Options{
+				HTTPClient: &http.Client{Transport: transport},
+				MaxAttempts: 3,
+				BackoffBase: time.Millisecond,
+			})
+
+			_, err := c.CreateProduct(context.Background(), "Coffee", 499)
+			var apiErr *Error
+			if tt.wantStatus == 0 && err != nil {
+				t.Fatalf("CreateProduct failed: %v", err)
+			} else if tt.wantStatus != 0 && (!errors.As(err, &apiErr) || apiErr.Status != tt.wantStatus || apiErr.Code != tt.code) {
+				t.Fatalf("Expected a %d %s error, got %v", tt.wantStatus, tt.code, err)
+			}
+			if calls.Load() != tt.wantCalls || sent.Load() != tt.wantCalls {
+				t.Fatalf("Expected %d calls through the client, got %d of %d", tt.wantCalls, sent.Load(), calls.Load())
+			}
+		})
+	}
+}
+
+func TestClient_RetryCanceled(t *testing.T) {
+	var calls atomic.Int64
+	c := newTestClient(t, flaky(http.NotFoundHandler(), http.StatusServiceUnavailable, "overloaded", 10, &calls), Options{BackoffBase: time.Hour, BackoffMax: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+	_, err := c.GetProduct(ctx, "1")
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Expected the deadline and the last error, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("Expected 1 call before the deadline, got %d", calls.Load())
+	}
+}
+
+func TestClient_Backoff(t *testing.T) {
+	c, err := New("http://localhost", Options{BackoffBase: 100 * time.Millisecond, BackoffMax: time.Second})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		if d := c.backoff(attempt, ""); d < want/2 || d > want {
+			t.Errorf("Attempt %d: expected a delay between %v and %v, got %v", attempt, want/2, want, d)
+		}
+	}
+	if d := c.backoff(1, "0"); d != 0 {
+		t.Errorf("Expected Retry-After 0 to retry at once, got %v", d)
+	}
+	if d := c.backoff(1, "120"); d != time.Second {
+		t.Errorf("Expected Retry-After to be capped at BackoffMax, got %v", d)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, u := range []string{"", "localhost:8080", "ftp://example.com", "http://"} {
+		if _, err := New(u, Options{}); err == nil {
+			t.Errorf("Expected New(%q) to fail", u)
+		}
+	}
+	if _, err := New("https://example.com/api/", Options{}); err != nil {
+		t.Errorf("New failed: %v", err)
+	}
+}
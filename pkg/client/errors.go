@@ -0,0 +1,112 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// The errors an *Error matches with errors.Is, by its problem code. They
+// mirror the errors of the server's product service.
+var (
+	ErrInvalidProduct = errors.New("invalid product")
+	ErrProductNotFound = errors.New("product not found")
+	ErrProductAlreadyExists = errors.New("product already exists")
+	ErrOverloaded = errors.New("service overloaded")
+	ErrBatchAborted = errors.New("batch aborted")
+	// ErrValidation is returned for request bodies with invalid fields;
+	// Error.Violations lists them.
+	ErrValidation = errors.New("validation failed")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrPatchTestFailed = errors.New("patch test failed")
+	ErrRateLimited = errors.New("rate limited")
+	ErrTimeout = errors.New("request timeout")
+)
+
+// errorCodes maps problem codes to the errors above.
+var errorCodes = map[string]error{
+	"invalid_product": ErrInvalidProduct,
+	"product_not_found": ErrProductNotFound,
+	"product_already_exists": ErrProductAlreadyExists,
+	"overloaded": ErrOverloaded,
+	"too_many_connections": ErrOverloaded,
+	"batch_aborted": ErrBatchAborted,
+	"validation_failed": ErrValidation,
+	"invalid_name": ErrValidation,
+	"invalid_price": ErrValidation,
+	"empty_patch": ErrValidation,
+	"invalid_json": ErrInvalidRequest,
+	"invalid_csv": ErrInvalidRequest,
+	"invalid_parameter": ErrInvalidRequest,
+	"invalid_patch": ErrInvalidRequest,
+	"body_too_large": ErrInvalidRequest,
+	"unsupported_media_type": ErrInvalidRequest,
+	"patch_test_failed": ErrPatchTestFailed,
+	"rate_limited": ErrRateLimited,
+	"timeout": ErrTimeout,
+}
+
+// Error is a problem details response of the API. Clients should branch on
+// Code or on the errors it matches; Title and Detail are meant for humans.
+type Error struct {
+	Type string `json:"type"`
+	Title string `json:"title"`
+	Status int `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code string `json:"code"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation describes one invalid field. Pointer is a JSON pointer into the
+// request body and Rule the name of the failed check.
+type Violation struct {
+	Pointer string `json:"pointer"`
+	Rule string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, msg)
+}
+
+// Is matches the error of e's code.
+func (e *Error) Is(target error) bool {
+	return target != nil && errorCodes[e.Code] == target
+}
+
+// readError turns an error response into an *Error. Responses that are not
+// problem details, such as from a proxy, get a code from their status.
+func readError(res *http.Response) *Error {
+	defer res.Body.Close() //nolint:all
+
+	data, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	var e Error
+	if json.Unmarshal(data, &e) != nil || e.Code == "" {
+		e = Error{Title: http.StatusText(res.StatusCode), Code: statusCode(res.StatusCode)}
+	}
+	e.Status = res.StatusCode
+	return &e
+}
+
+func statusCode(status int) string {
+	switch status {
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return "timeout"
+		case http.StatusTooManyRequests:
+			return "rate_limited"
+		case http.StatusServiceUnavailable:
+			return "overloaded"
+		case http.StatusNotFound:
+			return "not_found"
+		default:
+			return "http_" + strconv.Itoa(status)
+	}
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type EventType string
+
+const (
+	EventCreated EventType = "created"
+	EventUpdated EventType = "updated"
+	EventDeleted EventType = "deleted"
+	// EventReset means that events the stream should have delivered were
+	// pruned. The client has to reload every product; the stream goes on
+	// from the latest change.
+	EventReset EventType = "reset"
+)
+
+// Event is a change of a product. A deleted event carries the product as it
+// was last stored; a reset event carries none.
+type Event struct {
+	ID int64
+	Type EventType
+	Product *Product
+}
+
+// EventStream reads the product change feed. It is not safe for concurrent
+// use.
+type EventStream struct {
+	body io.ReadCloser
+	r *bufio.Reader
+	last int64
+}
+
+// ProductEvents follows the changes made from now on. Streams are
+// long-lived, so the HTTP client should not have a Timeout; cancel ctx or
+// call Close to end the stream.
+func (c *Client) ProductEvents(ctx context.Context) (*EventStream, error) {
+	return c.openEvents(ctx, nil)
+}
+
+// ResumeProductEvents follows the changes after the event with ID after,
+// such as the LastEventID of a stream that broke off.
+func (c *Client) ResumeProductEvents(ctx context.Context, after int64) (*EventStream, error) {
+	return c.openEvents(ctx, http.Header{"Last-Event-ID": {strconv.FormatInt(after, 10)}})
+}
+
+func (c *Client) openEvents(ctx context.Context, header http.Header) (*EventStream, error) {
+	res, err := c.do(ctx, request{method: http.MethodGet, path: "/products/events", header: header})
+	if err != nil {
+		return nil, err
+	}
+	if mediaType, _, _ := strings.Cut(res.Header.Get("Content-Type"), ";"); mediaType != "text/event-stream" {
+		res.Body.Close() //nolint:all
+		return nil, fmt.Errorf("unexpected event stream content type %q", mediaType)
+	}
+	return &EventStream{body: res.Body, r: bufio.NewReader(res.Body)}, nil
+}
+
+// Next blocks until the next event arrives. It returns io.EOF when the
+// server ends the stream, for example on shutdown.
+func (s *EventStream) Next() (Event, error) {
+	var e Event
+	var data strings.Builder
+	hasID := false
+	for {
+		line, err := s.r.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return Event{}, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			// A blank line ends an event. Blocks without an event type,
+			// such as the retry hint, carry nothing to dispatch.
+			if e.Type == "" {
+				e, hasID = Event{}, false
+				data.Reset()
+				continue
+			}
+			if hasID {
+				s.last = e.ID
+			}
+			if e.Type != EventReset {
+				var p Product
+				if err := json.Unmarshal([]byte(data.String()), &p); err != nil {
+					return Event{}, fmt.Errorf("decoding event %d: %w", e.ID, err)
+				}
+				e.Product = &p
+			}
+			return e, nil
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+			case "":
+				// A comment, such as a heartbeat.
+			case "id":
+				if e.ID, err = strconv.ParseInt(value, 10, 64); err != nil {
+					return Event{}, fmt.Errorf("invalid event id %q", value)
+				}
+				hasID = true
+			case "event":
+				e.Type = EventType(value)
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+		}
+	}
+}
+
+// LastEventID returns the ID of the last event read, to resume from with
+// ResumeProductEvents. It is 0 before the first event.
+func (s *EventStream) LastEventID() int64 {
+	return s.last
+}
+
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType = "application/json-patch+json"
+)
+
+// Product is a product as stored by the server. Prices are in cents.
+type Product struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Price int64 `json:"price"`
+}
+
+// ProductPatch changes the fields that are set and keeps the others.
+type ProductPatch struct {
+	Name *string `json:"name,omitempty"`
+	Price *int64 `json:"price,omitempty"`
+}
+
+// PatchOperation is one operation of an RFC 6902 JSON patch, such as
+// {Op: "test", Path: "/price", Value: 499}.
+type PatchOperation struct {
+	Op string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from,omitempty"`
+	Value any `json:"value,omitempty"`
+}
+
+type BatchMode string
+
+const (
+	// BatchAtomic commits every operation or none.
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort keeps the operations that succeed.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+// BatchOperation creates, updates or deletes one product. Creates take a
+// name and price, updates an id, name and price, and deletes an id.
+type BatchOperation struct {
+	Op string `json:"op"`
+	ID string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Price int64 `json:"price,omitempty"`
+}
+
+// BatchResult is the outcome of one operation of a batch, with the status
+// it would have had as a single request.
+type BatchResult struct {
+	Status int `json:"status"`
+	Product *Product `json:"product,omitempty"`
+	// Error is set if the operation failed. In an atomic batch that failed,
+	// the operations that did not fail themselves match ErrBatchAborted.
+	Error *Error `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode BatchMode `json:"mode"`
+	// Committed is set if at least one operation was kept.
+	Committed bool `json:"committed"`
+	Results []BatchResult `json:"results"`
+}
+
+// FileFormat is the format of product imports and exports.
+type FileFormat string
+
+const (
+	FormatNDJSON FileFormat = "ndjson"
+	FormatCSV FileFormat = "csv"
+)
+
+type ImportOptions struct {
+	// Format is the format of the data, NDJSON if empty.
+	Format FileFormat
+	// DryRun validates and reports without writing anything.
+	DryRun bool
+	// Upsert updates products that already exist instead of failing their
+	// rows.
+	Upsert bool
+}
+
+// ImportReport is the outcome of an import. Rows counts the records read;
+// each of them was created, updated or failed.
+type ImportReport struct {
+	DryRun bool `json:"dry_run"`
+	Rows int `json:"rows"`
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Failed int `json:"failed"`
+	Errors []ImportError `json:"errors"`
+	// ErrorsTruncated is set when more rows failed than are listed.
+	ErrorsTruncated bool `json:"errors_truncated,omitempty"`
+}
+
+// ImportError explains why one row of an import failed. Code is the problem
+// code the row would have caused as a single request.
+type ImportError struct {
+	Line int `json:"line"`
+	Code string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// productInput is the body of creates and full updates.
+type productInput struct {
+	Name string `json:"name"`
+	Price int64 `json:"price"`
+}
+
+func productPath(id string) string {
+	return "/products/" + url.PathEscape(id)
+}
+
+// ListProducts returns every product.
+func (c *Client) ListProducts(ctx context.Context) ([]Product, error) {
+	var products []Product
+	if err := c.doJSON(ctx, http.MethodGet, "/products", nil, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
+	var p Product
+	if err := c.doJSON(ctx, http.MethodGet, productPath(id), nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (c *Client) CreateProduct(ctx context.Context, name string, price int64) (*Product, error) {
+	var p Product
+	if err := c.doJSON(ctx, http.MethodPost, "/products", productInput{name, price}, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpdateProduct replaces the name and price of a product.
+func (c *Client) UpdateProduct(ctx context.Context, id, name string, price int64) (*Product, error) {
+	var p Product
+	if err := c.doJSON(ctx, http.MethodPut, productPath(id), productInput{name, price}, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PatchProduct changes the fields set in patch.
+func (c *Client) PatchProduct(ctx context.Context, id string, patch ProductPatch) (*Product, error) {
+	var p Product
+	if err := c.doJSON(ctx, http.MethodPatch, productPath(id), patch, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// MergePatchProduct applies an RFC 7396 merge patch, which is marshalled to
+// JSON, to a product.
+func (c *Client) MergePatchProduct(ctx context.Context, id string, patch any) (*Product, error) {
+	return c.applyPatch(ctx, id, mergePatchContentType, patch)
+}
+
+// JSONPatchProduct applies an RFC 6902 JSON patch to a product. A failed
+// test operation matches ErrPatchTestFailed and changes nothing.
+func (c *Client) JSONPatchProduct(ctx context.Context, id string, ops []PatchOperation) (*Product, error) {
+	return c.applyPatch(ctx, id, jsonPatchContentType, ops)
+}
+
+func (c *Client) applyPatch(ctx context.Context, id, contentType string, patch any) (*Product, error) {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	var p Product
+	req := request{method: http.MethodPatch, path: productPath(id), contentType: contentType, body: body}
+	if err := c.decode(ctx, req, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (c *Client) DeleteProduct(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, productPath(id), nil, nil)
+}
+
+// Batch runs up to the server's BATCH_MAX_SIZE operations in one
+// transaction. Operations that fail are reported in their result rather
+// than as the error.
+func (c *Client) Batch(ctx context.Context, mode BatchMode, ops []BatchOperation) (*BatchResponse, error) {
+	var res BatchResponse
+	in := struct {
+		Mode BatchMode `json:"mode,omitempty"`
+		Operations []BatchOperation `json:"operations"`
+	}{mode, ops}
+	if err := c.doJSON(ctx, http.MethodPost, "/products/batch", in, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ImportProducts imports products from CSV with an id, name and price
+// header row or from NDJSON with one product per line. The data is read
+// into memory first so the request can be retried. Rows that fail are
+// listed in the report rather than returned as the error.
+func (c *Client) ImportProducts(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := request{method: http.MethodPost, path: "/products:import", query: url.Values{}, body: body}
+	switch opts.Format {
+		case "", FormatNDJSON:
+			req.contentType = "application/x-ndjson"
+		case FormatCSV:
+			req.contentType = "text/csv"
+		default:
+			return nil, fmt.Errorf("unknown import format %q", opts.Format)
+	}
+	if opts.DryRun {
+		req.query.Set("dry_run", strconv.FormatBool(true))
+	}
+	if opts.Upsert {
+		req.query.Set("on_conflict", "upsert")
+	}
+
+	var report ImportReport
+	if err := c.decode(ctx, req, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ExportProducts streams every product in ID order in the given format,
+// NDJSON if empty. The caller must close the returned reader. An export that
+// fails midway ends with an unexpected EOF.
+func (c *Client) ExportProducts(ctx context.Context, format FileFormat) (io.ReadCloser, error) {
+	req := request{method: http.MethodGet, path: "/products:export"}
+	if format != "" {
+		req.query = url.Values{"format": {string(format)}}
+	}
+	res, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}